@@ -0,0 +1,161 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package addressaudit keeps a persistent log of the receive addresses shown to the user and
+// verified on a keystore.
+package addressaudit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+)
+
+// Action is what happened to an address. See the Action* constants.
+type Action string
+
+const (
+	// ActionDisplayed is an address shown to the user in the app.
+	ActionDisplayed Action = "displayed"
+	// ActionVerified is an address shown on the secure output of a keystore, i.e. on the device or
+	// on the mobile paired with it, so the user can compare it to the one shown in the app. See
+	// Entry.VerificationTypes.
+	ActionVerified Action = "verified"
+)
+
+// Entry is one record of the log.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	AccountCode string    `json:"accountCode"`
+	Address     string    `json:"address"`
+	Action      Action    `json:"action"`
+	// DeviceIDs are the identifiers of the keystores the address was verified on. Empty for
+	// ActionDisplayed.
+	DeviceIDs []string `json:"deviceIDs"`
+	// VerificationTypes are how the address was shown by each keystore in DeviceIDs, e.g. on the
+	// device or on the paired mobile app.
+	VerificationTypes []keystore.SecureOutputType `json:"verificationTypes"`
+}
+
+// Log is an append-only log of address audit entries, stored as one JSON object per line.
+type Log struct {
+	lock     locker.Locker
+	filename string
+}
+
+// NewLog creates a new Log, stored in the given location. The filename must be writable, but does
+// not have to exist.
+func NewLog(filename string) *Log {
+	return &Log{filename: filename}
+}
+
+// Record appends an entry to the log. If the time is not set, the current time is used.
+func (log *Log) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.DeviceIDs == nil {
+		entry.DeviceIDs = []string{}
+	}
+	if entry.VerificationTypes == nil {
+		entry.VerificationTypes = []keystore.SecureOutputType{}
+	}
+	if len(entry.VerificationTypes) != len(entry.DeviceIDs) {
+		return errp.New("a verification type is needed for each device")
+	}
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	defer log.lock.Lock()()
+	file, err := os.OpenFile(log.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	defer func() { _ = file.Close() }()
+	_, err = file.Write(append(jsonBytes, '\n'))
+	return errp.WithStack(err)
+}
+
+// Entries returns the entries of the given account, oldest first. If accountCode is empty, the
+// entries of all accounts are returned. Lines which can not be parsed, e.g. because the app stopped
+// while writing them, are skipped. Their line numbers, starting at 1, are returned as well, so that
+// they can be reported to the user.
+func (log *Log) Entries(accountCode string) ([]*Entry, []int, error) {
+	defer log.lock.RLock()()
+	result := []*Entry{}
+	corruptLines := []int{}
+	file, err := os.Open(log.filename)
+	if os.IsNotExist(err) {
+		return result, corruptLines, nil
+	}
+	if err != nil {
+		return nil, nil, errp.WithStack(err)
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			corruptLines = append(corruptLines, line)
+			continue
+		}
+		if accountCode == "" || entry.AccountCode == accountCode {
+			result = append(result, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errp.WithStack(err)
+	}
+	return result, corruptLines, nil
+}
+
+// ExportCSV returns the entries of the given account (all accounts if empty) as CSV, with a header
+// row. Multiple device identifiers and verification types are separated by spaces. The numbers of
+// the skipped lines are returned as well, see Entries().
+func (log *Log) ExportCSV(accountCode string) (string, []int, error) {
+	entries, corruptLines, err := log.Entries(accountCode)
+	if err != nil {
+		return "", nil, err
+	}
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	records := [][]string{{"time", "account", "address", "action", "devices", "verification"}}
+	for _, entry := range entries {
+		verificationTypes := make([]string, len(entry.VerificationTypes))
+		for index, verificationType := range entry.VerificationTypes {
+			verificationTypes[index] = string(verificationType)
+		}
+		records = append(records, []string{
+			entry.Time.Format(time.RFC3339),
+			entry.AccountCode,
+			entry.Address,
+			string(entry.Action),
+			strings.Join(entry.DeviceIDs, " "),
+			strings.Join(verificationTypes, " "),
+		})
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return "", nil, errp.WithStack(err)
+	}
+	return buffer.String(), corruptLines, nil
+}
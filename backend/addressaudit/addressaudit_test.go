@@ -0,0 +1,122 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package addressaudit_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressaudit"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	filename := test.TstTempFile("addressaudit-")
+	log := addressaudit.NewLog(filename)
+	entries, corruptLines, err := log.Entries("")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.Empty(t, corruptLines)
+
+	displayed := time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, log.Record(addressaudit.Entry{
+		Time:        displayed,
+		AccountCode: "tbtc-p2wpkh",
+		Address:     "tb1qaddress",
+		Action:      addressaudit.ActionDisplayed,
+	}))
+	require.NoError(t, log.Record(addressaudit.Entry{
+		AccountCode: "tbtc-p2wpkh",
+		Address:     "tb1qaddress",
+		Action:      addressaudit.ActionVerified,
+		DeviceIDs:   []string{"device1", "device2"},
+		VerificationTypes: []keystore.SecureOutputType{
+			keystore.SecureOutputTypeMobile, keystore.SecureOutputTypeDevice},
+	}))
+	// Each device needs a verification type.
+	require.Error(t, log.Record(addressaudit.Entry{
+		AccountCode: "tbtc-p2wpkh",
+		Address:     "tb1qaddress",
+		Action:      addressaudit.ActionVerified,
+		DeviceIDs:   []string{"device1"},
+	}))
+	require.NoError(t, log.Record(addressaudit.Entry{
+		AccountCode: "tltc-p2wpkh",
+		Address:     "tltc1qaddress",
+		Action:      addressaudit.ActionDisplayed,
+	}))
+
+	// Entries are persisted.
+	log = addressaudit.NewLog(filename)
+	entries, _, err = log.Entries("tbtc-p2wpkh")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, &addressaudit.Entry{
+		Time:              displayed,
+		AccountCode:       "tbtc-p2wpkh",
+		Address:           "tb1qaddress",
+		Action:            addressaudit.ActionDisplayed,
+		DeviceIDs:         []string{},
+		VerificationTypes: []keystore.SecureOutputType{},
+	}, entries[0])
+	require.Equal(t, addressaudit.ActionVerified, entries[1].Action)
+	require.False(t, entries[1].Time.IsZero())
+	entries, _, err = log.Entries("")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	csv, corruptLines, err := log.ExportCSV("tbtc-p2wpkh")
+	require.NoError(t, err)
+	require.Empty(t, corruptLines)
+	require.Equal(t,
+		"time,account,address,action,devices,verification\n"+
+			"2018-07-01T12:00:00Z,tbtc-p2wpkh,tb1qaddress,displayed,,\n"+
+			entries[1].Time.Format(time.RFC3339)+
+			",tbtc-p2wpkh,tb1qaddress,verified,device1 device2,mobile device\n",
+		csv)
+}
+
+func TestLogCorruptLines(t *testing.T) {
+	filename := test.TstTempFile("addressaudit-")
+	log := addressaudit.NewLog(filename)
+	require.NoError(t, log.Record(addressaudit.Entry{
+		AccountCode: "tbtc-p2wpkh",
+		Address:     "tb1qaddress",
+		Action:      addressaudit.ActionDisplayed,
+	}))
+	// The app stopped while writing an entry.
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString("{\"time\":\"2018-07-01T12:00:00Z\",\"accou\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.NoError(t, log.Record(addressaudit.Entry{
+		AccountCode: "tbtc-p2wpkh",
+		Address:     "tb1qaddress2",
+		Action:      addressaudit.ActionDisplayed,
+	}))
+
+	entries, corruptLines, err := log.Entries("")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "tb1qaddress2", entries[1].Address)
+	require.Equal(t, []int{2}, corruptLines)
+	_, corruptLines, err = log.ExportCSV("tbtc-p2wpkh")
+	require.NoError(t, err)
+	require.Equal(t, []int{2}, corruptLines)
+}
@@ -0,0 +1,247 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package addressbook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/random"
+	"github.com/sirupsen/logrus"
+)
+
+// ValidationError is returned when an entry can not be saved because of invalid input.
+type ValidationError string
+
+func (err ValidationError) Error() string {
+	return string(err)
+}
+
+// Entry is a saved recipient.
+type Entry struct {
+	// ID is assigned when the entry is added.
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	CoinCode string `json:"coinCode"`
+	Note     string `json:"note"`
+	// DefaultAmount is the amount, in the unit of the coin, proposed when sending to this
+	// recipient. Empty if there is none.
+	DefaultAmount string `json:"defaultAmount"`
+}
+
+// matches returns true if the query is contained in the name, address or note, ignoring case.
+func (entry *Entry) matches(query string) bool {
+	query = strings.ToLower(query)
+	for _, field := range []string{entry.Name, entry.Address, entry.Note} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressBook manages the saved recipients, persisted in a JSON file.
+type AddressBook struct {
+	lock     locker.Locker
+	filename string
+	entries  map[string]*Entry
+	// coin returns the coin with the given code, or an error if the coin code is unknown.
+	coin func(coinCode string) (coin.Coin, error)
+	// loadErr is the error the file could not be loaded with. If not nil, the file is not
+	// overwritten, so that the saved entries are not lost.
+	loadErr error
+	log     *logrus.Entry
+}
+
+// NewAddressBook creates a new AddressBook, stored in the given location. The filename must be
+// writable, but does not have to exist. If the file is corrupt, it is moved to filename.bak and
+// the address book starts empty.
+func NewAddressBook(
+	filename string, coin func(coinCode string) (coin.Coin, error), log *logrus.Entry,
+) *AddressBook {
+	addressBook := &AddressBook{
+		filename: filename,
+		entries:  map[string]*Entry{},
+		coin:     coin,
+		log:      log.WithField("group", "addressbook"),
+	}
+	addressBook.load()
+	return addressBook
+}
+
+func (addressBook *AddressBook) load() {
+	jsonBytes, err := ioutil.ReadFile(addressBook.filename)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		addressBook.log.WithError(err).Error("Could not read the address book")
+		addressBook.loadErr = errp.WithStack(err)
+		return
+	}
+	entries := []*Entry{}
+	if err := json.Unmarshal(jsonBytes, &entries); err != nil {
+		addressBook.log.WithError(err).Error("Could not parse the address book, moving it away")
+		if err := os.Rename(addressBook.filename, addressBook.filename+".bak"); err != nil {
+			addressBook.log.WithError(err).Error("Could not move the corrupt address book")
+			addressBook.loadErr = errp.WithStack(err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		addressBook.entries[entry.ID] = entry
+	}
+}
+
+func (addressBook *AddressBook) save() error {
+	if addressBook.loadErr != nil {
+		return errp.WithMessage(addressBook.loadErr, "the address book could not be loaded")
+	}
+	jsonBytes, err := json.Marshal(addressBook.sortedEntries(func(*Entry) bool { return true }))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(ioutil.WriteFile(addressBook.filename, jsonBytes, 0600))
+}
+
+// sortedEntries returns copies of the entries for which the filter returns true, sorted by name.
+func (addressBook *AddressBook) sortedEntries(filter func(*Entry) bool) []*Entry {
+	result := []*Entry{}
+	for _, entry := range addressBook.entries {
+		if filter(entry) {
+			entryCopy := *entry
+			result = append(result, &entryCopy)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name == result[j].Name {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// validate checks that the address is valid for the coin of the entry.
+func (addressBook *AddressBook) validate(entry *Entry) error {
+	if strings.TrimSpace(entry.Name) == "" {
+		return errp.WithStack(ValidationError("name missing"))
+	}
+	entryCoin, err := addressBook.coin(entry.CoinCode)
+	if err != nil {
+		return errp.WithStack(ValidationError("unknown coin"))
+	}
+	if err := entryCoin.ValidateAddress(entry.Address); err != nil {
+		return errp.WithStack(ValidationError("invalid address"))
+	}
+	if entry.DefaultAmount != "" {
+		amount, err := strconv.ParseFloat(entry.DefaultAmount, 64)
+		if err != nil || amount <= 0 {
+			return errp.WithStack(ValidationError("invalid amount"))
+		}
+		if _, err := btcutil.NewAmount(amount); err != nil {
+			return errp.WithStack(ValidationError("invalid amount"))
+		}
+	}
+	return nil
+}
+
+// Entries returns all entries, sorted by name.
+func (addressBook *AddressBook) Entries() []*Entry {
+	defer addressBook.lock.RLock()()
+	return addressBook.sortedEntries(func(*Entry) bool { return true })
+}
+
+// Search returns the entries matching the query in their name, address or note, sorted by name.
+// If coinCode is not empty, only entries of that coin are returned.
+func (addressBook *AddressBook) Search(query string, coinCode string) []*Entry {
+	defer addressBook.lock.RLock()()
+	return addressBook.sortedEntries(func(entry *Entry) bool {
+		return (coinCode == "" || entry.CoinCode == coinCode) && entry.matches(query)
+	})
+}
+
+// Entry returns the entry with the given ID.
+func (addressBook *AddressBook) Entry(id string) (*Entry, error) {
+	defer addressBook.lock.RLock()()
+	entry, ok := addressBook.entries[id]
+	if !ok {
+		return nil, errp.Newf("address book entry %s not found", id)
+	}
+	entryCopy := *entry
+	return &entryCopy, nil
+}
+
+// Add validates and stores a new entry. The ID of the given entry is ignored and the ID of the new
+// entry is returned.
+func (addressBook *AddressBook) Add(entry Entry) (string, error) {
+	if err := addressBook.validate(&entry); err != nil {
+		return "", err
+	}
+	id, err := random.HexString(16)
+	if err != nil {
+		return "", err
+	}
+	entry.ID = id
+	defer addressBook.lock.Lock()()
+	addressBook.entries[id] = &entry
+	if err := addressBook.save(); err != nil {
+		delete(addressBook.entries, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Update validates and replaces the entry with the same ID.
+func (addressBook *AddressBook) Update(entry Entry) error {
+	if err := addressBook.validate(&entry); err != nil {
+		return err
+	}
+	defer addressBook.lock.Lock()()
+	previous, ok := addressBook.entries[entry.ID]
+	if !ok {
+		return errp.Newf("address book entry %s not found", entry.ID)
+	}
+	addressBook.entries[entry.ID] = &entry
+	if err := addressBook.save(); err != nil {
+		addressBook.entries[entry.ID] = previous
+		return err
+	}
+	return nil
+}
+
+// Delete removes the entry with the given ID.
+func (addressBook *AddressBook) Delete(id string) error {
+	defer addressBook.lock.Lock()()
+	previous, ok := addressBook.entries[id]
+	if !ok {
+		return errp.Newf("address book entry %s not found", id)
+	}
+	delete(addressBook.entries, id)
+	if err := addressBook.save(); err != nil {
+		addressBook.entries[id] = previous
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package addressbook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressbook"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logging.Get().WithGroup("addressbook_test")
+
+func lookupCoin(coinCode string) (coin.Coin, error) {
+	switch coinCode {
+	case "btc":
+		return btc.NewCoin("btc", "Bitcoin", "BTC", &chaincfg.MainNetParams, "", nil, "", nil), nil
+	case "tbtc":
+		return btc.NewCoin(
+			"tbtc", "Bitcoin Testnet", "TBTC", &chaincfg.TestNet3Params, "", nil, "", nil), nil
+	case "eth":
+		return eth.NewCoin("eth", "Ethereum", "ETH", eth.ChainIDMainnet, nil, "", nil, nil), nil
+	default:
+		return nil, errp.Newf("unknown coin code %s", coinCode)
+	}
+}
+
+func address(t *testing.T, hash byte, net *chaincfg.Params) string {
+	pubKeyHash := make([]byte, 20)
+	pubKeyHash[0] = hash
+	address, err := btcutil.NewAddressPubKeyHash(pubKeyHash, net)
+	require.NoError(t, err)
+	return address.EncodeAddress()
+}
+
+func TestAddressBook(t *testing.T) {
+	filename := test.TstTempFile("addressbook-")
+	addressBook := addressbook.NewAddressBook(filename, lookupCoin, log)
+	require.Empty(t, addressBook.Entries())
+
+	vendor := addressbook.Entry{
+		Name:          "Vendor",
+		Address:       address(t, 1, &chaincfg.TestNet3Params),
+		CoinCode:      "tbtc",
+		Note:          "Monthly invoice",
+		DefaultAmount: "0.5",
+	}
+	vendorID, err := addressBook.Add(vendor)
+	require.NoError(t, err)
+	rent := addressbook.Entry{
+		Name:     "Landlord",
+		Address:  address(t, 2, &chaincfg.MainNetParams),
+		CoinCode: "btc",
+	}
+	rentID, err := addressBook.Add(rent)
+	require.NoError(t, err)
+	require.NotEqual(t, vendorID, rentID)
+
+	entries := addressBook.Entries()
+	require.Len(t, entries, 2)
+	require.Equal(t, "Landlord", entries[0].Name)
+	require.Equal(t, vendorID, entries[1].ID)
+
+	require.Len(t, addressBook.Search("invoice", ""), 1)
+	require.Len(t, addressBook.Search("LORD", "btc"), 1)
+	require.Empty(t, addressBook.Search("lord", "tbtc"))
+	require.Len(t, addressBook.Search("", ""), 2)
+
+	// Persisted.
+	addressBook = addressbook.NewAddressBook(filename, lookupCoin, log)
+	entry, err := addressBook.Entry(vendorID)
+	require.NoError(t, err)
+	vendor.ID = vendorID
+	require.Equal(t, &vendor, entry)
+
+	entry.Note = "Quarterly invoice"
+	require.NoError(t, addressBook.Update(*entry))
+	entry, err = addressBook.Entry(vendorID)
+	require.NoError(t, err)
+	require.Equal(t, "Quarterly invoice", entry.Note)
+
+	require.NoError(t, addressBook.Delete(rentID))
+	require.Error(t, addressBook.Delete(rentID))
+	_, err = addressBook.Entry(rentID)
+	require.Error(t, err)
+	require.Len(t, addressBook.Entries(), 1)
+}
+
+func TestAddressBookValidation(t *testing.T) {
+	addressBook := addressbook.NewAddressBook(test.TstTempFile("addressbook-"), lookupCoin, log)
+	valid := addressbook.Entry{
+		Name:     "Vendor",
+		Address:  address(t, 1, &chaincfg.TestNet3Params),
+		CoinCode: "tbtc",
+	}
+	for _, modify := range []func(entry *addressbook.Entry){
+		func(entry *addressbook.Entry) { entry.Name = " " },
+		func(entry *addressbook.Entry) { entry.CoinCode = "xyz" },
+		func(entry *addressbook.Entry) { entry.Address = "invalid" },
+		// Mainnet address for a testnet coin.
+		func(entry *addressbook.Entry) { entry.Address = address(t, 1, &chaincfg.MainNetParams) },
+		func(entry *addressbook.Entry) { entry.DefaultAmount = "-1" },
+		func(entry *addressbook.Entry) { entry.DefaultAmount = "abc" },
+	} {
+		entry := valid
+		modify(&entry)
+		_, err := addressBook.Add(entry)
+		_, ok := errp.Cause(err).(addressbook.ValidationError)
+		require.True(t, ok)
+	}
+	require.Empty(t, addressBook.Entries())
+
+	id, err := addressBook.Add(valid)
+	require.NoError(t, err)
+	invalid := valid
+	invalid.ID = id
+	invalid.Address = "invalid"
+	require.Error(t, addressBook.Update(invalid))
+	entry, err := addressBook.Entry(id)
+	require.NoError(t, err)
+	require.Equal(t, valid.Address, entry.Address)
+}
+
+func TestAddressBookEthereum(t *testing.T) {
+	addressBook := addressbook.NewAddressBook(test.TstTempFile("addressbook-"), lookupCoin, log)
+	entry := addressbook.Entry{
+		Name:          "Exchange",
+		Address:       "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		CoinCode:      "eth",
+		DefaultAmount: "1.5",
+	}
+	_, err := addressBook.Add(entry)
+	require.NoError(t, err)
+
+	// Wrong EIP-55 checksum.
+	entry.Address = "0x5aaeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	_, err = addressBook.Add(entry)
+	_, ok := errp.Cause(err).(addressbook.ValidationError)
+	require.True(t, ok)
+	// Bitcoin address for Ethereum.
+	entry.Address = address(t, 1, &chaincfg.MainNetParams)
+	_, err = addressBook.Add(entry)
+	_, ok = errp.Cause(err).(addressbook.ValidationError)
+	require.True(t, ok)
+	require.Len(t, addressBook.Search("", "eth"), 1)
+}
+
+func TestAddressBookCorrupt(t *testing.T) {
+	filename := test.TstTempFile("addressbook-")
+	corrupt := []byte(`[{"id": "1", "name": "Vendor"`)
+	require.NoError(t, ioutil.WriteFile(filename, corrupt, 0600))
+	addressBook := addressbook.NewAddressBook(filename, lookupCoin, log)
+	require.Empty(t, addressBook.Entries())
+
+	// The corrupt file is kept.
+	backup, err := ioutil.ReadFile(filename + ".bak")
+	require.NoError(t, err)
+	require.Equal(t, corrupt, backup)
+	_, err = os.Stat(filename)
+	require.True(t, os.IsNotExist(err))
+
+	_, err = addressBook.Add(addressbook.Entry{
+		Name:     "Landlord",
+		Address:  address(t, 2, &chaincfg.MainNetParams),
+		CoinCode: "btc",
+	})
+	require.NoError(t, err)
+	backup, err = ioutil.ReadFile(filename + ".bak")
+	require.NoError(t, err)
+	require.Equal(t, corrupt, backup)
+	require.Len(t, addressbook.NewAddressBook(filename, lookupCoin, log).Entries(), 1)
+}
@@ -19,23 +19,32 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"path"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"golang.org/x/text/language"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
 	"github.com/cloudfoundry-attic/jibber_jabber"
 	"github.com/sirupsen/logrus"
 
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressaudit"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressbook"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/arguments"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/device"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/usb"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/scheduler"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
@@ -75,38 +84,58 @@ type Backend struct {
 
 	devices        map[string]device.Interface
 	keystores      keystore.Keystores
-	onWalletInit   func(*btc.Account)
-	onWalletUninit func(*btc.Account)
+	onWalletInit   func(coin.Account)
+	onWalletUninit func(coin.Account)
 	onDeviceInit   func(device.Interface)
 	onDeviceUninit func(string)
 
-	coins     map[string]*btc.Coin
+	coins     map[string]coin.Coin
 	coinsLock locker.Locker
 
-	accounts     []*btc.Account
+	accounts     []coin.Account
 	accountsLock locker.Locker
 	// accountsSyncStart time.Time
 
 	// Stored and exposed temporarily through the backend.
 	ratesUpdater coin.RatesUpdater
 
+	addressBook  *addressbook.AddressBook
+	addressAudit *addressaudit.Log
+	scheduler    *scheduler.Scheduler
+
 	log *logrus.Entry
 }
 
 // NewBackend creates a new backend with the given arguments.
 func NewBackend(arguments *arguments.Arguments) *Backend {
 	log := logging.Get().WithGroup("backend")
-	return &Backend{
+	backend := &Backend{
 		arguments: arguments,
 		config:    config.NewConfig(arguments.ConfigFilename()),
 		events:    make(chan interface{}, 1000),
 
 		devices:      map[string]device.Interface{},
 		keystores:    keystore.NewKeystores(),
-		coins:        map[string]*btc.Coin{},
+		coins:        map[string]coin.Coin{},
 		ratesUpdater: btc.NewRatesUpdater(),
-		log:          log,
+		addressAudit: addressaudit.NewLog(
+			path.Join(arguments.MainDirectoryPath(), "addressaudit.log")),
+		log: log,
 	}
+	backend.addressBook = addressbook.NewAddressBook(
+		path.Join(arguments.MainDirectoryPath(), "addressbook.json"),
+		backend.addressBookCoin,
+		log,
+	)
+	backend.scheduler = scheduler.NewScheduler(
+		path.Join(arguments.MainDirectoryPath(), "scheduledpayments.json"),
+		backend.schedulerAccount,
+		func(event scheduler.Event) {
+			backend.events <- backendEvent{Type: "scheduler", Data: string(event)}
+		},
+		log,
+	)
+	return backend
 }
 
 func (backend *Backend) addAccount(
@@ -124,6 +153,10 @@ func (backend *Backend) addAccount(
 	onEvent := func(code string) func(btc.Event) {
 		return func(event btc.Event) {
 			backend.events <- WalletEvent{Type: "wallet", Code: code, Data: string(event)}
+			switch event {
+			case btc.EventStatusChanged, btc.EventSyncDone:
+				backend.notifyPortfolioChanged()
+			}
 		}
 	}
 	absoluteKeypath, err := signing.NewAbsoluteKeypath(keypath)
@@ -141,6 +174,40 @@ func (backend *Backend) addAccount(
 	backend.accounts = append(backend.accounts, account)
 }
 
+func (backend *Backend) addETHAccount(
+	coin *eth.Coin,
+	code string,
+	name string,
+	keypath string,
+) {
+	if !backend.config.Config().Backend.AccountActive(code) {
+		backend.log.WithField("code", code).WithField("name", name).Info("skipping inactive account")
+		return
+	}
+	if backend.arguments.Multisig() {
+		backend.log.WithField("code", code).Info("skipping Ethereum account in multisig mode")
+		return
+	}
+	backend.log.WithField("code", code).WithField("name", name).Info("init account")
+	onEvent := func(event eth.Event) {
+		backend.events <- WalletEvent{Type: "wallet", Code: code, Data: string(event)}
+		switch event {
+		case eth.EventStatusChanged, eth.EventSyncDone:
+			backend.notifyPortfolioChanged()
+		}
+	}
+	absoluteKeypath, err := signing.NewAbsoluteKeypath(keypath)
+	if err != nil {
+		panic(err)
+	}
+	getSigningConfiguration := func() (*signing.Configuration, error) {
+		return backend.keystores.Configuration(signing.ScriptTypeP2PKH, absoluteKeypath, 1)
+	}
+	account := eth.NewAccount(coin, backend.arguments.CacheDirectoryPath(), code, name,
+		getSigningConfiguration, backend.keystores, onEvent, backend.log)
+	backend.accounts = append(backend.accounts, account)
+}
+
 // Config returns the app config.
 func (backend *Backend) Config() *config.Config {
 	return backend.config
@@ -151,21 +218,33 @@ func (backend *Backend) DefaultConfig() config.AppConfig {
 	return config.NewDefaultConfig()
 }
 
-func (backend *Backend) defaultProdServers(code string) []*rpc.ServerInfo {
+func (backend *Backend) coinConfig(code string) config.CoinConfig {
 	switch code {
 	case "btc":
-		return backend.config.Config().Backend.BTC.ElectrumServers
+		return backend.config.Config().Backend.BTC
 	case "tbtc":
-		return backend.config.Config().Backend.TBTC.ElectrumServers
+		return backend.config.Config().Backend.TBTC
 	case "ltc":
-		return backend.config.Config().Backend.LTC.ElectrumServers
+		return backend.config.Config().Backend.LTC
 	case "tltc":
-		return backend.config.Config().Backend.TLTC.ElectrumServers
+		return backend.config.Config().Backend.TLTC
+	case "bch":
+		return backend.config.Config().Backend.BCH
+	case "tbch":
+		return backend.config.Config().Backend.TBCH
+	case "doge":
+		return backend.config.Config().Backend.DOGE
+	case "tdoge":
+		return backend.config.Config().Backend.TDOGE
 	default:
 		panic(errp.Newf("The given code %s is unknown.", code))
 	}
 }
 
+func (backend *Backend) defaultProdServers(code string) []*rpc.ServerInfo {
+	return backend.coinConfig(code).ElectrumServers
+}
+
 func defaultDevServers(code string) []*rpc.ServerInfo {
 	const devShiftCA = `-----BEGIN CERTIFICATE-----
 MIIGGjCCBAKgAwIBAgIJAO1AEqR+xvjRMA0GCSqGSIb3DQEBDQUAMIGZMQswCQYD
@@ -215,6 +294,9 @@ O3nOxjgSfRAfKWQ2Ny1APKcn6I83P5PFLhtO5I12
 		return []*rpc.ServerInfo{{Server: "dev.shiftcrypto.ch:50004", TLS: true, PEMCert: devShiftCA}}
 	case "tltc":
 		return []*rpc.ServerInfo{{Server: "dev.shiftcrypto.ch:51004", TLS: true, PEMCert: devShiftCA}}
+	case "bch", "tbch", "doge", "tdoge":
+		// There are no dev servers for these coins, the configured servers are used instead.
+		return nil
 	default:
 		panic(errp.Newf("The given code %s is unknown.", code))
 	}
@@ -222,68 +304,173 @@ O3nOxjgSfRAfKWQ2Ny1APKcn6I83P5PFLhtO5I12
 
 func (backend *Backend) defaultServers(code string) []*rpc.ServerInfo {
 	if backend.arguments.DevMode() {
-		return defaultDevServers(code)
+		if servers := defaultDevServers(code); servers != nil {
+			return servers
+		}
 	}
 
 	return backend.defaultProdServers(code)
 }
 
 // Coin returns a Coin instance for a coin type.
-func (backend *Backend) Coin(code string) *btc.Coin {
+func (backend *Backend) Coin(code string) coin.Coin {
 	defer backend.coinsLock.Lock()()
-	coin, ok := backend.coins[code]
-	if ok {
+	if coin, ok := backend.coins[code]; ok {
 		return coin
 	}
-	servers := backend.defaultServers(code)
+	coin, err := backend.newCoin(code)
+	if err != nil {
+		panic(err)
+	}
+	coin.Init()
+	coin.Observe(func(event observable.Event) { backend.events <- event })
+	backend.coins[code] = coin
+	return coin
+}
+
+// addressBookCoin returns the coin with the given code, to validate the addresses of the address
+// book. Coins without accounts are not initialized, so that no connection is made to their
+// blockchain backend.
+func (backend *Backend) addressBookCoin(code string) (coin.Coin, error) {
+	defer backend.coinsLock.RLock()()
+	if coin, ok := backend.coins[code]; ok {
+		return coin, nil
+	}
+	return backend.newCoin(code)
+}
+
+// newCoin creates the coin with the given code, without initializing it.
+func (backend *Backend) newCoin(code string) (coin.Coin, error) {
+	switch code {
+	case "reth", "teth", "eth":
+		return backend.newETHCoin(code)
+	default:
+		return backend.newBTCCoin(code)
+	}
+}
+
+// newETHCoin creates the Ethereum coin with the given code.
+func (backend *Backend) newETHCoin(code string) (*eth.Coin, error) {
+	switch code {
+	case "reth":
+		// A local development node, e.g. `geth --dev --http`.
+		return eth.NewCoin("reth", "Ethereum Dev", "RETH", eth.ChainIDDev,
+			rpcclient.NewRPCClient("http://127.0.0.1:8545"), "", nil, nil), nil
+	case "teth":
+		return eth.NewCoin("teth", "Ethereum Sepolia", "TETH", eth.ChainIDSepolia,
+			rpcclient.NewRPCClient(backend.config.Config().Backend.TETH.NodeURL),
+			"https://sepolia.etherscan.io/tx/", nil, backend.ratesUpdater), nil
+	case "eth":
+		return eth.NewCoin("eth", "Ethereum", "ETH", eth.ChainIDMainnet,
+			rpcclient.NewRPCClient(backend.config.Config().Backend.ETH.NodeURL),
+			"https://etherscan.io/tx/", eth.MainnetTokens, backend.ratesUpdater), nil
+	default:
+		return nil, errp.Newf("unknown coin code %s", code)
+	}
+}
+
+// newBTCCoin creates the Bitcoin-derived coin with the given code.
+func (backend *Backend) newBTCCoin(code string) (*btc.Coin, error) {
+	var coin *btc.Coin
+	servers := func() []*rpc.ServerInfo { return backend.defaultServers(code) }
 	dbFolder := backend.arguments.CacheDirectoryPath()
 	switch code {
 	case "rbtc":
-		servers = []*rpc.ServerInfo{{"127.0.0.1:52001", false, ""}}
-		coin = btc.NewCoin("rbtc", "RBTC", &chaincfg.RegressionNetParams, dbFolder, servers, "", nil)
+		coin = btc.NewCoin("rbtc", "Bitcoin Regtest", "RBTC", &chaincfg.RegressionNetParams, dbFolder,
+			[]*rpc.ServerInfo{{"127.0.0.1:52001", false, ""}}, "", nil)
 	case "tbtc":
-		coin = btc.NewCoin("tbtc", "TBTC", &chaincfg.TestNet3Params, dbFolder, servers, "https://testnet.blockchain.info/tx/", backend.ratesUpdater)
+		coin = btc.NewCoin("tbtc", "Bitcoin Testnet", "TBTC", &chaincfg.TestNet3Params, dbFolder, servers(), "https://testnet.blockchain.info/tx/", backend.ratesUpdater)
 	case "btc":
-		coin = btc.NewCoin("btc", "BTC", &chaincfg.MainNetParams, dbFolder, servers, "https://blockchain.info/tx/", backend.ratesUpdater)
+		coin = btc.NewCoin("btc", "Bitcoin", "BTC", &chaincfg.MainNetParams, dbFolder, servers(), "https://blockchain.info/tx/", backend.ratesUpdater)
 	case "tltc":
-		coin = btc.NewCoin("tltc", "TLTC", &ltc.TestNet4Params, dbFolder, servers, "http://explorer.litecointools.com/tx/", backend.ratesUpdater)
+		coin = btc.NewCoin("tltc", "Litecoin Testnet", "TLTC", &ltc.TestNet4Params, dbFolder, servers(), "http://explorer.litecointools.com/tx/", backend.ratesUpdater)
 	case "ltc":
-		coin = btc.NewCoin("ltc", "LTC", &ltc.MainNetParams, dbFolder, servers, "https://insight.litecore.io/tx/", backend.ratesUpdater)
+		coin = btc.NewCoin("ltc", "Litecoin", "LTC", &ltc.MainNetParams, dbFolder, servers(), "https://insight.litecore.io/tx/", backend.ratesUpdater)
+	case "tbch":
+		coin = btc.NewCoin("tbch", "Bitcoin Cash Testnet", "TBCH", &bch.TestNet3Params, dbFolder, servers(), "", backend.ratesUpdater)
+	case "bch":
+		coin = btc.NewCoin("bch", "Bitcoin Cash", "BCH", &bch.MainNetParams, dbFolder, servers(), "https://blockchair.com/bitcoin-cash/transaction/", backend.ratesUpdater)
+	case "tdoge":
+		coin = btc.NewCoin("tdoge", "Dogecoin Testnet", "TDOGE", &doge.TestNet3Params, dbFolder, servers(), "", backend.ratesUpdater)
+	case "doge":
+		coin = btc.NewCoin("doge", "Dogecoin", "DOGE", &doge.MainNetParams, dbFolder, servers(), "https://blockchair.com/dogecoin/transaction/", backend.ratesUpdater)
 	default:
-		panic(errp.Newf("unknown coin code %s", code))
+		return nil, errp.Newf("unknown coin code %s", code)
 	}
-	coin.Init()
-	coin.Observe(func(event observable.Event) { backend.events <- event })
-	backend.coins[code] = coin
-	return coin
+	if code != "rbtc" {
+		coinConfig := backend.coinConfig(code)
+		if coinConfig.ConsistencyCheck {
+			coin.EnableConsistencyCheck()
+		}
+		coin.SetDustThreshold(btcutil.Amount(coinConfig.DustThreshold))
+	}
+	coin.SetFiatRateTolerance(backend.config.Config().Backend.FiatRateTolerance)
+	if batching := backend.config.Config().Backend.RPCBatching; batching != nil {
+		if batchConfig := batching.BatchConfig(); batchConfig.Valid() {
+			coin.SetBatchConfig(batchConfig)
+		} else {
+			backend.log.WithField("rpc-batching", *batching).Error("Invalid RPC batching config, using the defaults")
+		}
+	}
+	return coin, nil
 }
 
 func (backend *Backend) initAccounts() {
-	backend.accounts = []*btc.Account{}
+	backend.accounts = []coin.Account{}
+	backendConfig := backend.config.Config().Backend
 	if backend.arguments.Testing() {
 		if backend.arguments.Regtest() {
-			RBTC := backend.Coin("rbtc")
+			RBTC := backend.Coin("rbtc").(*btc.Coin)
 			backend.addAccount(RBTC, "rbtc-p2pkh", "Bitcoin Regtest Legacy", "m/44'/1'/0'", signing.ScriptTypeP2PKH)
 			backend.addAccount(RBTC, "rbtc-p2wpkh-p2sh", "Bitcoin Regtest Segwit", "m/49'/1'/0'", signing.ScriptTypeP2WPKHP2SH)
+
+			RETH := backend.Coin("reth").(*eth.Coin)
+			backend.addETHAccount(RETH, "reth", "Ethereum Dev", "m/44'/1'/0'/0")
 		} else {
-			TBTC := backend.Coin("tbtc")
+			TBTC := backend.Coin("tbtc").(*btc.Coin)
 			backend.addAccount(TBTC, "tbtc-p2wpkh-p2sh", "Bitcoin Testnet", "m/49'/1'/0'", signing.ScriptTypeP2WPKHP2SH)
 			backend.addAccount(TBTC, "tbtc-p2wpkh", "Bitcoin Testnet: bech32", "m/84'/1'/0'", signing.ScriptTypeP2WPKH)
 			backend.addAccount(TBTC, "tbtc-p2pkh", "Bitcoin Testnet Legacy", "m/44'/1'/0'", signing.ScriptTypeP2PKH)
 
-			TLTC := backend.Coin("tltc")
+			TLTC := backend.Coin("tltc").(*btc.Coin)
 			backend.addAccount(TLTC, "tltc-p2wpkh-p2sh", "Litecoin Testnet", "m/49'/1'/0'", signing.ScriptTypeP2WPKHP2SH)
 			backend.addAccount(TLTC, "tltc-p2wpkh", "Litecoin Testnet: bech32", "m/84'/1'/0'", signing.ScriptTypeP2WPKH)
+
+			TETH := backend.Coin("teth").(*eth.Coin)
+			backend.addETHAccount(TETH, "teth", "Ethereum Sepolia", "m/44'/1'/0'/0")
+
+			// The coins are only created when active, as they have no default servers.
+			if backendConfig.BitcoinCashActive {
+				TBCH := backend.Coin("tbch").(*btc.Coin)
+				backend.addAccount(TBCH, "tbch-p2pkh", "Bitcoin Cash Testnet", "m/44'/1'/0'", signing.ScriptTypeP2PKH)
+			}
+			if backendConfig.DogecoinActive {
+				TDOGE := backend.Coin("tdoge").(*btc.Coin)
+				backend.addAccount(TDOGE, "tdoge-p2pkh", "Dogecoin Testnet", "m/44'/1'/0'", signing.ScriptTypeP2PKH)
+			}
 		}
 	} else {
-		BTC := backend.Coin("btc")
+		BTC := backend.Coin("btc").(*btc.Coin)
 		backend.addAccount(BTC, "btc-p2wpkh-p2sh", "Bitcoin", "m/49'/0'/0'", signing.ScriptTypeP2WPKHP2SH)
 		backend.addAccount(BTC, "btc-p2wpkh", "Bitcoin: bech32", "m/84'/0'/0'", signing.ScriptTypeP2WPKH)
 		backend.addAccount(BTC, "btc-p2pkh", "Bitcoin Legacy", "m/44'/0'/0'", signing.ScriptTypeP2PKH)
 
-		LTC := backend.Coin("ltc")
+		LTC := backend.Coin("ltc").(*btc.Coin)
 		backend.addAccount(LTC, "ltc-p2wpkh-p2sh", "Litecoin", "m/49'/2'/0'", signing.ScriptTypeP2WPKHP2SH)
 		backend.addAccount(LTC, "ltc-p2wpkh", "Litecoin: bech32", "m/84'/2'/0'", signing.ScriptTypeP2WPKH)
+
+		ETH := backend.Coin("eth").(*eth.Coin)
+		backend.addETHAccount(ETH, "eth", "Ethereum", "m/44'/60'/0'/0")
+
+		// The coins are only created when active, as they have no default servers.
+		if backendConfig.BitcoinCashActive {
+			BCH := backend.Coin("bch").(*btc.Coin)
+			backend.addAccount(BCH, "bch-p2pkh", "Bitcoin Cash", "m/44'/145'/0'", signing.ScriptTypeP2PKH)
+		}
+		if backendConfig.DogecoinActive {
+			DOGE := backend.Coin("doge").(*btc.Coin)
+			backend.addAccount(DOGE, "doge-p2pkh", "Dogecoin", "m/44'/3'/0'", signing.ScriptTypeP2PKH)
+		}
 	}
 	for _, account := range backend.accounts {
 		backend.onWalletInit(account)
@@ -304,7 +491,7 @@ func (backend *Backend) Testing() bool {
 }
 
 // Accounts returns the supported accounts.
-func (backend *Backend) Accounts() []*btc.Account {
+func (backend *Backend) Accounts() []coin.Account {
 	return backend.accounts
 }
 
@@ -324,12 +511,12 @@ func (backend *Backend) UserLanguage() language.Tag {
 }
 
 // OnWalletInit installs a callback to be called when a wallet is initialized.
-func (backend *Backend) OnWalletInit(f func(*btc.Account)) {
+func (backend *Backend) OnWalletInit(f func(coin.Account)) {
 	backend.onWalletInit = f
 }
 
 // OnWalletUninit installs a callback to be called when a wallet is stopped.
-func (backend *Backend) OnWalletUninit(f func(*btc.Account)) {
+func (backend *Backend) OnWalletUninit(f func(coin.Account)) {
 	backend.onWalletUninit = f
 }
 
@@ -347,6 +534,8 @@ func (backend *Backend) OnDeviceUninit(f func(string)) {
 // client.
 func (backend *Backend) Start() <-chan interface{} {
 	go backend.listenHID()
+	backend.ratesUpdater.Observe(func(observable.Event) { backend.notifyPortfolioChanged() })
+	backend.scheduler.Start()
 	go func() {
 		err := backend.checkForUpdate()
 		if err != nil {
@@ -356,6 +545,12 @@ func (backend *Backend) Start() <-chan interface{} {
 	return backend.events
 }
 
+// Close stops the background services and closes the accounts.
+func (backend *Backend) Close() {
+	backend.scheduler.Close()
+	backend.uninitWallets()
+}
+
 // Events returns the push notifications channel.
 func (backend *Backend) Events() <-chan interface{} {
 	return backend.events
@@ -474,6 +669,40 @@ func (backend *Backend) listenHID() {
 	usb.NewManager(backend.Register, backend.Deregister).ListenHID()
 }
 
+// account returns the loaded account with the given code, or nil if there is none.
+func (backend *Backend) account(code string) coin.Account {
+	defer backend.accountsLock.RLock()()
+	for _, account := range backend.accounts {
+		if account.Code() == code {
+			return account
+		}
+	}
+	return nil
+}
+
+func (backend *Backend) schedulerAccount(code string) scheduler.Account {
+	// Only Bitcoin-derived accounts support scheduled payments.
+	if account, ok := backend.account(code).(scheduler.Account); ok {
+		return account
+	}
+	return nil
+}
+
+// Scheduler returns the scheduled payments.
+func (backend *Backend) Scheduler() *scheduler.Scheduler {
+	return backend.scheduler
+}
+
+// AddressAudit returns the log of displayed and verified receive addresses.
+func (backend *Backend) AddressAudit() *addressaudit.Log {
+	return backend.addressAudit
+}
+
+// AddressBook returns the saved recipients.
+func (backend *Backend) AddressBook() *addressbook.AddressBook {
+	return backend.addressBook
+}
+
 // Rates return the latest rates.
 func (backend *Backend) Rates() map[string]map[string]float64 {
 	return backend.ratesUpdater.Last()
@@ -518,7 +747,7 @@ func (backend *Backend) CheckElectrumServer(server string, pemCert string) error
 	_ = conn.Close()
 	// Simple check if the server is an electrum server.
 	jsonrpcClient := jsonrpc.NewRPCClient(backends, backend.log)
-	electrumClient := client.NewElectrumClient(jsonrpcClient, backend.log)
+	electrumClient := client.NewElectrumClient(jsonrpcClient, nil, backend.log)
 	defer electrumClient.Close()
 	_, err = electrumClient.ServerVersion()
 	return err
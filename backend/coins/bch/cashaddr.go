@@ -0,0 +1,188 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bch
+
+import (
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// cashAddrCharset maps 5 bit values to the characters of a CashAddr address.
+const cashAddrCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	// cashAddrTypeP2PKH and cashAddrTypeP2SH are the version bytes of the address types, for a
+	// hash size of 160 bits.
+	cashAddrTypeP2PKH byte = 0 << 3
+	cashAddrTypeP2SH  byte = 1 << 3
+
+	cashAddrChecksumLength = 8
+)
+
+// CashAddrPrefix returns the prefix of CashAddr addresses of the given network.
+func CashAddrPrefix(net *chaincfg.Params) (string, error) {
+	switch net.Net {
+	case MainNet:
+		return "bitcoincash", nil
+	case TestNet3:
+		return "bchtest", nil
+	default:
+		return "", errp.Newf("no CashAddr prefix for network %s", net.Name)
+	}
+}
+
+// cashAddrPolymod computes the BCH checksum of the 5 bit values.
+func cashAddrPolymod(values []byte) uint64 {
+	generators := []uint64{
+		0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470,
+	}
+	checksum := uint64(1)
+	for _, value := range values {
+		top := checksum >> 35
+		checksum = ((checksum & 0x07ffffffff) << 5) ^ uint64(value)
+		for i, generator := range generators {
+			if (top>>uint(i))&1 == 1 {
+				checksum ^= generator
+			}
+		}
+	}
+	return checksum ^ 1
+}
+
+// cashAddrPrefixValues returns the lower 5 bits of each prefix character followed by the
+// separator, which are committed to by the checksum.
+func cashAddrPrefixValues(prefix string) []byte {
+	values := make([]byte, 0, len(prefix)+1)
+	for _, char := range []byte(prefix) {
+		values = append(values, char&0x1f)
+	}
+	return append(values, 0)
+}
+
+// convertBits regroups the bits of the values from `fromBits` to `toBits` bits per value.
+func convertBits(values []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	result := []byte{}
+	accumulator := uint(0)
+	bits := uint(0)
+	maxValue := uint(1)<<toBits - 1
+	for _, value := range values {
+		if uint(value)>>fromBits != 0 {
+			return nil, errp.New("invalid value")
+		}
+		accumulator = accumulator<<fromBits | uint(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(accumulator>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(accumulator<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || accumulator<<(toBits-bits)&maxValue != 0 {
+		return nil, errp.New("invalid padding")
+	}
+	return result, nil
+}
+
+// EncodeAddress encodes a P2PKH or P2SH address in the CashAddr format, including the prefix of
+// the network.
+func EncodeAddress(address btcutil.Address, net *chaincfg.Params) (string, error) {
+	prefix, err := CashAddrPrefix(net)
+	if err != nil {
+		return "", err
+	}
+	var version byte
+	switch address.(type) {
+	case *btcutil.AddressPubKeyHash:
+		version = cashAddrTypeP2PKH
+	case *btcutil.AddressScriptHash:
+		version = cashAddrTypeP2SH
+	default:
+		return "", errp.Newf("address type %T is not supported by CashAddr", address)
+	}
+	payload, err := convertBits(append([]byte{version}, address.ScriptAddress()...), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	values := append(cashAddrPrefixValues(prefix), payload...)
+	checksum := cashAddrPolymod(append(values, make([]byte, cashAddrChecksumLength)...))
+	for i := 0; i < cashAddrChecksumLength; i++ {
+		payload = append(payload, byte(checksum>>uint(5*(cashAddrChecksumLength-1-i))&0x1f))
+	}
+	encoded := make([]byte, len(payload))
+	for i, value := range payload {
+		encoded[i] = cashAddrCharset[value]
+	}
+	return prefix + ":" + string(encoded), nil
+}
+
+// DecodeAddress decodes a CashAddr address of the given network. The prefix can be omitted.
+// Legacy base58 addresses are accepted as well.
+func DecodeAddress(address string, net *chaincfg.Params) (btcutil.Address, error) {
+	if !strings.Contains(address, ":") {
+		if legacyAddress, err := btcutil.DecodeAddress(address, net); err == nil {
+			if !legacyAddress.IsForNet(net) {
+				return nil, errp.New("address is for another network")
+			}
+			return legacyAddress, nil
+		}
+	}
+	prefix, err := CashAddrPrefix(net)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return nil, errp.New("mixed case address")
+	}
+	address = strings.ToLower(address)
+	if separator := strings.LastIndexByte(address, ':'); separator != -1 {
+		if address[:separator] != prefix {
+			return nil, errp.Newf("wrong prefix, expected %s", prefix)
+		}
+		address = address[separator+1:]
+	}
+	values := make([]byte, len(address))
+	for i, char := range []byte(address) {
+		value := strings.IndexByte(cashAddrCharset, char)
+		if value == -1 {
+			return nil, errp.Newf("invalid character %q", char)
+		}
+		values[i] = byte(value)
+	}
+	if len(values) <= cashAddrChecksumLength ||
+		cashAddrPolymod(append(cashAddrPrefixValues(prefix), values...)) != 0 {
+		return nil, errp.New("invalid checksum")
+	}
+	payload, err := convertBits(values[:len(values)-cashAddrChecksumLength], 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 21 {
+		return nil, errp.New("unsupported hash size")
+	}
+	switch payload[0] {
+	case cashAddrTypeP2PKH:
+		return btcutil.NewAddressPubKeyHash(payload[1:], net)
+	case cashAddrTypeP2SH:
+		return btcutil.NewAddressScriptHashFromHash(payload[1:], net)
+	default:
+		return nil, errp.Newf("unsupported address version %d", payload[0])
+	}
+}
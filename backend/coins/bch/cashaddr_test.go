@@ -0,0 +1,90 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bch_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from the CashAddr specification.
+var cashAddrVectors = []struct {
+	legacy   string
+	cashAddr string
+}{
+	{"1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"},
+	{"1KXrWXciRDZUpQwQmuM1DbwsKDLYAYsVLR", "bitcoincash:qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy"},
+	{"16w1D5WRVKJuZUsSRzdLp9w3YGcgoxDXb", "bitcoincash:qqq3728yw0y47sqn6l2na30mcw6zm78dzqre909m2r"},
+	{"3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC", "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq"},
+	{"3LDsS579y7sruadqu11beEJoTjdFiFCdX4", "bitcoincash:pr95sy3j9xwd2ap32xkykttr4cvcu7as4yc93ky28e"},
+	{"31nwvkZwyPdgzjBJZXfDmSWsC4ZLKpYyUw", "bitcoincash:pqq3728yw0y47sqn6l2na30mcw6zm78dzq5ucqzc37"},
+}
+
+func TestEncodeAddress(t *testing.T) {
+	for _, vector := range cashAddrVectors {
+		address, err := btcutil.DecodeAddress(vector.legacy, &bch.MainNetParams)
+		require.NoError(t, err)
+		encoded, err := bch.EncodeAddress(address, &bch.MainNetParams)
+		require.NoError(t, err)
+		require.Equal(t, vector.cashAddr, encoded)
+	}
+
+	// Testnet addresses use a different prefix.
+	address, err := btcutil.DecodeAddress(
+		"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", &bch.TestNet3Params)
+	require.NoError(t, err)
+	encoded, err := bch.EncodeAddress(address, &bch.TestNet3Params)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(encoded, "bchtest:q"))
+	decoded, err := bch.DecodeAddress(encoded, &bch.TestNet3Params)
+	require.NoError(t, err)
+	require.Equal(t, address.EncodeAddress(), decoded.EncodeAddress())
+}
+
+func TestDecodeAddress(t *testing.T) {
+	for _, vector := range cashAddrVectors {
+		for _, input := range []string{
+			vector.cashAddr,
+			strings.ToUpper(vector.cashAddr),
+			strings.TrimPrefix(vector.cashAddr, "bitcoincash:"),
+			vector.legacy,
+		} {
+			address, err := bch.DecodeAddress(input, &bch.MainNetParams)
+			require.NoError(t, err, input)
+			require.Equal(t, vector.legacy, address.EncodeAddress())
+			require.True(t, address.IsForNet(&bch.MainNetParams))
+		}
+	}
+
+	for _, invalid := range []string{
+		"",
+		// Wrong checksum.
+		"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b",
+		// Mixed case.
+		"bitcoincash:Qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		// Wrong network.
+		"bchtest:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		// Invalid character.
+		"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6i",
+	} {
+		_, err := bch.DecodeAddress(invalid, &bch.MainNetParams)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bch
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ASERTAnchor is the block from which the ASERT difficulty adjustment algorithm (aserti3-2d)
+// computes the targets of all later blocks.
+type ASERTAnchor struct {
+	// Height is the height of the anchor block. ASERT applies to all blocks above it.
+	Height int
+	// Bits is the compact target of the anchor block.
+	Bits uint32
+	// PrevBlockTime is the timestamp of the parent of the anchor block.
+	PrevBlockTime int64
+}
+
+const (
+	// MainNetDAAHeight is the height of the last block on the main network before the cw-144
+	// difficulty adjustment algorithm activated in November 2017.
+	MainNetDAAHeight = 504031
+
+	// ASERTHalfLife is the time in seconds after which the ASERT target doubles (or halves) if
+	// the blocks are behind (or ahead of) the schedule.
+	ASERTHalfLife = 2 * 24 * 60 * 60
+)
+
+// MainNetASERTAnchor is the ASERT anchor block of the main network, which activated the algorithm
+// in November 2020.
+var MainNetASERTAnchor = ASERTAnchor{
+	Height:        661647,
+	Bits:          0x1804dafe,
+	PrevBlockTime: 1605447844,
+}
+
+// MainNetParams defines the network parameters for the main Bitcoin Cash network.
+var MainNetParams = chaincfg.Params{
+	Name:        "mainnet",
+	Net:         MainNet,
+	DefaultPort: "8333",
+	DNSSeeds: []chaincfg.DNSSeed{
+		{Host: "seed.bitcoinabc.org", HasFiltering: true},
+		{Host: "seed-abc.bitcoinforks.org", HasFiltering: true},
+		{Host: "btccash-seeder.bitcoinunlimited.info", HasFiltering: true},
+		{Host: "seed.bitprim.org", HasFiltering: true},
+		{Host: "seed.deadalnix.me", HasFiltering: true},
+	},
+
+	// Chain parameters. The chain split off Bitcoin at block 478559, so the genesis block is
+	// shared.
+	GenesisBlock:             chaincfg.MainNetParams.GenesisBlock,
+	GenesisHash:              chaincfg.MainNetParams.GenesisHash,
+	PowLimit:                 chaincfg.MainNetParams.PowLimit,
+	PowLimitBits:             0x1d00ffff,
+	BIP0034Height:            227931,
+	BIP0065Height:            388381,
+	BIP0066Height:            363725,
+	CoinbaseMaturity:         100,
+	SubsidyReductionInterval: 210000,
+	TargetTimespan:           time.Hour * 24 * 14, // 14 days
+	TargetTimePerBlock:       time.Minute * 10,    // 10 minutes
+	RetargetAdjustmentFactor: 4,                   // 25% less, 400% more
+	ReduceMinDifficulty:      false,
+	MinDiffReductionTime:     0,
+	GenerateSupported:        false,
+
+	// Checkpoints ordered from oldest to newest.
+	Checkpoints: []chaincfg.Checkpoint{
+		// UAHF fork block.
+		{Height: 478559, Hash: newHashFromStr("000000000000000000651ef99cb9fcbe0dadde1d424bd9f15ff20136191a5eec")},
+		// November 2017 DAA fork.
+		{Height: 504031, Hash: newHashFromStr("0000000000000000011ebf65b60d0a3de80b8175be709d653b4c1a1beeb6ab9c")},
+		// November 2020 ASERT fork.
+		{Height: 661648, Hash: newHashFromStr("0000000000000000029e471c41818d24b8b74c911071c4ef0b4a0509f9b5a8ce")},
+	},
+
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   target proof of work timespan / target proof of work spacing
+	RuleChangeActivationThreshold: 1916, // 95% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016, //
+	Deployments: [chaincfg.DefinedDeployments]chaincfg.ConsensusDeployment{
+		chaincfg.DeploymentTestDummy: {
+			BitNumber:  28,
+			StartTime:  1199145601, // January 1, 2008 UTC
+			ExpireTime: 1230767999, // December 31, 2008 UTC
+		},
+		chaincfg.DeploymentCSV: {
+			BitNumber:  0,
+			StartTime:  1462060800, // May 1st, 2016
+			ExpireTime: 1493596800, // May 1st, 2017
+		},
+		// Bitcoin Cash did not activate segwit.
+	},
+
+	// Mempool parameters
+	RelayNonStdTxs: false,
+
+	// Bitcoin Cash has no segwit addresses. CashAddr addresses are handled by this package, see
+	// CashAddrPrefix().
+
+	// Address encoding magics
+	PubKeyHashAddrID: 0x00, // starts with 1
+	ScriptHashAddrID: 0x05, // starts with 3
+	PrivateKeyID:     0x80, // starts with 5 (uncompressed) or K (compressed)
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x88, 0xad, 0xe4}, // starts with xprv
+	HDPublicKeyID:  [4]byte{0x04, 0x88, 0xb2, 0x1e}, // starts with xpub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	HDCoinType: 145,
+}
+
+// TestNet3Params defines the network parameters for the Bitcoin Cash test network (version 3).
+var TestNet3Params = chaincfg.Params{
+	Name:        "testnet3",
+	Net:         TestNet3,
+	DefaultPort: "18333",
+	DNSSeeds: []chaincfg.DNSSeed{
+		{Host: "testnet-seed.bitcoinabc.org", HasFiltering: true},
+		{Host: "testnet-seed-abc.bitcoinforks.org", HasFiltering: true},
+		{Host: "testnet-seed.bitprim.org", HasFiltering: true},
+		{Host: "testnet-seed.deadalnix.me", HasFiltering: true},
+	},
+
+	// Chain parameters
+	GenesisBlock:             chaincfg.TestNet3Params.GenesisBlock,
+	GenesisHash:              chaincfg.TestNet3Params.GenesisHash,
+	PowLimit:                 chaincfg.TestNet3Params.PowLimit,
+	PowLimitBits:             0x1d00ffff,
+	BIP0034Height:            21111,
+	BIP0065Height:            581885,
+	BIP0066Height:            330776,
+	CoinbaseMaturity:         100,
+	SubsidyReductionInterval: 210000,
+	TargetTimespan:           time.Hour * 24 * 14, // 14 days
+	TargetTimePerBlock:       time.Minute * 10,    // 10 minutes
+	RetargetAdjustmentFactor: 4,                   // 25% less, 400% more
+	ReduceMinDifficulty:      true,
+	MinDiffReductionTime:     time.Minute * 20, // TargetTimePerBlock * 2
+	GenerateSupported:        false,
+
+	// No checkpoints, the headers are synced from the genesis block.
+	Checkpoints: nil,
+
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   target proof of work timespan / target proof of work spacing
+	RuleChangeActivationThreshold: 1512, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016,
+	Deployments: [chaincfg.DefinedDeployments]chaincfg.ConsensusDeployment{
+		chaincfg.DeploymentTestDummy: {
+			BitNumber:  28,
+			StartTime:  1199145601, // January 1, 2008 UTC
+			ExpireTime: 1230767999, // December 31, 2008 UTC
+		},
+		chaincfg.DeploymentCSV: {
+			BitNumber:  0,
+			StartTime:  1456790400, // March 1st, 2016
+			ExpireTime: 1493596800, // May 1st, 2017
+		},
+	},
+
+	// Mempool parameters
+	RelayNonStdTxs: true,
+
+	// Address encoding magics
+	PubKeyHashAddrID: 0x6f, // starts with m or n
+	ScriptHashAddrID: 0xc4, // starts with 2
+	PrivateKeyID:     0xef, // starts with 9 (uncompressed) or c (compressed)
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	HDCoinType: 1,
+}
+
+// IsNet returns true if the network parameters are the ones of a Bitcoin Cash network.
+func IsNet(net *chaincfg.Params) bool {
+	return net.Net == MainNet || net.Net == TestNet3
+}
+
+// newHashFromStr converts the passed big-endian hex string into a
+// chainhash.Hash.  It only differs from the one available in chainhash in that
+// it panics on an error since it will only (and must only) be called with
+// hard-coded, and therefore known good, hashes.
+func newHashFromStr(hexStr string) *chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(hexStr)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// mustRegister performs the same function as Register except it panics if there
+// is an error.  This should only be called from package init functions.
+func mustRegister(params *chaincfg.Params) {
+	if err := chaincfg.Register(params); err != nil {
+		panic("failed to register network: " + err.Error())
+	}
+}
+
+func init() {
+	// Register all default networks when the package is initialized.
+	mustRegister(&MainNetParams)
+	mustRegister(&TestNet3Params)
+}
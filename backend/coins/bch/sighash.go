@@ -0,0 +1,94 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bch
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// SigHashForkID is set in the signature hash type of all Bitcoin Cash signatures. It selects the
+// replay protected signature hash algorithm.
+const SigHashForkID txscript.SigHashType = 0x40
+
+// CalcSignatureHash computes the replay protected signature hash of an input spending an output
+// of the given amount, with SigHashForkID added to the hash type. The algorithm is the one of
+// BIP143 with a fork id of zero, so it also applies to non-segwit scripts. The sigHashes can be
+// reused for all inputs of the transaction.
+func CalcSignatureHash(
+	subScript []byte,
+	sigHashes *txscript.TxSigHashes,
+	hashType txscript.SigHashType,
+	transaction *wire.MsgTx,
+	index int,
+	amount int64,
+) ([]byte, error) {
+	return txscript.CalcWitnessSigHash(
+		subScript, sigHashes, hashType|SigHashForkID, transaction, index, amount)
+}
+
+// VerifyP2PKHSignature verifies the replay protected signature of the input at the index, which
+// spends a P2PKH output with the given script and amount. It stands in for the script engine of
+// btcd, which does not know the signature hash of Bitcoin Cash.
+func VerifyP2PKHSignature(
+	pkScript []byte,
+	sigHashes *txscript.TxSigHashes,
+	transaction *wire.MsgTx,
+	index int,
+	amount int64,
+) error {
+	if txscript.GetScriptClass(pkScript) != txscript.PubKeyHashTy {
+		return errp.New("only P2PKH outputs are supported")
+	}
+	pushes, err := txscript.PushedData(transaction.TxIn[index].SignatureScript)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if len(pushes) != 2 || len(pushes[0]) == 0 {
+		return errp.New("the signature script must push a signature and a public key")
+	}
+	signatureBytes, publicKeyBytes := pushes[0], pushes[1]
+	hashType := txscript.SigHashType(signatureBytes[len(signatureBytes)-1])
+	if hashType&SigHashForkID == 0 {
+		return errp.New("the signature is not replay protected")
+	}
+	// The P2PKH script is OP_DUP OP_HASH160 <20 byte hash> OP_EQUALVERIFY OP_CHECKSIG.
+	if !bytes.Equal(btcutil.Hash160(publicKeyBytes), pkScript[3:23]) {
+		return errp.New("the public key does not match the output")
+	}
+	publicKey, err := btcec.ParsePubKey(publicKeyBytes, btcec.S256())
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	signature, err := btcec.ParseDERSignature(
+		signatureBytes[:len(signatureBytes)-1], btcec.S256())
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	signatureHash, err := CalcSignatureHash(
+		pkScript, sigHashes, hashType, transaction, index, amount)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if !signature.Verify(signatureHash, publicKey) {
+		return errp.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bch_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	"github.com/stretchr/testify/require"
+)
+
+// The vectors are the native P2WPKH example of BIP143, see
+// https://github.com/bitcoin/bips/blob/master/bip-0143.mediawiki#native-p2wpkh. The second input
+// is signed.
+const (
+	bip143UnsignedTx = "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f" +
+		"0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a01000000" +
+		"00ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d00" +
+		"0000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+	bip143ScriptCode = "76a9141d0f172a0ecb48aee1be1f2687d2963ae33f71a188ac"
+	bip143Amount     = 600000000
+	bip143Preimage   = "0100000096b827c8483d4e9b96712b6713a7b68d6e8003a781feba36c31143470b4efd37" +
+		"52b0a642eea2fb7ae638c36f6252b6750293dbe574a806984b8e4d8548339a3bef51e1b804cc89d182d279655c" +
+		"3aa89e815b1b309fe287d9b2b55d57b90ec68a010000001976a9141d0f172a0ecb48aee1be1f2687d2963ae33f" +
+		"71a188ac0046c32300000000ffffffff863ef3e1a92afbfdb97f31ad0fc7683ee943e9abcf2501590ff8f6551f" +
+		"47e5e51100000001000000"
+	bip143SigHash    = "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670"
+	bip143PrivateKey = "619c335025c7f4012e556c2a58b2506e30b8511b53ade95ea316fd8c3286feb9"
+)
+
+func mustDecodeHex(hexString string) []byte {
+	decoded, err := hex.DecodeString(hexString)
+	if err != nil {
+		panic(err)
+	}
+	return decoded
+}
+
+func bip143Transaction(t *testing.T) *wire.MsgTx {
+	transaction := wire.NewMsgTx(wire.TxVersion)
+	require.NoError(t, transaction.Deserialize(bytes.NewReader(mustDecodeHex(bip143UnsignedTx))))
+	return transaction
+}
+
+func TestCalcSignatureHash(t *testing.T) {
+	preimage := mustDecodeHex(bip143Preimage)
+	require.Equal(t, bip143SigHash, hex.EncodeToString(chainhash.DoubleHashB(preimage)))
+
+	// The replay protected preimage is the one of BIP143, with the fork id in the hash type, which
+	// is the last field.
+	forkIDPreimage := append(preimage[:len(preimage)-4:len(preimage)-4], 0x41, 0, 0, 0)
+	transaction := bip143Transaction(t)
+	signatureHash, err := bch.CalcSignatureHash(mustDecodeHex(bip143ScriptCode),
+		txscript.NewTxSigHashes(transaction), txscript.SigHashAll, transaction, 1, bip143Amount)
+	require.NoError(t, err)
+	require.Equal(t, chainhash.DoubleHashB(forkIDPreimage), signatureHash)
+}
+
+func TestVerifyP2PKHSignature(t *testing.T) {
+	privateKey, publicKey := btcec.PrivKeyFromBytes(btcec.S256(), mustDecodeHex(bip143PrivateKey))
+	pkScript := mustDecodeHex(bip143ScriptCode)
+	transaction := bip143Transaction(t)
+	sigHashes := txscript.NewTxSigHashes(transaction)
+
+	sign := func(signatureHash []byte, hashType txscript.SigHashType) {
+		signature, err := privateKey.Sign(signatureHash)
+		require.NoError(t, err)
+		transaction.TxIn[1].SignatureScript, err = txscript.NewScriptBuilder().
+			AddData(append(signature.Serialize(), byte(hashType))).
+			AddData(publicKey.SerializeCompressed()).
+			Script()
+		require.NoError(t, err)
+	}
+
+	signatureHash, err := bch.CalcSignatureHash(
+		pkScript, sigHashes, txscript.SigHashAll, transaction, 1, bip143Amount)
+	require.NoError(t, err)
+	sign(signatureHash, txscript.SigHashAll|bch.SigHashForkID)
+	require.NoError(t, bch.VerifyP2PKHSignature(pkScript, sigHashes, transaction, 1, bip143Amount))
+	// The amount is committed to.
+	require.Error(t, bch.VerifyP2PKHSignature(pkScript, sigHashes, transaction, 1, bip143Amount+1))
+
+	// Signatures without the fork id can be replayed on the Bitcoin chain.
+	sign(signatureHash, txscript.SigHashAll)
+	require.Error(t, bch.VerifyP2PKHSignature(pkScript, sigHashes, transaction, 1, bip143Amount))
+
+	// The BIP143 signature hash of Bitcoin is not valid.
+	sign(mustDecodeHex(bip143SigHash), txscript.SigHashAll|bch.SigHashForkID)
+	require.Error(t, bch.VerifyP2PKHSignature(pkScript, sigHashes, transaction, 1, bip143Amount))
+}
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"path"
 	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 
@@ -30,9 +32,11 @@ import (
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/synchronizer"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/db/transactionsdb"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
@@ -47,24 +51,38 @@ const (
 
 // Interface is the API of a Account.
 type Interface interface {
-	Code() string
-	Coin() *Coin
-	Init() error
-	InitialSyncDone() bool
-	Offline() bool
-	Close()
+	coin.Account
 	Transactions() []*transactions.TxInfo
+	SearchTransactions(*transactions.TxFilter) ([]*transactions.TxInfo, int, error)
+	TxDetail(chainhash.Hash) (*transactions.TxDetail, error)
 	Balance() *transactions.Balance
-	SendTx(string, SendAmount, FeeTargetCode, map[wire.OutPoint]struct{}) error
+	BalanceBreakdown() *transactions.BalanceBreakdown
+	BalanceHistory(transactions.BalanceHistoryInterval) ([]*transactions.BalancePoint, error)
+	SendTx(string, SendAmount, FeeTargetCode, btcutil.Amount, map[wire.OutPoint]struct{}) error
+	AbandonTransaction(chainhash.Hash) error
+	Sweep(string, string, FeeTargetCode) (*SweepResult, error)
+	Consolidation() (*Consolidation, error)
+	Consolidate(map[wire.OutPoint]struct{}) error
 	FeeTargets() ([]*FeeTarget, FeeTargetCode)
-	TxProposal(string, SendAmount, FeeTargetCode, map[wire.OutPoint]struct{}) (
+	FeeRateForBlocks(int) *btcutil.Amount
+	ConfirmationTime(btcutil.Amount) *time.Duration
+	MinFeeRatePerKb() *btcutil.Amount
+	TxProposal(string, SendAmount, FeeTargetCode, btcutil.Amount, map[wire.OutPoint]struct{}) (
 		btcutil.Amount, btcutil.Amount, btcutil.Amount, error)
 	GetUnusedReceiveAddresses() []*addresses.AccountAddress
+	LookupReceiveAddress(blockchain.ScriptHashHex) *addresses.AccountAddress
+	MarkAddressDisplayed(blockchain.ScriptHashHex) error
+	AddressUsage() []*AddressUsage
+	OwnAddressReuse(string) int
 	VerifyAddress(blockchain.ScriptHashHex) (bool, error)
 	ConvertToLegacyAddress(blockchain.ScriptHashHex) (btcutil.Address, error)
 	Keystores() keystore.Keystores
+	AddressSyncErrors() []*AddressSyncError
+	ServerDiscrepancies() []*electrum.Discrepancy
 	HeadersStatus() (*headers.Status, error)
 	SpendableOutputs() []*SpendableOutput
+	SetOutputFrozen(wire.OutPoint, bool) error
+	SetOutputReleased(wire.OutPoint, bool) error
 }
 
 // Account is a account whose addresses are derived from an xpub.
@@ -89,12 +107,27 @@ type Account struct {
 
 	synchronizer *synchronizer.Synchronizer
 
+	// addressSyncErrors contains the addresses whose history could not be fetched.
+	addressSyncErrors map[blockchain.ScriptHashHex]*AddressSyncError
+
+	// serverDiscrepancies contains the latest disagreements found by the consistency check, oldest
+	// first. At most maxServerDiscrepancies are kept.
+	serverDiscrepancies []*electrum.Discrepancy
+
 	feeTargets []*FeeTarget
+	// feeHistogram is the latest mempool fee histogram. Nil until fetched.
+	feeHistogram blockchain.FeeHistogram
+	// relayFee is the minimum relay fee rate per kB. Nil until fetched.
+	relayFee *btcutil.Amount
 
 	initialSyncDone bool
 	offline         bool
 	onEvent         func(Event)
 	log             *logrus.Entry
+
+	// syncStarted is the time the current sync started, in nanoseconds since the unix epoch.
+	// Accessed atomically, as the sync can be started and finished from different goroutines.
+	syncStarted int64
 }
 
 // MarshalJSON implements json.Marshaler.
@@ -105,7 +138,7 @@ func (account *Account) MarshalJSON() ([]byte, error) {
 		Name                  string `json:"name"`
 		BlockExplorerTxPrefix string `json:"blockExplorerTxPrefix"`
 	}{
-		CoinCode: account.coin.Name(),
+		CoinCode: account.coin.Code(),
 		Code:     account.code,
 		Name:     account.name,
 		BlockExplorerTxPrefix: account.coin.blockExplorerTxPrefix,
@@ -160,6 +193,7 @@ func NewAccount(
 			{Blocks: 6, Code: FeeTargetCodeNormal},
 			{Blocks: 2, Code: FeeTargetCodeHigh},
 		},
+		addressSyncErrors: map[blockchain.ScriptHashHex]*AddressSyncError{},
 		// initializing to false, to prevent flashing of offline notification in the frontend
 		offline:         false,
 		initialSyncDone: false,
@@ -167,10 +201,22 @@ func NewAccount(
 		log:             log,
 	}
 	account.synchronizer = synchronizer.NewSynchronizer(
-		func() { onEvent(EventSyncStarted) },
+		func() {
+			atomic.StoreInt64(&account.syncStarted, time.Now().UnixNano())
+			onEvent(EventSyncStarted)
+		},
 		func() {
 			if !account.initialSyncDone {
 				account.initialSyncDone = true
+				metrics := account.coin.BlockchainMetrics()
+				syncStarted := time.Unix(0, atomic.LoadInt64(&account.syncStarted))
+				account.log.WithFields(logrus.Fields{
+					"duration":             time.Since(syncStarted),
+					"rpc-requests":         metrics.Requests,
+					"rpc-batched-requests": metrics.BatchedRequests,
+					"rpc-batches":          metrics.Batches,
+					"rpc-avg-latency":      metrics.AverageLatency(),
+				}).Info("Initial sync done")
 				onEvent(EventStatusChanged)
 			}
 			onEvent(EventSyncDone)
@@ -182,7 +228,7 @@ func NewAccount(
 
 // String returns a representation of the account for logging.
 func (account *Account) String() string {
-	return fmt.Sprintf("%s-%s", account.Coin().String(), account.code)
+	return fmt.Sprintf("%s-%s", account.coin.String(), account.code)
 }
 
 // Code returns the code of the account.
@@ -191,7 +237,7 @@ func (account *Account) Code() string {
 }
 
 // Coin returns the coin of the account.
-func (account *Account) Coin() *Coin {
+func (account *Account) Coin() coin.Coin {
 	return account.coin
 }
 
@@ -257,6 +303,20 @@ func (account *Account) Init() error {
 	account.transactions = transactions.NewTransactions(
 		account.coin.Net(), account.db, account.headers, account.synchronizer,
 		account.blockchain, account.log)
+	account.transactions.SetDustThreshold(account.coin.dustThreshold)
+	account.transactions.SubscribeEvent(func(event transactions.Event) {
+		switch event {
+		case transactions.EventIncomingTxDoubleSpent:
+			account.onEvent(EventIncomingTxDoubleSpent)
+		case transactions.EventOutputQuarantined:
+			account.onEvent(EventOutputQuarantined)
+		}
+	})
+	account.headers.SubscribeReorg(func(fromHeight, toHeight int) {
+		if account.transactions.Reorg(fromHeight, toHeight) > 0 {
+			account.onEvent(EventReorg)
+		}
+	})
 
 	account.receiveAddresses = addresses.NewAddressChain(
 		account.signingConfiguration, account.coin.Net(), gapLimit, 0, account.log)
@@ -302,8 +362,15 @@ func (account *Account) Close() {
 		}
 		account.log.Info("Closed DB")
 	}
-	// TODO: deregister from json RPC client. The client can be closed when no account uses
-	// the client any longer.
+	for _, addressChain := range []*addresses.AddressChain{
+		account.receiveAddresses, account.changeAddresses} {
+		if addressChain == nil {
+			continue
+		}
+		for _, address := range addressChain.Addresses() {
+			account.blockchain.ScriptHashUnsubscribe(address.PubkeyScriptHashHex())
+		}
+	}
 	account.initialSyncDone = false
 	if account.transactions != nil {
 		account.transactions.Close()
@@ -313,6 +380,24 @@ func (account *Account) Close() {
 
 func (account *Account) updateFeeTargets() {
 	defer account.RLock()()
+	account.blockchain.RelayFee(
+		func(relayFee btcutil.Amount) error {
+			defer account.Lock()()
+			account.relayFee = &relayFee
+			account.onEvent(EventFeeTargetsChanged)
+			return nil
+		},
+		func() {},
+	)
+	account.blockchain.FeeHistogram(
+		func(histogram blockchain.FeeHistogram) error {
+			defer account.Lock()()
+			account.feeHistogram = histogram
+			account.onEvent(EventFeeTargetsChanged)
+			return nil
+		},
+		func() {},
+	)
 	for _, feeTarget := range account.feeTargets {
 		func(feeTarget *FeeTarget) {
 			setFee := func(feeRatePerKb btcutil.Amount) error {
@@ -328,6 +413,9 @@ func (account *Account) updateFeeTargets() {
 				feeTarget.Blocks,
 				func(feeRatePerKb *btcutil.Amount) error {
 					if feeRatePerKb == nil {
+						if histogramFeeRatePerKb := account.FeeRateForBlocks(feeTarget.Blocks); histogramFeeRatePerKb != nil {
+							return setFee(*histogramFeeRatePerKb)
+						}
 						if account.code != "tltc" {
 							account.log.WithField("fee-target", feeTarget.Blocks).
 								Warning("Fee could not be estimated. Taking the minimum relay fee instead")
@@ -335,6 +423,9 @@ func (account *Account) updateFeeTargets() {
 						account.blockchain.RelayFee(setFee, func() {})
 						return nil
 					}
+					if checker := account.coin.ConsistencyChecker(); checker != nil {
+						checker.CheckFeeEstimate(feeTarget.Blocks, *feeRatePerKb, account.onServerDiscrepancy)
+					}
 					return setFee(*feeRatePerKb)
 				},
 				func() {},
@@ -374,11 +465,88 @@ outer:
 	return feeTargets, defaultFee
 }
 
+// maxServerDiscrepancies is the number of server discrepancies kept for display.
+const maxServerDiscrepancies = 20
+
+// onServerDiscrepancy is called when the consistency checker finds that two servers disagree.
+func (account *Account) onServerDiscrepancy(discrepancy *electrum.Discrepancy) {
+	func() {
+		defer account.Lock()()
+		// A repeated discrepancy replaces the previous one, so that the list shows the latest
+		// values.
+		discrepancies := []*electrum.Discrepancy{}
+		for _, previous := range account.serverDiscrepancies {
+			if previous.Kind != discrepancy.Kind || previous.Subject != discrepancy.Subject {
+				discrepancies = append(discrepancies, previous)
+			}
+		}
+		discrepancies = append(discrepancies, discrepancy)
+		if len(discrepancies) > maxServerDiscrepancies {
+			discrepancies = discrepancies[len(discrepancies)-maxServerDiscrepancies:]
+		}
+		account.serverDiscrepancies = discrepancies
+	}()
+	// Emitted without holding the lock, as the handlers of the event query the account.
+	account.onEvent(EventServerInconsistency)
+}
+
+// ServerDiscrepancies returns the latest disagreements between the primary and the secondary
+// server, oldest first.
+func (account *Account) ServerDiscrepancies() []*electrum.Discrepancy {
+	defer account.RLock()()
+	return append([]*electrum.Discrepancy{}, account.serverDiscrepancies...)
+}
+
+// FeeRateForBlocks returns the fee rate per kB needed for the transaction to be confirmed within
+// the given number of blocks, estimated from the mempool fee histogram. The result is never below
+// the minimum relay fee. Returns nil if the histogram or the relay fee have not been fetched yet.
+func (account *Account) FeeRateForBlocks(blocks int) *btcutil.Amount {
+	defer account.RLock()()
+	if account.feeHistogram == nil || account.relayFee == nil {
+		return nil
+	}
+	feeRatePerKb := feeRateForBlocks(account.feeHistogram, blocks)
+	if feeRatePerKb == nil || *feeRatePerKb < *account.relayFee {
+		return account.relayFee
+	}
+	return feeRatePerKb
+}
+
+// ConfirmationTime estimates how long it takes until a transaction paying the given fee rate per
+// kB is confirmed. Returns nil if the mempool fee histogram has not been fetched yet.
+func (account *Account) ConfirmationTime(feeRatePerKb btcutil.Amount) *time.Duration {
+	defer account.RLock()()
+	if account.feeHistogram == nil {
+		return nil
+	}
+	blocks := blocksForFeeRate(account.feeHistogram, feeRatePerKb)
+	duration := time.Duration(blocks) * account.coin.Net().TargetTimePerBlock
+	return &duration
+}
+
+// MinFeeRatePerKb returns the minimum relay fee rate per kB, which is the lowest fee rate accepted
+// for custom fees. Returns nil if it has not been fetched yet.
+func (account *Account) MinFeeRatePerKb() *btcutil.Amount {
+	defer account.RLock()()
+	return account.relayFee
+}
+
 // Balance wraps transaction.Transactions.Balance()
 func (account *Account) Balance() *transactions.Balance {
 	return account.transactions.Balance()
 }
 
+// BalanceBreakdown wraps transaction.Transactions.BalanceBreakdown()
+func (account *Account) BalanceBreakdown() *transactions.BalanceBreakdown {
+	return account.transactions.BalanceBreakdown()
+}
+
+// BalanceHistory wraps transaction.Transactions.BalanceHistory()
+func (account *Account) BalanceHistory(interval transactions.BalanceHistoryInterval) (
+	[]*transactions.BalancePoint, error) {
+	return account.transactions.BalanceHistory(interval)
+}
+
 func (account *Account) addresses(change bool) *addresses.AddressChain {
 	if change {
 		return account.changeAddresses
@@ -398,24 +566,125 @@ func (account *Account) onAddressStatus(address *addresses.AccountAddress, statu
 	account.log.Debug("Address status changed, fetching history.")
 
 	done := account.synchronizer.IncRequestsCounter()
-	account.blockchain.ScriptHashGetHistory(
+	// The history is only fetched once the transactions of previously fetched histories are
+	// downloaded, so that the download queue stays bounded.
+	account.transactions.WhenTxDownloadQueueAvailable(func() {
+		account.blockchain.ScriptHashGetHistory(
+			address.PubkeyScriptHashHex(),
+			func(history blockchain.TxHistory) error {
+				func() {
+					defer account.Lock()()
+					address.HistoryStatus = history.Status()
+					if address.HistoryStatus != status {
+						account.log.Warning("client status should match after sync")
+					}
+					account.transactions.UpdateAddressHistory(address.PubkeyScriptHashHex(), history)
+				}()
+				account.setAddressSyncError(address, nil)
+				if checker := account.coin.ConsistencyChecker(); checker != nil {
+					checker.CheckHistory(
+						address.PubkeyScriptHashHex(), history, account.onServerDiscrepancy)
+				}
+				account.ensureAddresses()
+				return nil
+			},
+			func(err error) { account.onAddressHistoryError(address, status, err) },
+			func() { done() },
+		)
+	})
+}
+
+// onAddressHistoryError is called when the history of an address could not be fetched. If the
+// server refuses to send the history because it is too large, the unspent outputs of the address
+// are fetched instead, so that at least the balance is correct.
+func (account *Account) onAddressHistoryError(
+	address *addresses.AccountAddress, status string, err error) {
+	if errp.Cause(err) != blockchain.ErrHistoryTooLarge {
+		account.log.WithError(err).Error("Failed to fetch the address history")
+		account.setAddressSyncError(address, &AddressSyncError{Error: err.Error()})
+		return
+	}
+	account.log.Warning("Address history too large, falling back to the unspent outputs")
+	done := account.synchronizer.IncRequestsCounter()
+	account.blockchain.ScriptHashListUnspent(
 		address.PubkeyScriptHashHex(),
-		func(history blockchain.TxHistory) error {
+		func(utxos []*blockchain.UTXO) error {
 			func() {
 				defer account.Lock()()
-				address.HistoryStatus = history.Status()
-				if address.HistoryStatus != status {
-					account.log.Warning("client status should match after sync")
-				}
-				account.transactions.UpdateAddressHistory(address.PubkeyScriptHashHex(), history)
+				// The history is incomplete, so its status can't match the one of the server.
+				// Take the status of the server so the history is only fetched again when it
+				// changes.
+				address.HistoryStatus = status
+				account.transactions.UpdateAddressHistory(
+					address.PubkeyScriptHashHex(), unspentHistory(utxos))
 			}()
+			account.setAddressSyncError(address, &AddressSyncError{
+				Error:          blockchain.ErrHistoryTooLarge.Error(),
+				PartialHistory: true,
+			})
 			account.ensureAddresses()
 			return nil
 		},
+		func(err error) {
+			account.log.WithError(err).Error("Failed to fetch the unspent outputs")
+			account.setAddressSyncError(address, &AddressSyncError{Error: err.Error()})
+		},
 		func() { done() },
 	)
 }
 
+// unspentHistory returns the transactions creating the given outputs, as a history.
+func unspentHistory(utxos []*blockchain.UTXO) blockchain.TxHistory {
+	history := blockchain.TxHistory{}
+	seen := map[chainhash.Hash]struct{}{}
+	for _, utxo := range utxos {
+		txHash := utxo.TXHash.Hash()
+		if _, ok := seen[txHash]; ok {
+			continue
+		}
+		seen[txHash] = struct{}{}
+		history = append(history, &blockchain.TxInfo{Height: utxo.Height, TXHash: utxo.TXHash})
+	}
+	return history
+}
+
+// AddressSyncError describes why an address could not be synced.
+type AddressSyncError struct {
+	Address string `json:"address"`
+	Error   string `json:"error"`
+	// PartialHistory is true if only the unspent outputs of the address could be fetched. The
+	// balance is correct, but spent transactions are missing from the transaction list.
+	PartialHistory bool `json:"partialHistory"`
+}
+
+// setAddressSyncError records the sync error of the address, or clears it if syncError is nil.
+func (account *Account) setAddressSyncError(
+	address *addresses.AccountAddress, syncError *AddressSyncError) {
+	defer account.Lock()()
+	scriptHashHex := address.PubkeyScriptHashHex()
+	if syncError == nil {
+		if _, ok := account.addressSyncErrors[scriptHashHex]; ok {
+			delete(account.addressSyncErrors, scriptHashHex)
+			account.onEvent(EventAddressSyncErrorsChanged)
+		}
+		return
+	}
+	syncError.Address = address.EncodeAddress()
+	account.addressSyncErrors[scriptHashHex] = syncError
+	account.onEvent(EventAddressSyncErrorsChanged)
+}
+
+// AddressSyncErrors returns the addresses which could not be synced.
+func (account *Account) AddressSyncErrors() []*AddressSyncError {
+	defer account.RLock()()
+	result := []*AddressSyncError{}
+	for _, syncError := range account.addressSyncErrors {
+		result = append(result, syncError)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Address < result[j].Address })
+	return result
+}
+
 // ensureAddresses is the entry point of syncing up the account. It extends the receive and change
 // address chains to discover all funds, with respect to the gap limit. In the end, there are
 // `gapLimit` unused addresses in the tail. It is also called whenever the status (tx history) of
@@ -473,20 +742,45 @@ func (account *Account) subscribeAddress(
 	return nil
 }
 
+func (account *Account) isChange(scriptHashHex blockchain.ScriptHashHex) bool {
+	return account.changeAddresses.LookupByScriptHashHex(scriptHashHex) != nil
+}
+
 // Transactions wraps transaction.Transactions.Transactions()
 func (account *Account) Transactions() []*transactions.TxInfo {
-	return account.transactions.Transactions(
-		func(scriptHashHex blockchain.ScriptHashHex) bool {
-			return account.changeAddresses.LookupByScriptHashHex(scriptHashHex) != nil
-		})
+	return account.transactions.Transactions(account.isChange)
 }
 
-// GetUnusedReceiveAddresses returns a number of unused addresses.
+// SearchTransactions wraps transaction.Transactions.SearchTransactions()
+func (account *Account) SearchTransactions(
+	filter *transactions.TxFilter) ([]*transactions.TxInfo, int, error) {
+	return account.transactions.SearchTransactions(filter, account.isChange)
+}
+
+// TxDetail wraps transaction.Transactions.TxDetail()
+func (account *Account) TxDetail(txHash chainhash.Hash) (*transactions.TxDetail, error) {
+	return account.transactions.TxDetail(txHash, account.isChange)
+}
+
+// AbandonTransaction wraps transaction.Transactions.Abandon()
+func (account *Account) AbandonTransaction(txHash chainhash.Hash) error {
+	return account.transactions.Abandon(txHash)
+}
+
+// GetUnusedReceiveAddresses returns a number of unused addresses. Addresses which were not shown to
+// the user yet come first, see MarkAddressDisplayed().
 func (account *Account) GetUnusedReceiveAddresses() []*addresses.AccountAddress {
 	account.synchronizer.WaitSynchronized()
 	defer account.RLock()()
 	account.log.Debug("Get unused receive address")
-	return account.receiveAddresses.GetUnused()
+	return account.rotateReceiveAddresses(account.receiveAddresses.GetUnused())
+}
+
+// LookupReceiveAddress returns the receive address which matches the provided scriptHashHex.
+// Returns nil if not found.
+func (account *Account) LookupReceiveAddress(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+	defer account.RLock()()
+	return account.receiveAddresses.LookupByScriptHashHex(scriptHashHex)
 }
 
 // VerifyAddress verifies a receive address on a keystore. Returns false, nil if no secure output
@@ -498,6 +792,9 @@ func (account *Account) VerifyAddress(scriptHashHex blockchain.ScriptHashHex) (b
 	if address == nil {
 		return false, errp.New("unknown address not found")
 	}
+	if err := account.markAddressDisplayed(scriptHashHex); err != nil {
+		return false, err
+	}
 	if account.Keystores().HaveSecureOutput() {
 		return true, account.Keystores().OutputAddress(address.Configuration, account.Coin())
 	}
@@ -513,7 +810,7 @@ func (account *Account) ConvertToLegacyAddress(scriptHashHex blockchain.ScriptHa
 	if address == nil {
 		return nil, errp.New("unknown address not found")
 	}
-	if account.Coin().Net() != &ltc.MainNetParams || address.Configuration.ScriptType() != signing.ScriptTypeP2WPKHP2SH {
+	if account.coin.Net() != &ltc.MainNetParams || address.Configuration.ScriptType() != signing.ScriptTypeP2WPKHP2SH {
 		return nil, errp.New("must be an ltc p2sh address")
 	}
 	hash := address.Address.(*btcutil.AddressScriptHash).Hash160()
@@ -561,3 +858,13 @@ func (account *Account) SpendableOutputs() []*SpendableOutput {
 	sort.Sort(sort.Reverse(&byValue{result}))
 	return result
 }
+
+// SetOutputFrozen wraps transaction.Transactions.SetOutputFrozen()
+func (account *Account) SetOutputFrozen(outPoint wire.OutPoint, frozen bool) error {
+	return account.transactions.SetOutputFrozen(outPoint, frozen)
+}
+
+// SetOutputReleased wraps transaction.Transactions.SetOutputReleased()
+func (account *Account) SetOutputReleased(outPoint wire.OutPoint, released bool) error {
+	return account.transactions.SetOutputReleased(outPoint, released)
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
+	headersMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/synchronizer"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/db/transactionsdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerDiscrepancies(t *testing.T) {
+	events := 0
+	account := &Account{}
+	account.onEvent = func(event Event) {
+		require.Equal(t, EventServerInconsistency, event)
+		// The event is emitted after releasing the lock, so the handler can query the account.
+		require.NotEmpty(t, account.ServerDiscrepancies())
+		events++
+	}
+	require.Empty(t, account.ServerDiscrepancies())
+
+	discrepancy := func(subject string, primary string) *electrum.Discrepancy {
+		return &electrum.Discrepancy{
+			Kind:            electrum.DiscrepancyKindHistory,
+			PrimaryServer:   "primary:50002",
+			SecondaryServer: "secondary:50002",
+			Subject:         subject,
+			Primary:         primary,
+			Secondary:       "status",
+		}
+	}
+	account.onServerDiscrepancy(discrepancy("a", "1"))
+	account.onServerDiscrepancy(discrepancy("b", "1"))
+	// A repeated discrepancy replaces the previous one.
+	account.onServerDiscrepancy(discrepancy("a", "2"))
+	require.Equal(t, 3, events)
+	require.Equal(t,
+		[]*electrum.Discrepancy{discrepancy("b", "1"), discrepancy("a", "2")},
+		account.ServerDiscrepancies())
+
+	for i := 0; i < maxServerDiscrepancies; i++ {
+		account.onServerDiscrepancy(discrepancy(fmt.Sprintf("c%d", i), "1"))
+	}
+	discrepancies := account.ServerDiscrepancies()
+	require.Len(t, discrepancies, maxServerDiscrepancies)
+	require.Equal(t, "c0", discrepancies[0].Subject)
+}
+
+// unspentBlockchain serves the unspent outputs of an address and the transactions creating them.
+type unspentBlockchain struct {
+	blockchainMock.Interface
+	utxos        []*blockchain.UTXO
+	transactions map[chainhash.Hash]*wire.MsgTx
+	// callbacks are the pending TransactionGet() callbacks. They are called by flush(), as calling
+	// them right away would deadlock on the transactions lock.
+	callbacks []func()
+}
+
+func (b *unspentBlockchain) ScriptHashListUnspent(
+	_ blockchain.ScriptHashHex, success func([]*blockchain.UTXO) error, _ func(error),
+	cleanup func()) {
+	defer cleanup()
+	if err := success(b.utxos); err != nil {
+		panic(err)
+	}
+}
+
+func (b *unspentBlockchain) TransactionGet(
+	txHash chainhash.Hash, success func(*wire.MsgTx) error, cleanup func()) {
+	b.callbacks = append(b.callbacks, func() {
+		defer cleanup()
+		if err := success(b.transactions[txHash]); err != nil {
+			panic(err)
+		}
+	})
+}
+
+func (b *unspentBlockchain) ScriptHashSubscribe(
+	func() func(), blockchain.ScriptHashHex, func(string) error) {
+}
+
+func (b *unspentBlockchain) flush() {
+	for len(b.callbacks) != 0 {
+		callbacks := b.callbacks
+		b.callbacks = nil
+		for _, callback := range callbacks {
+			callback()
+		}
+	}
+}
+
+func TestOnAddressHistoryError(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	log := logging.Get().WithGroup("account_test")
+	configuration, receiveAddresses := addressesTest.NewAddressChain()
+	db, err := transactionsdb.NewDB(test.TstTempFile("godbb-db-"))
+	require.NoError(t, err)
+	headers := &headersMock.Interface{}
+	headers.On("SubscribeEvent", mock.AnythingOfType("func(headers.Event)")).Return(func() {})
+	headers.On("TipHeight").Return(15)
+	fakeBlockchain := &unspentBlockchain{transactions: map[chainhash.Hash]*wire.MsgTx{}}
+	sync := synchronizer.NewSynchronizer(func() {}, func() {}, log)
+	account := &Account{
+		db:                db,
+		blockchain:        fakeBlockchain,
+		receiveAddresses:  receiveAddresses,
+		changeAddresses:   addresses.NewAddressChain(configuration, net, 6, 1, log),
+		transactions:      transactions.NewTransactions(net, db, headers, sync, fakeBlockchain, log),
+		headers:           headers,
+		synchronizer:      sync,
+		addressSyncErrors: map[blockchain.ScriptHashHex]*AddressSyncError{},
+		onEvent:           func(Event) {},
+		log:               log,
+	}
+	address := receiveAddresses.EnsureAddresses()[0]
+
+	// Any other error is recorded without falling back to the unspent outputs.
+	account.onAddressHistoryError(address, "status", errors.New("connection lost"))
+	require.Equal(t,
+		[]*AddressSyncError{{Address: address.EncodeAddress(), Error: "connection lost"}},
+		account.AddressSyncErrors())
+	require.Equal(t, "", address.HistoryStatus)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.HashH([]byte("funding"))}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, address.PubkeyScript()))
+	tx.AddTxOut(wire.NewTxOut(2000, address.PubkeyScript()))
+	fakeBlockchain.transactions[tx.TxHash()] = tx
+	fakeBlockchain.utxos = []*blockchain.UTXO{
+		{TXPos: 0, Value: 1000, TXHash: blockchain.TXHash(tx.TxHash())},
+		{TXPos: 1, Value: 2000, TXHash: blockchain.TXHash(tx.TxHash())},
+	}
+	account.onAddressHistoryError(
+		address, "status", errp.WithStack(blockchain.ErrHistoryTooLarge))
+	fakeBlockchain.flush()
+	require.Equal(t, "status", address.HistoryStatus)
+	require.Equal(t, btcutil.Amount(3000), account.transactions.Balance().Incoming)
+	require.Equal(t,
+		[]*AddressSyncError{{
+			Address:        address.EncodeAddress(),
+			Error:          blockchain.ErrHistoryTooLarge.Error(),
+			PartialHistory: true,
+		}},
+		account.AddressSyncErrors())
+}
+
+func TestReceiveAddressRotation(t *testing.T) {
+	log := logging.Get().WithGroup("account_test")
+	_, receiveAddresses := addressesTest.NewAddressChain()
+	db, err := transactionsdb.NewDB(test.TstTempFile("godbb-db-"))
+	require.NoError(t, err)
+	account := &Account{
+		db:               db,
+		receiveAddresses: receiveAddresses,
+		synchronizer:     synchronizer.NewSynchronizer(func() {}, func() {}, log),
+		log:              log,
+	}
+	receiveAddresses.EnsureAddresses()
+	unused := account.GetUnusedReceiveAddresses()
+	require.Len(t, unused, 20)
+
+	// Only receive addresses of the account can be marked.
+	require.Error(t, account.MarkAddressDisplayed(blockchain.ScriptHashHex("unknown")))
+
+	// Getting the addresses does not mark any of them as shown.
+	require.Equal(t, unused, account.GetUnusedReceiveAddresses())
+
+	// A shown address is handed out last.
+	require.NoError(t, account.MarkAddressDisplayed(unused[0].PubkeyScriptHashHex()))
+	rotated := account.GetUnusedReceiveAddresses()
+	require.Equal(t, unused[1], rotated[0])
+	require.Equal(t, unused[0], rotated[19])
+
+	// After all addresses were shown, the least recently shown one is handed out again.
+	for _, address := range rotated[:19] {
+		require.NoError(t, account.MarkAddressDisplayed(address.PubkeyScriptHashHex()))
+	}
+	require.Equal(t, unused[0], account.GetUnusedReceiveAddresses()[0])
+}
@@ -170,9 +170,11 @@ func index(publicKey *btcec.PublicKey, sortedPublicKeys []*btcec.PublicKey) int
 }
 
 // SignatureScript returns the signature script (and witness) needed to spend from this address.
-// The signatures have to be provided in the order of the configuration (and some can be nil).
+// The signatures have to be provided in the order of the configuration (and some can be nil). The
+// sigHashType is appended to each signature.
 func (address *AccountAddress) SignatureScript(
 	signatures []*btcec.Signature,
+	sigHashType txscript.SigHashType,
 ) ([]byte, wire.TxWitness) {
 	if len(signatures) != address.Configuration.NumberOfSigners() {
 		address.log.Panic("The wrong number of signatures were provided.")
@@ -188,7 +190,7 @@ func (address *AccountAddress) SignatureScript(
 		scriptBuilder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
 		for _, signature := range sortedSignatures {
 			if signature != nil {
-				scriptBuilder.AddData(append(signature.Serialize(), byte(txscript.SigHashAll)))
+				scriptBuilder.AddData(append(signature.Serialize(), byte(sigHashType)))
 			}
 		}
 		signatureScript, err := scriptBuilder.AddData(address.redeemScript).Script()
@@ -205,7 +207,7 @@ func (address *AccountAddress) SignatureScript(
 	switch address.Configuration.ScriptType() {
 	case signing.ScriptTypeP2PKH:
 		signatureScript, err := txscript.NewScriptBuilder().
-			AddData(append(signature.Serialize(), byte(txscript.SigHashAll))).
+			AddData(append(signature.Serialize(), byte(sigHashType))).
 			AddData(publicKey.SerializeCompressed()).
 			Script()
 		if err != nil {
@@ -220,13 +222,13 @@ func (address *AccountAddress) SignatureScript(
 			address.log.WithError(err).Panic("Failed to build segwit signature script.")
 		}
 		txWitness := wire.TxWitness{
-			append(signature.Serialize(), byte(txscript.SigHashAll)),
+			append(signature.Serialize(), byte(sigHashType)),
 			publicKey.SerializeCompressed(),
 		}
 		return signatureScript, txWitness
 	case signing.ScriptTypeP2WPKH:
 		txWitness := wire.TxWitness{
-			append(signature.Serialize(), byte(txscript.SigHashAll)),
+			append(signature.Serialize(), byte(sigHashType)),
 			publicKey.SerializeCompressed(),
 		}
 		return []byte{}, txWitness
@@ -67,6 +67,11 @@ func (addresses *AddressChain) GetUnused() []*AccountAddress {
 	return addresses.addresses[len(addresses.addresses)-unusedTailCount:]
 }
 
+// Addresses returns all addresses of the chain.
+func (addresses *AddressChain) Addresses() []*AccountAddress {
+	return addresses.addresses
+}
+
 // addAddress appends a new address at the end of the chain.
 func (addresses *AddressChain) addAddress() *AccountAddress {
 	addresses.log.Debug("Add new address to chain")
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
@@ -45,7 +46,7 @@ func TestSigScriptWitnessSize(t *testing.T) {
 		address := test.GetAddress(scriptType)
 		t.Run(string(address.Configuration.String()), func(t *testing.T) {
 			sigScriptSize, hasWitness := addresses.SigScriptWitnessSize(address.Configuration)
-			sigScript, witness := address.SignatureScript([]*btcec.Signature{sig})
+			sigScript, witness := address.SignatureScript([]*btcec.Signature{sig}, txscript.SigHashAll)
 			require.Equal(t, len(sigScript), sigScriptSize)
 			require.Equal(t, witness != nil, hasWitness)
 		})
@@ -63,7 +64,7 @@ func TestSigScriptWitnessSize(t *testing.T) {
 					sigs[numSigs] = sig
 				}
 				sigScriptSize, hasWitness := addresses.SigScriptWitnessSize(address.Configuration)
-				sigScript, _ := address.SignatureScript(sigs)
+				sigScript, _ := address.SignatureScript(sigs, txscript.SigHashAll)
 				require.Equal(t, len(sigScript), sigScriptSize)
 				require.False(t, hasWitness)
 			})
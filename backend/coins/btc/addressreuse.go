@@ -0,0 +1,147 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// AddressUsage describes how often an address of the account was shown and paid to.
+type AddressUsage struct {
+	Address       string
+	ScriptHashHex blockchain.ScriptHashHex
+	Change        bool
+	// ReceiveCount is the number of txs which paid to the address. Above one, the address was
+	// reused.
+	ReceiveCount int
+	// Displayed is the last time the address was shown to the user. Nil if it was never shown.
+	Displayed *time.Time
+}
+
+// displayedAddresses returns the times the receive addresses were last shown to the user.
+func (account *Account) displayedAddresses() map[blockchain.ScriptHashHex]time.Time {
+	dbTx, err := account.db.Begin()
+	if err != nil {
+		account.log.WithError(err).Panic("Failed to begin transaction")
+	}
+	defer dbTx.Rollback()
+	displayed, err := dbTx.DisplayedAddresses()
+	if err != nil {
+		account.log.WithError(err).Panic("Failed to retrieve displayed addresses")
+	}
+	return displayed
+}
+
+// rotateReceiveAddresses orders the unused receive addresses so that addresses which were never
+// shown come first, followed by the others, least recently shown first. This way, an address is not
+// handed out twice before all others were.
+//
+// Only the gapLimit unused addresses are rotated. After they were all shown without being paid to,
+// the least recently shown one is handed out again. The window is not extended beyond the gap limit
+// on purpose: funds paid to addresses further out are not found when the wallet is restored, by
+// this app or others.
+func (account *Account) rotateReceiveAddresses(
+	unused []*addresses.AccountAddress) []*addresses.AccountAddress {
+	displayed := account.displayedAddresses()
+	result := append([]*addresses.AccountAddress{}, unused...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return displayed[result[i].PubkeyScriptHashHex()].Before(
+			displayed[result[j].PubkeyScriptHashHex()])
+	})
+	return result
+}
+
+// MarkAddressDisplayed records that the receive address was shown to the user, so the next call to
+// GetUnusedReceiveAddresses() returns a different address first.
+func (account *Account) MarkAddressDisplayed(scriptHashHex blockchain.ScriptHashHex) error {
+	if account.LookupReceiveAddress(scriptHashHex) == nil {
+		return errp.New("unknown address not found")
+	}
+	return account.markAddressDisplayed(scriptHashHex)
+}
+
+func (account *Account) markAddressDisplayed(scriptHashHex blockchain.ScriptHashHex) error {
+	dbTx, err := account.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	if err := dbTx.PutAddressDisplayed(scriptHashHex, time.Now()); err != nil {
+		return err
+	}
+	return dbTx.Commit()
+}
+
+// AddressUsage returns all addresses which were shown to the user or received funds, the most often
+// paid to first.
+func (account *Account) AddressUsage() []*AddressUsage {
+	receiveCounts := account.transactions.ReceiveCounts()
+	displayed := account.displayedAddresses()
+	defer account.RLock()()
+	result := []*AddressUsage{}
+	for _, change := range []bool{false, true} {
+		for _, address := range account.addresses(change).Addresses() {
+			scriptHashHex := address.PubkeyScriptHashHex()
+			usage := &AddressUsage{
+				Address:       account.coin.EncodeAddress(address.Address),
+				ScriptHashHex: scriptHashHex,
+				Change:        change,
+				ReceiveCount:  receiveCounts[scriptHashHex],
+			}
+			if displayedTime, ok := displayed[scriptHashHex]; ok {
+				usage.Displayed = &displayedTime
+			}
+			if usage.ReceiveCount == 0 && usage.Displayed == nil {
+				continue
+			}
+			result = append(result, usage)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ReceiveCount > result[j].ReceiveCount
+	})
+	return result
+}
+
+// OwnAddressReuse returns the number of txs which already paid to the recipient address if it
+// belongs to the account, so that paying to it again can be warned about. It returns 0 for foreign
+// or invalid addresses.
+func (account *Account) OwnAddressReuse(recipientAddress string) int {
+	address, err := account.coin.DecodeAddress(recipientAddress)
+	if err != nil {
+		return 0
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return 0
+	}
+	scriptHashHex := blockchain.ScriptHashHex(chainhash.HashH(pkScript).String())
+	own := func() bool {
+		defer account.RLock()()
+		return account.receiveAddresses.LookupByScriptHashHex(scriptHashHex) != nil ||
+			account.changeAddresses.LookupByScriptHashHex(scriptHashHex) != nil
+	}()
+	if !own {
+		return 0
+	}
+	return account.transactions.ReceiveCounts()[scriptHashHex]
+}
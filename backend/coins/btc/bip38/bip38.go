@@ -0,0 +1,153 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bip38 decrypts passphrase-protected private keys as specified in
+// https://github.com/bitcoin/bips/blob/master/bip-0038.mediawiki.
+package bip38
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	prefixNonECMultiply = 0x42
+	prefixECMultiply    = 0x43
+
+	flagCompressed  = 0x20
+	flagLotSequence = 0x04
+)
+
+// ErrWrongPassphrase is returned if the key could not be decrypted with the given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// IsEncrypted returns true if the key looks like a BIP38 encrypted key.
+func IsEncrypted(encryptedKey string) bool {
+	return strings.HasPrefix(encryptedKey, "6P")
+}
+
+func aesDecrypt(key []byte, block []byte) []byte {
+	cipher, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	result := make([]byte, len(block))
+	cipher.Decrypt(result, block)
+	return result
+}
+
+func xor(a []byte, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+	return result
+}
+
+// addressHash is the checksum of the P2PKH address of the key stored in the encrypted key.
+func addressHash(privateKey *btcec.PrivateKey, compressed bool, net *chaincfg.Params) ([]byte, error) {
+	wif, err := btcutil.NewWIF(privateKey, net, compressed)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	address, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), net)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return chainhash.DoubleHashB([]byte(address.EncodeAddress()))[:4], nil
+}
+
+// Decrypt decrypts the BIP38 encrypted key with the passphrase. Keys created with and without EC
+// multiplication are supported. The net is needed to check the address hash, which is computed
+// from the address of the key on that network.
+func Decrypt(encryptedKey string, passphrase string, net *chaincfg.Params) (*btcutil.WIF, error) {
+	payload, version, err := base58.CheckDecode(encryptedKey)
+	if err != nil || version != 0x01 || len(payload) != 38 {
+		return nil, errp.New("invalid BIP38 key")
+	}
+	flag := payload[1]
+	compressed := flag&flagCompressed != 0
+	hash := payload[2:6]
+	passphraseBytes := []byte(norm.NFC.String(passphrase))
+
+	var privateKey *btcec.PrivateKey
+	switch payload[0] {
+	case prefixNonECMultiply:
+		derived, err := scrypt.Key(passphraseBytes, hash, 16384, 8, 8, 64)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		half1, half2 := derived[:32], derived[32:]
+		keyBytes := append(
+			xor(aesDecrypt(half2, payload[6:22]), half1[:16]),
+			xor(aesDecrypt(half2, payload[22:38]), half1[16:])...)
+		privateKey, _ = btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	case prefixECMultiply:
+		ownerEntropy := payload[6:14]
+		ownerSalt := ownerEntropy
+		if flag&flagLotSequence != 0 {
+			ownerSalt = ownerEntropy[:4]
+		}
+		passFactor, err := scrypt.Key(passphraseBytes, ownerSalt, 16384, 8, 8, 32)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if flag&flagLotSequence != 0 {
+			passFactor = chainhash.DoubleHashB(append(passFactor, ownerEntropy...))
+		}
+		_, passPoint := btcec.PrivKeyFromBytes(btcec.S256(), passFactor)
+		derived, err := scrypt.Key(passPoint.SerializeCompressed(),
+			append(append([]byte{}, hash...), ownerEntropy...), 1024, 1, 1, 64)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		half1, half2 := derived[:32], derived[32:]
+		// decrypted2 is encryptedPart1[8:16] followed by seedB[16:24].
+		decrypted2 := xor(aesDecrypt(half2, payload[22:38]), half1[16:])
+		encryptedPart1 := append(append([]byte{}, payload[14:22]...), decrypted2[:8]...)
+		seedB := append(xor(aesDecrypt(half2, encryptedPart1), half1[:16]), decrypted2[8:]...)
+		factorB := chainhash.DoubleHashB(seedB)
+		curveOrder := btcec.S256().N
+		keyInt := new(big.Int).Mul(new(big.Int).SetBytes(passFactor), new(big.Int).SetBytes(factorB))
+		keyInt.Mod(keyInt, curveOrder)
+		keyBytes := make([]byte, 32)
+		keyIntBytes := keyInt.Bytes()
+		copy(keyBytes[32-len(keyIntBytes):], keyIntBytes)
+		privateKey, _ = btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	default:
+		return nil, errp.New("invalid BIP38 key")
+	}
+
+	expectedHash, err := addressHash(privateKey, compressed, net)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(expectedHash, hash) {
+		return nil, errp.WithStack(ErrWrongPassphrase)
+	}
+	wif, err := btcutil.NewWIF(privateKey, net, compressed)
+	return wif, errp.WithStack(err)
+}
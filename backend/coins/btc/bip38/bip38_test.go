@@ -0,0 +1,78 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bip38_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bip38"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from BIP38.
+func TestDecrypt(t *testing.T) {
+	vectors := []struct {
+		encrypted  string
+		passphrase string
+		wif        string
+	}{
+		// No compression, no EC multiply.
+		{
+			"6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg",
+			"TestingOneTwoThree",
+			"5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR",
+		},
+		{
+			"6PRNFFkZc2NZ6dJqFfhRoFNMR9Lnyj7dYGrzdgXXVMXcxoKTePPX1dWByq",
+			"Satoshi",
+			"5HtasZ6ofTHP6HCwTqTkLDuLQisYPah7aUnSKfC7h4hMUVw2gi5",
+		},
+		// Compression, no EC multiply.
+		{
+			"6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo",
+			"TestingOneTwoThree",
+			"L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP",
+		},
+		{
+			"6PYLtMnXvfG3oJde97zRyLYFZCYizPU5T3LwgdYJz1fRhh16bU7u6PPmY7",
+			"Satoshi",
+			"KwYgW8gcxj1JWJXhPSu4Fqwzfhp5Yfi42mdYmMa4XqK7NJxXUSK7",
+		},
+		// EC multiply, no compression, no lot/sequence numbers.
+		{
+			"6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX",
+			"TestingOneTwoThree",
+			"5K4caxezwjGCGfnoPTZ8tMcJBLB7Jvyjv4xxeacadhq8nLisLR2",
+		},
+		{
+			"6PfLGnQs6VZnrNpmVKfjotbnQuaJK4KZoPFrAjx1JMJUa1Ft8gnf5WxfKd",
+			"Satoshi",
+			"5KJ51SgxWaAYR13zd9ReMhJpwrcX47xTJh2D3fGPG9CM8vkv5sH",
+		},
+	}
+	for _, vector := range vectors {
+		require.True(t, bip38.IsEncrypted(vector.encrypted))
+		wif, err := bip38.Decrypt(vector.encrypted, vector.passphrase, &chaincfg.MainNetParams)
+		require.NoError(t, err)
+		require.Equal(t, vector.wif, wif.String())
+	}
+
+	_, err := bip38.Decrypt(vectors[0].encrypted, "wrong", &chaincfg.MainNetParams)
+	require.Equal(t, bip38.ErrWrongPassphrase, errp.Cause(err))
+	_, err = bip38.Decrypt(vectors[0].wif, "", &chaincfg.MainNetParams)
+	require.Error(t, err)
+}
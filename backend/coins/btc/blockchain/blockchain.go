@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -27,6 +28,10 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 )
 
+// ErrHistoryTooLarge is returned by ScriptHashGetHistory() if the server refuses to return the
+// history because it is too large.
+var ErrHistoryTooLarge = errors.New("address history too large")
+
 // TXHash wraps chainhash.Hash for json deserialization.
 type TXHash chainhash.Hash
 
@@ -96,19 +101,44 @@ const (
 	DISCONNECTED
 )
 
+// UTXO is an unspent output, as returned by ScriptHashListUnspent().
+type UTXO struct {
+	TXPos  int    `json:"tx_pos"`
+	Value  int64  `json:"value"`
+	TXHash TXHash `json:"tx_hash"`
+	Height int    `json:"height"`
+}
+
+// FeeHistogramEntry is one entry of the mempool fee histogram.
+type FeeHistogramEntry struct {
+	// FeeRatePerVByte is the fee rate in satoshi per virtual byte.
+	FeeRatePerVByte float64
+	// VSize is the total virtual size of all mempool transactions paying at least FeeRatePerVByte
+	// and less than the fee rate of the previous entry.
+	VSize int64
+}
+
+// FeeHistogram is returned by FeeHistogram(). Entries are ordered by fee rate, highest first.
+type FeeHistogram []*FeeHistogramEntry
+
 // Interface is the interface to a blockchain index backend. Currently geared to Electrum, though
 // other backends can implement the same interface.
 //go:generate mockery -name Interface
 type Interface interface {
-	ScriptHashGetHistory(ScriptHashHex, func(TxHistory) error, func())
+	ScriptHashGetHistory(ScriptHashHex, func(TxHistory) error, func(error), func())
+	ScriptHashListUnspent(ScriptHashHex, func([]*UTXO) error, func(error), func())
 	TransactionGet(chainhash.Hash, func(*wire.MsgTx) error, func())
 	ScriptHashSubscribe(func() func(), ScriptHashHex, func(string) error)
+	ScriptHashUnsubscribe(ScriptHashHex)
 	HeadersSubscribe(func() func(), func(*Header) error)
 	TransactionBroadcast(*wire.MsgTx) error
 	RelayFee(func(btcutil.Amount) error, func())
 	EstimateFee(int, func(*btcutil.Amount) error, func())
+	FeeHistogram(func(FeeHistogram) error, func())
 	Headers(int, int, func([]*wire.BlockHeader, int) error, func())
-	GetMerkle(chainhash.Hash, int, func(merkle []TXHash, pos int) error, func())
+	HeadersWithCheckpoint(
+		int, int, int, func([]*wire.BlockHeader, int, *CheckpointProof) error, func())
+	GetMerkle(chainhash.Hash, int, func(merkle []TXHash, pos int) error, func(error), func())
 	Close()
 	ConnectionStatus() Status
 	RegisterOnConnectionStatusChangedEvent(func(Status))
@@ -0,0 +1,43 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// CheckpointProof is a merkle proof that a header is part of the chain committed to by a
+// checkpoint. The checkpoint commits to the merkle root of the hashes of all headers from the
+// genesis block up to and including the checkpoint height.
+type CheckpointProof struct {
+	Root   chainhash.Hash
+	Branch []chainhash.Hash
+}
+
+// Verify checks that the header with the given hash is at the given height in the tree with the
+// root of the proof.
+func (proof *CheckpointProof) Verify(headerHash chainhash.Hash, height int) bool {
+	hash := headerHash
+	index := height
+	for _, branchHash := range proof.Branch {
+		if index&1 == 1 {
+			hash = chainhash.DoubleHashH(append(branchHash[:], hash[:]...))
+		} else {
+			hash = chainhash.DoubleHashH(append(hash[:], branchHash[:]...))
+		}
+		index >>= 1
+	}
+	return index == 0 && hash == proof.Root
+}
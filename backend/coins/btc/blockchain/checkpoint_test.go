@@ -0,0 +1,53 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/stretchr/testify/require"
+)
+
+func hashPair(left, right chainhash.Hash) chainhash.Hash {
+	return chainhash.DoubleHashH(append(left[:], right[:]...))
+}
+
+func TestCheckpointProofVerify(t *testing.T) {
+	leaves := []chainhash.Hash{}
+	for _, data := range []string{"header0", "header1", "header2", "header3"} {
+		leaves = append(leaves, chainhash.HashH([]byte(data)))
+	}
+	left := hashPair(leaves[0], leaves[1])
+	right := hashPair(leaves[2], leaves[3])
+	root := hashPair(left, right)
+
+	// Proof for the header at height 2.
+	proof := &blockchain.CheckpointProof{
+		Root:   root,
+		Branch: []chainhash.Hash{leaves[3], left},
+	}
+	require.True(t, proof.Verify(leaves[2], 2))
+	// Wrong height.
+	require.False(t, proof.Verify(leaves[2], 3))
+	// Height beyond the tree.
+	require.False(t, proof.Verify(leaves[2], 6))
+	// Wrong header.
+	require.False(t, proof.Verify(leaves[1], 2))
+	// Wrong root.
+	proof.Root = left
+	require.False(t, proof.Verify(leaves[2], 2))
+}
@@ -36,9 +36,14 @@ func (_m *Interface) EstimateFee(_a0 int, _a1 func(*btcutil.Amount) error, _a2 f
 	_m.Called(_a0, _a1, _a2)
 }
 
-// GetMerkle provides a mock function with given fields: _a0, _a1, _a2, _a3
-func (_m *Interface) GetMerkle(_a0 chainhash.Hash, _a1 int, _a2 func([]blockchain.TXHash, int) error, _a3 func()) {
-	_m.Called(_a0, _a1, _a2, _a3)
+// FeeHistogram provides a mock function with given fields: _a0, _a1
+func (_m *Interface) FeeHistogram(_a0 func(blockchain.FeeHistogram) error, _a1 func()) {
+	_m.Called(_a0, _a1)
+}
+
+// GetMerkle provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4
+func (_m *Interface) GetMerkle(_a0 chainhash.Hash, _a1 int, _a2 func([]blockchain.TXHash, int) error, _a3 func(error), _a4 func()) {
+	_m.Called(_a0, _a1, _a2, _a3, _a4)
 }
 
 // Headers provides a mock function with given fields: _a0, _a1, _a2, _a3
@@ -46,6 +51,11 @@ func (_m *Interface) Headers(_a0 int, _a1 int, _a2 func([]*wire.BlockHeader, int
 	_m.Called(_a0, _a1, _a2, _a3)
 }
 
+// HeadersWithCheckpoint provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4
+func (_m *Interface) HeadersWithCheckpoint(_a0 int, _a1 int, _a2 int, _a3 func([]*wire.BlockHeader, int, *blockchain.CheckpointProof) error, _a4 func()) {
+	_m.Called(_a0, _a1, _a2, _a3, _a4)
+}
+
 // HeadersSubscribe provides a mock function with given fields: _a0, _a1
 func (_m *Interface) HeadersSubscribe(_a0 func() func(), _a1 func(*blockchain.Header) error) {
 	_m.Called(_a0, _a1)
@@ -61,9 +71,14 @@ func (_m *Interface) RelayFee(_a0 func(btcutil.Amount) error, _a1 func()) {
 	_m.Called(_a0, _a1)
 }
 
-// ScriptHashGetHistory provides a mock function with given fields: _a0, _a1, _a2
-func (_m *Interface) ScriptHashGetHistory(_a0 blockchain.ScriptHashHex, _a1 func(blockchain.TxHistory) error, _a2 func()) {
-	_m.Called(_a0, _a1, _a2)
+// ScriptHashGetHistory provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Interface) ScriptHashGetHistory(_a0 blockchain.ScriptHashHex, _a1 func(blockchain.TxHistory) error, _a2 func(error), _a3 func()) {
+	_m.Called(_a0, _a1, _a2, _a3)
+}
+
+// ScriptHashListUnspent provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Interface) ScriptHashListUnspent(_a0 blockchain.ScriptHashHex, _a1 func([]*blockchain.UTXO) error, _a2 func(error), _a3 func()) {
+	_m.Called(_a0, _a1, _a2, _a3)
 }
 
 // ScriptHashSubscribe provides a mock function with given fields: _a0, _a1, _a2
@@ -71,6 +86,11 @@ func (_m *Interface) ScriptHashSubscribe(_a0 func() func(), _a1 blockchain.Scrip
 	_m.Called(_a0, _a1, _a2)
 }
 
+// ScriptHashUnsubscribe provides a mock function with given fields: _a0
+func (_m *Interface) ScriptHashUnsubscribe(_a0 blockchain.ScriptHashHex) {
+	_m.Called(_a0)
+}
+
 // TransactionBroadcast provides a mock function with given fields: _a0
 func (_m *Interface) TransactionBroadcast(_a0 *wire.MsgTx) error {
 	ret := _m.Called(_a0)
@@ -21,14 +21,19 @@ import (
 	"strings"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcutil"
 	"github.com/sirupsen/logrus"
 
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/db/headersdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
@@ -37,6 +42,7 @@ import (
 
 // Coin models a Bitcoin-related coin.
 type Coin struct {
+	code                  string
 	name                  string
 	unit                  string
 	net                   *chaincfg.Params
@@ -47,14 +53,29 @@ type Coin struct {
 	ratesUpdater coinpkg.RatesUpdater
 	observable.Implementation
 
-	blockchain blockchain.Interface
-	headers    *headers.Headers
+	blockchain     blockchain.Interface
+	electrumClient *client.ElectrumClient
+	headers        *headers.Headers
+
+	consistencyCheck bool
+	// batchConfig configures the request batching of the blockchain connection. Nil uses the
+	// defaults.
+	batchConfig        *rpc.BatchConfig
+	consistencyChecker *electrum.ConsistencyChecker
+
+	// fiatRateTolerance is the relative deviation of the current exchange rate from a locked rate
+	// which is accepted when converting fiat amounts.
+	fiatRateTolerance float64
+
+	// dustThreshold is the value below which incoming outputs are quarantined.
+	dustThreshold btcutil.Amount
 
 	log *logrus.Entry
 }
 
 // NewCoin creates a new coin with the given parameters.
 func NewCoin(
+	code string,
 	name string,
 	unit string,
 	net *chaincfg.Params,
@@ -64,6 +85,7 @@ func NewCoin(
 	ratesUpdater coinpkg.RatesUpdater,
 ) *Coin {
 	coin := &Coin{
+		code:                  code,
 		name:                  name,
 		unit:                  unit,
 		net:                   net,
@@ -72,7 +94,7 @@ func NewCoin(
 		blockExplorerTxPrefix: blockExplorerTxPrefix,
 		ratesUpdater:          ratesUpdater,
 
-		log: logging.Get().WithGroup("coin").WithField("name", name),
+		log: logging.Get().WithGroup("coin").WithField("code", code),
 	}
 	return coin
 }
@@ -80,11 +102,21 @@ func NewCoin(
 // Init initializes the coin - blockchain and headers.
 func (coin *Coin) Init() {
 	// Init blockchain
-	coin.blockchain = electrum.NewElectrumConnection(coin.servers, coin.log)
+	coin.electrumClient = electrum.NewElectrumConnection(
+		coin.servers, coin.net, coin.batchConfig, coin.log)
+	coin.blockchain = coin.electrumClient
+	if coin.consistencyCheck {
+		if len(coin.servers) > 1 {
+			coin.consistencyChecker = electrum.NewConsistencyChecker(
+				coin.electrumClient, coin.servers, coin.net, coin.log)
+		} else {
+			coin.log.Warning("Consistency check enabled, but only one server is configured")
+		}
+	}
 
 	// Init Headers
 	db, err := headersdb.NewDB(
-		path.Join(coin.dbFolder, fmt.Sprintf("headers-%s.db", coin.name)))
+		path.Join(coin.dbFolder, fmt.Sprintf("headers-%s.db", coin.code)))
 	if err != nil {
 		coin.log.WithError(err).Panic("Could not open headers DB")
 	}
@@ -101,7 +133,7 @@ func (coin *Coin) Init() {
 				coin.log.Error("Could not get headers status")
 			}
 			coin.Notify(observable.Event{
-				Subject: fmt.Sprintf("coins/%s/headers/status", coin.name),
+				Subject: fmt.Sprintf("coins/%s/headers/status", coin.code),
 				Action:  action.Replace,
 				Object:  status,
 			})
@@ -113,50 +145,162 @@ func (coin *Coin) Init() {
 	}
 }
 
-// Name returns the coin's name.
+// BlockchainMetrics returns the request metrics of the connection to the blockchain backend. The
+// metrics are shared by all accounts of the coin.
+func (coin *Coin) BlockchainMetrics() rpc.Metrics {
+	if coin.electrumClient == nil {
+		return rpc.Metrics{}
+	}
+	return coin.electrumClient.Metrics()
+}
+
+// SetBatchConfig configures how the requests to the blockchain backend are batched. Must be called
+// before Init().
+func (coin *Coin) SetBatchConfig(batchConfig rpc.BatchConfig) {
+	coin.batchConfig = &batchConfig
+}
+
+// EnableConsistencyCheck makes the coin cross-check address histories and fee estimates against a
+// second server. Must be called before Init().
+func (coin *Coin) EnableConsistencyCheck() {
+	coin.consistencyCheck = true
+}
+
+// SetFiatRateTolerance sets the relative deviation of the current exchange rate from a locked rate,
+// e.g. 0.02 for 2%, up to which fiat amounts are still converted at the locked rate.
+func (coin *Coin) SetFiatRateTolerance(tolerance float64) {
+	coin.fiatRateTolerance = tolerance
+}
+
+// SetDustThreshold sets the value below which incoming outputs are quarantined in the accounts of
+// this coin. 0 disables the quarantine. Must be called before the accounts are initialized.
+func (coin *Coin) SetDustThreshold(threshold btcutil.Amount) {
+	coin.dustThreshold = threshold
+}
+
+// ConsistencyChecker returns the checker used to compare server replies, or nil if consistency
+// checks are disabled.
+func (coin *Coin) ConsistencyChecker() *electrum.ConsistencyChecker {
+	return coin.consistencyChecker
+}
+
+// Code implements coin.Coin.
+func (coin *Coin) Code() string {
+	return coin.code
+}
+
+// Name implements coin.Coin.
 func (coin *Coin) Name() string {
 	return coin.name
 }
 
+// Type implements coin.Coin.
+func (coin *Coin) Type() uint32 {
+	return coin.net.HDCoinType
+}
+
 // Net returns the coin's network params.
 func (coin *Coin) Net() *chaincfg.Params {
 	return coin.net
 }
 
+// DecodeAddress decodes an address of the coin's network. Bitcoin Cash addresses can also be
+// given in the CashAddr format.
+func (coin *Coin) DecodeAddress(address string) (btcutil.Address, error) {
+	if bch.IsNet(coin.net) {
+		return bch.DecodeAddress(address, coin.net)
+	}
+	decodedAddress, err := btcutil.DecodeAddress(address, coin.net)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if !decodedAddress.IsForNet(coin.net) {
+		return nil, errp.New("address is for another network")
+	}
+	return decodedAddress, nil
+}
+
+// ValidateAddress implements coin.Coin.
+func (coin *Coin) ValidateAddress(address string) error {
+	_, err := coin.DecodeAddress(address)
+	return err
+}
+
+// EncodeAddress encodes the address in the format shown to the user, which is CashAddr for Bitcoin
+// Cash.
+func (coin *Coin) EncodeAddress(address btcutil.Address) string {
+	if bch.IsNet(coin.net) {
+		encoded, err := bch.EncodeAddress(address, coin.net)
+		if err == nil {
+			return encoded
+		}
+	}
+	return address.EncodeAddress()
+}
+
+// sigHashType returns the signature hash type used when signing transactions.
+func (coin *Coin) sigHashType() txscript.SigHashType {
+	if bch.IsNet(coin.net) {
+		return txscript.SigHashAll | bch.SigHashForkID
+	}
+	return txscript.SigHashAll
+}
+
+// segwit returns whether segwit outputs can be spent on the coin's network. Bitcoin Cash and
+// Dogecoin did not activate segwit.
+func (coin *Coin) segwit() bool {
+	return !bch.IsNet(coin.net) && !doge.IsNet(coin.net)
+}
+
 // Unit implements coin.Coin.
 func (coin *Coin) Unit() string {
 	return coin.unit
 }
 
+// AccountBased implements coin.Coin.
+func (coin *Coin) AccountBased() bool {
+	return false
+}
+
+// BlockExplorerTransactionURLPrefix implements coin.Coin.
+func (coin *Coin) BlockExplorerTransactionURLPrefix() string {
+	return coin.blockExplorerTxPrefix
+}
+
+// toBTCAmount converts the amount to satoshis. Amounts which do not fit are capped, which can't
+// happen for valid bitcoin amounts.
+func toBTCAmount(amount coinpkg.Amount) btcutil.Amount {
+	satoshis, err := amount.Int64()
+	if err != nil {
+		return btcutil.MaxSatoshi
+	}
+	return btcutil.Amount(satoshis)
+}
+
+// ToUnit implements coin.Coin.
+func (coin *Coin) ToUnit(amount coinpkg.Amount) float64 {
+	return toBTCAmount(amount).ToUnit(btcutil.AmountBTC)
+}
+
 // FormatAmount implements coin.Coin.
-func (coin *Coin) FormatAmount(amount int64) string {
-	return strconv.FormatFloat(btcutil.Amount(amount).ToUnit(btcutil.AmountBTC), 'f',
+func (coin *Coin) FormatAmount(amount coinpkg.Amount) string {
+	return strconv.FormatFloat(coin.ToUnit(amount), 'f',
 		-int(btcutil.AmountBTC+8), 64) + " " + coin.Unit()
 }
 
 func formatAsCurrency(amount float64) string {
-	formatted := strconv.FormatFloat(amount, 'f', 2, 64)
-	position := strings.Index(formatted, ".") - 3
-	for position > 0 {
-		formatted = formatted[:position] + "'" + formatted[position:]
-		position = position - 3
-	}
-	return formatted
+	return coinpkg.FormatAsCurrency(amount)
 }
 
 // FormatAmountAsJSON implements coin.Coin.
-func (coin *Coin) FormatAmountAsJSON(amount int64) coinpkg.FormattedAmount {
-	float := btcutil.Amount(amount).ToUnit(btcutil.AmountBTC)
+func (coin *Coin) FormatAmountAsJSON(amount coinpkg.Amount) coinpkg.FormattedAmount {
+	float := coin.ToUnit(amount)
 	var conversions map[string]string
 	if coin.ratesUpdater != nil {
 		rates := coin.ratesUpdater.Last()
 		if rates != nil {
-			unit := coin.unit
-			if len(unit) == 4 && strings.HasPrefix(unit, "T") {
-				unit = unit[1:]
-			}
 			conversions = map[string]string{}
-			for key, value := range rates[unit] {
+			for key, value := range rates[coin.ratesUnit()] {
 				conversions[key] = formatAsCurrency(float * value)
 			}
 		}
@@ -168,6 +312,25 @@ func (coin *Coin) FormatAmountAsJSON(amount int64) coinpkg.FormattedAmount {
 	}
 }
 
+// ratesUnit returns the unit under which the exchange rates of the coin are listed. Testnet coins
+// are valued like their mainnet counterparts.
+func (coin *Coin) ratesUnit() string {
+	unit := coin.unit
+	if len(unit) >= 4 && strings.HasPrefix(unit, "T") {
+		unit = unit[1:]
+	}
+	return unit
+}
+
+// ExchangeRate implements coin.Coin.
+func (coin *Coin) ExchangeRate(fiat string) (float64, bool) {
+	if coin.ratesUpdater == nil {
+		return 0, false
+	}
+	rate, ok := coin.ratesUpdater.Last()[coin.ratesUnit()][fiat]
+	return rate, ok
+}
+
 // RatesUpdater returns current exchange rates.
 func (coin *Coin) RatesUpdater() coinpkg.RatesUpdater {
 	return coin.ratesUpdater
@@ -184,5 +347,5 @@ func (coin *Coin) Headers() *headers.Headers {
 }
 
 func (coin *Coin) String() string {
-	return coin.name
+	return coin.code
 }
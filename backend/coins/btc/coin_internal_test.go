@@ -17,7 +17,17 @@ package btc
 import (
 	"testing"
 
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFormatAsCurrency(t *testing.T) {
@@ -26,3 +36,97 @@ func TestFormatAsCurrency(t *testing.T) {
 	assert.Equal(t, "1'234.56", formatAsCurrency(1234.555))
 	assert.Equal(t, "12'345'678.90", formatAsCurrency(12345678.9))
 }
+
+type testRatesUpdater struct {
+	observable.Implementation
+	rates map[string]map[string]float64
+}
+
+func (updater *testRatesUpdater) Last() map[string]map[string]float64 {
+	return updater.rates
+}
+
+func TestResolveSendAmount(t *testing.T) {
+	updater := &testRatesUpdater{rates: map[string]map[string]float64{"BTC": {"USD": 5000}}}
+	coin := &Coin{unit: "TBTC", ratesUpdater: updater}
+	coin.SetFiatRateTolerance(0.02)
+
+	// Concrete amounts are not converted.
+	amount, err := NewSendAmount(1000)
+	require.NoError(t, err)
+	resolved, rate, err := coin.ResolveSendAmount(amount)
+	require.NoError(t, err)
+	require.Equal(t, amount, resolved)
+	require.Equal(t, float64(0), rate)
+
+	fiatAmount, err := NewSendAmountFiat(50, "USD")
+	require.NoError(t, err)
+	resolved, rate, err = coin.ResolveSendAmount(fiatAmount)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(1000000), resolved.Amount())
+	require.Equal(t, float64(5000), rate)
+
+	// The locked rate is used within the tolerance.
+	updater.rates["BTC"]["USD"] = 5080
+	resolved, rate, err = coin.ResolveSendAmount(fiatAmount.WithRate(5000))
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(1000000), resolved.Amount())
+	require.Equal(t, float64(5000), rate)
+
+	// Rejected if the rate moved too much.
+	updater.rates["BTC"]["USD"] = 5200
+	_, _, err = coin.ResolveSendAmount(fiatAmount.WithRate(5000))
+	_, ok := errp.Cause(err).(TxValidationError)
+	require.True(t, ok)
+
+	// No rate available.
+	_, _, err = coin.ResolveSendAmount(SendAmount{fiatAmount: 50, fiat: "CHF"})
+	_, ok = errp.Cause(err).(TxValidationError)
+	require.True(t, ok)
+
+	_, err = NewSendAmountFiat(0, "USD")
+	require.Error(t, err)
+}
+
+func TestCoinInterface(t *testing.T) {
+	var coin coinpkg.Coin = NewCoin("tltc", "Litecoin Testnet", "TLTC", &ltc.TestNet4Params, ".",
+		[]*rpc.ServerInfo{}, "http://explorer.litecointools.com/tx/", nil)
+	require.Equal(t, "tltc", coin.Code())
+	require.Equal(t, "Litecoin Testnet", coin.Name())
+	require.Equal(t, uint32(1), coin.Type())
+	require.False(t, coin.AccountBased())
+	require.Equal(t, "http://explorer.litecointools.com/tx/", coin.BlockExplorerTransactionURLPrefix())
+
+	amount := coinpkg.NewAmountFromInt64(123456789)
+	require.Equal(t, 1.23456789, coin.ToUnit(amount))
+	require.Equal(t, "1.23456789 TLTC", coin.FormatAmount(amount))
+	require.Equal(t, "1.23456789", coin.FormatAmountAsJSON(amount).Amount)
+	_, ok := coin.ExchangeRate("USD")
+	require.False(t, ok)
+}
+
+func TestCoinAddresses(t *testing.T) {
+	const (
+		legacy   = "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu"
+		cashAddr = "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"
+	)
+	bitcoinCash := NewCoin("bch", "Bitcoin Cash", "BCH", &bch.MainNetParams, ".",
+		[]*rpc.ServerInfo{}, "", nil)
+	for _, input := range []string{legacy, cashAddr} {
+		address, err := bitcoinCash.DecodeAddress(input)
+		require.NoError(t, err)
+		require.Equal(t, cashAddr, bitcoinCash.EncodeAddress(address))
+	}
+	_, err := bitcoinCash.DecodeAddress("DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L")
+	require.Error(t, err)
+	require.Equal(t, txscript.SigHashAll|bch.SigHashForkID, bitcoinCash.sigHashType())
+
+	dogecoin := NewCoin("doge", "Dogecoin", "DOGE", &doge.MainNetParams, ".",
+		[]*rpc.ServerInfo{}, "", nil)
+	address, err := dogecoin.DecodeAddress("DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L")
+	require.NoError(t, err)
+	require.Equal(t, "DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L", dogecoin.EncodeAddress(address))
+	_, err = dogecoin.DecodeAddress(legacy)
+	require.Error(t, err)
+	require.Equal(t, txscript.SigHashAll, dogecoin.sigHashType())
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+)
+
+// Name implements coin.Account.
+func (account *Account) Name() string {
+	return account.name
+}
+
+// TotalBalance implements coin.Account.
+func (account *Account) TotalBalance() coin.Amount {
+	return coin.NewAmountFromInt64(int64(account.BalanceBreakdown().Total()))
+}
+
+// ReceiveAddress implements coin.Account. It returns the first of GetUnusedReceiveAddresses().
+func (account *Account) ReceiveAddress() string {
+	return account.coin.EncodeAddress(account.GetUnusedReceiveAddresses()[0].Address)
+}
+
+// History implements coin.Account.
+func (account *Account) History() []*coin.Transfer {
+	transferTypes := map[transactions.TxType]coin.TransferType{
+		transactions.TxTypeReceive:  coin.TransferTypeReceive,
+		transactions.TxTypeSend:     coin.TransferTypeSend,
+		transactions.TxTypeSendSelf: coin.TransferTypeSendSelf,
+	}
+	result := []*coin.Transfer{}
+	for _, txInfo := range account.Transactions() {
+		transfer := &coin.Transfer{
+			TxID:             txInfo.Tx.TxHash().String(),
+			Type:             transferTypes[txInfo.Type],
+			Amount:           coin.NewAmountFromInt64(int64(txInfo.Amount)),
+			Timestamp:        txInfo.Timestamp,
+			NumConfirmations: txInfo.NumConfirmations,
+			Addresses:        txInfo.Addresses,
+		}
+		if txInfo.Fee != nil {
+			fee := coin.NewAmountFromInt64(int64(*txInfo.Fee))
+			transfer.Fee = &fee
+		}
+		result = append(result, transfer)
+	}
+	return result
+}
+
+// Send implements coin.Account. It sends the amount with the default fee target.
+func (account *Account) Send(recipientAddress string, amount coin.Amount) error {
+	sendAmount, err := NewSendAmount(toBTCAmount(amount))
+	if err != nil {
+		return err
+	}
+	return account.SendTx(recipientAddress, sendAmount, defaultFeeTarget, 0, nil)
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	// consolidationFeeTarget is the fee target of consolidation txs, which are not urgent.
+	consolidationFeeTarget = FeeTargetCodeEconomy
+	// minConsolidationOutputs is the minimum number of outputs worth merging.
+	minConsolidationOutputs = 2
+)
+
+// ConsolidationUTXO is the cost of spending one spendable output.
+type ConsolidationUTXO struct {
+	OutPoint wire.OutPoint
+	Address  string
+	Value    btcutil.Amount
+	// CostNow is the fee needed to spend the output at the default fee target.
+	CostNow btcutil.Amount
+	// CostLow is the fee needed to spend the output at the consolidation fee target.
+	CostLow btcutil.Amount
+	// Included is true if the output is merged by the consolidation tx. Outputs worth less than
+	// the cost of spending them are left alone.
+	Included bool
+}
+
+// Consolidation is the analysis of the spendable outputs of the account, with a proposal to merge
+// them into one output at a low fee rate. Frozen and otherwise unspendable outputs are not
+// considered.
+type Consolidation struct {
+	// UTXOs are sorted by value, smallest first.
+	UTXOs           []*ConsolidationUTXO
+	FeeRateNowPerKb btcutil.Amount
+	FeeRateLowPerKb btcutil.Amount
+	// Savings is the fee saved by spending the included outputs now at the low fee rate instead of
+	// later at the current one.
+	Savings btcutil.Amount
+	// Possible is false if there are not enough outputs worth merging. The fields below are only
+	// set if it is true.
+	Possible bool
+	Amount   btcutil.Amount
+	Fee      btcutil.Amount
+}
+
+// selectConsolidation analyses the cost of spending the outputs, given the virtual size of an input
+// and the fee rates. Outputs worth more than the cost of spending them at the low fee rate are
+// selected, but only if there are at least minConsolidationOutputs of them. Otherwise, the returned
+// selection is nil.
+func selectConsolidation(
+	outputs map[wire.OutPoint]*transactions.SpendableOutput,
+	inputVSize int,
+	feeRateNowPerKb btcutil.Amount,
+	feeRateLowPerKb btcutil.Amount,
+) (*Consolidation, map[wire.OutPoint]struct{}) {
+	result := &Consolidation{
+		UTXOs:           []*ConsolidationUTXO{},
+		FeeRateNowPerKb: feeRateNowPerKb,
+		FeeRateLowPerKb: feeRateLowPerKb,
+	}
+	selectedUTXOs := map[wire.OutPoint]struct{}{}
+	for outPoint, output := range outputs {
+		utxo := &ConsolidationUTXO{
+			OutPoint: outPoint,
+			Address:  output.Address,
+			Value:    btcutil.Amount(output.Value),
+			CostNow:  feeRateNowPerKb * btcutil.Amount(inputVSize) / 1000,
+			CostLow:  feeRateLowPerKb * btcutil.Amount(inputVSize) / 1000,
+		}
+		if utxo.Value > utxo.CostLow {
+			utxo.Included = true
+			selectedUTXOs[outPoint] = struct{}{}
+			result.Savings += utxo.CostNow - utxo.CostLow
+		}
+		result.UTXOs = append(result.UTXOs, utxo)
+	}
+	sort.Slice(result.UTXOs, func(i, j int) bool {
+		if result.UTXOs[i].Value == result.UTXOs[j].Value {
+			return result.UTXOs[i].OutPoint.String() < result.UTXOs[j].OutPoint.String()
+		}
+		return result.UTXOs[i].Value < result.UTXOs[j].Value
+	})
+	if len(selectedUTXOs) < minConsolidationOutputs {
+		return result, nil
+	}
+	return result, selectedUTXOs
+}
+
+// setProposal records the result of proposing the consolidation tx. If the merged outputs do not
+// cover the fee, the consolidation is not possible, which is not an error.
+func (consolidation *Consolidation) setProposal(
+	amount btcutil.Amount, fee btcutil.Amount, err error) error {
+	if errp.Cause(err) == maketx.ErrInsufficientFunds {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	consolidation.Possible = true
+	consolidation.Amount = amount
+	consolidation.Fee = fee
+	return nil
+}
+
+// checkConsolidationOutPoints checks that the outputs to merge are all still spendable, and that
+// there are enough of them.
+func checkConsolidationOutPoints(
+	outPoints map[wire.OutPoint]struct{},
+	spendableOutputs map[wire.OutPoint]*transactions.SpendableOutput,
+) error {
+	if len(outPoints) < minConsolidationOutputs {
+		return errp.WithStack(TxValidationError("not enough outputs to consolidate"))
+	}
+	for outPoint := range outPoints {
+		if _, ok := spendableOutputs[outPoint]; !ok {
+			return errp.WithStack(TxValidationError(
+				"the outputs changed, please review the consolidation again"))
+		}
+	}
+	return nil
+}
+
+// unusedChangeAddress returns the address to consolidate into.
+func (account *Account) unusedChangeAddress() string {
+	defer account.RLock()()
+	return account.changeAddresses.GetUnused()[0].EncodeAddress()
+}
+
+// Consolidation analyses the cost of spending the spendable outputs now and at a low fee rate, and
+// proposes a tx merging them into an unused change address at the economy fee target.
+func (account *Account) Consolidation() (*Consolidation, error) {
+	feeRateNowPerKb, err := account.feeRatePerKb(defaultFeeTarget, 0)
+	if err != nil {
+		return nil, err
+	}
+	feeRateLowPerKb, err := account.feeRatePerKb(consolidationFeeTarget, 0)
+	if err != nil {
+		return nil, err
+	}
+	result, selectedUTXOs := selectConsolidation(
+		account.transactions.SpendableOutputs(),
+		maketx.InputVSize(account.signingConfiguration),
+		feeRateNowPerKb,
+		feeRateLowPerKb,
+	)
+	if selectedUTXOs == nil {
+		return result, nil
+	}
+	amount, fee, _, err := account.TxProposal(
+		account.unusedChangeAddress(), NewSendAmountAll(), consolidationFeeTarget, 0, selectedUTXOs)
+	if err := result.setProposal(amount, fee, err); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Consolidate signs and broadcasts a tx merging the given outputs, which are the ones included in
+// the consolidation reviewed by the user, see Consolidation(). The outputs are not selected again,
+// so that only what the user reviewed is spent.
+func (account *Account) Consolidate(outPoints map[wire.OutPoint]struct{}) error {
+	if err := checkConsolidationOutPoints(
+		outPoints, account.transactions.SpendableOutputs()); err != nil {
+		return err
+	}
+	return account.SendTx(
+		account.unusedChangeAddress(), NewSendAmountAll(), consolidationFeeTarget, 0, outPoints)
+}
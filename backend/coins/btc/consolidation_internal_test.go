@@ -0,0 +1,138 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testFeeRateNowPerKb = btcutil.Amount(10000)
+	testFeeRateLowPerKb = btcutil.Amount(1000)
+)
+
+func spendableOutputs(values ...btcutil.Amount) map[wire.OutPoint]*transactions.SpendableOutput {
+	outputs := map[wire.OutPoint]*transactions.SpendableOutput{}
+	for index, value := range values {
+		outPoint := wire.OutPoint{Hash: chainhash.Hash{byte(index)}, Index: uint32(index)}
+		outputs[outPoint] = &transactions.SpendableOutput{
+			TxOut:   wire.NewTxOut(int64(value), []byte{0x51}),
+			Address: "address",
+		}
+	}
+	return outputs
+}
+
+func TestSelectConsolidation(t *testing.T) {
+	configuration, _ := addressesTest.NewAddressChain()
+	inputVSize := maketx.InputVSize(configuration)
+	costNow := testFeeRateNowPerKb * btcutil.Amount(inputVSize) / 1000
+	costLow := testFeeRateLowPerKb * btcutil.Amount(inputVSize) / 1000
+
+	// Outputs not worth more than the cost of spending them are not included.
+	consolidation, selectedUTXOs := selectConsolidation(
+		spendableOutputs(100000, costLow, costLow+1), inputVSize,
+		testFeeRateNowPerKb, testFeeRateLowPerKb)
+	require.Len(t, consolidation.UTXOs, 3)
+	require.Equal(t, costLow, consolidation.UTXOs[0].Value)
+	require.False(t, consolidation.UTXOs[0].Included)
+	require.Equal(t, costLow+1, consolidation.UTXOs[1].Value)
+	require.True(t, consolidation.UTXOs[1].Included)
+	require.Equal(t, btcutil.Amount(100000), consolidation.UTXOs[2].Value)
+	require.True(t, consolidation.UTXOs[2].Included)
+	for _, utxo := range consolidation.UTXOs {
+		require.Equal(t, costNow, utxo.CostNow)
+		require.Equal(t, costLow, utxo.CostLow)
+	}
+	require.Equal(t, 2*(costNow-costLow), consolidation.Savings)
+	require.Len(t, selectedUTXOs, 2)
+	require.NotContains(t, selectedUTXOs, consolidation.UTXOs[0].OutPoint)
+
+	// Less than minConsolidationOutputs outputs are worth merging.
+	consolidation, selectedUTXOs = selectConsolidation(
+		spendableOutputs(100000, costLow), inputVSize, testFeeRateNowPerKb, testFeeRateLowPerKb)
+	require.Len(t, consolidation.UTXOs, 2)
+	require.Nil(t, selectedUTXOs)
+	consolidation, selectedUTXOs = selectConsolidation(
+		spendableOutputs(), inputVSize, testFeeRateNowPerKb, testFeeRateLowPerKb)
+	require.Empty(t, consolidation.UTXOs)
+	require.Nil(t, selectedUTXOs)
+}
+
+func TestConsolidationProposal(t *testing.T) {
+	log := logging.Get().WithGroup("consolidation_test")
+	configuration, _ := addressesTest.NewAddressChain()
+	inputVSize := maketx.InputVSize(configuration)
+	costLow := testFeeRateLowPerKb * btcutil.Amount(inputVSize) / 1000
+	propose := func(outputs map[wire.OutPoint]*transactions.SpendableOutput) *Consolidation {
+		consolidation, selectedUTXOs := selectConsolidation(
+			outputs, inputVSize, testFeeRateNowPerKb, testFeeRateLowPerKb)
+		require.Len(t, selectedUTXOs, len(outputs))
+		wireUTXOs := map[wire.OutPoint]*wire.TxOut{}
+		for outPoint, output := range outputs {
+			wireUTXOs[outPoint] = output.TxOut
+		}
+		txProposal, err := maketx.NewTxSpendAll(
+			nil, configuration, wireUTXOs, []byte{0x51}, testFeeRateLowPerKb, log)
+		if err != nil {
+			require.NoError(t, consolidation.setProposal(0, 0, err))
+			return consolidation
+		}
+		require.NoError(t, consolidation.setProposal(txProposal.Amount, txProposal.Fee, nil))
+		return consolidation
+	}
+
+	// The included outputs barely cover their own cost, but not the rest of the tx.
+	consolidation := propose(spendableOutputs(costLow+1, costLow+1))
+	require.False(t, consolidation.Possible)
+	require.Equal(t, btcutil.Amount(0), consolidation.Amount)
+
+	consolidation = propose(spendableOutputs(100000, 200000))
+	require.True(t, consolidation.Possible)
+	require.Equal(t, btcutil.Amount(300000), consolidation.Amount+consolidation.Fee)
+
+	// Other errors are returned.
+	require.Error(t, (&Consolidation{}).setProposal(0, 0, errors.New("error")))
+}
+
+func TestCheckConsolidationOutPoints(t *testing.T) {
+	outputs := spendableOutputs(1000, 2000, 3000)
+	outPoints := map[wire.OutPoint]struct{}{
+		{Hash: chainhash.Hash{0}, Index: 0}: {},
+		{Hash: chainhash.Hash{1}, Index: 1}: {},
+	}
+	require.NoError(t, checkConsolidationOutPoints(outPoints, outputs))
+
+	// A reviewed output was spent in the meantime.
+	_, ok := errp.Cause(
+		checkConsolidationOutPoints(outPoints, spendableOutputs(1000))).(TxValidationError)
+	require.True(t, ok)
+
+	// Not enough outputs.
+	delete(outPoints, wire.OutPoint{Hash: chainhash.Hash{1}, Index: 1})
+	_, ok = errp.Cause(checkConsolidationOutPoints(outPoints, outputs)).(TxValidationError)
+	require.True(t, ok)
+}
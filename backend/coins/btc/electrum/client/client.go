@@ -25,36 +25,57 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/semver"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	clientVersion         = "0.0.1"
-	clientProtocolVersion = "1.2"
+	clientVersion = "0.0.1"
+	// clientProtocolVersionMin and clientProtocolVersionMax are the range of protocol versions
+	// offered to the server in server.version. The server picks the highest one it supports.
+	clientProtocolVersionMin = "1.2"
+	clientProtocolVersionMax = "1.4.2"
+)
+
+var (
+	// protocolVersionCheckpoints is the first protocol version supporting header checkpoint proofs.
+	protocolVersionCheckpoints = semver.NewSemVer(1, 4, 0)
+	// protocolVersionUnsubscribe is the first protocol version supporting
+	// blockchain.scripthash.unsubscribe.
+	protocolVersionUnsubscribe = semver.NewSemVer(1, 4, 2)
 )
 
 // ElectrumClient is a high level API access to an ElectrumX server.
 // See https://github.com/kyuupichan/electrumx/blob/159db3f8e70b2b2cbb8e8cd01d1e9df3fe83828f/docs/PROTOCOL.rst.
 type ElectrumClient struct {
 	rpc rpc.Client
+	net *chaincfg.Params
 
 	scriptHashNotificationCallbacks     map[string]func(string) error
 	scriptHashNotificationCallbacksLock sync.RWMutex
 
+	// protocolVersion is the protocol version negotiated with the current server.
+	protocolVersion     *semver.SemVer
+	protocolVersionLock locker.Locker
+
 	close bool
 	log   *logrus.Entry
 }
 
-// NewElectrumClient creates a new Electrum client.
-func NewElectrumClient(rpcClient rpc.Client, log *logrus.Entry) *ElectrumClient {
+// NewElectrumClient creates a new Electrum client. If net is not nil, servers whose genesis block
+// does not match the one of the network are refused.
+func NewElectrumClient(rpcClient rpc.Client, net *chaincfg.Params, log *logrus.Entry) *ElectrumClient {
 	electrumClient := &ElectrumClient{
 		rpc: rpcClient,
+		net: net,
 		scriptHashNotificationCallbacks: map[string]func(string) error{},
 		log: log.WithField("group", "client"),
 	}
@@ -96,9 +117,11 @@ func NewElectrumClient(rpcClient rpc.Client, log *logrus.Entry) *ElectrumClient
 			return err
 		}
 		log.WithField("server-version", version).Debug("electrumx server version")
-		return nil
+		return electrumClient.checkGenesisHash()
 	})
-	rpcClient.RegisterHeartbeat("server.version", clientVersion, clientProtocolVersion)
+	// server.version must only be sent once per session, so server.ping is used to keep the
+	// connection alive.
+	rpcClient.RegisterHeartbeat("server.ping")
 
 	return electrumClient
 }
@@ -114,6 +137,17 @@ func (client *ElectrumClient) ConnectionStatus() blockchain.Status {
 	panic(errp.New("Connection status could not be determined"))
 }
 
+// ServerInfo returns the info of the server the client is currently connected to, or nil if it is
+// not connected.
+func (client *ElectrumClient) ServerInfo() *rpc.ServerInfo {
+	return client.rpc.ServerInfo()
+}
+
+// Metrics returns the request metrics of the underlying RPC client.
+func (client *ElectrumClient) Metrics() rpc.Metrics {
+	return client.rpc.Metrics()
+}
+
 // RegisterOnConnectionStatusChangedEvent registers an event that forwards the connection status from
 // the underlying client to the given callback.
 func (client *ElectrumClient) RegisterOnConnectionStatusChangedEvent(onConnectionStatusChanged func(blockchain.Status)) {
@@ -151,12 +185,55 @@ func (version *ServerVersion) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-// ServerVersion does the server.version() RPC call.
-// https://github.com/kyuupichan/electrumx/blob/159db3f8e70b2b2cbb8e8cd01d1e9df3fe83828f/docs/PROTOCOL.rst#serverversion
+// parseProtocolVersion parses protocol versions like "1.4" or "1.4.2".
+func parseProtocolVersion(version string) (*semver.SemVer, error) {
+	if strings.Count(version, ".") == 1 {
+		version += ".0"
+	}
+	return semver.NewSemVerFromString(version)
+}
+
+// ServerVersion does the server.version() RPC call, negotiating the protocol version used for the
+// rest of the session.
+// https://github.com/kyuupichan/electrumx/blob/1.8.7/docs/protocol-methods.rst#serverversion
 func (client *ElectrumClient) ServerVersion() (*ServerVersion, error) {
 	response := &ServerVersion{}
-	err := client.rpc.MethodSync(response, "server.version", clientVersion, clientProtocolVersion)
-	return response, err
+	err := client.rpc.MethodSync(response, "server.version", clientVersion,
+		[]string{clientProtocolVersionMin, clientProtocolVersionMax})
+	if err != nil {
+		return nil, err
+	}
+	protocolVersion, err := parseProtocolVersion(response.ProtocolVersion)
+	if err != nil {
+		return nil, errp.WithContext(errp.Wrap(err, "Unexpected protocol version"),
+			errp.Context{"protocol-version": response.ProtocolVersion})
+	}
+	defer client.protocolVersionLock.Lock()()
+	client.protocolVersion = protocolVersion
+	return response, nil
+}
+
+// supports returns true if the protocol version negotiated with the current server is at least the
+// given version.
+func (client *ElectrumClient) supports(version *semver.SemVer) bool {
+	defer client.protocolVersionLock.RLock()()
+	return client.protocolVersion != nil && client.protocolVersion.AtLeast(version)
+}
+
+// checkGenesisHash refuses the server if it serves a different chain than the one of the client.
+func (client *ElectrumClient) checkGenesisHash() error {
+	if client.net == nil {
+		return nil
+	}
+	features, err := client.ServerFeatures()
+	if err != nil {
+		return err
+	}
+	if features.GenesisHash != client.net.GenesisHash.String() {
+		return errp.WithContext(errp.New("The server is on the wrong chain"),
+			errp.Context{"net": client.net.Name, "genesis-hash": features.GenesisHash})
+	}
+	return nil
 }
 
 // ServerFeatures is returned by ServerFeatures().
@@ -178,6 +255,25 @@ type Balance struct {
 	Unconfirmed int64 `json:"unconfirmed"`
 }
 
+// ScriptHashUnsubscribe does the blockchain.scripthash.unsubscribe() RPC call and removes the
+// callback installed by ScriptHashSubscribe(). If the server does not support unsubscribing,
+// notifications for the script hash are ignored instead.
+// https://github.com/kyuupichan/electrumx/blob/1.8.7/docs/protocol-methods.rst#blockchainscripthashunsubscribe
+func (client *ElectrumClient) ScriptHashUnsubscribe(scriptHashHex blockchain.ScriptHashHex) {
+	client.scriptHashNotificationCallbacksLock.Lock()
+	delete(client.scriptHashNotificationCallbacks, string(scriptHashHex))
+	client.scriptHashNotificationCallbacksLock.Unlock()
+	client.rpc.RemoveSubscription("blockchain.scripthash.subscribe", string(scriptHashHex))
+	if !client.supports(protocolVersionUnsubscribe) {
+		return
+	}
+	client.rpc.Method(
+		func([]byte) error { return nil },
+		func() func() { return func() {} },
+		"blockchain.scripthash.unsubscribe",
+		string(scriptHashHex))
+}
+
 // ScriptHashGetBalance does the blockchain.scripthash.get_balance() RPC call.
 // https://github.com/kyuupichan/electrumx/blob/159db3f8e70b2b2cbb8e8cd01d1e9df3fe83828f/docs/PROTOCOL.rst#blockchainscripthashget_balance
 func (client *ElectrumClient) ScriptHashGetBalance(
@@ -200,14 +296,26 @@ func (client *ElectrumClient) ScriptHashGetBalance(
 		scriptHashHex)
 }
 
-// ScriptHashGetHistory does the blockchain.scripthash.get_history() RPC call.
+// isHistoryTooLarge returns true if the error is the server refusing to send a history because of
+// its size. ElectrumX either refuses to compute it ("excessive resource usage"), or refuses to send
+// it ("response too large").
+func isHistoryTooLarge(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "too large") ||
+		strings.Contains(message, "excessive resource usage")
+}
+
+// ScriptHashGetHistory does the blockchain.scripthash.get_history() RPC call. The request is
+// batched with other requests. If the server refuses to return the history because it is too large,
+// blockchain.ErrHistoryTooLarge is passed to the failure callback.
 // https://github.com/kyuupichan/electrumx/blob/159db3f8e70b2b2cbb8e8cd01d1e9df3fe83828f/docs/PROTOCOL.rst#blockchainscripthashget_history
 func (client *ElectrumClient) ScriptHashGetHistory(
 	scriptHashHex blockchain.ScriptHashHex,
 	success func(blockchain.TxHistory) error,
+	failure func(error),
 	cleanup func(),
 ) {
-	client.rpc.Method(
+	client.rpc.MethodBatched(
 		func(responseBytes []byte) error {
 			txs := blockchain.TxHistory{}
 			if err := json.Unmarshal(responseBytes, &txs); err != nil {
@@ -216,6 +324,13 @@ func (client *ElectrumClient) ScriptHashGetHistory(
 			}
 			return success(txs)
 		},
+		func(err error) {
+			if isHistoryTooLarge(err) {
+				failure(errp.WithStack(blockchain.ErrHistoryTooLarge))
+				return
+			}
+			failure(err)
+		},
 		func() func() {
 			return cleanup
 		},
@@ -262,14 +377,14 @@ func parseTX(rawTXHex string, log *logrus.Entry) (*wire.MsgTx, error) {
 	return tx, nil
 }
 
-// TransactionGet downloads a transaction.
+// TransactionGet downloads a transaction. The request is batched with other requests.
 // See https://github.com/kyuupichan/electrumx/blob/159db3f8e70b2b2cbb8e8cd01d1e9df3fe83828f/docs/PROTOCOL.rst#blockchaintransactionget
 func (client *ElectrumClient) TransactionGet(
 	txHash chainhash.Hash,
 	success func(*wire.MsgTx) error,
 	cleanup func(),
 ) {
-	client.rpc.Method(
+	client.rpc.MethodBatched(
 		func(responseBytes []byte) error {
 			var rawTXHex string
 			if err := json.Unmarshal(responseBytes, &rawTXHex); err != nil {
@@ -281,6 +396,7 @@ func (client *ElectrumClient) TransactionGet(
 			}
 			return success(tx)
 		},
+		nil,
 		func() func() {
 			return cleanup
 		},
@@ -353,22 +469,28 @@ func (txHash *TXHash) UnmarshalJSON(jsonBytes []byte) error {
 	return nil
 }
 
-// UTXO is the data returned by the listunspent RPC call.
-type UTXO struct {
-	TXPos  int    `json:"tx_pos"`
-	Value  int64  `json:"value"`
-	TXHash string `json:"tx_hash"`
-	Height int    `json:"height"`
-}
-
-// ScriptHashListUnspent does the blockchain.address.listunspent() RPC call.
+// ScriptHashListUnspent does the blockchain.scripthash.listunspent() RPC call.
 // https://github.com/kyuupichan/electrumx/blob/159db3f8e70b2b2cbb8e8cd01d1e9df3fe83828f/docs/PROTOCOL.rst#blockchainscripthashlistunspent
-func (client *ElectrumClient) ScriptHashListUnspent(scriptHashHex string) ([]*UTXO, error) {
-	response := []*UTXO{}
-	if err := client.rpc.MethodSync(&response, "blockchain.scripthash.listunspent", scriptHashHex); err != nil {
-		return nil, errp.WithStack(err)
-	}
-	return response, nil
+func (client *ElectrumClient) ScriptHashListUnspent(
+	scriptHashHex blockchain.ScriptHashHex,
+	success func([]*blockchain.UTXO) error,
+	failure func(error),
+	cleanup func(),
+) {
+	client.rpc.MethodBatched(
+		func(responseBytes []byte) error {
+			utxos := []*blockchain.UTXO{}
+			if err := json.Unmarshal(responseBytes, &utxos); err != nil {
+				return errp.WithStack(err)
+			}
+			return success(utxos)
+		},
+		failure,
+		func() func() {
+			return cleanup
+		},
+		"blockchain.scripthash.listunspent",
+		string(scriptHashHex))
 }
 
 // TransactionBroadcast does the blockchain.transaction.broadcast() RPC call.
@@ -463,12 +585,36 @@ func (client *ElectrumClient) Headers(
 	success func(headers []*wire.BlockHeader, max int) error,
 	cleanup func(),
 ) {
+	client.HeadersWithCheckpoint(
+		startHeight, count, 0,
+		func(headers []*wire.BlockHeader, max int, _ *blockchain.CheckpointProof) error {
+			return success(headers, max)
+		},
+		cleanup,
+	)
+}
+
+// HeadersWithCheckpoint is like Headers(), but additionally requests a proof that the last returned
+// header is part of the chain committed to by the checkpoint at cpHeight. If cpHeight is 0 or the
+// server does not support checkpoint proofs, the proof passed to the success callback is nil.
+// See https://github.com/kyuupichan/electrumx/blob/1.8.7/docs/protocol-methods.rst#blockchainblockheaders
+func (client *ElectrumClient) HeadersWithCheckpoint(
+	startHeight int, count int, cpHeight int,
+	success func(headers []*wire.BlockHeader, max int, proof *blockchain.CheckpointProof) error,
+	cleanup func(),
+) {
+	params := []interface{}{startHeight, count}
+	if cpHeight != 0 && client.supports(protocolVersionCheckpoints) {
+		params = append(params, cpHeight)
+	}
 	client.rpc.Method(
 		func(responseBytes []byte) error {
 			var response struct {
-				Hex   string `json:"hex"`
-				Count int    `json:"count"`
-				Max   int    `json:"max"`
+				Hex    string              `json:"hex"`
+				Count  int                 `json:"count"`
+				Max    int                 `json:"max"`
+				Root   *blockchain.TXHash  `json:"root"`
+				Branch []blockchain.TXHash `json:"branch"`
 			}
 			if err := json.Unmarshal(responseBytes, &response); err != nil {
 				return errp.WithStack(err)
@@ -483,23 +629,61 @@ func (client *ElectrumClient) Headers(
 					response.Count,
 					len(headers))
 			}
-			return success(headers, response.Max)
+			var proof *blockchain.CheckpointProof
+			if response.Root != nil {
+				branch := make([]chainhash.Hash, len(response.Branch))
+				for i, hash := range response.Branch {
+					branch[i] = hash.Hash()
+				}
+				proof = &blockchain.CheckpointProof{Root: response.Root.Hash(), Branch: branch}
+			}
+			return success(headers, response.Max, proof)
 		},
 		func() func() {
 			return cleanup
 		},
 		"blockchain.block.headers",
-		startHeight, count)
+		params...)
+}
+
+// FeeHistogram does the mempool.get_fee_histogram() RPC call.
+// https://github.com/kyuupichan/electrumx/blob/1.8.7/docs/protocol-methods.rst#mempoolget_fee_histogram
+func (client *ElectrumClient) FeeHistogram(
+	success func(blockchain.FeeHistogram) error,
+	cleanup func(),
+) {
+	client.rpc.Method(
+		func(responseBytes []byte) error {
+			var response [][2]float64
+			if err := json.Unmarshal(responseBytes, &response); err != nil {
+				return errp.Wrap(err, "Failed to unmarshal JSON")
+			}
+			histogram := make(blockchain.FeeHistogram, len(response))
+			for i, entry := range response {
+				histogram[i] = &blockchain.FeeHistogramEntry{
+					FeeRatePerVByte: entry[0],
+					VSize:           int64(entry[1]),
+				}
+			}
+			return success(histogram)
+		},
+		func() func() {
+			return cleanup
+		},
+		"mempool.get_fee_histogram")
 }
 
-// GetMerkle does the blockchain.transaction.get_merkle() RPC call. See
+// GetMerkle does the blockchain.transaction.get_merkle() RPC call. The request is batched with other
+// requests. If the server fails or returns the proof for a different height, for example because
+// the block at the requested height was orphaned, the error is passed to the failure callback. See
 // https://github.com/kyuupichan/electrumx/blob/1.3/docs/protocol-methods.rst#blockchaintransactionget_merkle
 func (client *ElectrumClient) GetMerkle(
 	txHash chainhash.Hash, height int,
 	success func(merkle []blockchain.TXHash, pos int) error,
+	failure func(error),
 	cleanup func(),
 ) {
-	client.rpc.Method(
+	client.rpc.MethodBatched(
 		func(responseBytes []byte) error {
 			var response struct {
 				Merkle      []blockchain.TXHash `json:"merkle"`
@@ -510,10 +694,12 @@ func (client *ElectrumClient) GetMerkle(
 				return errp.WithStack(err)
 			}
 			if response.BlockHeight != height {
-				return errp.Newf("height should be %d, but got %d", height, response.BlockHeight)
+				failure(errp.Newf("height should be %d, but got %d", height, response.BlockHeight))
+				return nil
 			}
 			return success(response.Merkle, response.Pos)
 		},
+		failure,
 		func() func() {
 			return cleanup
 		},
@@ -0,0 +1,199 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
+)
+
+const (
+	// fixtureAddresses is the number of addresses of the wallet served by walletBackend.
+	fixtureAddresses = 200
+	// fixtureTxsPerAddress is the number of txs in the history of each address.
+	fixtureTxsPerAddress = 5
+)
+
+// walletBackend is a server with the histories and txs of a wallet with many addresses. Each
+// request or batch request is answered after the latency, one after the other, to simulate the
+// round trip to a remote server.
+type walletBackend struct {
+	latency   time.Duration
+	histories map[string]blockchain.TxHistory
+	rawTxs    map[string]string
+}
+
+func newWalletBackend(latency time.Duration) *walletBackend {
+	backend := &walletBackend{
+		latency:   latency,
+		histories: map[string]blockchain.TxHistory{},
+		rawTxs:    map[string]string{},
+	}
+	for i := 0; i < fixtureAddresses; i++ {
+		history := blockchain.TxHistory{}
+		for j := 0; j < fixtureTxsPerAddress; j++ {
+			tx := wire.NewMsgTx(wire.TxVersion)
+			tx.AddTxIn(wire.NewTxIn(
+				&wire.OutPoint{Hash: chainhash.HashH([]byte(fmt.Sprintf("%d-%d", i, j)))}, nil, nil))
+			tx.AddTxOut(wire.NewTxOut(1000, []byte{}))
+			rawTx := &bytes.Buffer{}
+			if err := tx.Serialize(rawTx); err != nil {
+				panic(err)
+			}
+			backend.rawTxs[tx.TxHash().String()] = hex.EncodeToString(rawTx.Bytes())
+			history = append(history,
+				&blockchain.TxInfo{TXHash: blockchain.TXHash(tx.TxHash()), Height: 100 + j})
+		}
+		backend.histories[string(fixtureScriptHashHex(i))] = history
+	}
+	return backend
+}
+
+// fixtureScriptHashHex returns the script hash of the address with the given index.
+func fixtureScriptHashHex(index int) blockchain.ScriptHashHex {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("address %d", index)))
+	return blockchain.ScriptHashHex(hex.EncodeToString(hash[:]))
+}
+
+func (backend *walletBackend) ServerInfo() *rpc.ServerInfo {
+	return &rpc.ServerInfo{Server: "wallet"}
+}
+
+type walletRequest struct {
+	ID     int           `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+func (backend *walletBackend) reply(request *walletRequest) map[string]interface{} {
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	switch request.Method {
+	case "server.version":
+		reply["result"] = []string{"ElectrumX 1.8.7", "1.4"}
+	case "blockchain.scripthash.get_history":
+		reply["result"] = backend.histories[request.Params[0].(string)]
+	case "blockchain.transaction.get":
+		reply["result"] = backend.rawTxs[request.Params[0].(string)]
+	default:
+		reply["result"] = nil
+	}
+	return reply
+}
+
+func (backend *walletBackend) EstablishConnection() (io.ReadWriteCloser, error) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			time.Sleep(backend.latency)
+			var response interface{}
+			if line[0] == '[' {
+				requests := []*walletRequest{}
+				if err := json.Unmarshal(line, &requests); err != nil {
+					panic(err)
+				}
+				replies := []interface{}{}
+				for _, request := range requests {
+					replies = append(replies, backend.reply(request))
+				}
+				response = replies
+			} else {
+				request := &walletRequest{}
+				if err := json.Unmarshal(line, request); err != nil {
+					panic(err)
+				}
+				response = backend.reply(request)
+			}
+			responseBytes, err := json.Marshal(response)
+			if err != nil {
+				panic(err)
+			}
+			if _, err := serverConn.Write(append(responseBytes, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+	return clientConn, nil
+}
+
+// benchmarkWalletSync fetches the histories of all addresses of the fixture wallet and downloads
+// all txs in them, like the initial sync of an account, from a server with a latency of 1ms per
+// request or batch. If batchConfig is nil, the default batch config is used.
+func benchmarkWalletSync(b *testing.B, batchConfig *rpc.BatchConfig) {
+	log := logging.Get().WithGroup("client_test")
+	backend := newWalletBackend(time.Millisecond)
+	rpcClient := jsonrpc.NewRPCClient([]rpc.Backend{backend}, log)
+	defer rpcClient.Close()
+	if batchConfig != nil {
+		rpcClient.ConfigureBatching(*batchConfig)
+	}
+	electrumClient := client.NewElectrumClient(rpcClient, nil, log)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var wg sync.WaitGroup
+		wg.Add(fixtureAddresses * (1 + fixtureTxsPerAddress))
+		for i := 0; i < fixtureAddresses; i++ {
+			electrumClient.ScriptHashGetHistory(
+				fixtureScriptHashHex(i),
+				func(history blockchain.TxHistory) error {
+					for _, txInfo := range history {
+						electrumClient.TransactionGet(
+							txInfo.TXHash.Hash(),
+							func(*wire.MsgTx) error { return nil },
+							wg.Done)
+					}
+					return nil
+				},
+				func(err error) { panic(err) },
+				wg.Done)
+		}
+		wg.Wait()
+	}
+	b.StopTimer()
+	metrics := rpcClient.Metrics()
+	b.Logf("requests: %d, batches: %d, average latency: %v",
+		metrics.Requests, metrics.Batches, metrics.AverageLatency())
+}
+
+// BenchmarkWalletSync and BenchmarkWalletSyncUnbatched compare the sync of a wallet with 200
+// addresses and 1000 txs with the default batch config and with every request sent on its own.
+func BenchmarkWalletSync(b *testing.B) {
+	benchmarkWalletSync(b, nil)
+}
+
+func BenchmarkWalletSyncUnbatched(b *testing.B) {
+	benchmarkWalletSync(b, &rpc.BatchConfig{Window: 0, MaxBatchSize: 1, MaxInFlight: 1 << 20})
+}
@@ -15,10 +15,20 @@
 package client_test
 
 import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
 	"github.com/stretchr/testify/require"
 )
 
@@ -47,3 +57,158 @@ func TestStatus(t *testing.T) {
 		"9783fa8a2f1c89652022e0bb435f302ee8b856961dd979ee083435c65384f314",
 		history.Status())
 }
+
+// rejectingBackend is a server which rejects every broadcast, like a server which does not accept a
+// tx whose inputs are already spent.
+type rejectingBackend struct{}
+
+func (backend *rejectingBackend) ServerInfo() *rpc.ServerInfo {
+	return &rpc.ServerInfo{Server: "rejecting"}
+}
+
+func (backend *rejectingBackend) EstablishConnection() (io.ReadWriteCloser, error) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			request := &struct {
+				ID     int    `json:"id"`
+				Method string `json:"method"`
+			}{}
+			if err := json.Unmarshal(line, request); err != nil {
+				panic(err)
+			}
+			reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+			switch request.Method {
+			case "server.version":
+				reply["result"] = []string{"ElectrumX 1.8.7", "1.4"}
+			case "blockchain.transaction.broadcast":
+				reply["error"] = map[string]interface{}{
+					"code":    1,
+					"message": "the transaction was rejected by network rules.\n\nmissing-inputs",
+				}
+			default:
+				reply["result"] = nil
+			}
+			replyBytes, err := json.Marshal(reply)
+			if err != nil {
+				panic(err)
+			}
+			if _, err := serverConn.Write(append(replyBytes, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+	return clientConn, nil
+}
+
+func TestTransactionBroadcastRejected(t *testing.T) {
+	log := logging.Get().WithGroup("client_test")
+	rpcClient := jsonrpc.NewRPCClient([]rpc.Backend{&rejectingBackend{}}, log)
+	defer rpcClient.Close()
+	electrumClient := client.NewElectrumClient(rpcClient, nil, log)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.HashH([]byte("spent"))}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{}))
+	// A rejection is returned, also when the tx is broadcast again.
+	for i := 0; i < 2; i++ {
+		err := electrumClient.TransactionBroadcast(tx)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "missing-inputs")
+	}
+}
+
+// movedTxBackend is a server on which every tx was moved to height 12 by a reorg.
+type movedTxBackend struct{}
+
+func (backend *movedTxBackend) ServerInfo() *rpc.ServerInfo {
+	return &rpc.ServerInfo{Server: "moved"}
+}
+
+func (backend *movedTxBackend) EstablishConnection() (io.ReadWriteCloser, error) {
+	type jsonRequest struct {
+		ID     int    `json:"id"`
+		Method string `json:"method"`
+	}
+	reply := func(request *jsonRequest) map[string]interface{} {
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		switch request.Method {
+		case "server.version":
+			reply["result"] = []string{"ElectrumX 1.8.7", "1.4"}
+		case "blockchain.transaction.get_merkle":
+			reply["result"] = map[string]interface{}{
+				"merkle":       []string{},
+				"pos":          0,
+				"block_height": 12,
+			}
+		default:
+			reply["result"] = nil
+		}
+		return reply
+	}
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var response interface{}
+			if line[0] == '[' {
+				requests := []*jsonRequest{}
+				if err := json.Unmarshal(line, &requests); err != nil {
+					panic(err)
+				}
+				replies := []interface{}{}
+				for _, request := range requests {
+					replies = append(replies, reply(request))
+				}
+				response = replies
+			} else {
+				request := &jsonRequest{}
+				if err := json.Unmarshal(line, request); err != nil {
+					panic(err)
+				}
+				response = reply(request)
+			}
+			responseBytes, err := json.Marshal(response)
+			if err != nil {
+				panic(err)
+			}
+			if _, err := serverConn.Write(append(responseBytes, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+	return clientConn, nil
+}
+
+func TestGetMerkleHeightMismatch(t *testing.T) {
+	log := logging.Get().WithGroup("client_test")
+	rpcClient := jsonrpc.NewRPCClient([]rpc.Backend{&movedTxBackend{}}, log)
+	defer rpcClient.Close()
+	electrumClient := client.NewElectrumClient(rpcClient, nil, log)
+
+	failed := make(chan error, 1)
+	electrumClient.GetMerkle(
+		chainhash.HashH([]byte("tx")), 10,
+		func([]blockchain.TXHash, int) error {
+			require.Fail(t, "the proof is for a different height")
+			return nil
+		},
+		func(err error) { failed <- err },
+		func() {},
+	)
+	select {
+	case err := <-failed:
+		require.Contains(t, err.Error(), "height should be 10, but got 12")
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "the failure callback was not called")
+	}
+}
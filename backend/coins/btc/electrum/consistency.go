@@ -0,0 +1,269 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package electrum
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// recheckDelay is the time to wait before comparing a history again after a mismatch. Two
+	// honest servers can briefly disagree if one of them has not yet processed the latest block.
+	recheckDelay = 30 * time.Second
+
+	// maxFeeDeviationFactor is the factor by which the fee estimates of two servers may differ
+	// before it is reported. Fee estimates of different nodes are never exactly the same.
+	maxFeeDeviationFactor = 3
+)
+
+// DiscrepancyKind is the kind of data two servers disagree on. See the DiscrepancyKind* constants.
+type DiscrepancyKind string
+
+const (
+	// DiscrepancyKindHistory means that the confirmed history of an address differs.
+	DiscrepancyKindHistory DiscrepancyKind = "history"
+	// DiscrepancyKindFeeEstimate means that the fee estimates differ by more than
+	// maxFeeDeviationFactor.
+	DiscrepancyKindFeeEstimate DiscrepancyKind = "feeEstimate"
+)
+
+// Discrepancy describes a disagreement between the primary and the secondary server.
+type Discrepancy struct {
+	Kind            DiscrepancyKind `json:"kind"`
+	PrimaryServer   string          `json:"primaryServer"`
+	SecondaryServer string          `json:"secondaryServer"`
+	// Subject is the script hash for history discrepancies and the number of target blocks for
+	// fee estimate discrepancies.
+	Subject   string `json:"subject"`
+	Primary   string `json:"primary"`
+	Secondary string `json:"secondary"`
+}
+
+// ConsistencyChecker cross-checks the replies of the primary connection against a second,
+// independently connected server. A single malicious server could otherwise omit transactions from
+// an address history without us noticing.
+type ConsistencyChecker struct {
+	primary       *client.ElectrumClient
+	servers       []*rpc.ServerInfo
+	net           *chaincfg.Params
+	secondary     *client.ElectrumClient
+	secondaryLock locker.Locker
+	log           *logrus.Entry
+}
+
+// NewConsistencyChecker creates a new ConsistencyChecker. The secondary connection is established
+// lazily with one of the given servers the primary connection is not using.
+func NewConsistencyChecker(
+	primary *client.ElectrumClient,
+	servers []*rpc.ServerInfo,
+	net *chaincfg.Params,
+	log *logrus.Entry,
+) *ConsistencyChecker {
+	return &ConsistencyChecker{
+		primary: primary,
+		servers: servers,
+		net:     net,
+		log:     log.WithField("group", "consistency"),
+	}
+}
+
+// secondaryClient returns the connection to the secondary server, or nil if no server independent
+// of the primary one is available at the moment.
+func (checker *ConsistencyChecker) secondaryClient() *client.ElectrumClient {
+	defer checker.secondaryLock.Lock()()
+	primaryServer := checker.primary.ServerInfo()
+	if primaryServer == nil {
+		return nil
+	}
+	if checker.secondary == nil {
+		backends := []rpc.Backend{}
+		for _, serverInfo := range checker.servers {
+			if serverInfo.Server != primaryServer.Server {
+				backends = append(backends, &Electrum{log: checker.log, serverInfo: serverInfo})
+			}
+		}
+		if len(backends) == 0 {
+			checker.log.Warning("Consistency check needs at least two servers")
+			return nil
+		}
+		jsonrpcClient := jsonrpc.NewRPCClient(backends, checker.log)
+		checker.secondary = client.NewElectrumClient(jsonrpcClient, checker.net, checker.log)
+	}
+	secondaryServer := checker.secondary.ServerInfo()
+	if secondaryServer != nil && secondaryServer.Server == primaryServer.Server {
+		// The primary connection failed over to the server we use for checking.
+		checker.log.Debug("Primary and secondary server are the same, skipping check")
+		return nil
+	}
+	return checker.secondary
+}
+
+func (checker *ConsistencyChecker) serverNames(secondary *client.ElectrumClient) (string, string) {
+	var primaryName, secondaryName string
+	if serverInfo := checker.primary.ServerInfo(); serverInfo != nil {
+		primaryName = serverInfo.Server
+	}
+	if serverInfo := secondary.ServerInfo(); serverInfo != nil {
+		secondaryName = serverInfo.Server
+	}
+	return primaryName, secondaryName
+}
+
+func (checker *ConsistencyChecker) report(discrepancy *Discrepancy, onDiscrepancy func(*Discrepancy)) {
+	checker.log.WithFields(logrus.Fields{
+		"kind":             discrepancy.Kind,
+		"primary-server":   discrepancy.PrimaryServer,
+		"secondary-server": discrepancy.SecondaryServer,
+		"subject":          discrepancy.Subject,
+		"primary":          discrepancy.Primary,
+		"secondary":        discrepancy.Secondary,
+	}).Warning("Servers disagree")
+	onDiscrepancy(discrepancy)
+}
+
+// confirmedStatus is the status of the confirmed part of the history. Unconfirmed transactions are
+// ignored, as mempools of different servers legitimately differ.
+func confirmedStatus(history blockchain.TxHistory) string {
+	confirmed := blockchain.TxHistory{}
+	for _, tx := range history {
+		if tx.Height > 0 {
+			confirmed = append(confirmed, tx)
+		}
+	}
+	return confirmed.Status()
+}
+
+// CheckHistory fetches the history of the address from the secondary server and compares it to the
+// history returned by the primary server. If they differ, the histories are fetched again from both
+// servers after a delay, and onDiscrepancy is called if they still differ.
+func (checker *ConsistencyChecker) CheckHistory(
+	scriptHashHex blockchain.ScriptHashHex,
+	history blockchain.TxHistory,
+	onDiscrepancy func(*Discrepancy),
+) {
+	checker.compareHistory(scriptHashHex, history, func(*Discrepancy) {
+		time.AfterFunc(recheckDelay, func() {
+			checker.primary.ScriptHashGetHistory(
+				scriptHashHex,
+				func(history blockchain.TxHistory) error {
+					checker.compareHistory(scriptHashHex, history, func(discrepancy *Discrepancy) {
+						checker.report(discrepancy, onDiscrepancy)
+					})
+					return nil
+				},
+				checker.onError,
+				func() {},
+			)
+		})
+	})
+}
+
+func (checker *ConsistencyChecker) compareHistory(
+	scriptHashHex blockchain.ScriptHashHex,
+	history blockchain.TxHistory,
+	onMismatch func(*Discrepancy),
+) {
+	secondary := checker.secondaryClient()
+	if secondary == nil {
+		return
+	}
+	primaryStatus := confirmedStatus(history)
+	secondary.ScriptHashGetHistory(
+		scriptHashHex,
+		func(secondaryHistory blockchain.TxHistory) error {
+			secondaryStatus := confirmedStatus(secondaryHistory)
+			if primaryStatus == secondaryStatus {
+				return nil
+			}
+			primaryServer, secondaryServer := checker.serverNames(secondary)
+			onMismatch(&Discrepancy{
+				Kind:            DiscrepancyKindHistory,
+				PrimaryServer:   primaryServer,
+				SecondaryServer: secondaryServer,
+				Subject:         string(scriptHashHex),
+				Primary:         primaryStatus,
+				Secondary:       secondaryStatus,
+			})
+			return nil
+		},
+		checker.onError,
+		func() {},
+	)
+}
+
+func (checker *ConsistencyChecker) onError(err error) {
+	checker.log.WithError(err).Debug("Could not fetch history for the consistency check")
+}
+
+// feeEstimatesDeviate returns true if one fee rate is more than maxFeeDeviationFactor times the
+// other one.
+func feeEstimatesDeviate(a, b btcutil.Amount) bool {
+	if a > b {
+		a, b = b, a
+	}
+	return b > a*maxFeeDeviationFactor
+}
+
+// CheckFeeEstimate fetches the fee estimate for the given number of blocks from the secondary
+// server and calls onDiscrepancy if it deviates too much from the one returned by the primary
+// server.
+func (checker *ConsistencyChecker) CheckFeeEstimate(
+	blocks int,
+	feeRatePerKb btcutil.Amount,
+	onDiscrepancy func(*Discrepancy),
+) {
+	secondary := checker.secondaryClient()
+	if secondary == nil {
+		return
+	}
+	secondary.EstimateFee(
+		blocks,
+		func(secondaryFeeRatePerKb *btcutil.Amount) error {
+			if secondaryFeeRatePerKb == nil ||
+				!feeEstimatesDeviate(feeRatePerKb, *secondaryFeeRatePerKb) {
+				return nil
+			}
+			primaryServer, secondaryServer := checker.serverNames(secondary)
+			checker.report(&Discrepancy{
+				Kind:            DiscrepancyKindFeeEstimate,
+				PrimaryServer:   primaryServer,
+				SecondaryServer: secondaryServer,
+				Subject:         fmt.Sprintf("%d", blocks),
+				Primary:         feeRatePerKb.String(),
+				Secondary:       secondaryFeeRatePerKb.String(),
+			}, onDiscrepancy)
+			return nil
+		},
+		func() {},
+	)
+}
+
+// Close closes the secondary connection.
+func (checker *ConsistencyChecker) Close() {
+	defer checker.secondaryLock.Lock()()
+	if checker.secondary != nil {
+		checker.secondary.Close()
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package electrum
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmedStatus(t *testing.T) {
+	tx1 := &blockchain.TxInfo{
+		Height: 10,
+		TXHash: blockchain.TXHash(chainhash.HashH([]byte("tx1"))),
+	}
+	tx2 := &blockchain.TxInfo{
+		Height: 0,
+		TXHash: blockchain.TXHash(chainhash.HashH([]byte("tx2"))),
+	}
+	require.Equal(t, "", confirmedStatus(blockchain.TxHistory{}))
+	require.Equal(t, "", confirmedStatus(blockchain.TxHistory{tx2}))
+	// Unconfirmed transactions do not change the status.
+	require.Equal(t,
+		blockchain.TxHistory{tx1}.Status(),
+		confirmedStatus(blockchain.TxHistory{tx1, tx2}))
+}
+
+func TestFeeEstimatesDeviate(t *testing.T) {
+	require.False(t, feeEstimatesDeviate(1000, 1000))
+	require.False(t, feeEstimatesDeviate(1000, 3000))
+	require.False(t, feeEstimatesDeviate(3000, 1000))
+	require.True(t, feeEstimatesDeviate(1000, 3001))
+	require.True(t, feeEstimatesDeviate(3001, 1000))
+}
@@ -20,7 +20,7 @@ import (
 	"io"
 	"net"
 
-	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
@@ -91,7 +91,14 @@ func newTCPConnection(address string) (net.Conn, error) {
 
 // NewElectrumConnection connects to an Electrum server and returns a ElectrumClient instance to
 // communicate with it.
-func NewElectrumConnection(servers []*rpc.ServerInfo, log *logrus.Entry) blockchain.Interface {
+// Servers which are not on the chain of the given network are refused. If batchConfig is not nil, it
+// replaces the default batching of the JSON-RPC client.
+func NewElectrumConnection(
+	servers []*rpc.ServerInfo,
+	net *chaincfg.Params,
+	batchConfig *rpc.BatchConfig,
+	log *logrus.Entry,
+) *client.ElectrumClient {
 	var serverList string
 	for _, serverInfo := range servers {
 		if serverList != "" {
@@ -107,5 +114,8 @@ func NewElectrumConnection(servers []*rpc.ServerInfo, log *logrus.Entry) blockch
 		backends = append(backends, &Electrum{log, serverInfo})
 	}
 	jsonrpcClient := jsonrpc.NewRPCClient(backends, log)
-	return client.NewElectrumClient(jsonrpcClient, log)
+	if batchConfig != nil {
+		jsonrpcClient.ConfigureBatching(*batchConfig)
+	}
+	return client.NewElectrumClient(jsonrpcClient, net, log)
 }
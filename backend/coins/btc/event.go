@@ -34,4 +34,26 @@ const (
 
 	// EventFeeTargetsChanged is fired when the fee targets change.
 	EventFeeTargetsChanged Event = "feeTargetsChanged"
+
+	// EventServerInconsistency is fired when the consistency check finds that the primary and the
+	// secondary server disagree on an address history or a fee estimate. See
+	// Account.ServerDiscrepancies().
+	EventServerInconsistency Event = "serverInconsistency"
+
+	// EventAddressSyncErrorsChanged is fired when an address could not be synced, or when such an
+	// address was synced successfully again. See Account.AddressSyncErrors().
+	EventAddressSyncErrorsChanged Event = "addressSyncErrorsChanged"
+
+	// EventReorg is fired when transactions of the wallet were confirmed in blocks which were
+	// orphaned by a chain reorganization. Their confirmations are reversed until they are confirmed
+	// and verified again.
+	EventReorg Event = "reorg"
+
+	// EventIncomingTxDoubleSpent is fired when an unconfirmed incoming transaction was double spent
+	// or replaced. Check the status of the transactions using Transactions().
+	EventIncomingTxDoubleSpent Event = "incomingTxDoubleSpent"
+
+	// EventOutputQuarantined is fired when an output paid to the account is suspected to be dust
+	// and quarantined. See transactions.OutputStateQuarantined and Account.SetOutputReleased().
+	EventOutputQuarantined Event = "outputQuarantined"
 )
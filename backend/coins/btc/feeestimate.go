@@ -0,0 +1,55 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"math"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+)
+
+// maxBlockVSize is the maximum virtual size of a block.
+const maxBlockVSize = 1000000
+
+// feeRateForBlocks returns the fee rate per kB needed to be among the transactions mined in the
+// next `blocks` blocks, judging by the current mempool. Returns nil if the mempool is small enough
+// for all of it to fit into these blocks, in which case the minimum relay fee suffices.
+func feeRateForBlocks(histogram blockchain.FeeHistogram, blocks int) *btcutil.Amount {
+	capacity := int64(blocks) * maxBlockVSize
+	var vsize int64
+	for _, entry := range histogram {
+		vsize += entry.VSize
+		if vsize > capacity {
+			feeRatePerKb := btcutil.Amount(math.Ceil(entry.FeeRatePerVByte * 1000))
+			return &feeRatePerKb
+		}
+	}
+	return nil
+}
+
+// blocksForFeeRate returns the number of blocks after which a transaction paying the given fee rate
+// per kB is expected to be mined, assuming miners pick the transactions paying the most first and
+// ignoring transactions arriving in the meantime.
+func blocksForFeeRate(histogram blockchain.FeeHistogram, feeRatePerKb btcutil.Amount) int {
+	var vsizeAhead int64
+	for _, entry := range histogram {
+		if btcutil.Amount(entry.FeeRatePerVByte*1000) <= feeRatePerKb {
+			break
+		}
+		vsizeAhead += entry.VSize
+	}
+	return int(vsizeAhead/maxBlockVSize) + 1
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/stretchr/testify/assert"
+)
+
+var testHistogram = blockchain.FeeHistogram{
+	{FeeRatePerVByte: 50, VSize: 600000},
+	{FeeRatePerVByte: 20, VSize: 800000},
+	{FeeRatePerVByte: 10.5, VSize: 1000000},
+	{FeeRatePerVByte: 2, VSize: 500000},
+}
+
+func TestFeeRateForBlocks(t *testing.T) {
+	assert.Equal(t, btcutil.Amount(20000), *feeRateForBlocks(testHistogram, 1))
+	assert.Equal(t, btcutil.Amount(10500), *feeRateForBlocks(testHistogram, 2))
+	// The whole mempool fits into the next three blocks.
+	assert.Nil(t, feeRateForBlocks(testHistogram, 3))
+	assert.Nil(t, feeRateForBlocks(blockchain.FeeHistogram{}, 1))
+}
+
+func TestBlocksForFeeRate(t *testing.T) {
+	assert.Equal(t, 1, blocksForFeeRate(testHistogram, 100000))
+	assert.Equal(t, 1, blocksForFeeRate(testHistogram, 50000))
+	assert.Equal(t, 1, blocksForFeeRate(testHistogram, 20000))
+	assert.Equal(t, 2, blocksForFeeRate(testHistogram, 10500))
+	assert.Equal(t, 3, blocksForFeeRate(testHistogram, 1000))
+	assert.Equal(t, 1, blocksForFeeRate(blockchain.FeeHistogram{}, 1000))
+}
@@ -30,6 +30,7 @@ func NewFeeTargetCode(code string, log *logrus.Entry) (FeeTargetCode, error) {
 	case string(FeeTargetCodeEconomy):
 	case string(FeeTargetCodeNormal):
 	case string(FeeTargetCodeHigh):
+	case string(FeeTargetCodeCustom):
 	default:
 		return "", errp.WithStack(errp.Newf("Unrecognized fee target code %s", code))
 	}
@@ -49,6 +50,9 @@ const (
 	// FeeTargetCodeHigh is the high priority fee target.
 	FeeTargetCodeHigh FeeTargetCode = "high"
 
+	// FeeTargetCodeCustom means that the fee rate is entered by the user.
+	FeeTargetCodeCustom FeeTargetCode = "custom"
+
 	defaultFeeTarget = FeeTargetCodeNormal
 )
 
@@ -15,17 +15,25 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/gorilla/mux"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressaudit"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressbook"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
@@ -37,25 +45,43 @@ import (
 
 // Handlers provides a web api to the account.
 type Handlers struct {
-	account btc.Interface
-	log     *logrus.Entry
+	account      btc.Interface
+	addressBook  *addressbook.AddressBook
+	addressAudit *addressaudit.Log
+	log          *logrus.Entry
 }
 
 // NewHandlers creates a new Handlers instance.
 func NewHandlers(
-	handleFunc func(string, func(*http.Request) (interface{}, error)) *mux.Route, log *logrus.Entry) *Handlers {
-	handlers := &Handlers{log: log}
+	handleFunc func(string, func(*http.Request) (interface{}, error)) *mux.Route,
+	addressBook *addressbook.AddressBook,
+	addressAudit *addressaudit.Log,
+	log *logrus.Entry,
+) *Handlers {
+	handlers := &Handlers{addressBook: addressBook, addressAudit: addressAudit, log: log}
 
 	handleFunc("/init", handlers.postInit).Methods("POST")
 	handleFunc("/status", handlers.getAccountStatus).Methods("GET")
 	handleFunc("/transactions", handlers.ensureAccountInitialized(handlers.getAccountTransactions)).Methods("GET")
+	handleFunc("/transaction", handlers.ensureAccountInitialized(handlers.getAccountTransaction)).Methods("GET")
 	handleFunc("/utxos", handlers.ensureAccountInitialized(handlers.getUTXOs)).Methods("GET")
+	handleFunc("/utxos/freeze", handlers.ensureAccountInitialized(handlers.postSetUTXOFrozen)).Methods("POST")
+	handleFunc("/utxos/release", handlers.ensureAccountInitialized(handlers.postSetUTXOReleased)).Methods("POST")
 	handleFunc("/balance", handlers.ensureAccountInitialized(handlers.getAccountBalance)).Methods("GET")
+	handleFunc("/balance-history", handlers.ensureAccountInitialized(handlers.getBalanceHistory)).Methods("GET")
 	handleFunc("/sendtx", handlers.ensureAccountInitialized(handlers.postAccountSendTx)).Methods("POST")
+	handleFunc("/abandon-tx", handlers.ensureAccountInitialized(handlers.postAbandonTx)).Methods("POST")
+	handleFunc("/sweep", handlers.ensureAccountInitialized(handlers.postSweep)).Methods("POST")
+	handleFunc("/consolidation", handlers.ensureAccountInitialized(handlers.getConsolidation)).Methods("GET")
+	handleFunc("/consolidate", handlers.ensureAccountInitialized(handlers.postConsolidate)).Methods("POST")
+	handleFunc("/address-sync-errors", handlers.ensureAccountInitialized(handlers.getAddressSyncErrors)).Methods("GET")
+	handleFunc("/server-discrepancies", handlers.ensureAccountInitialized(handlers.getServerDiscrepancies)).Methods("GET")
 	handleFunc("/fee-targets", handlers.ensureAccountInitialized(handlers.getAccountFeeTargets)).Methods("GET")
 	handleFunc("/tx-proposal", handlers.ensureAccountInitialized(handlers.getAccountTxProposal)).Methods("POST")
 	handleFunc("/headers/status", handlers.ensureAccountInitialized(handlers.getHeadersStatus)).Methods("GET")
 	handleFunc("/receive-addresses", handlers.ensureAccountInitialized(handlers.getReceiveAddresses)).Methods("GET")
+	handleFunc("/address-shown", handlers.ensureAccountInitialized(handlers.postAddressShown)).Methods("POST")
+	handleFunc("/address-usage", handlers.ensureAccountInitialized(handlers.getAddressUsage)).Methods("GET")
 	handleFunc("/verify-address", handlers.ensureAccountInitialized(handlers.postVerifyAddress)).Methods("POST")
 	handleFunc("/convert-to-legacy-address", handlers.ensureAccountInitialized(handlers.postConvertToLegacyAddress)).Methods("POST")
 	return handlers
@@ -86,6 +112,7 @@ type Transaction struct {
 	FeeRatePerKb     coin.FormattedAmount `json:"feeRatePerKb"`
 	Time             *string              `json:"time"`
 	Addresses        []string             `json:"addresses"`
+	Status           string               `json:"status"`
 }
 
 func (handlers *Handlers) ensureAccountInitialized(h func(*http.Request) (interface{}, error)) func(*http.Request) (interface{}, error) {
@@ -97,39 +124,211 @@ func (handlers *Handlers) ensureAccountInitialized(h func(*http.Request) (interf
 	}
 }
 
-func (handlers *Handlers) getAccountTransactions(_ *http.Request) (interface{}, error) {
+func (handlers *Handlers) formatAmountAsJSON(amount btcutil.Amount) coin.FormattedAmount {
+	return handlers.account.Coin().FormatAmountAsJSON(coin.NewAmountFromInt64(int64(amount)))
+}
+
+func (handlers *Handlers) formatTransaction(txInfo *transactions.TxInfo) Transaction {
+	var feeString, feeRatePerKb coin.FormattedAmount
+	if txInfo.Fee != nil {
+		feeString = handlers.formatAmountAsJSON(*txInfo.Fee)
+		feeRatePerKb = handlers.formatAmountAsJSON(*txInfo.FeeRatePerKb())
+	}
+	var formattedTime *string
+	if txInfo.Timestamp != nil {
+		t := txInfo.Timestamp.Format(time.RFC3339)
+		formattedTime = &t
+	}
+	return Transaction{
+		ID:               txInfo.Tx.TxHash().String(),
+		NumConfirmations: txInfo.NumConfirmations,
+		VSize:            txInfo.VSize,
+		Size:             txInfo.Size,
+		Weight:           txInfo.Weight,
+		Height:           txInfo.Height,
+		Type: map[transactions.TxType]string{
+			transactions.TxTypeReceive:  "receive",
+			transactions.TxTypeSend:     "send",
+			transactions.TxTypeSendSelf: "send_to_self",
+		}[txInfo.Type],
+		Amount:       handlers.formatAmountAsJSON(txInfo.Amount),
+		Fee:          feeString,
+		FeeRatePerKb: feeRatePerKb,
+		Time:         formattedTime,
+		Addresses:    txInfo.Addresses,
+		Status:       string(txInfo.Status),
+	}
+}
+
+// parseTxFilter parses the query parameters of the /transactions endpoint. Dates are in RFC3339,
+// amounts in the unit of the coin.
+func parseTxFilter(query url.Values) (*transactions.TxFilter, error) {
+	filter := &transactions.TxFilter{
+		Address:  query.Get("address"),
+		IDPrefix: query.Get("txid"),
+	}
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := query.Get(param.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errp.Newf("invalid %s date", param.name)
+			}
+			*param.target = &parsed
+		}
+	}
+	for _, param := range []struct {
+		name   string
+		target **btcutil.Amount
+	}{{"minAmount", &filter.MinAmount}, {"maxAmount", &filter.MaxAmount}} {
+		if value := query.Get(param.name); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, errp.Newf("invalid %s", param.name)
+			}
+			btcAmount, err := btcutil.NewAmount(amount)
+			if err != nil {
+				return nil, errp.Newf("invalid %s", param.name)
+			}
+			*param.target = &btcAmount
+		}
+	}
+	switch value := query.Get("type"); value {
+	case "":
+	case "receive":
+		filter.Type = transactions.TxTypeReceive
+	case "send":
+		filter.Type = transactions.TxTypeSend
+	case "send_to_self":
+		filter.Type = transactions.TxTypeSendSelf
+	default:
+		return nil, errp.Newf("invalid type %s", value)
+	}
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{{"offset", &filter.Offset}, {"limit", &filter.Limit}} {
+		if value := query.Get(param.name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 0 {
+				return nil, errp.Newf("invalid %s", param.name)
+			}
+			*param.target = number
+		}
+	}
+	return filter, nil
+}
+
+// TransactionsPage is returned by the /transactions endpoint if it is queried with a filter.
+type TransactionsPage struct {
+	Transactions []Transaction `json:"transactions"`
+	// Total is the number of txs matching the filter, including the ones not in the page.
+	Total int `json:"total"`
+}
+
+// getAccountTransactions returns all txs, or the TransactionsPage selected by the query
+// parameters, see parseTxFilter().
+func (handlers *Handlers) getAccountTransactions(r *http.Request) (interface{}, error) {
+	if len(r.URL.Query()) == 0 {
+		return handlers.formatTransactions(handlers.account.Transactions()), nil
+	}
+	filter, err := parseTxFilter(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	txs, total, err := handlers.account.SearchTransactions(filter)
+	if err != nil {
+		return nil, err
+	}
+	return TransactionsPage{Transactions: handlers.formatTransactions(txs), Total: total}, nil
+}
+
+func (handlers *Handlers) formatTransactions(txs []*transactions.TxInfo) []Transaction {
 	result := []Transaction{}
-	txs := handlers.account.Transactions()
 	for _, txInfo := range txs {
-		var feeString, feeRatePerKb coin.FormattedAmount
-		if txInfo.Fee != nil {
-			feeString = handlers.account.Coin().FormatAmountAsJSON(int64(*txInfo.Fee))
-			feeRatePerKb = handlers.account.Coin().FormatAmountAsJSON(int64(*txInfo.FeeRatePerKb()))
-		}
-		var formattedTime *string
-		if txInfo.Timestamp != nil {
-			t := txInfo.Timestamp.Format(time.RFC3339)
-			formattedTime = &t
+		result = append(result, handlers.formatTransaction(txInfo))
+	}
+	return result
+}
+
+// TransactionInput is an input returned by the /transaction endpoint.
+type TransactionInput struct {
+	PreviousOutPoint string `json:"previousOutPoint"`
+	// Amount is nil and Address empty if the spent output is unknown.
+	Amount  *coin.FormattedAmount `json:"amount"`
+	Address string                `json:"address"`
+	Ours    bool                  `json:"ours"`
+}
+
+// TransactionOutput is an output returned by the /transaction endpoint.
+type TransactionOutput struct {
+	Index   uint32               `json:"index"`
+	Amount  coin.FormattedAmount `json:"amount"`
+	Address string               `json:"address"`
+	// Kind is "ours", "change" or "external".
+	Kind string `json:"kind"`
+}
+
+// TransactionDetail is the info returned by the /transaction endpoint.
+type TransactionDetail struct {
+	Transaction
+	Inputs    []TransactionInput  `json:"inputs"`
+	Outputs   []TransactionOutput `json:"outputs"`
+	RawTx     string              `json:"rawTx"`
+	RBF       bool                `json:"rbf"`
+	BlockHash *string             `json:"blockHash"`
+	Verified  bool                `json:"verified"`
+}
+
+// getAccountTransaction returns the details of the tx given by the `id` query parameter.
+func (handlers *Handlers) getAccountTransaction(r *http.Request) (interface{}, error) {
+	txHash, err := chainhash.NewHashFromStr(r.URL.Query().Get("id"))
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	txDetail, err := handlers.account.TxDetail(*txHash)
+	if err != nil {
+		return nil, err
+	}
+	var rawTx bytes.Buffer
+	if err := txDetail.Tx.Serialize(&rawTx); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	result := TransactionDetail{
+		Transaction: handlers.formatTransaction(txDetail.TxInfo),
+		Inputs:      []TransactionInput{},
+		Outputs:     []TransactionOutput{},
+		RawTx:       hex.EncodeToString(rawTx.Bytes()),
+		RBF:         txDetail.RBF,
+		Verified:    txDetail.Verified,
+	}
+	for _, input := range txDetail.Inputs {
+		var amount *coin.FormattedAmount
+		if input.Value != nil {
+			formatted := handlers.formatAmountAsJSON(*input.Value)
+			amount = &formatted
 		}
-		result = append(result, Transaction{
-			ID:               txInfo.Tx.TxHash().String(),
-			NumConfirmations: txInfo.NumConfirmations,
-			VSize:            txInfo.VSize,
-			Size:             txInfo.Size,
-			Weight:           txInfo.Weight,
-			Height:           txInfo.Height,
-			Type: map[transactions.TxType]string{
-				transactions.TxTypeReceive:  "receive",
-				transactions.TxTypeSend:     "send",
-				transactions.TxTypeSendSelf: "send_to_self",
-			}[txInfo.Type],
-			Amount:       handlers.account.Coin().FormatAmountAsJSON(int64(txInfo.Amount)),
-			Fee:          feeString,
-			FeeRatePerKb: feeRatePerKb,
-			Time:         formattedTime,
-			Addresses:    txInfo.Addresses,
+		result.Inputs = append(result.Inputs, TransactionInput{
+			PreviousOutPoint: input.PreviousOutPoint.String(),
+			Amount:           amount,
+			Address:          input.Address,
+			Ours:             input.Ours,
 		})
 	}
+	for _, output := range txDetail.Outputs {
+		result.Outputs = append(result.Outputs, TransactionOutput{
+			Index:   output.Index,
+			Amount:  handlers.formatAmountAsJSON(output.Value),
+			Address: output.Address,
+			Kind:    string(output.Kind),
+		})
+	}
+	if txDetail.BlockHash != nil {
+		blockHash := txDetail.BlockHash.String()
+		result.BlockHash = &blockHash
+	}
 	return result, nil
 }
 
@@ -139,61 +338,183 @@ func (handlers *Handlers) getUTXOs(_ *http.Request) (interface{}, error) {
 		result = append(result,
 			map[string]interface{}{
 				"outPoint": output.OutPoint.String(),
-				"amount":   handlers.account.Coin().FormatAmountAsJSON(output.TxOut.Value),
+				"amount":   handlers.formatAmountAsJSON(btcutil.Amount(output.TxOut.Value)),
 				"address":  output.Address,
 			})
 	}
 	return result, nil
 }
 
-func (handlers *Handlers) getAccountBalance(_ *http.Request) (interface{}, error) {
-	balance := handlers.account.Balance()
+func (handlers *Handlers) postSetUTXOFrozen(r *http.Request) (interface{}, error) {
+	jsonBody := struct {
+		OutPoint string `json:"outPoint"`
+		Frozen   bool   `json:"frozen"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	outPoint, err := util.ParseOutPoint([]byte(jsonBody.OutPoint))
+	if err != nil {
+		return nil, err
+	}
+	return nil, handlers.account.SetOutputFrozen(*outPoint, jsonBody.Frozen)
+}
+
+// postSetUTXOReleased releases a quarantined output, so it is spent like any other output, or puts
+// it back into quarantine.
+func (handlers *Handlers) postSetUTXOReleased(r *http.Request) (interface{}, error) {
+	jsonBody := struct {
+		OutPoint string `json:"outPoint"`
+		Released bool   `json:"released"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	outPoint, err := util.ParseOutPoint([]byte(jsonBody.OutPoint))
+	if err != nil {
+		return nil, err
+	}
+	return nil, handlers.account.SetOutputReleased(*outPoint, jsonBody.Released)
+}
+
+func (handlers *Handlers) formatBalanceAmounts(amounts *transactions.BalanceAmounts) map[string]interface{} {
+	format := func(amount btcutil.Amount) coin.FormattedAmount {
+		return handlers.formatAmountAsJSON(amount)
+	}
 	return map[string]interface{}{
-		"available":   handlers.account.Coin().FormatAmountAsJSON(int64(balance.Available)),
-		"incoming":    handlers.account.Coin().FormatAmountAsJSON(int64(balance.Incoming)),
-		"hasIncoming": balance.Incoming != 0,
-	}, nil
+		"confirmed":      format(amounts.Confirmed),
+		"unconfirmedOwn": format(amounts.UnconfirmedOwn),
+		"incoming":       format(amounts.Incoming),
+		"immature":       format(amounts.Immature),
+		"frozen":         format(amounts.Frozen),
+		"reserved":       format(amounts.Reserved),
+		"quarantined":    format(amounts.Quarantined),
+		"spendable":      format(amounts.Spendable()),
+		"total":          format(amounts.Total()),
+	}
+}
+
+func (handlers *Handlers) getAccountBalance(_ *http.Request) (interface{}, error) {
+	balance := handlers.account.BalanceBreakdown()
+	result := handlers.formatBalanceAmounts(&balance.BalanceAmounts)
+	// The send form uses the spendable amount as the maximum, so the available amount is the same.
+	result["available"] = result["spendable"]
+	result["hasIncoming"] = balance.Incoming != 0
+	addressBalances := map[string]interface{}{}
+	for address, amounts := range balance.Addresses {
+		addressBalances[address] = handlers.formatBalanceAmounts(amounts)
+	}
+	result["addresses"] = addressBalances
+	utxos := []map[string]interface{}{}
+	for _, utxo := range balance.UTXOs {
+		utxos = append(utxos, map[string]interface{}{
+			"outPoint": utxo.OutPoint.String(),
+			"amount":   handlers.formatAmountAsJSON(btcutil.Amount(utxo.TxOut.Value)),
+			"address":  utxo.Address,
+			"height":   utxo.Height,
+			"state":    utxo.State,
+			// Empty unless the output is suspected to be dust, see transactions.QuarantineReason.
+			"quarantineReason": utxo.QuarantineReason,
+		})
+	}
+	result["utxos"] = utxos
+	return result, nil
+}
+
+// getBalanceHistory returns the balance over time. The `interval` query parameter is "day" (default)
+// or "week". If the `fiat` query parameter is set, e.g. to "USD", each point is also valued in that
+// currency. No historical exchange rates are available, so all points are valued at the current
+// rate, which is why the value is returned as `fiatAtCurrentRate`. It does not show how the value
+// of the balance developed over time.
+func (handlers *Handlers) getBalanceHistory(r *http.Request) (interface{}, error) {
+	interval := transactions.BalanceHistoryIntervalDay
+	if value := r.URL.Query().Get("interval"); value != "" {
+		interval = transactions.BalanceHistoryInterval(value)
+	}
+	fiat := r.URL.Query().Get("fiat")
+	points, err := handlers.account.BalanceHistory(interval)
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for _, point := range points {
+		balance := handlers.formatAmountAsJSON(point.Balance)
+		entry := map[string]interface{}{
+			"time":    point.Time.Format(time.RFC3339),
+			"balance": balance,
+		}
+		if fiat != "" {
+			entry["fiatAtCurrentRate"] = balance.Conversions[fiat]
+		}
+		result = append(result, entry)
+	}
+	return result, nil
 }
 
 type sendTxInput struct {
-	address       string
-	sendAmount    btc.SendAmount
-	feeTargetCode btc.FeeTargetCode
-	selectedUTXOs map[wire.OutPoint]struct{}
-	log           *logrus.Entry
+	address string
+	// recipientID references an address book entry. If set, address is taken from the entry, as
+	// well as the amount if none was given.
+	recipientID        string
+	useDefaultAmount   bool
+	sendAmount         btc.SendAmount
+	feeTargetCode      btc.FeeTargetCode
+	customFeeRatePerKb btcutil.Amount
+	selectedUTXOs      map[wire.OutPoint]struct{}
+	log                *logrus.Entry
 }
 
 func (input *sendTxInput) UnmarshalJSON(jsonBytes []byte) error {
 	jsonBody := struct {
 		Address       string   `json:"address"`
+		RecipientID   string   `json:"recipientID"`
 		SendAll       string   `json:"sendAll"`
 		FeeTarget     string   `json:"feeTarget"`
+		CustomFee     string   `json:"customFee"`
 		Amount        string   `json:"amount"`
+		FiatAmount    string   `json:"fiatAmount"`
+		Fiat          string   `json:"fiat"`
 		SelectedUTXOS []string `json:"selectedUTXOS"`
+		// Rate is the exchange rate returned with the proposal, locked when sending a fiat amount.
+		Rate float64 `json:"rate"`
 	}{}
 	if err := json.Unmarshal(jsonBytes, &jsonBody); err != nil {
 		return errp.WithStack(err)
 	}
 	input.address = jsonBody.Address
+	input.recipientID = jsonBody.RecipientID
 	var err error
 	input.feeTargetCode, err = btc.NewFeeTargetCode(jsonBody.FeeTarget, input.log)
 	if err != nil {
 		return errp.WithMessage(err, "Failed to retrieve fee target code")
 	}
-	if jsonBody.SendAll == "yes" {
+	if input.feeTargetCode == btc.FeeTargetCodeCustom {
+		// The custom fee is entered in sat/vB.
+		feeRatePerVByte, err := strconv.ParseFloat(jsonBody.CustomFee, 64)
+		if err != nil || feeRatePerVByte <= 0 {
+			return errp.WithStack(btc.TxValidationError("invalid fee rate"))
+		}
+		input.customFeeRatePerKb = btcutil.Amount(math.Round(feeRatePerVByte * 1000))
+	}
+	switch {
+	case jsonBody.SendAll == "yes":
 		input.sendAmount = btc.NewSendAmountAll()
-	} else {
-		amount, err := strconv.ParseFloat(jsonBody.Amount, 64)
+	case jsonBody.FiatAmount != "":
+		fiatAmount, err := strconv.ParseFloat(jsonBody.FiatAmount, 64)
 		if err != nil {
 			return errp.WithStack(btc.TxValidationError("invalid amount"))
 		}
-		btcAmount, err := btcutil.NewAmount(amount)
+		sendAmount, err := btc.NewSendAmountFiat(fiatAmount, jsonBody.Fiat)
 		if err != nil {
 			return errp.WithStack(btc.TxValidationError("invalid amount"))
 		}
-		input.sendAmount, err = btc.NewSendAmount(btcAmount)
+		input.sendAmount = sendAmount.WithRate(jsonBody.Rate)
+	case jsonBody.Amount == "" && input.recipientID != "":
+		input.useDefaultAmount = true
+	default:
+		input.sendAmount, err = parseSendAmount(jsonBody.Amount)
 		if err != nil {
-			return errp.WithStack(btc.TxValidationError("invalid amount"))
+			return err
 		}
 	}
 	input.selectedUTXOs = map[wire.OutPoint]struct{}{}
@@ -207,13 +528,65 @@ func (input *sendTxInput) UnmarshalJSON(jsonBytes []byte) error {
 	return nil
 }
 
+// parseSendAmount parses an amount in the unit of the coin, e.g. "0.01".
+func parseSendAmount(amountString string) (btc.SendAmount, error) {
+	amount, err := strconv.ParseFloat(amountString, 64)
+	if err != nil {
+		return btc.SendAmount{}, errp.WithStack(btc.TxValidationError("invalid amount"))
+	}
+	btcAmount, err := btcutil.NewAmount(amount)
+	if err != nil {
+		return btc.SendAmount{}, errp.WithStack(btc.TxValidationError("invalid amount"))
+	}
+	sendAmount, err := btc.NewSendAmount(btcAmount)
+	if err != nil {
+		return btc.SendAmount{}, errp.WithStack(btc.TxValidationError("invalid amount"))
+	}
+	return sendAmount, nil
+}
+
+// resolveRecipient fills in the address and, if needed, the amount from the address book entry
+// referenced by the input.
+func (handlers *Handlers) resolveRecipient(input *sendTxInput) error {
+	if input.recipientID == "" {
+		return nil
+	}
+	entry, err := handlers.addressBook.Entry(input.recipientID)
+	if err != nil {
+		return errp.WithStack(btc.TxValidationError("unknown recipient"))
+	}
+	if entry.CoinCode != handlers.account.Coin().Code() {
+		return errp.WithStack(btc.TxValidationError("the recipient is for a different coin"))
+	}
+	input.address = entry.Address
+	if input.useDefaultAmount {
+		if entry.DefaultAmount == "" {
+			return errp.WithStack(btc.TxValidationError("invalid amount"))
+		}
+		input.sendAmount, err = parseSendAmount(entry.DefaultAmount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (handlers *Handlers) postAccountSendTx(r *http.Request) (interface{}, error) {
 	input := &sendTxInput{log: handlers.log}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, errp.WithStack(err)
 	}
+	if err := handlers.resolveRecipient(input); err != nil {
+		return nil, err
+	}
 
-	err := handlers.account.SendTx(input.address, input.sendAmount, input.feeTargetCode, input.selectedUTXOs)
+	err := handlers.account.SendTx(
+		input.address,
+		input.sendAmount,
+		input.feeTargetCode,
+		input.customFeeRatePerKb,
+		input.selectedUTXOs,
+	)
 	if bitbox.IsErrorAbort(err) {
 		return map[string]interface{}{"success": false}, nil
 	}
@@ -223,6 +596,105 @@ func (handlers *Handlers) postAccountSendTx(r *http.Request) (interface{}, error
 	return map[string]interface{}{"success": true}, nil
 }
 
+func (handlers *Handlers) postAbandonTx(r *http.Request) (interface{}, error) {
+	var txID string
+	if err := json.NewDecoder(r.Body).Decode(&txID); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	txHash, err := chainhash.NewHashFromStr(txID)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := handlers.account.AbandonTransaction(*txHash); err != nil {
+		return map[string]interface{}{"success": false, "errMsg": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+// postSweep sends all funds of a private key, e.g. from a paper wallet, to the account.
+func (handlers *Handlers) postSweep(r *http.Request) (interface{}, error) {
+	jsonBody := struct {
+		PrivateKey string `json:"privateKey"`
+		Passphrase string `json:"passphrase"`
+		FeeTarget  string `json:"feeTarget"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	feeTargetCode, err := btc.NewFeeTargetCode(jsonBody.FeeTarget, handlers.log)
+	if err != nil {
+		return nil, errp.WithMessage(err, "Failed to retrieve fee target code")
+	}
+	result, err := handlers.account.Sweep(jsonBody.PrivateKey, jsonBody.Passphrase, feeTargetCode)
+	if err != nil {
+		return txProposalError(err)
+	}
+	return map[string]interface{}{
+		"success": true,
+		"txID":    result.Transaction.TxHash().String(),
+		"amount":  handlers.formatAmountAsJSON(result.Amount),
+		"fee":     handlers.formatAmountAsJSON(result.Fee),
+	}, nil
+}
+
+func (handlers *Handlers) getConsolidation(_ *http.Request) (interface{}, error) {
+	consolidation, err := handlers.account.Consolidation()
+	if err != nil {
+		return nil, err
+	}
+	utxos := []map[string]interface{}{}
+	for _, utxo := range consolidation.UTXOs {
+		utxos = append(utxos, map[string]interface{}{
+			"outPoint": utxo.OutPoint.String(),
+			"address":  utxo.Address,
+			"amount":   handlers.formatAmountAsJSON(utxo.Value),
+			"costNow":  handlers.formatAmountAsJSON(utxo.CostNow),
+			"costLow":  handlers.formatAmountAsJSON(utxo.CostLow),
+			"included": utxo.Included,
+		})
+	}
+	result := map[string]interface{}{
+		"utxos": utxos,
+		// Fee rates in sat/vB.
+		"feeRateNow": float64(consolidation.FeeRateNowPerKb) / 1000,
+		"feeRateLow": float64(consolidation.FeeRateLowPerKb) / 1000,
+		"savings":    handlers.formatAmountAsJSON(consolidation.Savings),
+		"possible":   consolidation.Possible,
+	}
+	if consolidation.Possible {
+		result["amount"] = handlers.formatAmountAsJSON(consolidation.Amount)
+		result["fee"] = handlers.formatAmountAsJSON(consolidation.Fee)
+	}
+	return result, nil
+}
+
+// postConsolidate merges the outputs included in the consolidation returned by getConsolidation(),
+// which are passed as the "utxos" field, e.g. ["<txid>:<index>", ...].
+func (handlers *Handlers) postConsolidate(r *http.Request) (interface{}, error) {
+	jsonBody := struct {
+		UTXOs []string `json:"utxos"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	outPoints := map[wire.OutPoint]struct{}{}
+	for _, outPointString := range jsonBody.UTXOs {
+		outPoint, err := util.ParseOutPoint([]byte(outPointString))
+		if err != nil {
+			return nil, err
+		}
+		outPoints[*outPoint] = struct{}{}
+	}
+	err := handlers.account.Consolidate(outPoints)
+	if bitbox.IsErrorAbort(err) {
+		return map[string]interface{}{"success": false}, nil
+	}
+	if err != nil {
+		return txProposalError(err)
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
 func txProposalError(err error) (interface{}, error) {
 	if errp.Cause(err) == maketx.ErrInsufficientFunds {
 		return map[string]interface{}{
@@ -244,10 +716,19 @@ func (handlers *Handlers) getAccountTxProposal(r *http.Request) (interface{}, er
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return txProposalError(errp.WithStack(err))
 	}
+	if err := handlers.resolveRecipient(input); err != nil {
+		return txProposalError(err)
+	}
+	// Fiat amounts are converted here so the rate can be returned, to be locked when sending.
+	sendAmount, rate, err := handlers.account.Coin().(*btc.Coin).ResolveSendAmount(input.sendAmount)
+	if err != nil {
+		return txProposalError(err)
+	}
 	outputAmount, fee, total, err := handlers.account.TxProposal(
 		input.address,
-		input.sendAmount,
+		sendAmount,
 		input.feeTargetCode,
+		input.customFeeRatePerKb,
 		input.selectedUTXOs,
 	)
 	if err != nil {
@@ -255,34 +736,83 @@ func (handlers *Handlers) getAccountTxProposal(r *http.Request) (interface{}, er
 	}
 	return map[string]interface{}{
 		"success": true,
-		"amount":  handlers.account.Coin().FormatAmountAsJSON(int64(outputAmount)),
-		"fee":     handlers.account.Coin().FormatAmountAsJSON(int64(fee)),
-		"total":   handlers.account.Coin().FormatAmountAsJSON(int64(total)),
+		"amount":  handlers.formatAmountAsJSON(outputAmount),
+		"fee":     handlers.formatAmountAsJSON(fee),
+		"total":   handlers.formatAmountAsJSON(total),
+		"address": input.address,
+		"rate":    rate,
+		// Paying to an own address which already received funds links the txs. The frontend warns
+		// if this is not 0.
+		"ownAddressReuse": handlers.account.OwnAddressReuse(input.address),
 	}, nil
 }
 
+func (handlers *Handlers) getAddressSyncErrors(_ *http.Request) (interface{}, error) {
+	return handlers.account.AddressSyncErrors(), nil
+}
+
+func (handlers *Handlers) getServerDiscrepancies(_ *http.Request) (interface{}, error) {
+	return handlers.account.ServerDiscrepancies(), nil
+}
+
 func (handlers *Handlers) getHeadersStatus(r *http.Request) (interface{}, error) {
 	return handlers.account.HeadersStatus()
 }
 
-func (handlers *Handlers) getAccountFeeTargets(_ *http.Request) (interface{}, error) {
+// estimatedMinutes returns the estimated confirmation time in minutes for the given fee rate, or nil
+// if it can't be estimated yet.
+func (handlers *Handlers) estimatedMinutes(feeRatePerKb btcutil.Amount) interface{} {
+	duration := handlers.account.ConfirmationTime(feeRatePerKb)
+	if duration == nil {
+		return nil
+	}
+	return int(duration.Minutes())
+}
+
+// getAccountFeeTargets returns the fee targets. If the `blocks` query parameter is present, the fee
+// rate for confirmation within this number of blocks is estimated and returned as `target`.
+func (handlers *Handlers) getAccountFeeTargets(r *http.Request) (interface{}, error) {
 	feeTargets, defaultFeeTarget := handlers.account.FeeTargets()
 	result := []map[string]interface{}{}
 	for _, feeTarget := range feeTargets {
 		var feeRatePerKb coin.FormattedAmount
+		var estimatedMinutes interface{}
 		if feeTarget.FeeRatePerKb != nil {
-			feeRatePerKb = handlers.account.Coin().FormatAmountAsJSON(int64(*feeTarget.FeeRatePerKb))
+			feeRatePerKb = handlers.formatAmountAsJSON(*feeTarget.FeeRatePerKb)
+			estimatedMinutes = handlers.estimatedMinutes(*feeTarget.FeeRatePerKb)
 		}
 		result = append(result,
 			map[string]interface{}{
-				"code":         feeTarget.Code,
-				"feeRatePerKb": feeRatePerKb,
+				"code":             feeTarget.Code,
+				"feeRatePerKb":     feeRatePerKb,
+				"estimatedMinutes": estimatedMinutes,
 			})
 	}
-	return map[string]interface{}{
-		"feeTargets":       result,
-		"defaultFeeTarget": defaultFeeTarget,
-	}, nil
+	response := map[string]interface{}{
+		"feeTargets":         result,
+		"defaultFeeTarget":   defaultFeeTarget,
+		"minFeeRatePerVByte": nil,
+	}
+	if minFeeRatePerKb := handlers.account.MinFeeRatePerKb(); minFeeRatePerKb != nil {
+		response["minFeeRatePerVByte"] = float64(*minFeeRatePerKb) / 1000
+	}
+	if blocksParam := r.URL.Query().Get("blocks"); blocksParam != "" {
+		blocks, err := strconv.Atoi(blocksParam)
+		if err != nil || blocks <= 0 {
+			return nil, errp.New("invalid number of blocks")
+		}
+		var target map[string]interface{}
+		if feeRatePerKb := handlers.account.FeeRateForBlocks(blocks); feeRatePerKb != nil {
+			target = map[string]interface{}{
+				"blocks":           blocks,
+				"feeRatePerKb":     handlers.formatAmountAsJSON(*feeRatePerKb),
+				"feeRatePerVByte":  float64(*feeRatePerKb) / 1000,
+				"estimatedMinutes": handlers.estimatedMinutes(*feeRatePerKb),
+			}
+		}
+		response["target"] = target
+	}
+	return response, nil
 }
 
 func (handlers *Handlers) postInit(_ *http.Request) (interface{}, error) {
@@ -308,26 +838,95 @@ func (handlers *Handlers) getAccountStatus(_ *http.Request) (interface{}, error)
 	return status, nil
 }
 
+// formatAddress returns the address as shown to the user.
+func (handlers *Handlers) formatAddress(address *addresses.AccountAddress) string {
+	return handlers.account.Coin().(*btc.Coin).EncodeAddress(address.Address)
+}
+
+// getReceiveAddresses returns the unused receive addresses, the ones not shown yet first. Once an
+// address is shown to the user, postAddressShown() needs to be called, so that the next call starts
+// with a fresh address. After all of them were shown, the least recently shown one is returned
+// first again, see btc.Account.GetUnusedReceiveAddresses().
 func (handlers *Handlers) getReceiveAddresses(_ *http.Request) (interface{}, error) {
+	unusedAddresses := handlers.account.GetUnusedReceiveAddresses()
 	addresses := []interface{}{}
-	for _, address := range handlers.account.GetUnusedReceiveAddresses() {
+	for _, address := range unusedAddresses {
 		addresses = append(addresses, struct {
 			Address       string `json:"address"`
 			ScriptHashHex string `json:"scriptHashHex"`
 		}{
-			Address:       address.EncodeAddress(),
+			Address:       handlers.formatAddress(address),
 			ScriptHashHex: string(address.PubkeyScriptHashHex()),
 		})
 	}
 	return addresses, nil
 }
 
+// postAddressShown records that the receive address with the given scriptHashHex was shown to the
+// user, also in the address audit log.
+func (handlers *Handlers) postAddressShown(r *http.Request) (interface{}, error) {
+	var scriptHashHex string
+	if err := json.NewDecoder(r.Body).Decode(&scriptHashHex); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := handlers.account.MarkAddressDisplayed(
+		blockchain.ScriptHashHex(scriptHashHex)); err != nil {
+		return nil, err
+	}
+	address := handlers.account.LookupReceiveAddress(blockchain.ScriptHashHex(scriptHashHex))
+	return true, handlers.addressAudit.Record(addressaudit.Entry{
+		AccountCode: handlers.account.Code(),
+		Address:     handlers.formatAddress(address),
+		Action:      addressaudit.ActionDisplayed,
+	})
+}
+
+// getAddressUsage returns the addresses which were shown or paid to, with the number of txs paying
+// to each of them. A receiveCount above one means the address was reused.
+func (handlers *Handlers) getAddressUsage(_ *http.Request) (interface{}, error) {
+	result := []map[string]interface{}{}
+	for _, usage := range handlers.account.AddressUsage() {
+		var displayed *string
+		if usage.Displayed != nil {
+			formatted := usage.Displayed.Format(time.RFC3339)
+			displayed = &formatted
+		}
+		result = append(result, map[string]interface{}{
+			"address":       usage.Address,
+			"scriptHashHex": usage.ScriptHashHex,
+			"change":        usage.Change,
+			"receiveCount":  usage.ReceiveCount,
+			"reused":        usage.ReceiveCount > 1,
+			"displayed":     displayed,
+		})
+	}
+	return result, nil
+}
+
 func (handlers *Handlers) postVerifyAddress(r *http.Request) (interface{}, error) {
 	var scriptHashHex string
 	if err := json.NewDecoder(r.Body).Decode(&scriptHashHex); err != nil {
 		return nil, errp.WithStack(err)
 	}
-	return handlers.account.VerifyAddress(blockchain.ScriptHashHex(scriptHashHex))
+	address := handlers.account.LookupReceiveAddress(blockchain.ScriptHashHex(scriptHashHex))
+	verified, err := handlers.account.VerifyAddress(blockchain.ScriptHashHex(scriptHashHex))
+	if err != nil || !verified {
+		return verified, err
+	}
+	secureOutputs, err := handlers.account.Keystores().SecureOutputs()
+	if err != nil {
+		return nil, err
+	}
+	entry := addressaudit.Entry{
+		AccountCode: handlers.account.Code(),
+		Address:     handlers.formatAddress(address),
+		Action:      addressaudit.ActionVerified,
+	}
+	for _, secureOutput := range secureOutputs {
+		entry.DeviceIDs = append(entry.DeviceIDs, secureOutput.Identifier)
+		entry.VerificationTypes = append(entry.VerificationTypes, secureOutput.Type)
+	}
+	return true, handlers.addressAudit.Record(entry)
 }
 
 func (handlers *Handlers) postConvertToLegacyAddress(r *http.Request) (interface{}, error) {
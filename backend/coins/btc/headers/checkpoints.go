@@ -0,0 +1,206 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// maxHeadersPerRequest is the maximum number of headers an Electrum server returns per request.
+const maxHeadersPerRequest = 2016
+
+// lastCheckpoint returns the most recent checkpoint compiled into the chain parameters, or nil if
+// there is none.
+func (headers *Headers) lastCheckpoint() *chaincfg.Checkpoint {
+	if len(headers.net.Checkpoints) == 0 {
+		return nil
+	}
+	return &headers.net.Checkpoints[len(headers.net.Checkpoints)-1]
+}
+
+// syncStart returns the height from which headers are downloaded if they are not synced yet.
+//
+// Instead of starting at genesis, we start at the retarget window preceding the one of the last
+// checkpoint, which is the earliest window needed to compute the difficulty of the headers after
+// the checkpoint. The headers up to the checkpoint are not checked for difficulty and proof of
+// work, as they are committed to by the hash of the checkpoint. The skipped headers are fetched
+// lazily by HeaderByHeight().
+func (headers *Headers) syncStart() int {
+	checkpoint := headers.lastCheckpoint()
+	if checkpoint == nil {
+		return 0
+	}
+	blocksPerRetarget := headers.blocksPerRetarget()
+	start := (int(checkpoint.Height)/blocksPerRetarget - 1) * blocksPerRetarget
+	if headers.net.Net == ltc.MainNetParams.Net {
+		// See getTarget(): Litecoin also needs the last header of the previous window.
+		start--
+	}
+	if start < 0 {
+		return 0
+	}
+	return start
+}
+
+// fetchHeaders synchronously downloads `count` headers starting at `start`.
+func (headers *Headers) fetchHeaders(start, count int) ([]*wire.BlockHeader, error) {
+	var result []*wire.BlockHeader
+	done := make(chan struct{})
+	headers.blockchain.Headers(
+		start, count,
+		func(blockHeaders []*wire.BlockHeader, max int) error {
+			result = blockHeaders
+			return nil
+		},
+		func() { close(done) })
+	<-done
+	if len(result) != count {
+		return nil, errp.Newf("expected %d headers starting at %d, got %d", count, start, len(result))
+	}
+	return result, nil
+}
+
+// fetchCheckpointRoot fetches the merkle root of the header hashes up to the last checkpoint. The
+// root is served by the server, which must prove that the header at the checkpoint height, which
+// must have the checkpoint hash, is part of it. Returns nil if the server does not support
+// checkpoint proofs.
+func (headers *Headers) fetchCheckpointRoot() (*chainhash.Hash, error) {
+	checkpoint := headers.lastCheckpoint()
+	cpHeight := int(checkpoint.Height)
+	var result []*wire.BlockHeader
+	var proof *blockchain.CheckpointProof
+	done := make(chan struct{})
+	headers.blockchain.HeadersWithCheckpoint(
+		cpHeight, 1, cpHeight,
+		func(blockHeaders []*wire.BlockHeader, _ int, cpProof *blockchain.CheckpointProof) error {
+			result = blockHeaders
+			proof = cpProof
+			return nil
+		},
+		func() { close(done) })
+	<-done
+	if proof == nil {
+		return nil, nil
+	}
+	if len(result) != 1 || result[0].BlockHash() != *checkpoint.Hash {
+		return nil, errp.Newf("expected the checkpoint %s at %d", checkpoint.Hash, cpHeight)
+	}
+	if !proof.Verify(*checkpoint.Hash, cpHeight) {
+		return nil, errp.Newf("invalid proof of the checkpoint at %d", cpHeight)
+	}
+	return &proof.Root, nil
+}
+
+// verifyCheckpointProof verifies the proof that the last of the headers following `tip` is
+// committed to by the last checkpoint. The headers of a batch must connect, so the proof commits to
+// all of them. This way, a server serving a different chain is detected before its headers are
+// stored, not only when the sync reaches the checkpoint.
+func (headers *Headers) verifyCheckpointProof(
+	tip int, blockHeaders []*wire.BlockHeader, proof *blockchain.CheckpointProof) error {
+	if proof == nil || len(blockHeaders) == 0 {
+		// No proof requested, or the server does not support checkpoint proofs. The headers are
+		// verified against the checkpoint hash when the sync reaches it.
+		return nil
+	}
+	if headers.checkpointRoot == nil {
+		root, err := headers.fetchCheckpointRoot()
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			return errp.New("checkpoint proof without proof of the checkpoint")
+		}
+		headers.checkpointRoot = root
+	}
+	if proof.Root != *headers.checkpointRoot {
+		return errp.New("checkpoint proof with an unexpected root")
+	}
+	height := tip + len(blockHeaders)
+	if !proof.Verify(blockHeaders[len(blockHeaders)-1].BlockHash(), height) {
+		return errp.Newf("header %d is not committed to by the checkpoint", height)
+	}
+	return nil
+}
+
+// backfillAnchor returns the lowest height above the given height at which the block hash is known
+// and trusted, either by being a checkpoint or by being the first synced header.
+func (headers *Headers) backfillAnchor(height int) (int, *chainhash.Hash, error) {
+	start := headers.syncStart()
+	for _, checkpoint := range headers.net.Checkpoints {
+		if int(checkpoint.Height) >= height && int(checkpoint.Height) < start {
+			return int(checkpoint.Height), checkpoint.Hash, nil
+		}
+	}
+	defer headers.lock.RLock()()
+	dbTx, err := headers.db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer dbTx.Rollback()
+	header, err := dbTx.HeaderByHeight(start)
+	if err != nil {
+		return 0, nil, err
+	}
+	if header == nil {
+		return 0, nil, errp.Newf("header at sync start %d missing", start)
+	}
+	hash := header.BlockHash()
+	return start, &hash, nil
+}
+
+// backfill downloads and stores the headers from the given height up to the next trusted block
+// hash, verifying that they form a chain ending in it.
+func (headers *Headers) backfill(height int) error {
+	anchorHeight, anchorHash, err := headers.backfillAnchor(height)
+	if err != nil {
+		return err
+	}
+	headers.log.Infof("Fetching headers %d to %d skipped by the initial sync", height, anchorHeight)
+	blockHeaders := make([]*wire.BlockHeader, 0, anchorHeight-height+1)
+	for start := height; start <= anchorHeight; start += maxHeadersPerRequest {
+		batch, err := headers.fetchHeaders(start, min(maxHeadersPerRequest, anchorHeight-start+1))
+		if err != nil {
+			return err
+		}
+		blockHeaders = append(blockHeaders, batch...)
+	}
+	for i := 1; i < len(blockHeaders); i++ {
+		if blockHeaders[i].PrevBlock != blockHeaders[i-1].BlockHash() {
+			return errp.Newf("header %d does not connect to the previous one", height+i)
+		}
+	}
+	if blockHeaders[len(blockHeaders)-1].BlockHash() != *anchorHash {
+		return errp.Newf("headers from %d do not lead to the known block %s at %d",
+			height, anchorHash, anchorHeight)
+	}
+
+	defer headers.lock.Lock()()
+	dbTx, err := headers.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	for i, header := range blockHeaders {
+		if err := dbTx.PutHeaderBelowTip(height+i, header); err != nil {
+			return err
+		}
+	}
+	return dbTx.Commit()
+}
@@ -24,6 +24,8 @@ type DBTxInterface interface {
 	Rollback()
 	// PutHeader stores a header at a new tip.
 	PutHeader(tip int, header *wire.BlockHeader) error
+	// PutHeaderBelowTip stores a header which was skipped when syncing, without changing the tip.
+	PutHeaderBelowTip(height int, header *wire.BlockHeader) error
 	HeaderByHeight(height int) (*wire.BlockHeader, error)
 	PutTip(tip int) error
 	Tip() (int, error)
@@ -0,0 +1,188 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"math/big"
+	"time"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	// cashDAAWindow is the number of blocks over which the cw-144 algorithm averages the work.
+	cashDAAWindow = 144
+	// asertFractionBits is the number of fractional bits of the fixed point ASERT exponent.
+	asertFractionBits = 16
+)
+
+// headerAt is like dbTx.HeaderByHeight(), but fails if the header is not stored.
+func headerAt(dbTx DBTxInterface, height int) (*wire.BlockHeader, error) {
+	header, err := dbTx.HeaderByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, errp.Newf("missing header at %d", height)
+	}
+	return header, nil
+}
+
+// capTarget limits the target to the proof of work limit of the network.
+func (headers *Headers) capTarget(target *big.Int) *big.Int {
+	if target.Cmp(headers.net.PowLimit) > 0 {
+		return new(big.Int).Set(headers.net.PowLimit)
+	}
+	return target
+}
+
+// getDigishieldTarget computes the target of the header at the given index using Dogecoin's
+// DigiShield algorithm, which retargets with every block based on the time between the two
+// previous blocks. The adjustment is dampened and limited to 25% up and 50% down.
+func (headers *Headers) getDigishieldTarget(dbTx DBTxInterface, index int) (*big.Int, error) {
+	targetTimespan := int64(headers.net.TargetTimespan / time.Second)
+	first, err := headerAt(dbTx, index-2)
+	if err != nil {
+		return nil, err
+	}
+	last, err := headerAt(dbTx, index-1)
+	if err != nil {
+		return nil, err
+	}
+	timespan := last.Timestamp.Unix() - first.Timestamp.Unix()
+	timespan = targetTimespan + (timespan-targetTimespan)/8
+
+	minTimespan := targetTimespan - targetTimespan/4
+	maxTimespan := targetTimespan + targetTimespan/2
+	if timespan < minTimespan {
+		timespan = minTimespan
+	} else if timespan > maxTimespan {
+		timespan = maxTimespan
+	}
+	newTarget := new(big.Int).Mul(btcdBlockchain.CompactToBig(last.Bits), big.NewInt(timespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+	return headers.capTarget(newTarget), nil
+}
+
+// suitableHeader returns the header with the median timestamp of the header at the given height
+// and its two predecessors, together with its height. This makes the Bitcoin Cash difficulty
+// adjustment robust against single wrong timestamps.
+func suitableHeader(dbTx DBTxInterface, height int) (*wire.BlockHeader, int, error) {
+	heights := [3]int{height - 2, height - 1, height}
+	blockHeaders := [3]*wire.BlockHeader{}
+	for i, height := range heights {
+		header, err := headerAt(dbTx, height)
+		if err != nil {
+			return nil, 0, err
+		}
+		blockHeaders[i] = header
+	}
+	// Sorting network, the same as in the reference implementation so that ties are resolved
+	// identically.
+	for _, swap := range [][2]int{{0, 2}, {0, 1}, {1, 2}} {
+		a, b := swap[0], swap[1]
+		if blockHeaders[a].Timestamp.After(blockHeaders[b].Timestamp) {
+			blockHeaders[a], blockHeaders[b] = blockHeaders[b], blockHeaders[a]
+			heights[a], heights[b] = heights[b], heights[a]
+		}
+	}
+	return blockHeaders[1], heights[1], nil
+}
+
+// getCashTarget computes the target of the header at the given index using the cw-144
+// algorithm, which Bitcoin Cash used from November 2017 to November 2020. The target is derived
+// from the work done in the last 144 blocks and the time it took.
+func (headers *Headers) getCashTarget(dbTx DBTxInterface, index int) (*big.Int, error) {
+	last, lastHeight, err := suitableHeader(dbTx, index-1)
+	if err != nil {
+		return nil, err
+	}
+	first, firstHeight, err := suitableHeader(dbTx, index-1-cashDAAWindow)
+	if err != nil {
+		return nil, err
+	}
+	work := new(big.Int)
+	for height := firstHeight + 1; height <= lastHeight; height++ {
+		header, err := headerAt(dbTx, height)
+		if err != nil {
+			return nil, err
+		}
+		work.Add(work, btcdBlockchain.CalcWork(header.Bits))
+	}
+
+	targetTimePerBlock := int64(headers.net.TargetTimePerBlock / time.Second)
+	timespan := last.Timestamp.Unix() - first.Timestamp.Unix()
+	if timespan < cashDAAWindow/2*targetTimePerBlock {
+		timespan = cashDAAWindow / 2 * targetTimePerBlock
+	} else if timespan > cashDAAWindow*2*targetTimePerBlock {
+		timespan = cashDAAWindow * 2 * targetTimePerBlock
+	}
+	work.Mul(work, big.NewInt(targetTimePerBlock))
+	work.Div(work, big.NewInt(timespan))
+	if work.Sign() == 0 {
+		return nil, errp.Newf("no work done before header %d", index)
+	}
+	// The target is (2^256 - work) / work, the inverse of btcdBlockchain.CalcWork().
+	newTarget := new(big.Int).Lsh(big.NewInt(1), 256)
+	newTarget.Sub(newTarget, work)
+	newTarget.Div(newTarget, work)
+	return headers.capTarget(newTarget), nil
+}
+
+// getASERTTarget computes the target of the header at the given index using the aserti3-2d
+// algorithm, which Bitcoin Cash uses since November 2020. The target of the anchor block doubles
+// for every half life the chain is behind its ideal schedule, and halves for every half life it is
+// ahead of it. The exponential is approximated by a cubic polynomial in fixed point arithmetic,
+// exactly like in the reference implementation.
+func (headers *Headers) getASERTTarget(
+	dbTx DBTxInterface, index int, anchor *bch.ASERTAnchor) (*big.Int, error) {
+	previous, err := headerAt(dbTx, index-1)
+	if err != nil {
+		return nil, err
+	}
+	targetTimePerBlock := int64(headers.net.TargetTimePerBlock / time.Second)
+	timeDiff := previous.Timestamp.Unix() - anchor.PrevBlockTime
+	heightDiff := int64(index - 1 - anchor.Height)
+	exponent := ((timeDiff - targetTimePerBlock*(heightDiff+1)) << asertFractionBits) /
+		bch.ASERTHalfLife
+	shifts := exponent >> asertFractionBits
+	frac := big.NewInt(exponent - shifts<<asertFractionBits)
+
+	// factor = 2^16 + (195766423245049*frac + 971821376*frac^2 + 5127*frac^3 + 2^47) >> 48, which
+	// approximates 2^16 * 2^(frac/2^16).
+	polynomial := new(big.Int).Lsh(big.NewInt(1), 47)
+	term := new(big.Int).Set(frac)
+	for _, coefficient := range []int64{195766423245049, 971821376, 5127} {
+		polynomial.Add(polynomial, new(big.Int).Mul(big.NewInt(coefficient), term))
+		term.Mul(term, frac)
+	}
+	factor := polynomial.Rsh(polynomial, 48)
+	factor.Add(factor, big.NewInt(1<<asertFractionBits))
+
+	newTarget := new(big.Int).Mul(btcdBlockchain.CompactToBig(anchor.Bits), factor)
+	shifts -= asertFractionBits
+	if shifts <= 0 {
+		newTarget.Rsh(newTarget, uint(-shifts))
+	} else {
+		newTarget.Lsh(newTarget, uint(shifts))
+	}
+	if newTarget.Sign() == 0 {
+		return big.NewInt(1), nil
+	}
+	return headers.capTarget(newTarget), nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/db/headersdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTimedChain creates a chain of connected headers with the given bits, whose timestamps are
+// `spacing` apart.
+func makeTimedChain(length int, bits uint32, start time.Time, spacing time.Duration) []*wire.BlockHeader {
+	result := []*wire.BlockHeader{}
+	prevBlock := chainhash.Hash{}
+	for i := 0; i < length; i++ {
+		header := wire.NewBlockHeader(1, &prevBlock, &chainhash.Hash{}, bits, uint32(i))
+		header.Timestamp = start.Add(time.Duration(i) * spacing)
+		result = append(result, header)
+		prevBlock = header.BlockHash()
+	}
+	return result
+}
+
+// newHeaders stores the chain starting at the given height and returns a Headers instance on top
+// of it. The instance is not initialized, so nothing is synced.
+func newHeaders(
+	t *testing.T, net *chaincfg.Params, startHeight int, chain []*wire.BlockHeader,
+) *headers.Headers {
+	db, err := headersdb.NewDB(test.TstTempFile("headers-db-"))
+	require.NoError(t, err)
+	dbTx, err := db.Begin()
+	require.NoError(t, err)
+	for i, header := range chain {
+		require.NoError(t, dbTx.PutHeader(startHeight+i, header))
+	}
+	require.NoError(t, dbTx.Commit())
+	return headers.NewHeaders(
+		net, db, &blockchainMock.Interface{}, logging.Get().WithGroup("headers"))
+}
+
+// scaled returns target * numerator / denominator.
+func scaled(target *big.Int, numerator, denominator int64) *big.Int {
+	result := new(big.Int).Mul(target, big.NewInt(numerator))
+	return result.Div(result, big.NewInt(denominator))
+}
+
+func TestDigishieldTarget(t *testing.T) {
+	const (
+		bits   = 0x1b2e0dda
+		height = 200000
+	)
+	target := btcdBlockchain.CompactToBig(bits)
+	for _, testCase := range []struct {
+		spacing  time.Duration
+		expected *big.Int
+	}{
+		{time.Minute, target},
+		// Dampened: 60 + (30-60)/8 = 57 seconds.
+		{30 * time.Second, scaled(target, 57, 60)},
+		// Dampened: 60 + (0-60)/8 = 53 seconds.
+		{0, scaled(target, 53, 60)},
+		// Limited to 45 seconds.
+		{-2 * time.Minute, scaled(target, 45, 60)},
+		// Limited to 90 seconds.
+		{time.Hour, scaled(target, 90, 60)},
+	} {
+		chain := makeTimedChain(2, bits, time.Unix(1500000000, 0), testCase.spacing)
+		headersInstance := newHeaders(t, &doge.MainNetParams, height-2, chain)
+		newTarget, err := headersInstance.TstGetTarget(height)
+		require.NoError(t, err)
+		require.Equal(t, testCase.expected.String(), newTarget.String(), testCase.spacing.String())
+	}
+}
+
+func TestDogeAuxPow(t *testing.T) {
+	const (
+		bits   = 0x1b2e0dda
+		height = 400000
+	)
+	chain := makeTimedChain(3, bits, time.Unix(1500000000, 0), time.Minute)
+	last := chain[2]
+	net := doge.MainNetParams
+	checkpointHash := chain[1].BlockHash()
+	net.Checkpoints = []chaincfg.Checkpoint{{Height: height - 1, Hash: &checkpointHash}}
+	headersInstance := newHeaders(t, &net, height-2, chain[:2])
+
+	// Merge mined header, the proof of work of the parent block is not available.
+	last.Version = doge.AuxPowChainID<<16 | 0x100 | 4
+	require.NoError(t, headersInstance.TstCanConnect(height, last))
+
+	// Wrong difficulty.
+	last.Bits = bits + 1
+	require.Error(t, headersInstance.TstCanConnect(height, last))
+	last.Bits = bits
+
+	// Wrong chain id.
+	last.Version = 0x63<<16 | 0x100 | 4
+	require.Error(t, headersInstance.TstCanConnect(height, last))
+
+	// Not merge mined, its own proof of work is checked.
+	last.Version = 2
+	require.Error(t, headersInstance.TstCanConnect(height, last))
+}
+
+func TestCashTarget(t *testing.T) {
+	const (
+		bits   = 0x18031234
+		height = 600000
+	)
+	target := btcdBlockchain.CompactToBig(bits)
+	// The work based target only approximates the previous target.
+	requireClose := func(expected, actual *big.Int) {
+		difference := new(big.Int).Sub(expected, actual)
+		difference.Abs(difference).Mul(difference, big.NewInt(1000000))
+		require.True(t, difference.Cmp(expected) < 0, "expected %s, got %s", expected, actual)
+	}
+	for _, testCase := range []struct {
+		spacing  time.Duration
+		expected *big.Int
+	}{
+		{10 * time.Minute, target},
+		{5 * time.Minute, scaled(target, 1, 2)},
+		// Limited to half the target spacing.
+		{time.Minute, scaled(target, 1, 2)},
+		// Limited to twice the target spacing.
+		{time.Hour, scaled(target, 2, 1)},
+	} {
+		chain := makeTimedChain(150, bits, time.Unix(1550000000, 0), testCase.spacing)
+		headersInstance := newHeaders(t, &bch.MainNetParams, height-len(chain), chain)
+		newTarget, err := headersInstance.TstGetTarget(height)
+		require.NoError(t, err)
+		requireClose(testCase.expected, newTarget)
+	}
+
+	// A single block with a timestamp far in the future does not affect the target.
+	chain := makeTimedChain(150, bits, time.Unix(1550000000, 0), 10*time.Minute)
+	chain[len(chain)-1].Timestamp = chain[len(chain)-1].Timestamp.Add(24 * time.Hour)
+	headersInstance := newHeaders(t, &bch.MainNetParams, height-len(chain), chain)
+	newTarget, err := headersInstance.TstGetTarget(height)
+	require.NoError(t, err)
+	requireClose(target, newTarget)
+}
+
+func TestASERTTarget(t *testing.T) {
+	anchor := bch.MainNetASERTAnchor
+	anchorTarget := btcdBlockchain.CompactToBig(anchor.Bits)
+	const halfLife = bch.ASERTHalfLife * time.Second
+	for _, testCase := range []struct {
+		blocksAfterAnchor int
+		// offset is the deviation of the previous block's timestamp from the ideal schedule.
+		offset   time.Duration
+		expected *big.Int
+	}{
+		{0, 0, anchorTarget},
+		{10, 0, anchorTarget},
+		{0, -halfLife, scaled(anchorTarget, 1, 2)},
+		{0, halfLife, scaled(anchorTarget, 2, 1)},
+		{100, 2 * halfLife, scaled(anchorTarget, 4, 1)},
+	} {
+		index := anchor.Height + 1 + testCase.blocksAfterAnchor
+		previous := makeTimedChain(1, anchor.Bits, time.Unix(anchor.PrevBlockTime, 0), 0)[0]
+		previous.Timestamp = previous.Timestamp.Add(
+			time.Duration(testCase.blocksAfterAnchor+1)*10*time.Minute + testCase.offset)
+		headersInstance := newHeaders(t, &bch.MainNetParams, index-1, []*wire.BlockHeader{previous})
+		newTarget, err := headersInstance.TstGetTarget(index)
+		require.NoError(t, err)
+		require.Equal(t, testCase.expected.String(), newTarget.String())
+	}
+
+	// Between whole half lifes, the target is interpolated, within an error of 0.013%.
+	index := anchor.Height + 1
+	previous := makeTimedChain(1, anchor.Bits, time.Unix(anchor.PrevBlockTime, 0), 0)[0]
+	previous.Timestamp = previous.Timestamp.Add(10*time.Minute + halfLife/2)
+	headersInstance := newHeaders(t, &bch.MainNetParams, index-1, []*wire.BlockHeader{previous})
+	newTarget, err := headersInstance.TstGetTarget(index)
+	require.NoError(t, err)
+	require.True(t, newTarget.Cmp(scaled(anchorTarget, 1414, 1000)) > 0)
+	require.True(t, newTarget.Cmp(scaled(anchorTarget, 14143, 10000)) < 0)
+}
@@ -25,7 +25,9 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
@@ -53,6 +55,7 @@ const (
 type Interface interface {
 	Init()
 	SubscribeEvent(f func(Event)) func()
+	SubscribeReorg(f func(fromHeight, toHeight int)) func()
 	HeaderByHeight(int) (*wire.BlockHeader, error)
 	TipHeight() int
 	Status() (*Status, error)
@@ -67,6 +70,8 @@ type Headers struct {
 	blockchain      blockchain.Interface
 	headersPerBatch int
 	lock            locker.Locker
+	// backfillLock serializes fetching headers skipped by the initial sync.
+	backfillLock locker.Locker
 	// targetHeight is the potential tip height we are syncing up to.
 	targetHeight int
 	// tipAtInitTime is the tip at init time, i.e. the last tip known, loaded from the DB. It is
@@ -76,6 +81,18 @@ type Headers struct {
 
 	eventCallbacks []func(Event)
 	events         chan Event
+
+	reorgCallbacks []func(fromHeight, toHeight int)
+	// orphanCandidates are the hashes of the headers which were rolled back in a reorg, by height.
+	// They are compared to the headers fetched again to find out which blocks were orphaned.
+	orphanCandidates map[int]chainhash.Hash
+	// forkHeight is the lowest height at which a rolled back header was replaced, or -1.
+	forkHeight int
+	// orphanedTip is the highest height of the rolled back headers.
+	orphanedTip int
+	// checkpointRoot is the merkle root of the header hashes up to the last checkpoint, which the
+	// headers synced up to it are proven against. Nil if not fetched yet.
+	checkpointRoot *chainhash.Hash
 }
 
 // Status represents the syncing status.
@@ -108,6 +125,10 @@ func NewHeaders(
 
 		eventCallbacks: []func(Event){},
 		events:         make(chan Event),
+
+		reorgCallbacks:   []func(int, int){},
+		orphanCandidates: map[int]chainhash.Hash{},
+		forkHeight:       -1,
 	}
 }
 
@@ -122,6 +143,17 @@ func (headers *Headers) SubscribeEvent(f func(event Event)) func() {
 	}
 }
 
+// SubscribeReorg subscribes to reorgs. The provided callback is called with the range of heights
+// of the blocks which were orphaned. The returned function unsubscribes.
+// FIXME: not thread-safe
+func (headers *Headers) SubscribeReorg(f func(fromHeight, toHeight int)) func() {
+	headers.reorgCallbacks = append(headers.reorgCallbacks, f)
+	index := len(headers.reorgCallbacks) - 1
+	return func() {
+		headers.reorgCallbacks[index] = nil
+	}
+}
+
 // TipHeight returns the height of the tip.
 func (headers *Headers) TipHeight() int {
 	return headers.targetHeight
@@ -130,6 +162,9 @@ func (headers *Headers) TipHeight() int {
 // Init starts the syncing process.
 func (headers *Headers) Init() {
 	headers.tipAtInitTime = headers.tip()
+	if start := headers.syncStart(); headers.tipAtInitTime < start-1 {
+		headers.tipAtInitTime = start - 1
+	}
 	headers.log.Infof("last tip loaded: %d", headers.tipAtInitTime)
 	go headers.download()
 	headers.blockchain.HeadersSubscribe(
@@ -144,6 +179,7 @@ func (headers *Headers) Init() {
 type batchInfo struct {
 	blockHeaders []*wire.BlockHeader
 	max          int
+	proof        *blockchain.CheckpointProof
 }
 
 func (headers *Headers) download() {
@@ -165,15 +201,34 @@ func (headers *Headers) download() {
 					// TODO
 					panic(err)
 				}
+				if start := headers.syncStart(); tip < start-1 {
+					tip = start - 1
+				}
+				count := headers.headersPerBatch
+				cpHeight := 0
+				if checkpoint := headers.lastCheckpoint(); checkpoint != nil &&
+					tip < int(checkpoint.Height) {
+					// Don't request headers past the checkpoint, so that all headers up to it are
+					// proven to be committed to by it.
+					cpHeight = int(checkpoint.Height)
+					count = min(count, cpHeight-tip)
+				}
 				batchChan := make(chan batchInfo)
-				headers.blockchain.Headers(
-					tip+1, headers.headersPerBatch,
-					func(blockHeaders []*wire.BlockHeader, max int) error {
-						batchChan <- batchInfo{blockHeaders, max}
+				headers.blockchain.HeadersWithCheckpoint(
+					tip+1, count, cpHeight,
+					func(
+						blockHeaders []*wire.BlockHeader, max int, proof *blockchain.CheckpointProof,
+					) error {
+						batchChan <- batchInfo{blockHeaders, max, proof}
 						return nil
 					}, func() {})
 				batch := <-batchChan
-				if err := headers.processBatch(dbTx, tip, batch.blockHeaders, batch.max); err != nil {
+				err = headers.verifyCheckpointProof(tip, batch.blockHeaders, batch.proof)
+				if err != nil {
+					headers.log.WithError(err).Panic("verifyCheckpointProof")
+				}
+				err = headers.processBatch(dbTx, tip, count, batch.blockHeaders, batch.max)
+				if err != nil {
 					headers.log.WithError(err).Panic("processBatch")
 				}
 			}()
@@ -183,10 +238,24 @@ func (headers *Headers) download() {
 
 var errPrevHash = errors.New("header prevhash does not match")
 
+func (headers *Headers) blocksPerRetarget() int {
+	return int(headers.net.TargetTimespan / headers.net.TargetTimePerBlock)
+}
+
 func (headers *Headers) getTarget(dbTx DBTxInterface, index int) (*big.Int, error) {
+	// The special rules which applied before the algorithms below activated are not implemented.
+	// They only affect headers committed to by the checkpoints.
+	switch {
+	case headers.net.Net == doge.MainNetParams.Net && index > doge.MainNetDigishieldHeight:
+		return headers.getDigishieldTarget(dbTx, index)
+	case headers.net.Net == bch.MainNetParams.Net && index > bch.MainNetASERTAnchor.Height:
+		return headers.getASERTTarget(dbTx, index, &bch.MainNetASERTAnchor)
+	case headers.net.Net == bch.MainNetParams.Net && index > bch.MainNetDAAHeight:
+		return headers.getCashTarget(dbTx, index)
+	}
+
 	targetTimespan := int64(headers.net.TargetTimespan / time.Second)
-	targetTimePerBlock := int64(headers.net.TargetTimePerBlock / time.Second)
-	blocksPerRetarget := int(targetTimespan / targetTimePerBlock)
+	blocksPerRetarget := headers.blocksPerRetarget()
 	chunkIndex := (index / blocksPerRetarget) - 1
 	if chunkIndex == -1 {
 		return btcdBlockchain.CompactToBig(headers.net.GenesisBlock.Header.Bits), nil
@@ -226,9 +295,9 @@ func (headers *Headers) getTarget(dbTx DBTxInterface, index int) (*big.Int, erro
 
 func (headers *Headers) powHash(msg []byte) chainhash.Hash {
 	switch headers.net.Net {
-	case chaincfg.MainNetParams.Net:
+	case chaincfg.MainNetParams.Net, bch.MainNetParams.Net:
 		return chainhash.DoubleHashH(msg)
-	case ltc.MainNetParams.Net:
+	case ltc.MainNetParams.Net, doge.MainNetParams.Net:
 		const (
 			N = 1024
 			r = 1
@@ -248,6 +317,27 @@ func (headers *Headers) powHash(msg []byte) chainhash.Hash {
 	}
 }
 
+// checksProofOfWork returns true if the difficulty and proof of work of the headers are verified.
+// This is only done on the main networks, as the test networks allow blocks with the minimum
+// difficulty.
+func (headers *Headers) checksProofOfWork() bool {
+	switch headers.net.Net {
+	case chaincfg.MainNetParams.Net, ltc.MainNetParams.Net, doge.MainNetParams.Net,
+		bch.MainNetParams.Net:
+		return true
+	default:
+		return false
+	}
+}
+
+// canConnect checks whether the header can be added at the tip: it must connect to the previous
+// header, match the checkpoint and, on the main networks, have the expected difficulty and enough
+// proof of work.
+//
+// WARNING: the proof of work of merge mined (AuxPoW) Dogecoin headers is NOT verified, only their
+// difficulty and chain id. Almost all Dogecoin blocks since doge.MainNetAuxPowHeight are merge
+// mined, so above the last checkpoint, the Dogecoin headers are only as trustworthy as the
+// Electrum server serving them. See doge.IsAuxPow().
 func (headers *Headers) canConnect(dbTx DBTxInterface, tip int, header *wire.BlockHeader) error {
 	if tip == 0 {
 		if header.BlockHash() != *headers.net.GenesisHash {
@@ -259,6 +349,13 @@ func (headers *Headers) canConnect(dbTx DBTxInterface, tip int, header *wire.Blo
 		if err != nil {
 			return err
 		}
+		if previousHeader == nil {
+			if tip != headers.syncStart() {
+				return errp.Newf("missing header at %d", tip-1)
+			}
+			// First header of the initial sync. It is committed to by the last checkpoint.
+			return nil
+		}
 		prevBlock := previousHeader.BlockHash()
 		if header.PrevBlock != prevBlock {
 			return errp.Wrap(errPrevHash,
@@ -266,7 +363,10 @@ func (headers *Headers) canConnect(dbTx DBTxInterface, tip int, header *wire.Blo
 					header.PrevBlock, tip, prevBlock, tip-1))
 		}
 
-		lastCheckpoint := headers.net.Checkpoints[len(headers.net.Checkpoints)-1]
+		lastCheckpoint := headers.lastCheckpoint()
+		if lastCheckpoint == nil {
+			return nil
+		}
 		if tip == int(lastCheckpoint.Height) {
 			if *lastCheckpoint.Hash != header.BlockHash() {
 				return errp.Newf("checkpoint mismatch at %d. Expected %s, got %s",
@@ -274,8 +374,9 @@ func (headers *Headers) canConnect(dbTx DBTxInterface, tip int, header *wire.Blo
 			}
 			headers.log.Infof("checkpoint at %d matches", tip)
 		}
-		// Check Diffuclty, PoW.
-		if headers.net.Net == chaincfg.MainNetParams.Net || headers.net.Net == ltc.MainNetParams.Net {
+		// Check Diffuclty, PoW. Headers up to the checkpoint are committed to by its hash, and the
+		// headers needed to compute their difficulty might not be synced.
+		if tip > int(lastCheckpoint.Height) && headers.checksProofOfWork() {
 			newTarget, err := headers.getTarget(dbTx, tip)
 			if err != nil {
 				return err
@@ -283,17 +384,23 @@ func (headers *Headers) canConnect(dbTx DBTxInterface, tip int, header *wire.Blo
 			if header.Bits != btcdBlockchain.BigToCompact(newTarget) {
 				return errp.Newf("header %d has an unexpected difficulty", tip)
 			}
+			if headers.net.Net == doge.MainNetParams.Net && doge.IsAuxPow(header) {
+				if doge.ChainID(header) != doge.AuxPowChainID {
+					return errp.Newf("merge mined header %d has a wrong chain id", tip)
+				}
+				// The proof of work is done on the header of the parent block, which is not
+				// served by Electrum servers, so it can't be verified. The difficulty was checked
+				// above. See the warning in the doc comment of this function.
+				return nil
+			}
 			headerSerialized := &bytes.Buffer{}
 			if err := header.BtcEncode(headerSerialized, 0, wire.BaseEncoding); err != nil {
 				panic(errp.WithStack(err))
 			}
-			// Skip PoW check before the checkpoint for performance.
-			if tip > int(lastCheckpoint.Height) {
-				powHash := headers.powHash(headerSerialized.Bytes())
-				proofOfWork := btcdBlockchain.HashToBig(&powHash)
-				if proofOfWork.Cmp(newTarget) > 0 {
-					return errp.Newf("header %d, %s has insufficient proof of work.", tip, powHash)
-				}
+			powHash := headers.powHash(headerSerialized.Bytes())
+			proofOfWork := btcdBlockchain.HashToBig(&powHash)
+			if proofOfWork.Cmp(newTarget) > 0 {
+				return errp.Newf("header %d, %s has insufficient proof of work.", tip, powHash)
 			}
 		}
 	}
@@ -315,12 +422,66 @@ func (headers *Headers) reorg(dbTx DBTxInterface, tip int) {
 	if newTip < -1 {
 		newTip = -1
 	}
+	// Remember the rolled back headers, so we can tell which of them are orphaned once they are
+	// fetched again. If we are still catching up after a previous reorg, the hashes of the
+	// original chain are kept.
+	for height := newTip + 1; height <= tip; height++ {
+		if _, ok := headers.orphanCandidates[height]; ok {
+			continue
+		}
+		header, err := dbTx.HeaderByHeight(height)
+		if err != nil {
+			panic(err)
+		}
+		if header != nil {
+			headers.orphanCandidates[height] = header.BlockHash()
+		}
+	}
+	if tip > headers.orphanedTip {
+		headers.orphanedTip = tip
+	}
 	if err := dbTx.PutTip(newTip); err != nil {
 		panic(err)
 	}
 	headers.kick()
 }
 
+// checkOrphaned compares a newly stored header with the header previously stored at the same
+// height, if it was rolled back in a reorg.
+func (headers *Headers) checkOrphaned(height int, header *wire.BlockHeader) {
+	hash, ok := headers.orphanCandidates[height]
+	if !ok {
+		return
+	}
+	delete(headers.orphanCandidates, height)
+	if hash != header.BlockHash() && (headers.forkHeight == -1 || height < headers.forkHeight) {
+		headers.forkHeight = height
+	}
+}
+
+// finishReorg is called when the headers are synced. The rolled back headers which were not
+// replaced are orphaned as well, as the new chain is shorter. Subscribers are notified if any
+// headers were orphaned.
+func (headers *Headers) finishReorg() {
+	for height := range headers.orphanCandidates {
+		if headers.forkHeight == -1 || height < headers.forkHeight {
+			headers.forkHeight = height
+		}
+	}
+	if headers.forkHeight != -1 {
+		fromHeight, toHeight := headers.forkHeight, headers.orphanedTip
+		headers.log.Infof("Blocks %d to %d were orphaned", fromHeight, toHeight)
+		for _, f := range headers.reorgCallbacks {
+			if f != nil {
+				go f(fromHeight, toHeight)
+			}
+		}
+	}
+	headers.orphanCandidates = map[int]chainhash.Hash{}
+	headers.forkHeight = -1
+	headers.orphanedTip = 0
+}
+
 func (headers *Headers) notifyEvent(event Event) {
 	for _, f := range headers.eventCallbacks {
 		if f != nil {
@@ -330,7 +491,7 @@ func (headers *Headers) notifyEvent(event Event) {
 }
 
 func (headers *Headers) processBatch(
-	dbTx DBTxInterface, tip int, blockHeaders []*wire.BlockHeader, max int) error {
+	dbTx DBTxInterface, tip int, count int, blockHeaders []*wire.BlockHeader, max int) error {
 	for _, header := range blockHeaders {
 		err := headers.canConnect(dbTx, tip+1, header)
 		if errp.Cause(err) == errPrevHash {
@@ -345,23 +506,48 @@ func (headers *Headers) processBatch(
 		if err := dbTx.PutHeader(tip, header); err != nil {
 			return err
 		}
+		headers.checkOrphaned(tip, header)
 	}
-	if len(blockHeaders) == min(max, headers.headersPerBatch) {
+	if len(blockHeaders) == min(max, count) {
 		// Received max number of headers per batch, so there might be more.
 		headers.kick()
 		headers.log.Debugf("Syncing headers; tip: %d", tip)
 		headers.notifyEvent(EventSyncing)
-	} else if len(blockHeaders) != 0 {
-		headers.log.Debugf("Synced headers; tip: %d", tip)
-		headers.notifyEvent(EventSynced)
+	} else {
+		headers.finishReorg()
+		if len(blockHeaders) != 0 {
+			headers.log.Debugf("Synced headers; tip: %d", tip)
+			headers.notifyEvent(EventSynced)
+		}
 	}
 	headers.headersPerBatch = max
 	return nil
 }
 
 // HeaderByHeight returns the header at the given height. Returns nil if the headers are not synced
-// up to this height yet.
+// up to this height yet. Headers skipped by the initial sync are downloaded and verified against
+// the next checkpoint first, which blocks until they are fetched.
 func (headers *Headers) HeaderByHeight(height int) (*wire.BlockHeader, error) {
+	header, err := headers.headerByHeight(height)
+	if err != nil || header != nil || height >= headers.syncStart() {
+		return header, err
+	}
+	defer headers.backfillLock.Lock()()
+	// Might have been fetched while waiting for the lock.
+	header, err = headers.headerByHeight(height)
+	if err != nil || header != nil {
+		return header, err
+	}
+	if headers.tip() < height {
+		return nil, nil
+	}
+	if err := headers.backfill(height); err != nil {
+		return nil, err
+	}
+	return headers.headerByHeight(height)
+}
+
+func (headers *Headers) headerByHeight(height int) (*wire.BlockHeader, error) {
 	defer headers.lock.RLock()()
 	dbTx, err := headers.db.Begin()
 	if err != nil {
@@ -0,0 +1,47 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"math/big"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+)
+
+const TstReorgLimit = reorgLimit
+
+func (headers *Headers) TstGetTarget(index int) (*big.Int, error) {
+	dbTx, err := headers.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
+	return headers.getTarget(dbTx, index)
+}
+
+func (headers *Headers) TstCanConnect(tip int, header *wire.BlockHeader) error {
+	dbTx, err := headers.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	return headers.canConnect(dbTx, tip, header)
+}
+
+func (headers *Headers) TstVerifyCheckpointProof(
+	tip int, blockHeaders []*wire.BlockHeader, proof *blockchain.CheckpointProof) error {
+	return headers.verifyCheckpointProof(tip, blockHeaders, proof)
+}
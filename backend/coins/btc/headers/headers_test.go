@@ -0,0 +1,369 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/db/headersdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// extendChain returns a copy of the chain extended by `count` connected headers, without valid
+// proof of work. Chains extended from the same header with a different `branch` diverge.
+func extendChain(chain []*wire.BlockHeader, count int, branch uint32) []*wire.BlockHeader {
+	result := append([]*wire.BlockHeader{}, chain...)
+	prevBlock := chainhash.Hash{}
+	if len(chain) > 0 {
+		prevBlock = chain[len(chain)-1].BlockHash()
+	}
+	for i := 0; i < count; i++ {
+		header := wire.NewBlockHeader(1, &prevBlock, &chainhash.Hash{}, 0, branch<<16|uint32(i))
+		result = append(result, header)
+		prevBlock = header.BlockHash()
+	}
+	return result
+}
+
+// makeChain creates a chain of connected headers, without valid proof of work.
+func makeChain(length int) []*wire.BlockHeader {
+	return extendChain(nil, length, 0)
+}
+
+func TestHeaderByHeightBackfill(t *testing.T) {
+	chain := makeChain(16)
+	hash := func(height int) *chainhash.Hash {
+		blockHash := chain[height].BlockHash()
+		return &blockHash
+	}
+
+	net := chaincfg.RegressionNetParams
+	// Retarget every 4 blocks, so that the initial sync starts at height 8.
+	net.TargetTimespan = 4 * net.TargetTimePerBlock
+	net.Checkpoints = []chaincfg.Checkpoint{
+		{Height: 5, Hash: hash(5)},
+		{Height: 13, Hash: hash(13)},
+	}
+	db, err := headersdb.NewDB(test.TstTempFile("headers-db-"))
+	require.NoError(t, err)
+	dbTx, err := db.Begin()
+	require.NoError(t, err)
+	for height := 8; height < len(chain); height++ {
+		require.NoError(t, dbTx.PutHeader(height, chain[height]))
+	}
+	require.NoError(t, dbTx.Commit())
+
+	requests := []int{}
+	server := &blockchainMock.Interface{}
+	server.On("Headers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			start, count := args.Int(0), args.Int(1)
+			requests = append(requests, start)
+			success := args.Get(2).(func([]*wire.BlockHeader, int) error)
+			cleanup := args.Get(3).(func())
+			require.NoError(t, success(chain[start:start+count], 2016))
+			cleanup()
+		})
+	headersInstance := headers.NewHeaders(&net, db, server, logging.Get().WithGroup("headers"))
+
+	// Synced header, no request needed.
+	header, err := headersInstance.HeaderByHeight(10)
+	require.NoError(t, err)
+	require.Equal(t, chain[10], header)
+	require.Empty(t, requests)
+
+	// Verified against the first checkpoint.
+	header, err = headersInstance.HeaderByHeight(2)
+	require.NoError(t, err)
+	require.Equal(t, chain[2], header)
+	require.Equal(t, []int{2}, requests)
+	header, err = headersInstance.HeaderByHeight(4)
+	require.NoError(t, err)
+	require.Equal(t, chain[4], header)
+	require.Equal(t, []int{2}, requests)
+
+	// Verified against the first synced header.
+	header, err = headersInstance.HeaderByHeight(6)
+	require.NoError(t, err)
+	require.Equal(t, chain[6], header)
+	require.Equal(t, []int{2, 6}, requests)
+
+	// Not synced yet.
+	header, err = headersInstance.HeaderByHeight(20)
+	require.NoError(t, err)
+	require.Nil(t, header)
+}
+
+func TestHeaderByHeightBackfillInvalid(t *testing.T) {
+	chain := makeChain(16)
+	// Connects, but does not lead to the first synced header at height 8.
+	otherChain := makeChain(16)
+	otherChain[8].Timestamp = time.Unix(1, 0)
+
+	net := chaincfg.RegressionNetParams
+	net.TargetTimespan = 4 * net.TargetTimePerBlock
+	blockHash := chain[13].BlockHash()
+	net.Checkpoints = []chaincfg.Checkpoint{{Height: 13, Hash: &blockHash}}
+	db, err := headersdb.NewDB(test.TstTempFile("headers-db-"))
+	require.NoError(t, err)
+	dbTx, err := db.Begin()
+	require.NoError(t, err)
+	for height := 8; height < len(chain); height++ {
+		require.NoError(t, dbTx.PutHeader(height, chain[height]))
+	}
+	require.NoError(t, dbTx.Commit())
+
+	server := &blockchainMock.Interface{}
+	server.On("Headers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			start, count := args.Int(0), args.Int(1)
+			success := args.Get(2).(func([]*wire.BlockHeader, int) error)
+			require.NoError(t, success(otherChain[start:start+count], 2016))
+			args.Get(3).(func())()
+		})
+	headersInstance := headers.NewHeaders(&net, db, server, logging.Get().WithGroup("headers"))
+	_, err = headersInstance.HeaderByHeight(2)
+	require.Error(t, err)
+}
+
+type headersSuccess = func([]*wire.BlockHeader, int, *blockchain.CheckpointProof) error
+
+// checkpointProof returns the proof that the header at `height` is part of the merkle tree of the
+// hashes of the headers up to `cpHeight`, built like an Electrum server does.
+func checkpointProof(chain []*wire.BlockHeader, height, cpHeight int) *blockchain.CheckpointProof {
+	level := []chainhash.Hash{}
+	for _, header := range chain[:cpHeight+1] {
+		level = append(level, header.BlockHash())
+	}
+	branch := []chainhash.Hash{}
+	for index := height; len(level) > 1; index >>= 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[index^1])
+		nextLevel := []chainhash.Hash{}
+		for i := 0; i < len(level); i += 2 {
+			pair := append(append([]byte{}, level[i][:]...), level[i+1][:]...)
+			nextLevel = append(nextLevel, chainhash.DoubleHashH(pair))
+		}
+		level = nextLevel
+	}
+	return &blockchain.CheckpointProof{Root: level[0], Branch: branch}
+}
+
+// checkpointServer serves the headers of the chain, with checkpoint proofs if requested.
+// The returned function returns the requests as (start, count, cpHeight).
+func checkpointServer(
+	t *testing.T, chain []*wire.BlockHeader) (*blockchainMock.Interface, func() [][3]int) {
+	var requestsLock sync.Mutex
+	requests := [][3]int{}
+	server := &blockchainMock.Interface{}
+	server.On("HeadersWithCheckpoint",
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			start, count, cpHeight := args.Int(0), args.Int(1), args.Int(2)
+			requestsLock.Lock()
+			requests = append(requests, [3]int{start, count, cpHeight})
+			requestsLock.Unlock()
+			end := start + count
+			if end > len(chain) {
+				end = len(chain)
+			}
+			var proof *blockchain.CheckpointProof
+			if cpHeight != 0 {
+				proof = checkpointProof(chain, end-1, cpHeight)
+			}
+			success := args.Get(3).(headersSuccess)
+			cleanup := args.Get(4).(func())
+			go func() {
+				defer cleanup()
+				require.NoError(t, success(chain[start:end], 2016, proof))
+			}()
+		})
+	return server, func() [][3]int {
+		requestsLock.Lock()
+		defer requestsLock.Unlock()
+		return append([][3]int{}, requests...)
+	}
+}
+
+func TestCheckpointSync(t *testing.T) {
+	chain := makeChain(20)
+	blockHash := chain[13].BlockHash()
+	net := chaincfg.RegressionNetParams
+	// Retarget every 4 blocks, so that the initial sync starts at height 8.
+	net.TargetTimespan = 4 * net.TargetTimePerBlock
+	net.Checkpoints = []chaincfg.Checkpoint{{Height: 13, Hash: &blockHash}}
+
+	server, requests := checkpointServer(t, chain)
+	server.On("HeadersSubscribe", mock.Anything, mock.Anything)
+	db, err := headersdb.NewDB(test.TstTempFile("headers-db-"))
+	require.NoError(t, err)
+	headersInstance := headers.NewHeaders(&net, db, server, logging.Get().WithGroup("headers"))
+	synced := make(chan struct{}, 10)
+	headersInstance.SubscribeEvent(func(event headers.Event) {
+		if event == headers.EventSynced {
+			synced <- struct{}{}
+		}
+	})
+	headersInstance.Init()
+	waitFor(t, synced)
+	status, err := headersInstance.Status()
+	require.NoError(t, err)
+	require.Equal(t, 19, status.Tip)
+	require.Equal(t,
+		[][3]int{
+			// The headers up to the checkpoint, with the proof of the last one.
+			{8, 6, 13},
+			// The proof of the checkpoint, to get the root.
+			{13, 1, 13},
+			// The headers after the checkpoint.
+			{14, 2016, 0},
+		},
+		requests())
+}
+
+func TestCheckpointProofInvalid(t *testing.T) {
+	chain := makeChain(20)
+	// Diverges from the chain before the checkpoint.
+	otherChain := extendChain(chain[:10], 10, 1)
+	blockHash := chain[13].BlockHash()
+	net := chaincfg.RegressionNetParams
+	net.TargetTimespan = 4 * net.TargetTimePerBlock
+	net.Checkpoints = []chaincfg.Checkpoint{{Height: 13, Hash: &blockHash}}
+
+	server, _ := checkpointServer(t, chain)
+	db, err := headersdb.NewDB(test.TstTempFile("headers-db-"))
+	require.NoError(t, err)
+	headersInstance := headers.NewHeaders(&net, db, server, logging.Get().WithGroup("headers"))
+
+	require.NoError(t, headersInstance.TstVerifyCheckpointProof(
+		7, chain[8:12], checkpointProof(chain, 11, 13)))
+	// Proven against the tree of the other chain.
+	require.Error(t, headersInstance.TstVerifyCheckpointProof(
+		7, otherChain[8:12], checkpointProof(otherChain, 11, 13)))
+	// Proven against the right tree, but for a different header.
+	require.Error(t, headersInstance.TstVerifyCheckpointProof(
+		7, otherChain[8:12], checkpointProof(chain, 11, 13)))
+	// Proven at a different height.
+	require.Error(t, headersInstance.TstVerifyCheckpointProof(
+		8, chain[8:12], checkpointProof(chain, 11, 13)))
+}
+
+func waitFor(t *testing.T, events <-chan struct{}) {
+	select {
+	case <-events:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timeout")
+	}
+}
+
+func TestReorg(t *testing.T) {
+	for _, depth := range []int{1, 10, headers.TstReorgLimit} {
+		t.Run(fmt.Sprintf("depth=%d", depth), func(t *testing.T) {
+			testReorg(t, depth)
+		})
+	}
+}
+
+// testReorg syncs 150 headers and then replaces the last `depth` of them with a longer fork.
+func testReorg(t *testing.T, depth int) {
+	net := chaincfg.RegressionNetParams
+	genesis := net.GenesisBlock.Header
+	chain := extendChain([]*wire.BlockHeader{&genesis}, 149, 0)
+
+	var serverChainLock sync.Mutex
+	serverChain := chain
+	server := &blockchainMock.Interface{}
+	server.On("HeadersWithCheckpoint",
+		mock.Anything, mock.Anything, 0, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			serverChainLock.Lock()
+			defer serverChainLock.Unlock()
+			start, count := args.Int(0), args.Int(1)
+			end := start + count
+			if end > len(serverChain) {
+				end = len(serverChain)
+			}
+			if start > end {
+				start = end
+			}
+			blockHeaders := serverChain[start:end]
+			success := args.Get(3).(headersSuccess)
+			cleanup := args.Get(4).(func())
+			go func() {
+				defer cleanup()
+				require.NoError(t, success(blockHeaders, 2016, nil))
+			}()
+		})
+	var onNewTip func(*blockchain.Header) error
+	server.On("HeadersSubscribe", mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			onNewTip = args.Get(1).(func(*blockchain.Header) error)
+		})
+
+	db, err := headersdb.NewDB(test.TstTempFile("headers-db-"))
+	require.NoError(t, err)
+	headersInstance := headers.NewHeaders(&net, db, server, logging.Get().WithGroup("headers"))
+	synced := make(chan struct{}, 10)
+	headersInstance.SubscribeEvent(func(event headers.Event) {
+		if event == headers.EventSynced {
+			synced <- struct{}{}
+		}
+	})
+	reorged := make(chan struct{}, 10)
+	var reorgFrom, reorgTo int
+	headersInstance.SubscribeReorg(func(fromHeight, toHeight int) {
+		reorgFrom, reorgTo = fromHeight, toHeight
+		reorged <- struct{}{}
+	})
+	headersInstance.Init()
+	waitFor(t, synced)
+	status, err := headersInstance.Status()
+	require.NoError(t, err)
+	require.Equal(t, 149, status.Tip)
+
+	forkHeight := len(chain) - depth
+	fork := extendChain(chain[:forkHeight], depth+5, 1)
+	serverChainLock.Lock()
+	serverChain = fork
+	serverChainLock.Unlock()
+	require.NoError(t, onNewTip(&blockchain.Header{BlockHeight: len(fork) - 1}))
+
+	waitFor(t, reorged)
+	require.Equal(t, forkHeight, reorgFrom)
+	require.Equal(t, 149, reorgTo)
+	waitFor(t, synced)
+	status, err = headersInstance.Status()
+	require.NoError(t, err)
+	require.Equal(t, len(fork)-1, status.Tip)
+	for _, height := range []int{forkHeight - 1, forkHeight, len(fork) - 1} {
+		header, err := headersInstance.HeaderByHeight(height)
+		require.NoError(t, err)
+		require.Equal(t, fork[height].BlockHash(), header.BlockHash())
+	}
+}
@@ -77,6 +77,22 @@ func (_m *Interface) SubscribeEvent(f func(headers.Event)) func() {
 	return r0
 }
 
+// SubscribeReorg provides a mock function with given fields: f
+func (_m *Interface) SubscribeReorg(f func(int, int)) func() {
+	ret := _m.Called(f)
+
+	var r0 func()
+	if rf, ok := ret.Get(0).(func(func(int, int)) func()); ok {
+		r0 = rf(f)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(func())
+		}
+	}
+
+	return r0
+}
+
 // TipHeight provides a mock function with given fields:
 func (_m *Interface) TipHeight() int {
 	ret := _m.Called()
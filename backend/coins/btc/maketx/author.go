@@ -29,10 +29,10 @@ func feeForSerializeSize(relayFeePerKb btcutil.Amount, txSerializeSize int, log
 	return fee
 }
 
-// isDustAmount determines whether a transaction output value and script length would
+// IsDustAmount determines whether a transaction output value and script length would
 // cause the output to be considered dust.  Transactions with dust outputs are
 // not standard and are rejected by mempools with default policies.
-func isDustAmount(
+func IsDustAmount(
 	amount btcutil.Amount,
 	pkScriptSize int,
 	configuration *signing.Configuration,
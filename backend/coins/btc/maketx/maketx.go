@@ -183,7 +183,7 @@ func NewTx(
 			LockTime: 0,
 		}
 		changeAmount := selectedOutputsSum - targetAmount - maxRequiredFee
-		changeIsDust := isDustAmount(
+		changeIsDust := IsDustAmount(
 			changeAmount, len(changePKScript), changeAddress.Configuration, feePerKb)
 		finalFee := maxRequiredFee
 		if changeIsDust {
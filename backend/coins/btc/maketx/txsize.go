@@ -32,6 +32,31 @@ func outputSize(pkScriptSize int) int {
 	return 8 + wire.VarIntSerializeSize(uint64(pkScriptSize)) + pkScriptSize
 }
 
+// witnessSize is the size of the witness of an input, which has the format:
+// <serialized sig> <serialized compressed pubkey>
+func witnessSize() int {
+	const (
+		signatureSize = 73 // including SIGHASH op
+		pubkeySize    = 33
+	)
+	return wire.VarIntSerializeSize(2) +
+		wire.VarIntSerializeSize(signatureSize) + signatureSize +
+		wire.VarIntSerializeSize(pubkeySize) + pubkeySize
+}
+
+// InputVSize gives the worst case virtual size of an input with the given structure, taking segwit
+// discount into account. It is the size the input adds to a tx.
+func InputVSize(inputConfiguration *signing.Configuration) int {
+	const nonWitness = 4 // factor for non-witness fields
+	sigScriptSize, hasWitness := addresses.SigScriptWitnessSize(inputConfiguration)
+	weight := nonWitness * calcInputSize(sigScriptSize)
+	if hasWitness {
+		weight += witnessSize()
+	}
+	// return weight/4 rounded up.
+	return (weight + 3) / 4
+}
+
 // estimateTxSize gives the worst case tx size estimate. All inputs are assumed to be of the same
 // structure.
 // inputCount is the number of inputs in the tx.
@@ -59,16 +84,8 @@ func estimateTxSize(
 		outputSize(outputPkScriptSize) +
 		outputSize(changePkScriptSize))
 	if hasWitness {
-		// For now, every input has a witness serialization of this format:
-		// <serialized sig> <serialized compressed pubkey>
-		const (
-			signatureSize = 73 // including SIGHASH op
-			pubkeySize    = 33
-		)
-		witnessSize := wire.VarIntSerializeSize(2) +
-			wire.VarIntSerializeSize(signatureSize) + signatureSize +
-			wire.VarIntSerializeSize(pubkeySize) + pubkeySize
-		txWeight += inputCount * witnessSize
+		// For now, every input has a witness of the same format, see witnessSize().
+		txWeight += inputCount * witnessSize()
 		txWeight += 2 // segwit marker + segwit flag
 	}
 	// return txWeight/4 rounded up.
@@ -21,6 +21,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
@@ -50,7 +51,7 @@ func TestEstimateTxSize(t *testing.T) {
 		t.Run(fmt.Sprintf("%s/%s/%s", inputScriptType, outputScriptType, changeStr),
 			func(t *testing.T) {
 				inputAddress := addressesTest.GetAddress(inputScriptType)
-				sigScript, witness := inputAddress.SignatureScript([]*btcec.Signature{sig})
+				sigScript, witness := inputAddress.SignatureScript([]*btcec.Signature{sig}, txscript.SigHashAll)
 				outputPkScript := addressesTest.GetAddress(outputScriptType).PubkeyScript()
 				tx := &wire.MsgTx{
 					Version: wire.TxVersion,
@@ -103,3 +104,14 @@ func TestEstimateTxSize(t *testing.T) {
 		}
 	}
 }
+
+func TestInputVSize(t *testing.T) {
+	require.Equal(t, 148, InputVSize(addressesTest.GetAddress(signing.ScriptTypeP2PKH).Configuration))
+	for _, scriptType := range []signing.ScriptType{
+		signing.ScriptTypeP2PKH, signing.ScriptTypeP2WPKHP2SH, signing.ScriptTypeP2WPKH} {
+		configuration := addressesTest.GetAddress(scriptType).Configuration
+		// Adding an input grows the tx by its size, up to rounding.
+		growth := estimateTxSize(2, configuration, 25, 0) - estimateTxSize(1, configuration, 25, 0)
+		require.InDelta(t, growth, InputVSize(configuration), 1, string(scriptType))
+	}
+}
@@ -21,10 +21,12 @@ import (
 	"github.com/btcsuite/btcutil/txsort"
 	"github.com/sirupsen/logrus"
 
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 )
@@ -37,6 +39,79 @@ type ProposedTransaction struct {
 	// Signatures collects the signatures (signatures[transactionInput][cosignerIndex]).
 	Signatures [][]*btcec.Signature
 	SigHashes  *txscript.TxSigHashes
+	// SigHashType is the signature hash type of all signatures. For Bitcoin Cash, it includes
+	// bch.SigHashForkID, and the signature hashes have to be computed with bch.CalcSignatureHash().
+	SigHashType txscript.SigHashType
+}
+
+// SignatureHashes implements coin.ProposedTransaction. There is one signature hash per input.
+func (proposedTx *ProposedTransaction) SignatureHashes() ([]*coin.SignatureHash, error) {
+	signatureHashes := []*coin.SignatureHash{}
+	transaction := proposedTx.TXProposal.Transaction
+	for index, txIn := range transaction.TxIn {
+		spentOutput, ok := proposedTx.PreviousOutputs[txIn.PreviousOutPoint]
+		if !ok {
+			return nil, errp.New("There needs to be exactly one output being spent per input!")
+		}
+		address := proposedTx.GetAddress(spentOutput.ScriptHashHex())
+		isSegwit, subScript := address.ScriptForHashToSign()
+		var signatureHash []byte
+		var err error
+		switch {
+		case proposedTx.SigHashType&bch.SigHashForkID != 0:
+			signatureHash, err = bch.CalcSignatureHash(subScript, proposedTx.SigHashes,
+				proposedTx.SigHashType, transaction, index, spentOutput.Value)
+			if err != nil {
+				return nil, errp.Wrap(err, "Failed to calculate replay protected signature hash")
+			}
+		case isSegwit:
+			signatureHash, err = txscript.CalcWitnessSigHash(subScript, proposedTx.SigHashes,
+				txscript.SigHashAll, transaction, index, spentOutput.Value)
+			if err != nil {
+				return nil, errp.Wrap(err, "Failed to calculate SegWit signature hash")
+			}
+		default:
+			signatureHash, err = txscript.CalcSignatureHash(
+				subScript, txscript.SigHashAll, transaction, index)
+			if err != nil {
+				return nil, errp.Wrap(err, "Failed to calculate legacy signature hash")
+			}
+		}
+		signatureHashes = append(signatureHashes, &coin.SignatureHash{
+			Hash:    signatureHash,
+			Keypath: address.Configuration.AbsoluteKeypath(),
+		})
+	}
+	return signatureHashes, nil
+}
+
+// SetSignatures implements coin.ProposedTransaction.
+func (proposedTx *ProposedTransaction) SetSignatures(
+	cosignerIndex int,
+	signatures []*btcec.Signature,
+) error {
+	if len(signatures) != len(proposedTx.TXProposal.Transaction.TxIn) {
+		return errp.New("number of signatures doesn't match number of inputs")
+	}
+	for index, signature := range signatures {
+		proposedTx.Signatures[index][cosignerIndex] = signature
+	}
+	return nil
+}
+
+// VerificationTxProposal returns the tx proposal with the script of each spent output in the
+// signature script of its input, which is the serialization the mobile verification app expects.
+// The signature scripts are replaced once the tx is signed.
+func (proposedTx *ProposedTransaction) VerificationTxProposal() *maketx.TxProposal {
+	for _, txIn := range proposedTx.TXProposal.Transaction.TxIn {
+		spentOutput, ok := proposedTx.PreviousOutputs[txIn.PreviousOutPoint]
+		if !ok {
+			continue
+		}
+		address := proposedTx.GetAddress(spentOutput.ScriptHashHex())
+		_, txIn.SignatureScript = address.ScriptForHashToSign()
+	}
+	return proposedTx.TXProposal
 }
 
 // SignTransaction signs all inputs. It assumes all outputs spent belong to this
@@ -46,6 +121,7 @@ func SignTransaction(
 	txProposal *maketx.TxProposal,
 	previousOutputs map[wire.OutPoint]*transactions.SpendableOutput,
 	getAddress func(blockchain.ScriptHashHex) *addresses.AccountAddress,
+	sigHashType txscript.SigHashType,
 	log *logrus.Entry,
 ) error {
 	proposedTransaction := &ProposedTransaction{
@@ -54,6 +130,7 @@ func SignTransaction(
 		GetAddress:      getAddress,
 		Signatures:      make([][]*btcec.Signature, len(txProposal.Transaction.TxIn)),
 		SigHashes:       txscript.NewTxSigHashes(txProposal.Transaction),
+		SigHashType:     sigHashType,
 	}
 
 	for i := range proposedTransaction.Signatures {
@@ -68,12 +145,12 @@ func SignTransaction(
 		spentOutput := previousOutputs[input.PreviousOutPoint]
 		address := proposedTransaction.GetAddress(spentOutput.ScriptHashHex())
 		input.SignatureScript, input.Witness = address.SignatureScript(
-			proposedTransaction.Signatures[index])
+			proposedTransaction.Signatures[index], sigHashType)
 	}
 
 	// Sanity check: see if the created transaction is valid.
 	if err := txValidityCheck(txProposal.Transaction, previousOutputs,
-		proposedTransaction.SigHashes); err != nil {
+		proposedTransaction.SigHashes, sigHashType); err != nil {
 		log.WithError(err).Panic("Failed to pass transaction validity check.")
 	}
 
@@ -81,7 +158,7 @@ func SignTransaction(
 }
 
 func txValidityCheck(transaction *wire.MsgTx, previousOutputs map[wire.OutPoint]*transactions.SpendableOutput,
-	sigHashes *txscript.TxSigHashes) error {
+	sigHashes *txscript.TxSigHashes, sigHashType txscript.SigHashType) error {
 	if !txsort.IsSorted(transaction) {
 		return errp.New("tx not bip69 conformant")
 	}
@@ -90,6 +167,14 @@ func txValidityCheck(transaction *wire.MsgTx, previousOutputs map[wire.OutPoint]
 		if !ok {
 			return errp.New("There needs to be exactly one output being spent per input!")
 		}
+		if sigHashType&bch.SigHashForkID != 0 {
+			// The script engine does not know the replay protected signature hash of Bitcoin Cash.
+			if err := bch.VerifyP2PKHSignature(spentOutput.PkScript, sigHashes, transaction,
+				index, spentOutput.Value); err != nil {
+				return err
+			}
+			continue
+		}
 		engine, err := txscript.NewEngine(spentOutput.PkScript, transaction, index,
 			txscript.StandardVerifyFlags, nil, sigHashes, spentOutput.Value)
 		if err != nil {
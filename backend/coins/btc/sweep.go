@@ -0,0 +1,287 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/txsort"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bip38"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// sweepScript is an output script of a key to sweep.
+type sweepScript struct {
+	pkScript []byte
+	// redeemScript is set for P2SH-P2WPKH outputs.
+	redeemScript []byte
+	witness      bool
+}
+
+// SweepResult describes the tx created by Sweep().
+type SweepResult struct {
+	Transaction *wire.MsgTx
+	// Amount is the amount received by the account.
+	Amount btcutil.Amount
+	Fee    btcutil.Amount
+}
+
+// decodeSweepKey decodes a private key in WIF, or a BIP38 encrypted key.
+func decodeSweepKey(privateKey string, passphrase string, net *chaincfg.Params) (*btcutil.WIF, error) {
+	if bip38.IsEncrypted(privateKey) {
+		wif, err := bip38.Decrypt(privateKey, passphrase, net)
+		if errp.Cause(err) == bip38.ErrWrongPassphrase {
+			return nil, errp.WithStack(TxValidationError("wrong passphrase"))
+		}
+		if err != nil {
+			return nil, errp.WithStack(TxValidationError("invalid private key"))
+		}
+		return wif, nil
+	}
+	wif, err := btcutil.DecodeWIF(privateKey)
+	if err != nil || !wif.IsForNet(net) {
+		return nil, errp.WithStack(TxValidationError("invalid private key"))
+	}
+	return wif, nil
+}
+
+// sweepScripts returns the scripts whose outputs can be spent with the key: P2PKH, and if segwit is
+// true and the key is compressed, also P2WPKH and P2SH-P2WPKH.
+func sweepScripts(wif *btcutil.WIF, net *chaincfg.Params, segwit bool) ([]*sweepScript, error) {
+	pubKeyHash := btcutil.Hash160(wif.SerializePubKey())
+	p2pkhAddress, err := btcutil.NewAddressPubKeyHash(pubKeyHash, net)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	p2pkhScript, err := txscript.PayToAddrScript(p2pkhAddress)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	scripts := []*sweepScript{{pkScript: p2pkhScript}}
+	if !segwit || !wif.CompressPubKey {
+		// Segwit outputs require segwit to be activated and compressed public keys.
+		return scripts, nil
+	}
+	p2wpkhAddress, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, net)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	p2wpkhScript, err := txscript.PayToAddrScript(p2wpkhAddress)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	p2shAddress, err := btcutil.NewAddressScriptHash(p2wpkhScript, net)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	p2shScript, err := txscript.PayToAddrScript(p2shAddress)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return append(scripts,
+		&sweepScript{pkScript: p2wpkhScript, witness: true},
+		&sweepScript{pkScript: p2shScript, redeemScript: p2wpkhScript, witness: true},
+	), nil
+}
+
+// listUnspent synchronously fetches the unspent outputs of the script.
+func (account *Account) listUnspent(pkScript []byte) ([]*blockchain.UTXO, error) {
+	var result []*blockchain.UTXO
+	var resultErr error
+	done := make(chan struct{})
+	account.blockchain.ScriptHashListUnspent(
+		blockchain.ScriptHashHex(chainhash.HashH(pkScript).String()),
+		func(utxos []*blockchain.UTXO) error {
+			result = utxos
+			return nil
+		},
+		func(err error) { resultErr = err },
+		func() { close(done) },
+	)
+	<-done
+	return result, resultErr
+}
+
+// signSweep signs all inputs of the tx, which spend the given outputs. If sigHashType includes
+// bch.SigHashForkID, all outputs must be P2PKH.
+func signSweep(
+	tx *wire.MsgTx,
+	wif *btcutil.WIF,
+	spentOutputs map[wire.OutPoint]*wire.TxOut,
+	scripts map[wire.OutPoint]*sweepScript,
+	sigHashType txscript.SigHashType,
+) error {
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for index, txIn := range tx.TxIn {
+		spentOutput := spentOutputs[txIn.PreviousOutPoint]
+		script := scripts[txIn.PreviousOutPoint]
+		if sigHashType&bch.SigHashForkID != 0 {
+			signatureScript, err := bchSignatureScript(
+				tx, sigHashes, index, spentOutput, wif, sigHashType)
+			if err != nil {
+				return err
+			}
+			txIn.SignatureScript = signatureScript
+			continue
+		}
+		if !script.witness {
+			signatureScript, err := txscript.SignatureScript(
+				tx, index, script.pkScript, sigHashType, wif.PrivKey, wif.CompressPubKey)
+			if err != nil {
+				return errp.WithStack(err)
+			}
+			txIn.SignatureScript = signatureScript
+			continue
+		}
+		subScript := script.pkScript
+		if script.redeemScript != nil {
+			subScript = script.redeemScript
+			signatureScript, err := txscript.NewScriptBuilder().AddData(script.redeemScript).Script()
+			if err != nil {
+				return errp.WithStack(err)
+			}
+			txIn.SignatureScript = signatureScript
+		}
+		witness, err := txscript.WitnessSignature(tx, sigHashes, index, spentOutput.Value,
+			subScript, sigHashType, wif.PrivKey, true)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		txIn.Witness = witness
+	}
+	return nil
+}
+
+// bchSignatureScript returns the signature script of a P2PKH input, signed with the replay
+// protected signature hash of Bitcoin Cash.
+func bchSignatureScript(
+	tx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes,
+	index int,
+	spentOutput *wire.TxOut,
+	wif *btcutil.WIF,
+	sigHashType txscript.SigHashType,
+) ([]byte, error) {
+	signatureHash, err := bch.CalcSignatureHash(
+		spentOutput.PkScript, sigHashes, sigHashType, tx, index, spentOutput.Value)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	signature, err := wif.PrivKey.Sign(signatureHash)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	signatureScript, err := txscript.NewScriptBuilder().
+		AddData(append(signature.Serialize(), byte(sigHashType))).
+		AddData(wif.SerializePubKey()).
+		Script()
+	return signatureScript, errp.WithStack(err)
+}
+
+// sweepAmount returns the amount received by the account after deducting the fee from the swept
+// total. The received output must not be dust, as the tx would not be relayed.
+func sweepAmount(
+	total btcutil.Amount,
+	fee btcutil.Amount,
+	pkScript []byte,
+	configuration *signing.Configuration,
+	feeRatePerKb btcutil.Amount,
+) (btcutil.Amount, error) {
+	if fee >= total {
+		return 0, errp.WithStack(maketx.ErrInsufficientFunds)
+	}
+	if maketx.IsDustAmount(total-fee, len(pkScript), configuration, feeRatePerKb) {
+		return 0, errp.WithStack(
+			TxValidationError("the funds of this key are too small to pay for the fee"))
+	}
+	return total - fee, nil
+}
+
+// Sweep sends all funds of the given private key to an unused receive address of the account. The
+// key is either in WIF, or BIP38 encrypted with the passphrase. The key is only used in memory to
+// sign the tx, which is broadcast.
+func (account *Account) Sweep(
+	privateKey string,
+	passphrase string,
+	feeTargetCode FeeTargetCode,
+) (*SweepResult, error) {
+	wif, err := decodeSweepKey(privateKey, passphrase, account.coin.Net())
+	if err != nil {
+		return nil, err
+	}
+	feeRatePerKb, err := account.feeRatePerKb(feeTargetCode, 0)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := sweepScripts(wif, account.coin.Net(), account.coin.segwit())
+	if err != nil {
+		return nil, err
+	}
+	spentOutputs := map[wire.OutPoint]*wire.TxOut{}
+	outPointScripts := map[wire.OutPoint]*sweepScript{}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	var total btcutil.Amount
+	for _, script := range scripts {
+		utxos, err := account.listUnspent(script.pkScript)
+		if err != nil {
+			return nil, err
+		}
+		for _, utxo := range utxos {
+			outPoint := wire.OutPoint{Hash: utxo.TXHash.Hash(), Index: uint32(utxo.TXPos)}
+			spentOutputs[outPoint] = wire.NewTxOut(utxo.Value, script.pkScript)
+			outPointScripts[outPoint] = script
+			tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
+			total += btcutil.Amount(utxo.Value)
+		}
+	}
+	if len(tx.TxIn) == 0 {
+		return nil, errp.WithStack(TxValidationError("no funds found for this key"))
+	}
+
+	receiveAddress := account.GetUnusedReceiveAddresses()[0]
+	output := wire.NewTxOut(int64(total), receiveAddress.PubkeyScript())
+	tx.AddTxOut(output)
+	txsort.InPlaceSort(tx)
+	// Sign once to learn the size of the tx, then deduct the fee and sign again.
+	if err := signSweep(
+		tx, wif, spentOutputs, outPointScripts, account.coin.sigHashType()); err != nil {
+		return nil, err
+	}
+	fee := feeRatePerKb * btcutil.Amount(mempool.GetTxVirtualSize(btcutil.NewTx(tx))) / 1000
+	amount, err := sweepAmount(
+		total, fee, output.PkScript, receiveAddress.Configuration, feeRatePerKb)
+	if err != nil {
+		return nil, err
+	}
+	output.Value = int64(amount)
+	if err := signSweep(
+		tx, wif, spentOutputs, outPointScripts, account.coin.sigHashType()); err != nil {
+		return nil, err
+	}
+
+	account.log.WithField("inputs", len(tx.TxIn)).WithField("fee", fee).Info("Sweeping private key")
+	if err := account.transactions.Broadcast(tx); err != nil {
+		return nil, err
+	}
+	return &SweepResult{Transaction: tx, Amount: amount, Fee: fee}, nil
+}
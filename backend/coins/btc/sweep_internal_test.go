@@ -0,0 +1,161 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/btcsuite/btcutil/txsort"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSweepKey(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	privateKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	wif, err := btcutil.NewWIF(privateKey, net, true)
+	require.NoError(t, err)
+
+	decoded, err := decodeSweepKey(wif.String(), "", net)
+	require.NoError(t, err)
+	require.Equal(t, wif.String(), decoded.String())
+
+	_, err = decodeSweepKey(wif.String(), "", &chaincfg.MainNetParams)
+	_, ok := errp.Cause(err).(TxValidationError)
+	require.True(t, ok)
+	_, err = decodeSweepKey("invalid", "", net)
+	_, ok = errp.Cause(err).(TxValidationError)
+	require.True(t, ok)
+}
+
+func TestSignSweep(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	for _, compressed := range []bool{true, false} {
+		privateKey, err := btcec.NewPrivateKey(btcec.S256())
+		require.NoError(t, err)
+		wif, err := btcutil.NewWIF(privateKey, net, compressed)
+		require.NoError(t, err)
+		scripts, err := sweepScripts(wif, net, true)
+		require.NoError(t, err)
+		if compressed {
+			require.Len(t, scripts, 3)
+		} else {
+			require.Len(t, scripts, 1)
+		}
+
+		tx := wire.NewMsgTx(wire.TxVersion)
+		spentOutputs := map[wire.OutPoint]*wire.TxOut{}
+		outPointScripts := map[wire.OutPoint]*sweepScript{}
+		for index, script := range scripts {
+			outPoint := wire.OutPoint{Hash: chainhash.Hash{byte(index)}, Index: uint32(index)}
+			spentOutputs[outPoint] = wire.NewTxOut(100000, script.pkScript)
+			outPointScripts[outPoint] = script
+			tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
+		}
+		tx.AddTxOut(wire.NewTxOut(90000, scripts[0].pkScript))
+		require.NoError(t, signSweep(
+			tx, wif, spentOutputs, outPointScripts, txscript.SigHashAll))
+
+		sigHashes := txscript.NewTxSigHashes(tx)
+		for index, txIn := range tx.TxIn {
+			spentOutput := spentOutputs[txIn.PreviousOutPoint]
+			engine, err := txscript.NewEngine(spentOutput.PkScript, tx, index,
+				txscript.StandardVerifyFlags, nil, sigHashes, spentOutput.Value)
+			require.NoError(t, err)
+			require.NoError(t, engine.Execute())
+		}
+	}
+}
+
+// TestSignSweepP2PKH checks that only P2PKH outputs are swept on networks without segwit, and that
+// Bitcoin Cash inputs are signed with the replay protected signature hash.
+func TestSignSweepP2PKH(t *testing.T) {
+	for _, coin := range []*Coin{
+		NewCoin("tbch", "Bitcoin Cash Testnet", "TBCH", &bch.TestNet3Params, ".",
+			[]*rpc.ServerInfo{}, "", nil),
+		NewCoin("tdoge", "Dogecoin Testnet", "TDOGE", &doge.TestNet3Params, ".",
+			[]*rpc.ServerInfo{}, "", nil),
+	} {
+		require.False(t, coin.segwit())
+		privateKey, err := btcec.NewPrivateKey(btcec.S256())
+		require.NoError(t, err)
+		wif, err := btcutil.NewWIF(privateKey, coin.Net(), true)
+		require.NoError(t, err)
+		scripts, err := sweepScripts(wif, coin.Net(), coin.segwit())
+		require.NoError(t, err)
+		require.Len(t, scripts, 1)
+		require.Equal(t, txscript.PubKeyHashTy, txscript.GetScriptClass(scripts[0].pkScript))
+
+		tx := wire.NewMsgTx(wire.TxVersion)
+		spentOutputs := map[wire.OutPoint]*wire.TxOut{}
+		outPointScripts := map[wire.OutPoint]*sweepScript{}
+		previousOutputs := map[wire.OutPoint]*transactions.SpendableOutput{}
+		for index := 0; index < 2; index++ {
+			outPoint := wire.OutPoint{Hash: chainhash.Hash{byte(index)}, Index: uint32(index)}
+			spentOutputs[outPoint] = wire.NewTxOut(100000, scripts[0].pkScript)
+			outPointScripts[outPoint] = scripts[0]
+			previousOutputs[outPoint] = &transactions.SpendableOutput{TxOut: spentOutputs[outPoint]}
+			tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
+		}
+		tx.AddTxOut(wire.NewTxOut(190000, scripts[0].pkScript))
+		txsort.InPlaceSort(tx)
+		require.NoError(t, signSweep(
+			tx, wif, spentOutputs, outPointScripts, coin.sigHashType()))
+		sigHashes := txscript.NewTxSigHashes(tx)
+		require.NoError(t, txValidityCheck(tx, previousOutputs, sigHashes, coin.sigHashType()))
+		if bch.IsNet(coin.Net()) {
+			// The signatures are not valid without the fork id.
+			require.Error(t, txValidityCheck(tx, previousOutputs, sigHashes, txscript.SigHashAll))
+		}
+	}
+}
+
+func TestSweepAmount(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	seed := make([]byte, hdkeychain.RecommendedSeedLen)
+	master, err := hdkeychain.NewMaster(seed, net)
+	require.NoError(t, err)
+	xpub, err := master.Neuter()
+	require.NoError(t, err)
+	configuration := signing.NewSinglesigConfiguration(
+		signing.ScriptTypeP2WPKH, signing.NewEmptyAbsoluteKeypath(), xpub)
+	pkScript := make([]byte, 22)
+
+	amount, err := sweepAmount(10000, 800, pkScript, configuration, 1000)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(9200), amount)
+
+	// The received output would be dust.
+	_, err = sweepAmount(1000, 800, pkScript, configuration, 1000)
+	_, ok := errp.Cause(err).(TxValidationError)
+	require.True(t, ok)
+
+	_, err = sweepAmount(800, 800, pkScript, configuration, 1000)
+	require.Equal(t, maketx.ErrInsufficientFunds, errp.Cause(err))
+}
@@ -15,6 +15,8 @@
 package btc
 
 import (
+	"math"
+
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -33,10 +35,15 @@ func (err TxValidationError) Error() string {
 	return string(err)
 }
 
-// SendAmount is either a concrete amount, or "all"/"max".
+// SendAmount is either a concrete amount, an amount in a fiat currency, or "all"/"max".
 type SendAmount struct {
 	amount  btcutil.Amount
 	sendAll bool
+	// fiatAmount is set if the amount is given in the fiat currency fiat. It is converted at rate,
+	// if it was locked, and otherwise at the current exchange rate. See Coin.ResolveSendAmount().
+	fiatAmount float64
+	fiat       string
+	rate       float64
 }
 
 // NewSendAmount creates a new SendAmount based on a concrete amount.
@@ -52,37 +59,96 @@ func NewSendAmountAll() SendAmount {
 	return SendAmount{amount: 0, sendAll: true}
 }
 
+// NewSendAmountFiat creates a new SendAmount based on an amount in a fiat currency, e.g. "USD".
+func NewSendAmountFiat(fiatAmount float64, fiat string) (SendAmount, error) {
+	if fiatAmount <= 0 || fiat == "" {
+		return SendAmount{}, errp.New("invalid amount")
+	}
+	return SendAmount{fiatAmount: fiatAmount, fiat: fiat}, nil
+}
+
+// WithRate locks the exchange rate at which a fiat amount is converted, usually the one returned
+// with the proposal the user reviewed. It has no effect on amounts not given in fiat.
+func (sendAmount SendAmount) WithRate(rate float64) SendAmount {
+	if sendAmount.fiat != "" {
+		sendAmount.rate = rate
+	}
+	return sendAmount
+}
+
+// Amount returns the concrete amount, or 0 if all funds are sent.
+func (sendAmount SendAmount) Amount() btcutil.Amount {
+	return sendAmount.amount
+}
+
+// SendAll returns true if all funds are sent.
+func (sendAmount SendAmount) SendAll() bool {
+	return sendAmount.sendAll
+}
+
+// ResolveSendAmount converts an amount given in fiat to a concrete amount. The rate used is
+// returned as well, or 0 if the amount was not given in fiat. If the rate was locked with
+// SendAmount.WithRate(), it is used as long as the current rate does not deviate from it by more
+// than the fiat rate tolerance, so that the amount does not change between the proposal and
+// signing.
+func (coin *Coin) ResolveSendAmount(amount SendAmount) (SendAmount, float64, error) {
+	if amount.fiat == "" {
+		return amount, 0, nil
+	}
+	currentRate, ok := coin.ExchangeRate(amount.fiat)
+	if ok && currentRate <= 0 {
+		ok = false
+	}
+	rate := amount.rate
+	switch {
+	case rate == 0 && !ok:
+		return SendAmount{}, 0, errp.WithStack(TxValidationError("exchange rate not available"))
+	case rate == 0:
+		rate = currentRate
+	case ok && math.Abs(currentRate-rate)/rate > coin.fiatRateTolerance:
+		return SendAmount{}, 0, errp.WithStack(
+			TxValidationError("the exchange rate changed, please review the transaction again"))
+	}
+	btcAmount, err := btcutil.NewAmount(amount.fiatAmount / rate)
+	if err != nil {
+		return SendAmount{}, 0, errp.WithStack(TxValidationError("invalid amount"))
+	}
+	resolved, err := NewSendAmount(btcAmount)
+	if err != nil {
+		return SendAmount{}, 0, errp.WithStack(TxValidationError("invalid amount"))
+	}
+	return resolved, rate, nil
+}
+
 // newTx creates a new tx to the given recipient address. It also returns a set of used account
 // outputs, which contains all outputs that spent in the tx. Those are needed to be able to sign the
 // transaction. selectedUTXOs restricts the available coins; if empty, no restriction is applied and
-// all unspent coins can be used.
+// all unspent coins can be used. customFeeRatePerKb is only used if feeTargetCode is
+// FeeTargetCodeCustom.
 func (account *Account) newTx(
 	recipientAddress string,
 	amount SendAmount,
 	feeTargetCode FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
 	selectedUTXOs map[wire.OutPoint]struct{},
 ) (
 	map[wire.OutPoint]*transactions.SpendableOutput, *maketx.TxProposal, error) {
 
 	account.log.Debug("Prepare new transaction")
 
-	address, err := btcutil.DecodeAddress(recipientAddress, account.coin.Net())
+	amount, _, err := account.coin.ResolveSendAmount(amount)
 	if err != nil {
-		return nil, nil, errp.WithStack(TxValidationError("invalid address"))
+		return nil, nil, err
 	}
-	if !address.IsForNet(account.coin.Net()) {
+
+	address, err := account.coin.DecodeAddress(recipientAddress)
+	if err != nil {
 		return nil, nil, errp.WithStack(TxValidationError("invalid address"))
 	}
 
-	var feeTarget *FeeTarget
-	for _, target := range account.feeTargets {
-		if target.Code == feeTargetCode {
-			feeTarget = target
-			break
-		}
-	}
-	if feeTarget == nil || feeTarget.FeeRatePerKb == nil {
-		return nil, nil, errp.New("Fee could not be estimated")
+	feeRatePerKb, err := account.feeRatePerKb(feeTargetCode, customFeeRatePerKb)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	pkScript, err := txscript.PayToAddrScript(address)
@@ -107,7 +173,7 @@ func (account *Account) newTx(
 			account.signingConfiguration,
 			wireUTXO,
 			pkScript,
-			*feeTarget.FeeRatePerKb,
+			feeRatePerKb,
 			account.log,
 		)
 		if err != nil {
@@ -119,7 +185,7 @@ func (account *Account) newTx(
 			account.signingConfiguration,
 			wireUTXO,
 			wire.NewTxOut(int64(amount.amount), pkScript),
-			*feeTarget.FeeRatePerKb,
+			feeRatePerKb,
 			func() *addresses.AccountAddress {
 				return account.changeAddresses.GetUnused()[0]
 			},
@@ -133,22 +199,71 @@ func (account *Account) newTx(
 	return utxo, txProposal, nil
 }
 
+// feeRatePerKb returns the fee rate of the given fee target, or the custom fee rate if the target is
+// FeeTargetCodeCustom. Custom fee rates below the minimum relay fee are rejected.
+func (account *Account) feeRatePerKb(
+	feeTargetCode FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
+) (btcutil.Amount, error) {
+	if feeTargetCode == FeeTargetCodeCustom {
+		if customFeeRatePerKb <= 0 {
+			return 0, errp.WithStack(TxValidationError("invalid fee rate"))
+		}
+		minFeeRatePerKb := account.MinFeeRatePerKb()
+		if minFeeRatePerKb == nil {
+			return 0, errp.New("Minimum relay fee not known yet")
+		}
+		if customFeeRatePerKb < *minFeeRatePerKb {
+			return 0, errp.WithStack(TxValidationError("fee rate below minimum relay fee"))
+		}
+		return customFeeRatePerKb, nil
+	}
+	for _, target := range account.feeTargets {
+		if target.Code == feeTargetCode {
+			if target.FeeRatePerKb == nil {
+				break
+			}
+			return *target.FeeRatePerKb, nil
+		}
+	}
+	return 0, errp.New("Fee could not be estimated")
+}
+
 // SendTx creates, signs and sends tx which sends `amount` to the recipient.
 func (account *Account) SendTx(
 	recipientAddress string,
 	amount SendAmount,
 	feeTargetCode FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
 	selectedUTXOs map[wire.OutPoint]struct{},
 ) error {
+	tx, err := account.SignTx(
+		recipientAddress, amount, feeTargetCode, customFeeRatePerKb, selectedUTXOs)
+	if err != nil {
+		return err
+	}
+	return account.BroadcastTx(tx)
+}
+
+// SignTx creates and signs a tx which sends `amount` to the recipient, without broadcasting it.
+// See BroadcastTx().
+func (account *Account) SignTx(
+	recipientAddress string,
+	amount SendAmount,
+	feeTargetCode FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
+	selectedUTXOs map[wire.OutPoint]struct{},
+) (*wire.MsgTx, error) {
 	account.log.Info("Sending transaction")
 	utxo, txProposal, err := account.newTx(
 		recipientAddress,
 		amount,
 		feeTargetCode,
+		customFeeRatePerKb,
 		selectedUTXOs,
 	)
 	if err != nil {
-		return errp.WithMessage(err, "Failed to create transaction")
+		return nil, errp.WithMessage(err, "Failed to create transaction")
 	}
 	getAddress := func(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
 		if address := account.receiveAddresses.LookupByScriptHashHex(scriptHashHex); address != nil {
@@ -159,11 +274,17 @@ func (account *Account) SendTx(
 		}
 		panic("address must be present")
 	}
-	if err := SignTransaction(account.keystores, txProposal, utxo, getAddress, account.log); err != nil {
-		return errp.WithMessage(err, "Failed to sign transaction")
+	if err := SignTransaction(account.keystores, txProposal, utxo, getAddress,
+		account.coin.sigHashType(), account.log); err != nil {
+		return nil, errp.WithMessage(err, "Failed to sign transaction")
 	}
+	return txProposal.Transaction, nil
+}
+
+// BroadcastTx broadcasts a tx signed by SignTx().
+func (account *Account) BroadcastTx(tx *wire.MsgTx) error {
 	account.log.Info("Signed transaction is broadcasted")
-	return account.blockchain.TransactionBroadcast(txProposal.Transaction)
+	return account.transactions.Broadcast(tx)
 }
 
 // TxProposal creates a tx from the relevant input and returns information about it for display in
@@ -172,6 +293,7 @@ func (account *Account) TxProposal(
 	recipientAddress string,
 	amount SendAmount,
 	feeTargetCode FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
 	selectedUTXOs map[wire.OutPoint]struct{},
 ) (
 	btcutil.Amount, btcutil.Amount, btcutil.Amount, error) {
@@ -181,6 +303,7 @@ func (account *Account) TxProposal(
 		recipientAddress,
 		amount,
 		feeTargetCode,
+		customFeeRatePerKb,
 		selectedUTXOs,
 	)
 	if err != nil {
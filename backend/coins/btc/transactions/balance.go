@@ -0,0 +1,363 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"sort"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// OutputState is the state of an unspent output of the wallet. See the OutputState* constants.
+type OutputState string
+
+const (
+	// OutputStateConfirmed is a confirmed output which can be spent.
+	OutputStateConfirmed OutputState = "confirmed"
+	// OutputStateUnconfirmedOwn is an unconfirmed output of a tx funded by the wallet alone, e.g.
+	// change. It can be spent.
+	OutputStateUnconfirmedOwn OutputState = "unconfirmedOwn"
+	// OutputStateIncoming is an unconfirmed output paid to the wallet by someone else. It can not be
+	// spent until it confirms.
+	OutputStateIncoming OutputState = "incoming"
+	// OutputStateImmature is a coinbase output which did not reach the coinbase maturity yet.
+	OutputStateImmature OutputState = "immature"
+	// OutputStateFrozen is an output frozen by the user. It is not used when creating txs.
+	OutputStateFrozen OutputState = "frozen"
+	// OutputStateReserved is an output spent by one of our own txs which is not known to the server
+	// (yet), see TxStatusBroadcast and TxStatusDropped.
+	OutputStateReserved OutputState = "reserved"
+	// OutputStateQuarantined is a tiny output paid to the wallet by someone else, which is likely
+	// part of a dust attack. It is not used when creating txs unless released by the user, as
+	// spending it together with other outputs links them. See QuarantineReason.
+	OutputStateQuarantined OutputState = "quarantined"
+)
+
+// QuarantineReason explains why an output is quarantined. See the QuarantineReason* constants.
+type QuarantineReason string
+
+const (
+	// QuarantineReasonDust is an incoming output below the dust threshold.
+	QuarantineReasonDust QuarantineReason = "dust"
+	// QuarantineReasonReusedAddressDust is a small incoming output paid to an address which already
+	// received funds in another tx. Dust attacks target addresses known to be in use.
+	QuarantineReasonReusedAddressDust QuarantineReason = "reusedAddressDust"
+)
+
+// reusedAddressDustFactor is the multiple of the dust threshold below which incoming outputs paid
+// to an already used address are quarantined.
+const reusedAddressDustFactor = 10
+
+// Spendable returns true if outputs in this state can be used to create a tx.
+func (state OutputState) Spendable() bool {
+	return state == OutputStateConfirmed || state == OutputStateUnconfirmedOwn
+}
+
+// UTXO is an unspent output of the wallet, in any state.
+type UTXO struct {
+	OutPoint wire.OutPoint
+	TxOut    *wire.TxOut
+	Address  string
+	// Height is the height of the tx creating the output. 0 (or -1) for unconfirmed.
+	Height int
+	State  OutputState
+	// QuarantineReason is set if the output is suspected to be dust. Such outputs are in the
+	// quarantined state unless the user released them.
+	QuarantineReason QuarantineReason
+}
+
+// BalanceAmounts is the sum of the unspent outputs in each state.
+type BalanceAmounts struct {
+	Confirmed      btcutil.Amount
+	UnconfirmedOwn btcutil.Amount
+	Incoming       btcutil.Amount
+	Immature       btcutil.Amount
+	Frozen         btcutil.Amount
+	Reserved       btcutil.Amount
+	Quarantined    btcutil.Amount
+}
+
+func (amounts *BalanceAmounts) add(state OutputState, value btcutil.Amount) {
+	switch state {
+	case OutputStateConfirmed:
+		amounts.Confirmed += value
+	case OutputStateUnconfirmedOwn:
+		amounts.UnconfirmedOwn += value
+	case OutputStateIncoming:
+		amounts.Incoming += value
+	case OutputStateImmature:
+		amounts.Immature += value
+	case OutputStateFrozen:
+		amounts.Frozen += value
+	case OutputStateReserved:
+		amounts.Reserved += value
+	case OutputStateQuarantined:
+		amounts.Quarantined += value
+	}
+}
+
+// Spendable is the sum of the outputs which can be used to create a tx. This is the most that can
+// be sent, before fees.
+func (amounts *BalanceAmounts) Spendable() btcutil.Amount {
+	return amounts.Confirmed + amounts.UnconfirmedOwn
+}
+
+// Total is the sum of all unspent outputs.
+func (amounts *BalanceAmounts) Total() btcutil.Amount {
+	return amounts.Spendable() + amounts.Incoming + amounts.Immature + amounts.Frozen +
+		amounts.Reserved + amounts.Quarantined
+}
+
+// BalanceBreakdown is the balance of the wallet split by the state of the outputs, in total and per
+// address.
+type BalanceBreakdown struct {
+	BalanceAmounts
+	// Addresses maps addresses to their balance. Only addresses with unspent outputs are included.
+	Addresses map[string]*BalanceAmounts
+	// UTXOs are all unspent outputs, sorted by value descending.
+	UTXOs []*UTXO
+}
+
+// isImmature returns true if the tx is a coinbase tx whose outputs can not be spent yet.
+func (transactions *Transactions) isImmature(tx *wire.MsgTx, height int) bool {
+	if !btcdBlockchain.IsCoinBaseTx(tx) {
+		return false
+	}
+	if height <= 0 {
+		return true
+	}
+	return transactions.headersTipHeight-height+1 < int(transactions.net.CoinbaseMaturity)
+}
+
+// receivingTxs returns the txs paying to each output script. A tx paying twice to the same address
+// counts once.
+func receivingTxs(outputs map[wire.OutPoint]*wire.TxOut) map[string]map[chainhash.Hash]struct{} {
+	result := map[string]map[chainhash.Hash]struct{}{}
+	for outPoint, txOut := range outputs {
+		script := string(txOut.PkScript)
+		if _, ok := result[script]; !ok {
+			result[script] = map[chainhash.Hash]struct{}{}
+		}
+		result[script][outPoint.Hash] = struct{}{}
+	}
+	return result
+}
+
+// SetDustThreshold sets the value below which incoming outputs are quarantined. 0 disables the
+// quarantine.
+func (transactions *Transactions) SetDustThreshold(threshold btcutil.Amount) {
+	defer transactions.Lock()()
+	transactions.dustThreshold = threshold
+}
+
+// quarantineReason returns why the output should be quarantined, or "" if it is not suspicious.
+// Only outputs of txs funded by someone else can be quarantined. receivingTxs are the txs paying to
+// each output script.
+func (transactions *Transactions) quarantineReason(
+	dbTx DBTxInterface,
+	tx *wire.MsgTx,
+	txOut *wire.TxOut,
+	receivingTxs map[string]map[chainhash.Hash]struct{},
+) QuarantineReason {
+	if transactions.dustThreshold == 0 || btcdBlockchain.IsCoinBaseTx(tx) {
+		return ""
+	}
+	value := btcutil.Amount(txOut.Value)
+	if value >= reusedAddressDustFactor*transactions.dustThreshold ||
+		transactions.allInputsOurs(dbTx, tx) {
+		return ""
+	}
+	switch {
+	case value < transactions.dustThreshold:
+		return QuarantineReasonDust
+	case len(receivingTxs[string(txOut.PkScript)]) > 1:
+		return QuarantineReasonReusedAddressDust
+	default:
+		return ""
+	}
+}
+
+// checkQuarantine notifies the user with EventOutputQuarantined if one of the new outputs of the tx
+// is quarantined.
+func (transactions *Transactions) checkQuarantine(
+	dbTx DBTxInterface, tx *wire.MsgTx, newOutputs []*wire.TxOut) {
+	if transactions.dustThreshold == 0 {
+		return
+	}
+	var outputs map[wire.OutPoint]*wire.TxOut
+	for _, txOut := range newOutputs {
+		if btcutil.Amount(txOut.Value) >= reusedAddressDustFactor*transactions.dustThreshold {
+			continue
+		}
+		if outputs == nil {
+			var err error
+			outputs, err = dbTx.Outputs()
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve outputs")
+			}
+		}
+		if transactions.quarantineReason(dbTx, tx, txOut, receivingTxs(outputs)) != "" {
+			transactions.log.WithField("value", txOut.Value).Info("Output quarantined")
+			transactions.notifyEvent(EventOutputQuarantined)
+			return
+		}
+	}
+}
+
+// utxos returns all unspent outputs of the wallet. Outputs of evicted txs are not included, as
+// they will never exist.
+func (transactions *Transactions) utxos(dbTx DBTxInterface) []*UTXO {
+	outputs, err := dbTx.Outputs()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve outputs")
+	}
+	frozenOutputs, err := dbTx.FrozenOutputs()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve frozen outputs")
+	}
+	releasedOutputs, err := dbTx.ReleasedOutputs()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve released outputs")
+	}
+	lockedOutputs := transactions.lockedOutputs(dbTx)
+	receivingTxs := receivingTxs(outputs)
+	result := []*UTXO{}
+	for outPoint, txOut := range outputs {
+		if transactions.isInputSpent(dbTx, outPoint) {
+			continue
+		}
+		tx, _, height, _, err := dbTx.TxInfo(outPoint.Hash)
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+		}
+		if transactions.isEvicted(dbTx, outPoint.Hash, tx, height) {
+			continue
+		}
+		_, locked := lockedOutputs[outPoint]
+		_, frozen := frozenOutputs[outPoint]
+		_, released := releasedOutputs[outPoint]
+		quarantineReason := transactions.quarantineReason(dbTx, tx, txOut, receivingTxs)
+		var state OutputState
+		switch {
+		case locked:
+			state = OutputStateReserved
+		case frozen:
+			state = OutputStateFrozen
+		case transactions.isImmature(tx, height):
+			state = OutputStateImmature
+		case quarantineReason != "" && !released:
+			state = OutputStateQuarantined
+		case height > 0:
+			state = OutputStateConfirmed
+		case transactions.allInputsOurs(dbTx, tx):
+			state = OutputStateUnconfirmedOwn
+		default:
+			state = OutputStateIncoming
+		}
+		result = append(result, &UTXO{
+			OutPoint:         outPoint,
+			TxOut:            txOut,
+			Address:          transactions.outputToAddress(txOut.PkScript),
+			Height:           height,
+			State:            state,
+			QuarantineReason: quarantineReason,
+		})
+	}
+	return result
+}
+
+// BalanceBreakdown computes the balance of the wallet, split by the state of the unspent outputs.
+func (transactions *Transactions) BalanceBreakdown() *BalanceBreakdown {
+	transactions.synchronizer.WaitSynchronized()
+	defer transactions.RLock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to begin transaction")
+	}
+	defer dbTx.Rollback()
+	result := &BalanceBreakdown{
+		Addresses: map[string]*BalanceAmounts{},
+		UTXOs:     transactions.utxos(dbTx),
+	}
+	for _, utxo := range result.UTXOs {
+		value := btcutil.Amount(utxo.TxOut.Value)
+		result.add(utxo.State, value)
+		addressBalance, ok := result.Addresses[utxo.Address]
+		if !ok {
+			addressBalance = &BalanceAmounts{}
+			result.Addresses[utxo.Address] = addressBalance
+		}
+		addressBalance.add(utxo.State, value)
+	}
+	sort.Slice(result.UTXOs, func(i, j int) bool {
+		return result.UTXOs[i].TxOut.Value > result.UTXOs[j].TxOut.Value
+	})
+	return result
+}
+
+// SetOutputReleased releases a quarantined output, so it is used when creating txs again, or
+// quarantines it again.
+func (transactions *Transactions) SetOutputReleased(outPoint wire.OutPoint, released bool) error {
+	defer transactions.Lock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	if !released {
+		dbTx.DeleteReleasedOutput(outPoint)
+		return dbTx.Commit()
+	}
+	txOut, err := dbTx.Output(outPoint)
+	if err != nil {
+		return err
+	}
+	if txOut == nil {
+		return errp.Newf("output %s does not belong to the wallet", outPoint)
+	}
+	if err := dbTx.PutReleasedOutput(outPoint); err != nil {
+		return err
+	}
+	return dbTx.Commit()
+}
+
+// SetOutputFrozen freezes or unfreezes an output of the wallet. Frozen outputs are not spendable.
+func (transactions *Transactions) SetOutputFrozen(outPoint wire.OutPoint, frozen bool) error {
+	defer transactions.Lock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	if !frozen {
+		dbTx.DeleteFrozenOutput(outPoint)
+		return dbTx.Commit()
+	}
+	txOut, err := dbTx.Output(outPoint)
+	if err != nil {
+		return err
+	}
+	if txOut == nil {
+		return errp.Newf("output %s does not belong to the wallet", outPoint)
+	}
+	if err := dbTx.PutFrozenOutput(outPoint); err != nil {
+		return err
+	}
+	return dbTx.Commit()
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// BalanceHistoryInterval is the size of the buckets of the balance history. See the
+// BalanceHistoryInterval* constants.
+type BalanceHistoryInterval string
+
+const (
+	// BalanceHistoryIntervalDay creates one point per day (UTC).
+	BalanceHistoryIntervalDay BalanceHistoryInterval = "day"
+	// BalanceHistoryIntervalWeek creates one point per week, starting on Monday (UTC).
+	BalanceHistoryIntervalWeek BalanceHistoryInterval = "week"
+)
+
+// bucketStart returns the start of the bucket containing the given time.
+func (interval BalanceHistoryInterval) bucketStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == BalanceHistoryIntervalWeek {
+		// time.Sunday is 0.
+		daysSinceMonday := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -daysSinceMonday)
+	}
+	return day
+}
+
+func (interval BalanceHistoryInterval) next(bucketStart time.Time) time.Time {
+	if interval == BalanceHistoryIntervalWeek {
+		return bucketStart.AddDate(0, 0, 7)
+	}
+	return bucketStart.AddDate(0, 0, 1)
+}
+
+// BalancePoint is the balance at the end of a bucket of the balance history.
+type BalancePoint struct {
+	// Time is the start of the bucket.
+	Time    time.Time
+	Balance btcutil.Amount
+}
+
+// balanceChange is the change of the balance caused by a verified tx.
+type balanceChange struct {
+	timestamp time.Time
+	delta     btcutil.Amount
+}
+
+// balanceChanges returns the balance changes of all verified txs, sorted by time. Unverified txs
+// are ignored, as their timestamp is not known yet.
+func (transactions *Transactions) balanceChanges(dbTx DBTxInterface) []*balanceChange {
+	txHashes, err := dbTx.Transactions()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve transactions")
+	}
+	result := []*balanceChange{}
+	for _, txHash := range txHashes {
+		tx, _, height, timestamp, err := dbTx.TxInfo(txHash)
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+		}
+		if height <= 0 || timestamp == nil {
+			continue
+		}
+		var delta btcutil.Amount
+		for _, txIn := range tx.TxIn {
+			spentOut, err := dbTx.Output(txIn.PreviousOutPoint)
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve output")
+			}
+			if spentOut != nil {
+				delta -= btcutil.Amount(spentOut.Value)
+			}
+		}
+		for index := range tx.TxOut {
+			output, err := dbTx.Output(wire.OutPoint{Hash: txHash, Index: uint32(index)})
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve output")
+			}
+			if output != nil {
+				delta += btcutil.Amount(output.Value)
+			}
+		}
+		result = append(result, &balanceChange{timestamp: *timestamp, delta: delta})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].timestamp.Before(result[j].timestamp)
+	})
+	return result
+}
+
+// invalidateBalanceHistory must be called when a tx is added, removed, verified or unverified.
+func (transactions *Transactions) invalidateBalanceHistory() {
+	defer transactions.balanceChangesCacheLock.Lock()()
+	transactions.balanceChangesCache = nil
+}
+
+// BalanceHistory returns the balance at the end of each day or week, from the first verified tx
+// until now. Only verified txs are taken into account.
+func (transactions *Transactions) BalanceHistory(interval BalanceHistoryInterval) (
+	[]*BalancePoint, error) {
+	if interval != BalanceHistoryIntervalDay && interval != BalanceHistoryIntervalWeek {
+		return nil, errp.Newf("invalid interval %s", interval)
+	}
+	transactions.synchronizer.WaitSynchronized()
+	changes := func() []*balanceChange {
+		defer transactions.RLock()()
+		defer transactions.balanceChangesCacheLock.Lock()()
+		if transactions.balanceChangesCache == nil {
+			dbTx, err := transactions.db.Begin()
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to begin transaction")
+			}
+			defer dbTx.Rollback()
+			transactions.balanceChangesCache = transactions.balanceChanges(dbTx)
+		}
+		return transactions.balanceChangesCache
+	}()
+
+	result := []*BalancePoint{}
+	if len(changes) == 0 {
+		return result, nil
+	}
+	var balance btcutil.Amount
+	end := interval.bucketStart(time.Now())
+	for bucket := interval.bucketStart(changes[0].timestamp); !bucket.After(end); bucket = interval.next(bucket) {
+		nextBucket := interval.next(bucket)
+		for len(changes) > 0 && changes[0].timestamp.Before(nextBucket) {
+			balance += changes[0].delta
+			changes = changes[1:]
+		}
+		result = append(result, &BalancePoint{Time: bucket, Balance: balance})
+	}
+	return result, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Event instances are sent to the callbacks registered with SubscribeEvent().
+type Event string
+
+const (
+	// EventIncomingTxDoubleSpent is fired when an unconfirmed tx paying to the wallet is double
+	// spent by another tx, or when it disappears after being replaced by another tx.
+	EventIncomingTxDoubleSpent Event = "incomingTxDoubleSpent"
+
+	// EventOutputQuarantined is fired when an output paying to the wallet is quarantined, see
+	// OutputStateQuarantined.
+	EventOutputQuarantined Event = "outputQuarantined"
+)
+
+// SubscribeEvent subscribes to transaction events. The returned function unsubscribes.
+func (transactions *Transactions) SubscribeEvent(f func(Event)) func() {
+	defer transactions.eventCallbacksLock.Lock()()
+	transactions.eventCallbacks = append(transactions.eventCallbacks, f)
+	index := len(transactions.eventCallbacks) - 1
+	return func() {
+		defer transactions.eventCallbacksLock.Lock()()
+		transactions.eventCallbacks[index] = nil
+	}
+}
+
+func (transactions *Transactions) notifyEvent(event Event) {
+	defer transactions.eventCallbacksLock.RLock()()
+	for _, f := range transactions.eventCallbacks {
+		if f != nil {
+			go f(event)
+		}
+	}
+}
+
+// otherSpenders returns the txs spending the output, except for the given tx.
+func (transactions *Transactions) otherSpenders(
+	dbTx DBTxInterface, outPoint wire.OutPoint, txHash chainhash.Hash) []chainhash.Hash {
+	spenders, err := dbTx.Inputs(outPoint)
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve inputs for outPoint")
+	}
+	result := []chainhash.Hash{}
+	for _, spender := range spenders {
+		if spender != txHash {
+			result = append(result, spender)
+		}
+	}
+	return result
+}
+
+// hasConflicts returns true if any output spent by the tx is also spent by another tx.
+func (transactions *Transactions) hasConflicts(
+	dbTx DBTxInterface, txHash chainhash.Hash, tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if len(transactions.otherSpenders(dbTx, txIn.PreviousOutPoint, txHash)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isEvicted returns true if the tx can never confirm because a conflicting tx is confirmed, or
+// because a tx it depends on is evicted.
+func (transactions *Transactions) isEvicted(
+	dbTx DBTxInterface, txHash chainhash.Hash, tx *wire.MsgTx, height int) bool {
+	if height > 0 {
+		return false
+	}
+	for _, txIn := range tx.TxIn {
+		for _, spender := range transactions.otherSpenders(dbTx, txIn.PreviousOutPoint, txHash) {
+			_, _, spenderHeight, _, err := dbTx.TxInfo(spender)
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+			}
+			if spenderHeight > 0 {
+				return true
+			}
+		}
+		parentHash := txIn.PreviousOutPoint.Hash
+		parentTx, _, parentHeight, _, err := dbTx.TxInfo(parentHash)
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+		}
+		if parentTx != nil && transactions.isEvicted(dbTx, parentHash, parentTx, parentHeight) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncomingUnconfirmed returns true if the tx is unconfirmed, pays to the wallet and is not
+// funded by the wallet alone.
+func (transactions *Transactions) isIncomingUnconfirmed(dbTx DBTxInterface, txHash chainhash.Hash) bool {
+	tx, _, height, _, err := dbTx.TxInfo(txHash)
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+	}
+	if tx == nil || height > 0 || transactions.allInputsOurs(dbTx, tx) {
+		return false
+	}
+	for index := range tx.TxOut {
+		output, err := dbTx.Output(wire.OutPoint{Hash: txHash, Index: uint32(index)})
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve output")
+		}
+		if output != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// onDoubleSpend is called when a tx was found spending outputs also spent by the given other txs.
+func (transactions *Transactions) onDoubleSpend(
+	dbTx DBTxInterface, txHash chainhash.Hash, others []chainhash.Hash) {
+	for _, hash := range append([]chainhash.Hash{txHash}, others...) {
+		if transactions.isIncomingUnconfirmed(dbTx, hash) {
+			transactions.log.WithField("txHash", hash).Warning("Incoming tx double spent")
+			transactions.notifyEvent(EventIncomingTxDoubleSpent)
+			return
+		}
+	}
+}
@@ -49,22 +49,36 @@ type DBTxInterface interface {
 	// Transactions retrieves all stored transaction hashes.
 	Transactions() ([]chainhash.Hash, error)
 
+	// TxsByTime retrieves the hashes of the verified transactions whose header timestamp is in the
+	// range [from, to), at a resolution of one second.
+	TxsByTime(from, to time.Time) ([]chainhash.Hash, error)
+
+	// TxsByIDPrefix retrieves the hashes of the transactions whose ID, in hex, starts with the
+	// prefix.
+	TxsByIDPrefix(prefix string) ([]chainhash.Hash, error)
+
 	// UnverifiedTransactions retrieves all stored transaction hashes of unverified transactions.
 	UnverifiedTransactions() ([]chainhash.Hash, error)
 
 	// MarkTxVerified marks a tx as verified. Stores timestamp of the header this tx appears in.
 	MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time) error
 
+	// UnmarkTxVerified marks a tx as unverified again, e.g. because the block it was in was
+	// orphaned. The stored header timestamp is removed.
+	UnmarkTxVerified(txHash chainhash.Hash) error
+
 	// PutInput stores a transaction input. It is referenced by output it spends. The transaction
-	// hash of the transaction this input was found in is recorded. TODO: store slice of inputs
-	// along with the txhash they appear in. If there are more than one, a double spend is detected.
+	// hash of the transaction this input was found in is recorded. All transactions spending the
+	// same output are recorded. If there are more than one, a double spend is detected.
 	PutInput(wire.OutPoint, chainhash.Hash) error
 
-	// Input retrieves an input. `nil, nil` is returned if not found.
-	Input(wire.OutPoint) (*chainhash.Hash, error)
+	// Inputs retrieves the hashes of all transactions spending the output, in the order they were
+	// stored. An empty slice is returned if not found.
+	Inputs(wire.OutPoint) ([]chainhash.Hash, error)
 
-	// DeleteInput deletes an input (nothing happens if not found).
-	DeleteInput(wire.OutPoint)
+	// DeleteInput deletes the input of the given transaction spending the output (nothing happens
+	// if not found).
+	DeleteInput(wire.OutPoint, chainhash.Hash)
 
 	// PutOutput stores an Output.
 	PutOutput(wire.OutPoint, *wire.TxOut) error
@@ -81,6 +95,43 @@ type DBTxInterface interface {
 
 	// AddressHistory retrieves an address history. If not found, returns an empty history.
 	AddressHistory(blockchain.ScriptHashHex) (blockchain.TxHistory, error)
+
+	// PutLocalTx stores a tx created by the wallet, along with its broadcast state.
+	PutLocalTx(chainhash.Hash, *LocalTx) error
+
+	// LocalTx retrieves a tx stored with PutLocalTx(). `nil, nil` is returned if not found.
+	LocalTx(chainhash.Hash) (*LocalTx, error)
+
+	// LocalTxs retrieves all txs stored with PutLocalTx().
+	LocalTxs() (map[chainhash.Hash]*LocalTx, error)
+
+	// DeleteLocalTx deletes a local tx (nothing happens if not found).
+	DeleteLocalTx(chainhash.Hash)
+
+	// PutFrozenOutput marks an output as frozen by the user.
+	PutFrozenOutput(wire.OutPoint) error
+
+	// FrozenOutputs retrieves all outputs stored with PutFrozenOutput().
+	FrozenOutputs() (map[wire.OutPoint]struct{}, error)
+
+	// DeleteFrozenOutput unfreezes an output (nothing happens if it is not frozen).
+	DeleteFrozenOutput(wire.OutPoint)
+
+	// PutReleasedOutput marks a quarantined output as released by the user.
+	PutReleasedOutput(wire.OutPoint) error
+
+	// ReleasedOutputs retrieves all outputs stored with PutReleasedOutput().
+	ReleasedOutputs() (map[wire.OutPoint]struct{}, error)
+
+	// DeleteReleasedOutput quarantines a released output again (nothing happens if it is not
+	// released).
+	DeleteReleasedOutput(wire.OutPoint)
+
+	// PutAddressDisplayed stores the time an address was last shown to the user.
+	PutAddressDisplayed(blockchain.ScriptHashHex, time.Time) error
+
+	// DisplayedAddresses retrieves all times stored with PutAddressDisplayed().
+	DisplayedAddresses() (map[blockchain.ScriptHashHex]time.Time, error)
 }
 
 // DBInterface can be implemented by database backends to open database transactions.
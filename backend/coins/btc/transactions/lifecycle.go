@@ -0,0 +1,305 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// rebroadcastInterval is the interval in which our own unconfirmed txs are broadcast again, in
+// case the server or the nodes dropped them from their mempool.
+const rebroadcastInterval = 15 * time.Minute
+
+// TxStatus is the status of a tx. See the TxStatus* constants.
+type TxStatus string
+
+const (
+	// TxStatusLocal is a tx created by the wallet which was not broadcast successfully yet.
+	TxStatusLocal TxStatus = "local"
+	// TxStatusBroadcast is a tx created by the wallet which was broadcast, but which did not appear
+	// in the history of any of our addresses yet.
+	TxStatusBroadcast TxStatus = "broadcast"
+	// TxStatusMempool is an unconfirmed tx known to the server.
+	TxStatusMempool TxStatus = "mempool"
+	// TxStatusConfirmed is a tx included in a block.
+	TxStatusConfirmed TxStatus = "confirmed"
+	// TxStatusConflicting is an unconfirmed tx spending an output which is also spent by another
+	// unconfirmed tx. At most one of them can confirm.
+	TxStatusConflicting TxStatus = "conflicting"
+	// TxStatusReplaced is an unconfirmed tx which can never confirm, as an output it spends is
+	// spent by a confirmed tx, or because it depends on such a tx. Its outputs do not count towards
+	// the balance. Our own txs are also replaced if they disappeared while another tx spends the
+	// same outputs.
+	TxStatusReplaced TxStatus = "replaced"
+	// TxStatusDropped is a tx created by the wallet which was known to the server, but disappeared
+	// without being confirmed or replaced. It is broadcast again periodically. The outputs it
+	// spends stay locked until it is abandoned, see Abandon().
+	TxStatusDropped TxStatus = "dropped"
+)
+
+// LocalTx is a tx created by the wallet. It is tracked from the time it is signed until it
+// confirms or is abandoned.
+type LocalTx struct {
+	Tx      *wire.MsgTx `json:"tx"`
+	Created time.Time   `json:"created"`
+	// LastBroadcast is the time of the last successful broadcast, nil if it was never broadcast.
+	LastBroadcast *time.Time `json:"lastBroadcast"`
+	// Seen is true once the tx appeared in the history of one of our addresses.
+	Seen bool `json:"seen"`
+}
+
+// txStatus returns the status of a tx which is in the history of one of our addresses.
+func (transactions *Transactions) txStatus(
+	dbTx DBTxInterface, txHash chainhash.Hash, tx *wire.MsgTx, height int) TxStatus {
+	switch {
+	case height > 0:
+		return TxStatusConfirmed
+	case transactions.isEvicted(dbTx, txHash, tx, height):
+		return TxStatusReplaced
+	case transactions.hasConflicts(dbTx, txHash, tx):
+		return TxStatusConflicting
+	default:
+		return TxStatusMempool
+	}
+}
+
+// localTxStatus returns the status of a local tx which is not in the history of any of our
+// addresses.
+func (transactions *Transactions) localTxStatus(
+	dbTx DBTxInterface, txHash chainhash.Hash, localTx *LocalTx) TxStatus {
+	for _, txIn := range localTx.Tx.TxIn {
+		for _, spender := range transactions.otherSpenders(dbTx, txIn.PreviousOutPoint, txHash) {
+			spenderTx, _, spenderHeight, _, err := dbTx.TxInfo(spender)
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+			}
+			if spenderTx == nil || !transactions.isEvicted(dbTx, spender, spenderTx, spenderHeight) {
+				return TxStatusReplaced
+			}
+		}
+	}
+	switch {
+	case localTx.Seen:
+		return TxStatusDropped
+	case localTx.LastBroadcast != nil:
+		return TxStatusBroadcast
+	default:
+		return TxStatusLocal
+	}
+}
+
+// unindexedLocalTxs returns the local txs which are not in the history of any of our addresses,
+// and their status.
+func (transactions *Transactions) unindexedLocalTxs(
+	dbTx DBTxInterface) map[chainhash.Hash]*LocalTx {
+	localTxs, err := dbTx.LocalTxs()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve local txs")
+	}
+	result := map[chainhash.Hash]*LocalTx{}
+	for txHash, localTx := range localTxs {
+		tx, _, _, _, err := dbTx.TxInfo(txHash)
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+		}
+		if tx == nil {
+			result[txHash] = localTx
+		}
+	}
+	return result
+}
+
+// lockedOutputs returns the outputs spent by local txs which are not in the history of any of our
+// addresses, and can therefore not be found in the inputs index. These outputs must not be spent
+// again until the local tx is abandoned.
+func (transactions *Transactions) lockedOutputs(dbTx DBTxInterface) map[wire.OutPoint]struct{} {
+	result := map[wire.OutPoint]struct{}{}
+	for txHash, localTx := range transactions.unindexedLocalTxs(dbTx) {
+		if transactions.localTxStatus(dbTx, txHash, localTx) == TxStatusReplaced {
+			continue
+		}
+		for _, txIn := range localTx.Tx.TxIn {
+			result[txIn.PreviousOutPoint] = struct{}{}
+		}
+	}
+	return result
+}
+
+// onLocalTxSeen updates the local tx, if the tx is one, when it appears in an address history.
+// Requires the transactions lock.
+func (transactions *Transactions) onLocalTxSeen(dbTx DBTxInterface, txHash chainhash.Hash, height int) {
+	localTx, err := dbTx.LocalTx(txHash)
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve local tx")
+	}
+	if localTx == nil {
+		return
+	}
+	if height > 0 {
+		// Confirmed, no need to keep track of it anymore.
+		dbTx.DeleteLocalTx(txHash)
+		return
+	}
+	if !localTx.Seen {
+		localTx.Seen = true
+		if err := dbTx.PutLocalTx(txHash, localTx); err != nil {
+			transactions.log.WithError(err).Panic("Failed to store local tx")
+		}
+	}
+}
+
+// Broadcast broadcasts a tx created by the wallet. The tx is tracked until it confirms, and is
+// broadcast again periodically in case it is dropped from the mempool. If the broadcast fails, the
+// tx is forgotten.
+func (transactions *Transactions) Broadcast(tx *wire.MsgTx) error {
+	txHash := tx.TxHash()
+	transactions.modifyLocalTx(txHash, func(localTx *LocalTx) *LocalTx {
+		return &LocalTx{Tx: tx, Created: time.Now()}
+	})
+	if err := transactions.broadcast(txHash, tx); err != nil {
+		transactions.modifyLocalTx(txHash, func(localTx *LocalTx) *LocalTx {
+			if localTx != nil && localTx.LastBroadcast == nil && !localTx.Seen {
+				return nil
+			}
+			return localTx
+		})
+		return err
+	}
+	return nil
+}
+
+// broadcast broadcasts the tx and records the time of the broadcast if it succeeded.
+func (transactions *Transactions) broadcast(txHash chainhash.Hash, tx *wire.MsgTx) error {
+	if err := transactions.blockchain.TransactionBroadcast(tx); err != nil {
+		return err
+	}
+	transactions.modifyLocalTx(txHash, func(localTx *LocalTx) *LocalTx {
+		if localTx != nil {
+			now := time.Now()
+			localTx.LastBroadcast = &now
+		}
+		return localTx
+	})
+	return nil
+}
+
+// modifyLocalTx replaces the local tx (nil if not found) with the value returned by f. If f returns
+// nil, the local tx is deleted.
+func (transactions *Transactions) modifyLocalTx(
+	txHash chainhash.Hash, f func(localTx *LocalTx) *LocalTx) {
+	defer transactions.Lock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to begin transaction")
+	}
+	defer dbTx.Rollback()
+	localTx, err := dbTx.LocalTx(txHash)
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve local tx")
+	}
+	localTx = f(localTx)
+	if localTx == nil {
+		dbTx.DeleteLocalTx(txHash)
+	} else if err := dbTx.PutLocalTx(txHash, localTx); err != nil {
+		transactions.log.WithError(err).Panic("Failed to store local tx")
+	}
+	if err := dbTx.Commit(); err != nil {
+		transactions.log.WithError(err).Panic("Failed to commit transaction")
+	}
+}
+
+// Abandon forgets a local tx which was dropped or replaced, or which was never broadcast, so that
+// the outputs it spends become spendable again.
+func (transactions *Transactions) Abandon(txHash chainhash.Hash) error {
+	defer transactions.Lock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	localTx, ok := transactions.unindexedLocalTxs(dbTx)[txHash]
+	if !ok {
+		return errp.Newf("transaction %s is not a dropped transaction of this wallet", txHash)
+	}
+	if status := transactions.localTxStatus(dbTx, txHash, localTx); status == TxStatusBroadcast {
+		return errp.Newf("transaction %s might still be in the mempool", txHash)
+	}
+	transactions.log.WithField("txHash", txHash).Info("Abandoning transaction")
+	dbTx.DeleteLocalTx(txHash)
+	return dbTx.Commit()
+}
+
+// rebroadcast broadcasts our own unconfirmed txs again, which were broadcast successfully before.
+// A tx rejected by the server is kept, as the rejection is expected if the tx is still in the
+// mempool, or if it was replaced, which is detected once the replacement shows up in the history.
+func (transactions *Transactions) rebroadcast() {
+	if transactions.blockchain.ConnectionStatus() != blockchain.CONNECTED {
+		transactions.log.Debug("Skipping the rebroadcast while offline")
+		return
+	}
+	toBroadcast := map[chainhash.Hash]*wire.MsgTx{}
+	func() {
+		defer transactions.RLock()()
+		dbTx, err := transactions.db.Begin()
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to begin transaction")
+		}
+		defer dbTx.Rollback()
+		localTxs, err := dbTx.LocalTxs()
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve local txs")
+		}
+		unindexed := transactions.unindexedLocalTxs(dbTx)
+		for txHash, localTx := range localTxs {
+			if localTx.LastBroadcast == nil {
+				continue
+			}
+			var status TxStatus
+			if _, ok := unindexed[txHash]; ok {
+				status = transactions.localTxStatus(dbTx, txHash, localTx)
+			} else {
+				status = transactions.txStatus(dbTx, txHash, localTx.Tx, 0)
+			}
+			switch status {
+			case TxStatusBroadcast, TxStatusMempool, TxStatusDropped:
+				toBroadcast[txHash] = localTx.Tx
+			}
+		}
+	}()
+	for txHash, tx := range toBroadcast {
+		if err := transactions.broadcast(txHash, tx); err != nil {
+			transactions.log.WithError(err).WithField("txHash", txHash).Info(
+				"Rebroadcast failed")
+		}
+	}
+}
+
+func (transactions *Transactions) rebroadcastLoop() {
+	ticker := time.NewTicker(rebroadcastInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			transactions.rebroadcast()
+		case <-transactions.quit:
+			return
+		}
+	}
+}
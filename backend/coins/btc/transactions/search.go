@@ -0,0 +1,234 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/bch"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// TxFilter restricts the txs returned by SearchTransactions(). Nil and empty fields do not
+// restrict the result.
+type TxFilter struct {
+	// From and To restrict the result to txs confirmed in the range [From, To). As the time of
+	// confirmation is only known for verified txs, unconfirmed and unverified txs never match.
+	From *time.Time
+	To   *time.Time
+	// MinAmount and MaxAmount restrict TxInfo.Amount, both inclusive.
+	MinAmount *btcutil.Amount
+	MaxAmount *btcutil.Amount
+	Type      TxType
+	// Address restricts the result to txs paying to or spending from the address.
+	Address string
+	// IDPrefix restricts the result to txs whose ID starts with the prefix (hex, case insensitive).
+	IDPrefix string
+	// Offset and Limit select a page of the result. Limit 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// hashSet is a set of tx hashes. A nil hashSet contains all hashes.
+type hashSet map[chainhash.Hash]struct{}
+
+func newHashSet(txHashes []chainhash.Hash) hashSet {
+	result := hashSet{}
+	for _, txHash := range txHashes {
+		result[txHash] = struct{}{}
+	}
+	return result
+}
+
+func (set hashSet) contains(txHash chainhash.Hash) bool {
+	if set == nil {
+		return true
+	}
+	_, ok := set[txHash]
+	return ok
+}
+
+// intersect returns the hashes contained in both sets.
+func (set hashSet) intersect(other hashSet) hashSet {
+	if set == nil {
+		return other
+	}
+	result := hashSet{}
+	for txHash := range set {
+		if other.contains(txHash) {
+			result[txHash] = struct{}{}
+		}
+	}
+	return result
+}
+
+// addressTxs returns the hashes of the txs in the history of the address if it belongs to the
+// wallet. Nil is returned for foreign addresses, which need to be matched against
+// TxInfo.Addresses instead.
+func (transactions *Transactions) addressTxs(dbTx DBTxInterface, address string) (hashSet, error) {
+	var decodedAddress btcutil.Address
+	var err error
+	if bch.IsNet(transactions.net) {
+		decodedAddress, err = bch.DecodeAddress(address, transactions.net)
+	} else {
+		decodedAddress, err = btcutil.DecodeAddress(address, transactions.net)
+	}
+	if err != nil || !decodedAddress.IsForNet(transactions.net) {
+		return nil, errp.Newf("invalid address %s", address)
+	}
+	pkScript, err := txscript.PayToAddrScript(decodedAddress)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	history, err := dbTx.AddressHistory(blockchain.ScriptHashHex(chainhash.HashH(pkScript).String()))
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, nil
+	}
+	result := hashSet{}
+	for _, entry := range history {
+		result[entry.TXHash.Hash()] = struct{}{}
+	}
+	return result, nil
+}
+
+// matches checks the filter criteria which can't be looked up in an index.
+func (filter *TxFilter) matches(txInfo *TxInfo, matchAddress bool) bool {
+	if filter.Type != "" && txInfo.Type != filter.Type {
+		return false
+	}
+	if filter.MinAmount != nil && txInfo.Amount < *filter.MinAmount {
+		return false
+	}
+	if filter.MaxAmount != nil && txInfo.Amount > *filter.MaxAmount {
+		return false
+	}
+	if matchAddress {
+		for _, address := range txInfo.Addresses {
+			if address == filter.Address {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SearchTransactions returns the page of the txs matching the filter, ordered like Transactions(),
+// and the total number of matching txs. The date and tx ID criteria are looked up in the secondary
+// indexes of the database, and the address in the address histories, so that only candidate txs
+// are loaded.
+func (transactions *Transactions) SearchTransactions(
+	filter *TxFilter,
+	isChange func(blockchain.ScriptHashHex) bool) ([]*TxInfo, int, error) {
+	transactions.synchronizer.WaitSynchronized()
+	defer transactions.RLock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dbTx.Rollback()
+
+	var candidates hashSet
+	if filter.From != nil || filter.To != nil {
+		from, to := time.Unix(0, 0), time.Now().Add(24*time.Hour)
+		if filter.From != nil {
+			from = *filter.From
+		}
+		if filter.To != nil {
+			to = *filter.To
+		}
+		txHashes, err := dbTx.TxsByTime(from, to)
+		if err != nil {
+			return nil, 0, err
+		}
+		candidates = candidates.intersect(newHashSet(txHashes))
+	}
+	if filter.IDPrefix != "" {
+		txHashes, err := dbTx.TxsByIDPrefix(filter.IDPrefix)
+		if err != nil {
+			return nil, 0, err
+		}
+		candidates = candidates.intersect(newHashSet(txHashes))
+	}
+	matchAddress := false
+	if filter.Address != "" {
+		addressTxs, err := transactions.addressTxs(dbTx, filter.Address)
+		if err != nil {
+			return nil, 0, err
+		}
+		if addressTxs != nil {
+			candidates = candidates.intersect(addressTxs)
+		} else {
+			matchAddress = true
+		}
+	}
+	if candidates == nil {
+		txHashes, err := dbTx.Transactions()
+		if err != nil {
+			return nil, 0, err
+		}
+		candidates = newHashSet(txHashes)
+	}
+
+	txs := []*TxInfo{}
+	for txHash := range candidates {
+		tx, _, height, timestamp, err := dbTx.TxInfo(txHash)
+		if err != nil {
+			return nil, 0, err
+		}
+		status := transactions.txStatus(dbTx, txHash, tx, height)
+		txInfo := transactions.txInfo(dbTx, tx, height, timestamp, status, isChange)
+		if filter.matches(txInfo, matchAddress) {
+			txs = append(txs, txInfo)
+		}
+	}
+	// Local txs which are not indexed yet are unconfirmed, so they never match a date range.
+	if filter.From == nil && filter.To == nil {
+		for txHash, localTx := range transactions.unindexedLocalTxs(dbTx) {
+			if !strings.HasPrefix(txHash.String(), strings.ToLower(filter.IDPrefix)) {
+				continue
+			}
+			status := transactions.localTxStatus(dbTx, txHash, localTx)
+			txInfo := transactions.txInfo(dbTx, localTx.Tx, 0, nil, status, isChange)
+			if filter.matches(txInfo, filter.Address != "") {
+				txs = append(txs, txInfo)
+			}
+		}
+	}
+	// Order txs at the same height by ID so that pages are stable.
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].Tx.TxHash().String() < txs[j].Tx.TxHash().String()
+	})
+	sort.Stable(sort.Reverse(byHeight(txs)))
+
+	total := len(txs)
+	if filter.Offset >= total {
+		return []*TxInfo{}, total, nil
+	}
+	txs = txs[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(txs) {
+		txs = txs[:filter.Limit]
+	}
+	return txs, total, nil
+}
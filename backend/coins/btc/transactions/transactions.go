@@ -16,6 +16,7 @@ package transactions
 
 import (
 	"sort"
+	"sync"
 	"time"
 
 	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
@@ -32,6 +33,16 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// maxPendingTxDownloads is the maximum number of transactions being downloaded at the same time.
+// Further downloads are queued, so that syncing addresses with huge histories does not hold an
+// unbounded number of requests and callbacks in memory.
+const maxPendingTxDownloads = 200
+
+// txDownloadQueueCapacity is the number of queued transaction downloads above which no further
+// address histories should be processed, see WhenTxDownloadQueueAvailable(). The queue can exceed
+// it by the transactions of the address histories which were admitted before it was full.
+const txDownloadQueueCapacity = 1000
+
 // SpendableOutput is an unspent coin.
 type SpendableOutput struct {
 	*wire.TxOut
@@ -57,12 +68,37 @@ type Transactions struct {
 	headers      headers.Interface
 	requestedTXs map[chainhash.Hash][]func(DBTxInterface, *wire.MsgTx)
 
+	// txDownloadQueue holds the transactions waiting to be downloaded, and pendingTxDownloads is
+	// the number of downloads in progress.
+	txDownloadQueue     []*txDownload
+	pendingTxDownloads  int
+	txDownloadQueueLock locker.Locker
+	// txDownloadQueueWaiters are called one by one when the queue has capacity again.
+	txDownloadQueueWaiters []func()
+	// txDownloadDispatches tracks the goroutines started by onTxDownloadFinished().
+	txDownloadDispatches sync.WaitGroup
+
 	// headersTipHeight is the current chain tip height, so we can compute the number of
 	// confirmations of a transaction.
 	headersTipHeight int
 
+	// dustThreshold is the value below which incoming outputs are quarantined, see
+	// OutputStateQuarantined. 0 if disabled.
+	dustThreshold btcutil.Amount
+
 	unsubscribeHeadersEvent func()
 
+	eventCallbacks     []func(Event)
+	eventCallbacksLock locker.Locker
+
+	// balanceChangesCache caches the balance changes of the verified txs for BalanceHistory(). nil
+	// if invalidated.
+	balanceChangesCache     []*balanceChange
+	balanceChangesCacheLock locker.Locker
+
+	// quit is closed to stop the periodic rebroadcast of our own unconfirmed txs.
+	quit chan struct{}
+
 	synchronizer *synchronizer.Synchronizer
 	blockchain   blockchain.Interface
 	log          *logrus.Entry
@@ -87,15 +123,18 @@ func NewTransactions(
 
 		synchronizer: synchronizer,
 		blockchain:   blockchain,
+		quit:         make(chan struct{}),
 		log:          log.WithFields(logrus.Fields{"group": "transactions", "net": net.Name}),
 	}
 	transactions.unsubscribeHeadersEvent = headers.SubscribeEvent(transactions.onHeadersEvent)
+	go transactions.rebroadcastLoop()
 	return transactions
 }
 
 // Close cleans up when finished using.
 func (transactions *Transactions) Close() {
 	transactions.unsubscribeHeadersEvent()
+	close(transactions.quit)
 }
 
 func (transactions *Transactions) txInHistory(
@@ -130,16 +169,24 @@ func (transactions *Transactions) processTxForAddress(
 		transactions.log.WithError(err).Panic("Failed to put tx")
 	}
 
-	// Newly confirmed tx. Try to verify it.
-	if previousHeight <= 0 && height > 0 {
+	if previousHeight > 0 && height != previousHeight {
+		// The block the tx was verified in was orphaned.
+		if err := dbTx.UnmarkTxVerified(txHash); err != nil {
+			transactions.log.WithError(err).Panic("Failed to unmark tx as verified")
+		}
+	}
+	// Newly confirmed tx, or confirmed in a different block. Try to verify it.
+	if height > 0 && height != previousHeight {
 		transactions.log.Debug("Try to verify newly confirmed tx")
 		go transactions.verifyTransaction(txHash, height)
 	}
+	transactions.onLocalTxSeen(dbTx, txHash, height)
 
 	if err := dbTx.AddAddressToTx(txHash, scriptHashHex); err != nil {
 		transactions.log.WithError(err).Panic("Failed to add address to tx")
 	}
 	transactions.processInputsAndOutputsForAddress(dbTx, scriptHashHex, txHash, tx)
+	transactions.invalidateBalanceHistory()
 }
 
 // Go through the tx and extract all inputs and outputs which touch the address.
@@ -149,37 +196,54 @@ func (transactions *Transactions) processInputsAndOutputsForAddress(
 	txHash chainhash.Hash,
 	tx *wire.MsgTx) {
 	// Gather transaction inputs that spend outputs of the given address.
+	conflicts := []chainhash.Hash{}
 	for _, txIn := range tx.TxIn {
 		// Since transactions can be processed in any order, and we might process the same tx
 		// multiple times for different addresses, we index all inputs, even those that didn't
 		// originate from our wallet. At this stage we don't know if it is one of our own inputs,
 		// since the output that it spends might be indexed later.
-		txInTxHash, err := dbTx.Input(txIn.PreviousOutPoint)
+		spenders, err := dbTx.Inputs(txIn.PreviousOutPoint)
 		if err != nil {
 			transactions.log.WithError(err).Panic("Failed to retrieve input from previous outpoint")
 		}
-		if txInTxHash != nil && *txInTxHash != txHash {
+		indexed := false
+		for _, spender := range spenders {
+			if spender == txHash {
+				indexed = true
+			}
+		}
+		if !indexed && len(spenders) != 0 {
 			transactions.log.WithFields(logrus.Fields{"txIn.PreviousOutPoint": txIn.PreviousOutPoint,
-				"txInTxHash": txInTxHash, "txHash": txHash}).
+				"spenders": spenders, "txHash": txHash}).
 				Warning("Double spend detected")
+			conflicts = append(conflicts, spenders...)
 		}
 		if err := dbTx.PutInput(txIn.PreviousOutPoint, txHash); err != nil {
 			transactions.log.WithError(err).Panic("Failed to store the transaction input")
 		}
 	}
 	// Gather transaction outputs that belong to us.
+	newOutputs := []*wire.TxOut{}
 	for index, txOut := range tx.TxOut {
 		// Check if output is ours.
 		if getScriptHashHex(txOut) == scriptHashHex {
-			err := dbTx.PutOutput(
-				wire.OutPoint{Hash: txHash, Index: uint32(index)},
-				txOut,
-			)
+			outPoint := wire.OutPoint{Hash: txHash, Index: uint32(index)}
+			previous, err := dbTx.Output(outPoint)
 			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve output")
+			}
+			if err := dbTx.PutOutput(outPoint, txOut); err != nil {
 				transactions.log.WithError(err).Panic("Failed to store the transaction output")
 			}
+			if previous == nil {
+				newOutputs = append(newOutputs, txOut)
+			}
 		}
 	}
+	transactions.checkQuarantine(dbTx, tx, newOutputs)
+	if len(conflicts) != 0 {
+		transactions.onDoubleSpend(dbTx, txHash, conflicts)
+	}
 }
 
 func (transactions *Transactions) allInputsOurs(dbTx DBTxInterface, transaction *wire.MsgTx) bool {
@@ -197,7 +261,7 @@ func (transactions *Transactions) allInputsOurs(dbTx DBTxInterface, transaction
 
 // SpendableOutputs returns all unspent outputs of the wallet which are eligible to be spent. Those
 // include all unspent outputs of confirmed transactions, and unconfirmed outputs that we created
-// ourselves.
+// ourselves. Frozen, reserved, immature and quarantined outputs are excluded, see OutputState.
 func (transactions *Transactions) SpendableOutputs() map[wire.OutPoint]*SpendableOutput {
 	transactions.synchronizer.WaitSynchronized()
 	defer transactions.RLock()()
@@ -208,35 +272,58 @@ func (transactions *Transactions) SpendableOutputs() map[wire.OutPoint]*Spendabl
 	}
 	defer dbTx.Rollback()
 
+	result := map[wire.OutPoint]*SpendableOutput{}
+	for _, utxo := range transactions.utxos(dbTx) {
+		if utxo.State.Spendable() {
+			result[utxo.OutPoint] = &SpendableOutput{
+				TxOut:   utxo.TxOut,
+				Address: utxo.Address,
+			}
+		}
+	}
+	return result
+}
+
+// ReceiveCounts returns the number of txs which paid to each address of the wallet. Addresses which
+// never received anything are not included. A count above one means the address was reused.
+func (transactions *Transactions) ReceiveCounts() map[blockchain.ScriptHashHex]int {
+	transactions.synchronizer.WaitSynchronized()
+	defer transactions.RLock()()
+
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to begin transaction")
+	}
+	defer dbTx.Rollback()
+
 	outputs, err := dbTx.Outputs()
 	if err != nil {
 		transactions.log.WithError(err).Panic("Failed to retrieve outputs")
 	}
-	result := map[wire.OutPoint]*SpendableOutput{}
-	for outPoint, txOut := range outputs {
-		tx, _, height, _, err := dbTx.TxInfo(outPoint.Hash)
-		if err != nil {
-			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
-		}
-		confirmed := height > 0
-
-		spent := transactions.isInputSpent(dbTx, outPoint)
-		if !spent && (confirmed || transactions.allInputsOurs(dbTx, tx)) {
-			result[outPoint] = &SpendableOutput{
-				TxOut:   txOut,
-				Address: transactions.outputToAddress(txOut.PkScript),
-			}
-		}
+	result := map[blockchain.ScriptHashHex]int{}
+	for script, txs := range receivingTxs(outputs) {
+		scriptHashHex := blockchain.ScriptHashHex(chainhash.HashH([]byte(script)).String())
+		result[scriptHashHex] = len(txs)
 	}
 	return result
 }
 
+// isInputSpent returns true if the output is spent by a tx which is not evicted.
 func (transactions *Transactions) isInputSpent(dbTx DBTxInterface, outPoint wire.OutPoint) bool {
-	input, err := dbTx.Input(outPoint)
+	spenders, err := dbTx.Inputs(outPoint)
 	if err != nil {
 		transactions.log.WithError(err).Panic("Failed to retrieve input for outPoint")
 	}
-	return input != nil
+	for _, spender := range spenders {
+		tx, _, height, _, err := dbTx.TxInfo(spender)
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+		}
+		if tx == nil || !transactions.isEvicted(dbTx, spender, tx, height) {
+			return true
+		}
+	}
+	return false
 }
 
 func (transactions *Transactions) removeTxForAddress(
@@ -260,9 +347,13 @@ func (transactions *Transactions) removeTxForAddress(
 	if empty {
 		// Tx is not touching any of our outputs anymore. Remove.
 
+		if transactions.hasConflicts(dbTx, txHash, tx) {
+			// The tx disappeared because it was replaced.
+			transactions.onDoubleSpend(dbTx, txHash, nil)
+		}
 		for _, txIn := range tx.TxIn {
 			transactions.log.Debug("Deleting transaction iput")
-			dbTx.DeleteInput(txIn.PreviousOutPoint)
+			dbTx.DeleteInput(txIn.PreviousOutPoint, txHash)
 		}
 
 		// Remove the outputs added by this tx.
@@ -274,6 +365,7 @@ func (transactions *Transactions) removeTxForAddress(
 		}
 
 		dbTx.DeleteTx(txHash)
+		transactions.invalidateBalanceHistory()
 	}
 }
 
@@ -346,7 +438,92 @@ func (transactions *Transactions) doForTransaction(
 	if alreadyDownloading {
 		return
 	}
-	done := transactions.synchronizer.IncRequestsCounter()
+	transactions.enqueueTxDownload(&txDownload{
+		txHash: txHash,
+		done:   transactions.synchronizer.IncRequestsCounter(),
+	})
+}
+
+// txDownload is a transaction waiting to be downloaded.
+type txDownload struct {
+	txHash chainhash.Hash
+	// done decrements the requests counter of the synchronizer.
+	done func()
+}
+
+// enqueueTxDownload starts downloading the transaction, or queues the download if there are too
+// many downloads in progress.
+func (transactions *Transactions) enqueueTxDownload(download *txDownload) {
+	unlock := transactions.txDownloadQueueLock.Lock()
+	if transactions.pendingTxDownloads >= maxPendingTxDownloads {
+		transactions.txDownloadQueue = append(transactions.txDownloadQueue, download)
+		unlock()
+		return
+	}
+	transactions.pendingTxDownloads++
+	unlock()
+	transactions.downloadTx(download)
+}
+
+// onTxDownloadFinished starts the next queued download, if any. If the queue has capacity again,
+// it wakes up one waiter of WhenTxDownloadQueueAvailable(), or all of them if no download is left.
+//
+// It is called in the cleanup callback of the finished download, which the RPC client runs while
+// holding its pending requests lock. The next download and the waiters send new requests, which
+// take the same lock, so they are started in a new goroutine.
+func (transactions *Transactions) onTxDownloadFinished() {
+	unlock := transactions.txDownloadQueueLock.Lock()
+	var next *txDownload
+	if len(transactions.txDownloadQueue) == 0 {
+		transactions.pendingTxDownloads--
+	} else {
+		next = transactions.txDownloadQueue[0]
+		transactions.txDownloadQueue = transactions.txDownloadQueue[1:]
+	}
+	var waiters []func()
+	switch {
+	case transactions.pendingTxDownloads == 0:
+		// Nothing else would wake up the remaining waiters.
+		waiters = transactions.txDownloadQueueWaiters
+		transactions.txDownloadQueueWaiters = nil
+	case len(transactions.txDownloadQueue) < txDownloadQueueCapacity &&
+		len(transactions.txDownloadQueueWaiters) != 0:
+		waiters = transactions.txDownloadQueueWaiters[:1]
+		transactions.txDownloadQueueWaiters = transactions.txDownloadQueueWaiters[1:]
+	}
+	unlock()
+	if next == nil && len(waiters) == 0 {
+		return
+	}
+	transactions.txDownloadDispatches.Add(1)
+	go func() {
+		defer transactions.txDownloadDispatches.Done()
+		if next != nil {
+			transactions.downloadTx(next)
+		}
+		for _, waiter := range waiters {
+			waiter()
+		}
+	}()
+}
+
+// WhenTxDownloadQueueAvailable calls f as soon as fewer than txDownloadQueueCapacity transaction
+// downloads are queued, immediately if that is already the case. Fetching address histories through
+// it applies backpressure, so that the download queue stays bounded when syncing addresses with
+// huge histories.
+func (transactions *Transactions) WhenTxDownloadQueueAvailable(f func()) {
+	unlock := transactions.txDownloadQueueLock.Lock()
+	if len(transactions.txDownloadQueue) < txDownloadQueueCapacity {
+		unlock()
+		f()
+		return
+	}
+	transactions.txDownloadQueueWaiters = append(transactions.txDownloadQueueWaiters, f)
+	unlock()
+}
+
+func (transactions *Transactions) downloadTx(download *txDownload) {
+	txHash := download.txHash
 	transactions.blockchain.TransactionGet(
 		txHash,
 		func(tx *wire.MsgTx) error {
@@ -363,53 +540,30 @@ func (transactions *Transactions) doForTransaction(
 			delete(transactions.requestedTXs, txHash)
 			return dbTx.Commit()
 		},
-		func() { done() },
+		func() {
+			download.done()
+			transactions.onTxDownloadFinished()
+		},
 	)
-	return
 }
 
 // Balance contains the available and incoming balance of the wallet.
 type Balance struct {
 	// Available funds are all confirmed funds which are not spent by any tx. Exception: unconfirmed
-	// transactions that spend from the wallet are available.
+	// transactions that spend from the wallet are available. Frozen, reserved and immature funds
+	// are not available.
 	Available btcutil.Amount
 	// Incoming balance are unconfirmed funds coming into the wallet.
 	Incoming btcutil.Amount
 }
 
-// Balance computes the confirmed and unconfirmed balance of the wallet.
+// Balance computes the confirmed and unconfirmed balance of the wallet. See BalanceBreakdown() for
+// more details.
 func (transactions *Transactions) Balance() *Balance {
-	transactions.synchronizer.WaitSynchronized()
-	defer transactions.RLock()()
-	dbTx, err := transactions.db.Begin()
-	if err != nil {
-		transactions.log.WithError(err).Panic("Failed to begin transaction")
-	}
-	outputs, err := dbTx.Outputs()
-	if err != nil {
-		transactions.log.WithError(err).Panic("Failed to retrieve outputs")
-	}
-	defer dbTx.Rollback()
-	var available, incoming int64
-	for outPoint, txOut := range outputs {
-		// What is spent can not be available nor incoming.
-		if spent := transactions.isInputSpent(dbTx, outPoint); spent {
-			continue
-		}
-		tx, _, height, _, err := dbTx.TxInfo(outPoint.Hash)
-		if err != nil {
-			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
-		}
-		confirmed := height > 0
-		if confirmed || transactions.allInputsOurs(dbTx, tx) {
-			available += txOut.Value
-		} else {
-			incoming += txOut.Value
-		}
-	}
+	breakdown := transactions.BalanceBreakdown()
 	return &Balance{
-		Available: btcutil.Amount(available),
-		Incoming:  btcutil.Amount(incoming),
+		Available: breakdown.Spendable(),
+		Incoming:  breakdown.Incoming,
 	}
 }
 
@@ -465,6 +619,8 @@ type TxInfo struct {
 	Timestamp *time.Time
 	// Addresses money was sent to / received on (without change addresses).
 	Addresses []string
+	// Status tells whether the tx is confirmed, or whether it conflicts with other txs.
+	Status TxStatus
 }
 
 // FeeRatePerKb returns the fee rate of the tx (fee / tx size).
@@ -491,6 +647,7 @@ func (transactions *Transactions) txInfo(
 	tx *wire.MsgTx,
 	height int,
 	timestamp *time.Time,
+	status TxStatus,
 	isChange func(blockchain.ScriptHashHex) bool) *TxInfo {
 	defer transactions.RLock()()
 	var sumOurInputs btcutil.Amount
@@ -522,6 +679,10 @@ func (transactions *Transactions) txInfo(
 			// TODO
 			panic(err)
 		}
+		if output == nil && isChange(getScriptHashHex(txOut)) {
+			// Our own tx which is not indexed yet, or whose change address was not processed yet.
+			output = txOut
+		}
 		address := transactions.outputToAddress(txOut.PkScript)
 		if output != nil {
 			if isChange(getScriptHashHex(output)) {
@@ -575,6 +736,7 @@ func (transactions *Transactions) txInfo(
 		Fee:              feeP,
 		Timestamp:        timestamp,
 		Addresses:        addresses,
+		Status:           status,
 	}
 }
 
@@ -601,7 +763,12 @@ func (transactions *Transactions) Transactions(
 			// TODO
 			panic(err)
 		}
-		txs = append(txs, transactions.txInfo(dbTx, tx, height, timestamp, isChange))
+		status := transactions.txStatus(dbTx, txHash, tx, height)
+		txs = append(txs, transactions.txInfo(dbTx, tx, height, timestamp, status, isChange))
+	}
+	for txHash, localTx := range transactions.unindexedLocalTxs(dbTx) {
+		status := transactions.localTxStatus(dbTx, txHash, localTx)
+		txs = append(txs, transactions.txInfo(dbTx, localTx.Tx, 0, nil, status, isChange))
 	}
 	sort.Sort(sort.Reverse(byHeight(txs)))
 	return txs
@@ -15,21 +15,35 @@
 package transactions_test
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
 	headersMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/synchronizer"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/db/transactionsdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
@@ -41,6 +55,8 @@ type BlockchainMock struct {
 	blockchainMock.Interface
 	transactions            map[chainhash.Hash]*wire.MsgTx
 	transactionGetCallbacks map[chainhash.Hash][]func()
+	// lock guards the maps, as the next downloads are started in other goroutines.
+	lock sync.Mutex
 }
 
 func NewBlockchainMock() *BlockchainMock {
@@ -52,20 +68,37 @@ func NewBlockchainMock() *BlockchainMock {
 }
 
 func (blockchain *BlockchainMock) CallTransactionGetCallbacks(txHash chainhash.Hash) {
+	blockchain.lock.Lock()
 	callbacks := blockchain.transactionGetCallbacks[txHash]
 	delete(blockchain.transactionGetCallbacks, txHash)
+	blockchain.lock.Unlock()
 	for _, callback := range callbacks {
 		callback()
 	}
 }
 
 func (blockchain *BlockchainMock) CallAllTransactionGetCallbacks() {
+	blockchain.lock.Lock()
+	txHashes := []chainhash.Hash{}
 	for txHash := range blockchain.transactionGetCallbacks {
+		txHashes = append(txHashes, txHash)
+	}
+	blockchain.lock.Unlock()
+	for _, txHash := range txHashes {
 		blockchain.CallTransactionGetCallbacks(txHash)
 	}
 }
 
+// numTransactionGetCallbacks returns the number of txs being downloaded.
+func (blockchain *BlockchainMock) numTransactionGetCallbacks() int {
+	blockchain.lock.Lock()
+	defer blockchain.lock.Unlock()
+	return len(blockchain.transactionGetCallbacks)
+}
+
 func (blockchain *BlockchainMock) RegisterTxs(txs ...*wire.MsgTx) {
+	blockchain.lock.Lock()
+	defer blockchain.lock.Unlock()
 	for _, tx := range txs {
 		blockchain.transactions[tx.TxHash()] = tx
 	}
@@ -77,6 +110,8 @@ func (blockchain *BlockchainMock) TransactionGet(
 	txHash chainhash.Hash,
 	success func(*wire.MsgTx) error,
 	cleanup func()) {
+	blockchain.lock.Lock()
+	defer blockchain.lock.Unlock()
 	tx, ok := blockchain.transactions[txHash]
 	if !ok {
 		panic("you need to first register the transaction with the mock backend")
@@ -444,3 +479,879 @@ func (s *transactionsSuite) TestRemoveTransactionPendingDownload() {
 	require.Empty(s.T(),
 		s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false }))
 }
+
+// TestUpdateAddressHistoryQueuedDownloads checks that the number of concurrent transaction downloads
+// is limited, and that the queued transactions are downloaded once earlier downloads finish.
+func (s *transactionsSuite) TestUpdateAddressHistoryQueuedDownloads() {
+	address := s.addressChain.EnsureAddresses()[0]
+	const numTxs = 250
+	history := []*blockchain.TxInfo{}
+	for i := 0; i < numTxs; i++ {
+		tx := newTx(chainhash.HashH(nil), uint32(i), address, 1)
+		s.blockchainMock.RegisterTxs(tx)
+		history = append(history, &blockchain.TxInfo{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0})
+	}
+	s.transactions.UpdateAddressHistory(address.PubkeyScriptHashHex(), history)
+	require.Equal(s.T(), 200, s.blockchainMock.numTransactionGetCallbacks())
+	for s.blockchainMock.numTransactionGetCallbacks() != 0 {
+		s.blockchainMock.CallAllTransactionGetCallbacks()
+		s.transactions.TstWaitTxDownloadDispatches()
+	}
+	require.Equal(s.T(), btcutil.Amount(numTxs), s.transactions.Balance().Incoming)
+}
+
+// TestReorg checks that transactions in orphaned blocks are verified again against the new headers.
+func (s *transactionsSuite) TestReorg() {
+	address := s.addressChain.EnsureAddresses()[0]
+	tx := newTx(chainhash.HashH(nil), 0, address, 123)
+	s.blockchainMock.RegisterTxs(tx)
+
+	// In a block containing only this tx, the merkle root is the tx hash.
+	merkleRoot := tx.TxHash()
+	var headerLock sync.Mutex
+	header := wire.NewBlockHeader(1, &chainhash.Hash{}, &merkleRoot, 0, 0)
+	header.Timestamp = time.Unix(1000, 0)
+	s.headersMock.On("HeaderByHeight", 10).Return(
+		func(int) *wire.BlockHeader {
+			headerLock.Lock()
+			defer headerLock.Unlock()
+			return header
+		}, nil)
+	s.blockchainMock.On("GetMerkle", tx.TxHash(), 10, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			success := args.Get(2).(func([]blockchain.TXHash, int) error)
+			cleanup := args.Get(4).(func())
+			defer cleanup()
+			require.NoError(s.T(), success([]blockchain.TXHash{}, 0))
+		})
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 10},
+	})
+	require.Equal(s.T(), 0, s.transactions.Reorg(11, 20))
+	require.Equal(s.T(), 1, s.transactions.Reorg(5, 10))
+	transactions := s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false })
+	require.Len(s.T(), transactions, 1)
+	require.Equal(s.T(), int64(1000), transactions[0].Timestamp.Unix())
+
+	// The tx is included at the same height in the new chain.
+	headerLock.Lock()
+	header = wire.NewBlockHeader(1, &chainhash.Hash{1}, &merkleRoot, 0, 0)
+	header.Timestamp = time.Unix(2000, 0)
+	headerLock.Unlock()
+	require.Equal(s.T(), 1, s.transactions.Reorg(10, 10))
+	transactions = s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false })
+	require.Equal(s.T(), int64(2000), transactions[0].Timestamp.Unix())
+}
+
+// TestReorgTxMoved tests a reorg in which the tx is included in a block at a different height. The
+// server can't prove the tx at the old height anymore, so the tx stays unverified until the address
+// history with the new height arrives.
+func (s *transactionsSuite) TestReorgTxMoved() {
+	address := s.addressChain.EnsureAddresses()[0]
+	tx := newTx(chainhash.HashH(nil), 0, address, 123)
+	s.blockchainMock.RegisterTxs(tx)
+
+	// In a block containing only this tx, the merkle root is the tx hash.
+	merkleRoot := tx.TxHash()
+	verified := make(chan struct{}, 1)
+	for i, height := range []int{10, 12} {
+		header := wire.NewBlockHeader(1, &chainhash.Hash{byte(i)}, &merkleRoot, 0, 0)
+		header.Timestamp = time.Unix(int64(1000*(i+1)), 0)
+		s.headersMock.On("HeaderByHeight", height).Return(header, nil)
+	}
+	var orphanedLock sync.Mutex
+	orphaned := false
+	s.blockchainMock.On("GetMerkle", tx.TxHash(), 10, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			success := args.Get(2).(func([]blockchain.TXHash, int) error)
+			failure := args.Get(3).(func(error))
+			cleanup := args.Get(4).(func())
+			defer cleanup()
+			orphanedLock.Lock()
+			defer orphanedLock.Unlock()
+			if orphaned {
+				failure(errors.New("height should be 10, but got 12"))
+				return
+			}
+			require.NoError(s.T(), success([]blockchain.TXHash{}, 0))
+			verified <- struct{}{}
+		})
+	s.blockchainMock.On("GetMerkle", tx.TxHash(), 12, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			success := args.Get(2).(func([]blockchain.TXHash, int) error)
+			cleanup := args.Get(4).(func())
+			defer cleanup()
+			require.NoError(s.T(), success([]blockchain.TXHash{}, 0))
+			verified <- struct{}{}
+		})
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 10},
+	})
+	<-verified
+
+	orphanedLock.Lock()
+	orphaned = true
+	orphanedLock.Unlock()
+	require.Equal(s.T(), 1, s.transactions.Reorg(10, 10))
+	transactions := s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false })
+	require.Len(s.T(), transactions, 1)
+	require.Nil(s.T(), transactions[0].Timestamp)
+
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 12},
+	})
+	<-verified
+	transactions = s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false })
+	require.Equal(s.T(), 12, transactions[0].Height)
+	require.Equal(s.T(), int64(2000), transactions[0].Timestamp.Unix())
+}
+
+// TestDoubleSpend checks that an incoming tx which is replaced by another one is marked as such and
+// does not count towards the balance.
+func (s *transactionsSuite) TestDoubleSpend() {
+	events := make(chan transactions.Event, 10)
+	s.transactions.SubscribeEvent(func(event transactions.Event) { events <- event })
+	requireEvent := func() {
+		select {
+		case event := <-events:
+			require.Equal(s.T(), transactions.EventIncomingTxDoubleSpent, event)
+		case <-time.After(10 * time.Second):
+			require.FailNow(s.T(), "expected double spend event")
+		}
+	}
+	statuses := func() map[chainhash.Hash]transactions.TxStatus {
+		result := map[chainhash.Hash]transactions.TxStatus{}
+		for _, txInfo := range s.transactions.Transactions(
+			func(blockchain.ScriptHashHex) bool { return false }) {
+			result[txInfo.Tx.TxHash()] = txInfo.Status
+		}
+		return result
+	}
+
+	address := s.addressChain.EnsureAddresses()[0]
+	// The sender replaces the payment by one paying less.
+	tx := newTx(chainhash.HashH(nil), 0, address, 1000)
+	replacement := newTx(chainhash.HashH(nil), 0, address, 900)
+	s.blockchainMock.RegisterTxs(tx, replacement)
+	s.headersMock.On("HeaderByHeight", 10).Return(nil, nil)
+
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0},
+	})
+	require.Equal(s.T(), map[chainhash.Hash]transactions.TxStatus{
+		tx.TxHash(): transactions.TxStatusMempool,
+	}, statuses())
+
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0},
+		{TXHash: blockchain.TXHash(replacement.TxHash()), Height: 0},
+	})
+	requireEvent()
+	require.Equal(s.T(), map[chainhash.Hash]transactions.TxStatus{
+		tx.TxHash():          transactions.TxStatusConflicting,
+		replacement.TxHash(): transactions.TxStatusConflicting,
+	}, statuses())
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 0, Incoming: 1900},
+		s.transactions.Balance())
+
+	// The replacement confirms, the replaced tx is evicted.
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0},
+		{TXHash: blockchain.TXHash(replacement.TxHash()), Height: 10},
+	})
+	require.Equal(s.T(), map[chainhash.Hash]transactions.TxStatus{
+		tx.TxHash():          transactions.TxStatusReplaced,
+		replacement.TxHash(): transactions.TxStatusConfirmed,
+	}, statuses())
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 900, Incoming: 0},
+		s.transactions.Balance())
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 1)
+
+	// The replaced tx disappears from the history.
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(replacement.TxHash()), Height: 10},
+	})
+	requireEvent()
+	require.Equal(s.T(), map[chainhash.Hash]transactions.TxStatus{
+		replacement.TxHash(): transactions.TxStatusConfirmed,
+	}, statuses())
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 900, Incoming: 0},
+		s.transactions.Balance())
+}
+
+func (s *transactionsSuite) TestLocalTxLifecycle() {
+	statuses := func() map[chainhash.Hash]transactions.TxStatus {
+		result := map[chainhash.Hash]transactions.TxStatus{}
+		for _, txInfo := range s.transactions.Transactions(
+			func(blockchain.ScriptHashHex) bool { return false }) {
+			result[txInfo.Tx.TxHash()] = txInfo.Status
+		}
+		return result
+	}
+
+	address := s.addressChain.EnsureAddresses()[0]
+	funding := newTx(chainhash.HashH(nil), 0, address, 1000)
+	// Pays to a script which is not ours.
+	spend := newTx(funding.TxHash(), 0, address, 900)
+	spend.TxOut[0].PkScript = []byte{txscript.OP_TRUE}
+	s.blockchainMock.RegisterTxs(funding, spend)
+	s.headersMock.On("HeaderByHeight", 10).Return(nil, nil)
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+	})
+
+	// A failed broadcast is forgotten.
+	s.blockchainMock.On("TransactionBroadcast", spend).Return(errors.New("rejected")).Once()
+	require.Error(s.T(), s.transactions.Broadcast(spend))
+	require.NotContains(s.T(), statuses(), spend.TxHash())
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 1000, Incoming: 0},
+		s.transactions.Balance())
+
+	// Broadcast, but not in the address history yet. The spent output is locked.
+	s.blockchainMock.On("TransactionBroadcast", spend).Return(nil).Once()
+	require.NoError(s.T(), s.transactions.Broadcast(spend))
+	require.Equal(s.T(), transactions.TxStatusBroadcast, statuses()[spend.TxHash()])
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 0, Incoming: 0},
+		s.transactions.Balance())
+	require.Empty(s.T(), s.transactions.SpendableOutputs())
+	require.Error(s.T(), s.transactions.Abandon(spend.TxHash()))
+
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(spend.TxHash()), Height: 0},
+	})
+	require.Equal(s.T(), transactions.TxStatusMempool, statuses()[spend.TxHash()])
+	require.Error(s.T(), s.transactions.Abandon(spend.TxHash()))
+
+	// Dropped from the mempool. The output stays locked, and the tx is broadcast again.
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+	})
+	require.Equal(s.T(), transactions.TxStatusDropped, statuses()[spend.TxHash()])
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 0, Incoming: 0},
+		s.transactions.Balance())
+	s.blockchainMock.On("TransactionBroadcast", spend).Return(errors.New("rejected")).Once()
+	s.transactions.TstRebroadcast()
+	s.blockchainMock.AssertExpectations(s.T())
+	require.Equal(s.T(), transactions.TxStatusDropped, statuses()[spend.TxHash()])
+
+	// Abandoning it unlocks the output.
+	require.NoError(s.T(), s.transactions.Abandon(spend.TxHash()))
+	require.NotContains(s.T(), statuses(), spend.TxHash())
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 1000, Incoming: 0},
+		s.transactions.Balance())
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 1)
+}
+
+func (s *transactionsSuite) TestLocalTxReplacedAndConfirmed() {
+	address := s.addressChain.EnsureAddresses()[0]
+	funding := newTx(chainhash.HashH(nil), 0, address, 1000)
+	spend := newTx(funding.TxHash(), 0, address, 900)
+	spend.TxOut[0].PkScript = []byte{txscript.OP_TRUE}
+	otherSpend := newTx(funding.TxHash(), 0, address, 800)
+	s.blockchainMock.RegisterTxs(funding, spend, otherSpend)
+	s.headersMock.On("HeaderByHeight", mock.Anything).Return(nil, nil)
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+	})
+	s.blockchainMock.On("TransactionBroadcast", mock.Anything).Return(nil)
+
+	// Another tx of the wallet spending the same output confirms.
+	require.NoError(s.T(), s.transactions.Broadcast(spend))
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(otherSpend.TxHash()), Height: 11},
+	})
+	txs := s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false })
+	require.Len(s.T(), txs, 3)
+	for _, txInfo := range txs {
+		if txInfo.Tx.TxHash() == spend.TxHash() {
+			require.Equal(s.T(), transactions.TxStatusReplaced, txInfo.Status)
+		}
+	}
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 800, Incoming: 0},
+		s.transactions.Balance())
+	require.NoError(s.T(), s.transactions.Abandon(spend.TxHash()))
+
+	// Once confirmed, a tx is not tracked anymore.
+	require.NoError(s.T(), s.transactions.Broadcast(otherSpend))
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(otherSpend.TxHash()), Height: 12},
+	})
+	require.Len(s.T(),
+		s.transactions.Transactions(func(blockchain.ScriptHashHex) bool { return false }), 2)
+	require.Error(s.T(), s.transactions.Abandon(otherSpend.TxHash()))
+}
+
+func (s *transactionsSuite) TestBalanceBreakdown() {
+	addresses := s.addressChain.EnsureAddresses()
+	address0, address1 := addresses[0], addresses[1]
+	frozen := newTx(chainhash.HashH(nil), 0, address0, 1000)
+	reserved := newTx(chainhash.HashH(nil), 1, address0, 700)
+	incoming := newTx(chainhash.HashH(nil), 2, address0, 300)
+	funding := newTx(chainhash.HashH(nil), 3, address1, 2000)
+	change := newTx(funding.TxHash(), 0, address1, 1900)
+	coinbase := newTx(chainhash.Hash{}, wire.MaxPrevOutIndex, address1, 5000)
+	s.blockchainMock.RegisterTxs(frozen, reserved, incoming, funding, change, coinbase)
+	s.headersMock.On("HeaderByHeight", 10).Return(nil, nil)
+	s.updateAddressHistory(address0, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(frozen.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(reserved.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(incoming.TxHash()), Height: 0},
+	})
+	s.updateAddressHistory(address1, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(change.TxHash()), Height: 0},
+		{TXHash: blockchain.TXHash(coinbase.TxHash()), Height: 10},
+	})
+	require.NoError(s.T(), s.transactions.SetOutputFrozen(wire.OutPoint{Hash: frozen.TxHash()}, true))
+	require.Error(s.T(), s.transactions.SetOutputFrozen(wire.OutPoint{Hash: frozen.TxHash(), Index: 1}, true))
+	pendingSend := newTx(reserved.TxHash(), 0, address0, 600)
+	pendingSend.TxOut[0].PkScript = []byte{txscript.OP_TRUE}
+	s.blockchainMock.On("TransactionBroadcast", pendingSend).Return(nil).Once()
+	require.NoError(s.T(), s.transactions.Broadcast(pendingSend))
+
+	breakdown := s.transactions.BalanceBreakdown()
+	require.Equal(s.T(), transactions.BalanceAmounts{
+		UnconfirmedOwn: 1900,
+		Incoming:       300,
+		Immature:       5000,
+		Frozen:         1000,
+		Reserved:       700,
+	}, breakdown.BalanceAmounts)
+	require.Equal(s.T(), btcutil.Amount(1900), breakdown.Spendable())
+	require.Equal(s.T(), btcutil.Amount(8900), breakdown.Total())
+	require.Equal(s.T(), map[string]*transactions.BalanceAmounts{
+		address0.String(): {Incoming: 300, Frozen: 1000, Reserved: 700},
+		address1.String(): {UnconfirmedOwn: 1900, Immature: 5000},
+	}, breakdown.Addresses)
+	require.Len(s.T(), breakdown.UTXOs, 5)
+	require.Equal(s.T(), coinbase.TxHash(), breakdown.UTXOs[0].OutPoint.Hash)
+	require.Equal(s.T(), transactions.OutputStateImmature, breakdown.UTXOs[0].State)
+	require.Equal(s.T(),
+		&transactions.Balance{Available: 1900, Incoming: 300},
+		s.transactions.Balance())
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 1)
+
+	require.NoError(s.T(), s.transactions.SetOutputFrozen(wire.OutPoint{Hash: frozen.TxHash()}, false))
+	breakdown = s.transactions.BalanceBreakdown()
+	require.Equal(s.T(), btcutil.Amount(1000), breakdown.Confirmed)
+	require.Equal(s.T(), btcutil.Amount(0), breakdown.Frozen)
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 2)
+}
+
+func (s *transactionsSuite) TestDustQuarantine() {
+	events := make(chan transactions.Event, 10)
+	s.transactions.SubscribeEvent(func(event transactions.Event) { events <- event })
+	s.transactions.SetDustThreshold(1000)
+	addresses := s.addressChain.EnsureAddresses()
+	address0, address1, address2 := addresses[0], addresses[1], addresses[2]
+	payment := newTx(chainhash.HashH(nil), 0, address0, 20000)
+	reusedAddressDust := newTx(chainhash.HashH(nil), 1, address0, 3000)
+	dust := newTx(chainhash.HashH(nil), 2, address1, 500)
+	funding := newTx(chainhash.HashH(nil), 3, address2, 20000)
+	change := newTx(funding.TxHash(), 0, address2, 800)
+	s.blockchainMock.RegisterTxs(payment, reusedAddressDust, dust, funding, change)
+	s.headersMock.On("HeaderByHeight", 10).Return(nil, nil)
+	s.updateAddressHistory(address0, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(payment.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(reusedAddressDust.TxHash()), Height: 10},
+	})
+	s.updateAddressHistory(address1, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(dust.TxHash()), Height: 10},
+	})
+	s.updateAddressHistory(address2, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(change.TxHash()), Height: 10},
+	})
+
+	quarantineReasons := func() map[chainhash.Hash]transactions.QuarantineReason {
+		result := map[chainhash.Hash]transactions.QuarantineReason{}
+		for _, utxo := range s.transactions.BalanceBreakdown().UTXOs {
+			result[utxo.OutPoint.Hash] = utxo.QuarantineReason
+		}
+		return result
+	}
+	// The user is notified about the quarantined outputs.
+	select {
+	case event := <-events:
+		require.Equal(s.T(), transactions.EventOutputQuarantined, event)
+	case <-time.After(10 * time.Second):
+		require.FailNow(s.T(), "expected quarantine event")
+	}
+	// Small change is not quarantined, as it is funded by the wallet.
+	require.Equal(s.T(), map[chainhash.Hash]transactions.QuarantineReason{
+		payment.TxHash():           "",
+		reusedAddressDust.TxHash(): transactions.QuarantineReasonReusedAddressDust,
+		dust.TxHash():              transactions.QuarantineReasonDust,
+		change.TxHash():            "",
+	}, quarantineReasons())
+	breakdown := s.transactions.BalanceBreakdown()
+	require.Equal(s.T(), transactions.BalanceAmounts{
+		Confirmed:   20800,
+		Quarantined: 3500,
+	}, breakdown.BalanceAmounts)
+	require.Equal(s.T(), btcutil.Amount(24300), breakdown.Total())
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 2)
+
+	dustOutPoint := wire.OutPoint{Hash: dust.TxHash()}
+	require.Error(s.T(),
+		s.transactions.SetOutputReleased(wire.OutPoint{Hash: dust.TxHash(), Index: 1}, true))
+	require.NoError(s.T(), s.transactions.SetOutputReleased(dustOutPoint, true))
+	breakdown = s.transactions.BalanceBreakdown()
+	require.Equal(s.T(), btcutil.Amount(21300), breakdown.Confirmed)
+	require.Equal(s.T(), btcutil.Amount(3000), breakdown.Quarantined)
+	require.Equal(s.T(), transactions.QuarantineReasonDust, quarantineReasons()[dust.TxHash()])
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 3)
+
+	require.NoError(s.T(), s.transactions.SetOutputReleased(dustOutPoint, false))
+	require.Equal(s.T(), btcutil.Amount(3500), s.transactions.BalanceBreakdown().Quarantined)
+
+	// Disabling the quarantine makes all outputs spendable.
+	s.transactions.SetDustThreshold(0)
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 4)
+}
+
+func (s *transactionsSuite) TestReceiveCounts() {
+	addresses := s.addressChain.EnsureAddresses()
+	address0, address1 := addresses[0], addresses[1]
+	tx1 := newTx(chainhash.HashH(nil), 0, address0, 1000)
+	tx2 := newTx(chainhash.HashH(nil), 1, address0, 2000)
+	// Paying twice to the same address in one tx is no reuse.
+	tx3 := newTx(chainhash.HashH(nil), 2, address1, 3000)
+	tx3.AddTxOut(wire.NewTxOut(4000, address1.PubkeyScript()))
+	s.blockchainMock.RegisterTxs(tx1, tx2, tx3)
+	s.headersMock.On("HeaderByHeight", 10).Return(nil, nil)
+	s.updateAddressHistory(address0, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(tx2.TxHash()), Height: 10},
+	})
+	s.updateAddressHistory(address1, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx3.TxHash()), Height: 10},
+	})
+	require.Equal(s.T(), map[blockchain.ScriptHashHex]int{
+		address0.PubkeyScriptHashHex(): 2,
+		address1.PubkeyScriptHashHex(): 1,
+	}, s.transactions.ReceiveCounts())
+}
+
+func (s *transactionsSuite) TestTxDetail() {
+	addresses := s.addressChain.EnsureAddresses()
+	address, changeAddress := addresses[0], addresses[1]
+	isChange := func(scriptHashHex blockchain.ScriptHashHex) bool {
+		return scriptHashHex == changeAddress.PubkeyScriptHashHex()
+	}
+	funding := newTx(chainhash.HashH(nil), 0, address, 1000)
+	spend := newTx(funding.TxHash(), 0, changeAddress, 300)
+	spend.TxIn[0].Sequence = 0
+	spend.AddTxOut(wire.NewTxOut(600, []byte{txscript.OP_TRUE}))
+	s.blockchainMock.RegisterTxs(funding, spend)
+	// In a block containing only this tx, the merkle root is the tx hash.
+	merkleRoot := funding.TxHash()
+	header := wire.NewBlockHeader(1, &chainhash.Hash{}, &merkleRoot, 0, 0)
+	s.headersMock.On("HeaderByHeight", 10).Return(header, nil)
+	verified := make(chan struct{}, 1)
+	s.blockchainMock.On("GetMerkle", funding.TxHash(), 10, mock.Anything, mock.Anything, mock.Anything).Run(
+		func(args mock.Arguments) {
+			success := args.Get(2).(func([]blockchain.TXHash, int) error)
+			cleanup := args.Get(4).(func())
+			defer cleanup()
+			require.NoError(s.T(), success([]blockchain.TXHash{}, 0))
+			verified <- struct{}{}
+		})
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(funding.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(spend.TxHash()), Height: 0},
+	})
+	s.updateAddressHistory(changeAddress, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(spend.TxHash()), Height: 0},
+	})
+	select {
+	case <-verified:
+	case <-time.After(10 * time.Second):
+		require.FailNow(s.T(), "tx not verified")
+	}
+
+	// The header is looked up without holding the lock, as the headers can block while syncing.
+	s.headersMock.ExpectedCalls = nil
+	s.headersMock.On("HeaderByHeight", 10).Return(header, nil).Run(func(mock.Arguments) {
+		locked := make(chan struct{})
+		go func() {
+			s.transactions.SetDustThreshold(0)
+			close(locked)
+		}()
+		select {
+		case <-locked:
+		case <-time.After(10 * time.Second):
+			require.FailNow(s.T(), "lock held while looking up the header")
+		}
+	})
+	fundingDetail, err := s.transactions.TxDetail(funding.TxHash(), isChange)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), transactions.TxTypeReceive, fundingDetail.Type)
+	require.Equal(s.T(), []*transactions.TxInputDetail{
+		{PreviousOutPoint: funding.TxIn[0].PreviousOutPoint},
+	}, fundingDetail.Inputs)
+	require.Equal(s.T(), []*transactions.TxOutputDetail{
+		{Index: 0, Value: 1000, Address: address.EncodeAddress(), Kind: transactions.OutputKindOurs},
+	}, fundingDetail.Outputs)
+	require.False(s.T(), fundingDetail.RBF)
+	blockHash := header.BlockHash()
+	require.Equal(s.T(), &blockHash, fundingDetail.BlockHash)
+	require.True(s.T(), fundingDetail.Verified)
+
+	spendDetail, err := s.transactions.TxDetail(spend.TxHash(), isChange)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), transactions.TxType(transactions.TxTypeSend), spendDetail.Type)
+	spentValue := btcutil.Amount(1000)
+	require.Equal(s.T(), []*transactions.TxInputDetail{{
+		PreviousOutPoint: wire.OutPoint{Hash: funding.TxHash(), Index: 0},
+		Value:            &spentValue,
+		Address:          address.EncodeAddress(),
+		Ours:             true,
+	}}, spendDetail.Inputs)
+	require.Equal(s.T(), transactions.OutputKindChange, spendDetail.Outputs[0].Kind)
+	require.Equal(s.T(), transactions.OutputKindExternal, spendDetail.Outputs[1].Kind)
+	require.Equal(s.T(), btcutil.Amount(100), *spendDetail.Fee)
+	require.True(s.T(), spendDetail.RBF)
+	require.Nil(s.T(), spendDetail.BlockHash)
+	require.False(s.T(), spendDetail.Verified)
+
+	_, err = s.transactions.TxDetail(chainhash.HashH([]byte("unknown")), isChange)
+	require.Error(s.T(), err)
+}
+
+func (s *transactionsSuite) TestBalanceHistory() {
+	address := s.addressChain.EnsureAddresses()[0]
+	tx1 := newTx(chainhash.HashH(nil), 0, address, 1000)
+	tx2 := newTx(tx1.TxHash(), 0, address, 400)
+	tx3 := newTx(chainhash.HashH(nil), 1, address, 50)
+	s.blockchainMock.RegisterTxs(tx1, tx2, tx3)
+	now := time.Now()
+	verified := make(chan struct{}, 10)
+	for height, tx := range map[int]*wire.MsgTx{10: tx1, 11: tx2, 12: tx3} {
+		// In a block containing only this tx, the merkle root is the tx hash.
+		merkleRoot := tx.TxHash()
+		header := wire.NewBlockHeader(1, &chainhash.Hash{}, &merkleRoot, 0, 0)
+		header.Timestamp = map[int]time.Time{
+			10: now.AddDate(0, 0, -9), 11: now.AddDate(0, 0, -2), 12: now}[height]
+		s.headersMock.On("HeaderByHeight", height).Return(header, nil)
+		s.blockchainMock.On("GetMerkle", tx.TxHash(), height, mock.Anything, mock.Anything, mock.Anything).Run(
+			func(args mock.Arguments) {
+				success := args.Get(2).(func([]blockchain.TXHash, int) error)
+				cleanup := args.Get(4).(func())
+				defer cleanup()
+				require.NoError(s.T(), success([]blockchain.TXHash{}, 0))
+				verified <- struct{}{}
+			})
+	}
+	waitVerified := func() {
+		select {
+		case <-verified:
+		case <-time.After(10 * time.Second):
+			require.FailNow(s.T(), "tx not verified")
+		}
+	}
+
+	history, err := s.transactions.BalanceHistory(transactions.BalanceHistoryIntervalDay)
+	require.NoError(s.T(), err)
+	require.Empty(s.T(), history)
+
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(tx2.TxHash()), Height: 11},
+	})
+	waitVerified()
+	waitVerified()
+	history, err = s.transactions.BalanceHistory(transactions.BalanceHistoryIntervalDay)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), history, 10)
+	for i, point := range history {
+		expected := btcutil.Amount(1000)
+		if i >= 7 {
+			expected = 400
+		}
+		require.Equal(s.T(), expected, point.Balance)
+		require.Equal(s.T(), 0, point.Time.Hour())
+	}
+	history, err = s.transactions.BalanceHistory(transactions.BalanceHistoryIntervalWeek)
+	require.NoError(s.T(), err)
+	require.True(s.T(), len(history) == 2 || len(history) == 3)
+	require.Equal(s.T(), btcutil.Amount(1000), history[0].Balance)
+	require.Equal(s.T(), btcutil.Amount(400), history[len(history)-1].Balance)
+	require.Equal(s.T(), time.Monday, history[0].Time.Weekday())
+
+	// The cached history is updated when a new tx is verified.
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(tx2.TxHash()), Height: 11},
+		{TXHash: blockchain.TXHash(tx3.TxHash()), Height: 12},
+	})
+	waitVerified()
+	history, err = s.transactions.BalanceHistory(transactions.BalanceHistoryIntervalDay)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), history, 10)
+	require.Equal(s.T(), btcutil.Amount(450), history[9].Balance)
+
+	_, err = s.transactions.BalanceHistory("month")
+	require.Error(s.T(), err)
+}
+
+func (s *transactionsSuite) TestSearchTransactions() {
+	address := s.addressChain.EnsureAddresses()[0]
+	tx1 := newTx(chainhash.HashH(nil), 0, address, 1000)
+	tx2 := newTx(tx1.TxHash(), 0, address, 400)
+	tx3 := newTx(chainhash.HashH(nil), 1, address, 50)
+	s.blockchainMock.RegisterTxs(tx1, tx2, tx3)
+	now := time.Now()
+	verified := make(chan struct{}, 10)
+	for height, tx := range map[int]*wire.MsgTx{10: tx1, 11: tx2} {
+		// In a block containing only this tx, the merkle root is the tx hash.
+		merkleRoot := tx.TxHash()
+		header := wire.NewBlockHeader(1, &chainhash.Hash{}, &merkleRoot, 0, 0)
+		header.Timestamp = map[int]time.Time{10: now.AddDate(0, 0, -9), 11: now.AddDate(0, 0, -2)}[height]
+		s.headersMock.On("HeaderByHeight", height).Return(header, nil)
+		s.blockchainMock.On("GetMerkle", tx.TxHash(), height, mock.Anything, mock.Anything, mock.Anything).Run(
+			func(args mock.Arguments) {
+				success := args.Get(2).(func([]blockchain.TXHash, int) error)
+				cleanup := args.Get(4).(func())
+				defer cleanup()
+				require.NoError(s.T(), success([]blockchain.TXHash{}, 0))
+				verified <- struct{}{}
+			})
+	}
+	s.updateAddressHistory(address, []*blockchain.TxInfo{
+		{TXHash: blockchain.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(tx2.TxHash()), Height: 11},
+		{TXHash: blockchain.TXHash(tx3.TxHash()), Height: 0},
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verified:
+		case <-time.After(10 * time.Second):
+			require.FailNow(s.T(), "tx not verified")
+		}
+	}
+
+	isChange := func(blockchain.ScriptHashHex) bool { return false }
+	search := func(filter *transactions.TxFilter) []chainhash.Hash {
+		txs, _, err := s.transactions.SearchTransactions(filter, isChange)
+		require.NoError(s.T(), err)
+		result := []chainhash.Hash{}
+		for _, txInfo := range txs {
+			result = append(result, txInfo.Tx.TxHash())
+		}
+		return result
+	}
+	all := []chainhash.Hash{tx3.TxHash(), tx2.TxHash(), tx1.TxHash()}
+	require.Equal(s.T(), all, search(&transactions.TxFilter{}))
+
+	fiveDaysAgo := now.AddDate(0, 0, -5)
+	require.Equal(s.T(), []chainhash.Hash{tx2.TxHash()},
+		search(&transactions.TxFilter{From: &fiveDaysAgo}))
+	require.Equal(s.T(), []chainhash.Hash{tx1.TxHash()},
+		search(&transactions.TxFilter{To: &fiveDaysAgo}))
+	// Dates before 1970 don't wrap around in the time index.
+	longAgo := time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(s.T(), all[1:], search(&transactions.TxFilter{From: &longAgo}))
+	require.Empty(s.T(), search(&transactions.TxFilter{To: &longAgo}))
+
+	minAmount := btcutil.Amount(100)
+	require.Equal(s.T(), []chainhash.Hash{tx1.TxHash()}, search(&transactions.TxFilter{
+		Type:      transactions.TxTypeReceive,
+		MinAmount: &minAmount,
+	}))
+	maxAmount := btcutil.Amount(100)
+	require.Equal(s.T(), []chainhash.Hash{tx3.TxHash()},
+		search(&transactions.TxFilter{MaxAmount: &maxAmount}))
+
+	require.Equal(s.T(), []chainhash.Hash{tx2.TxHash()}, search(&transactions.TxFilter{
+		IDPrefix: strings.ToUpper(tx2.TxHash().String()[:10]),
+	}))
+
+	require.Equal(s.T(), all, search(&transactions.TxFilter{Address: address.EncodeAddress()}))
+	foreignAddress, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), s.net)
+	require.NoError(s.T(), err)
+	require.Empty(s.T(), search(&transactions.TxFilter{Address: foreignAddress.EncodeAddress()}))
+	_, _, err = s.transactions.SearchTransactions(
+		&transactions.TxFilter{Address: "invalid"}, isChange)
+	require.Error(s.T(), err)
+
+	require.Equal(s.T(), all[1:2], search(&transactions.TxFilter{Offset: 1, Limit: 1}))
+	require.Empty(s.T(), search(&transactions.TxFilter{Offset: 3}))
+	// The total includes the txs which are not in the page.
+	for _, offset := range []int{1, 3} {
+		_, total, err := s.transactions.SearchTransactions(
+			&transactions.TxFilter{Offset: offset, Limit: 1}, isChange)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), len(all), total)
+	}
+}
+
+// TestTxDownloadQueueBackpressure checks that WhenTxDownloadQueueAvailable() holds back callers while
+// the download queue is full, and calls them once enough downloads have finished.
+func (s *transactionsSuite) TestTxDownloadQueueBackpressure() {
+	var calledLock sync.Mutex
+	called := 0
+	onAvailable := func() {
+		calledLock.Lock()
+		called++
+		calledLock.Unlock()
+	}
+	s.transactions.WhenTxDownloadQueueAvailable(onAvailable)
+	require.Equal(s.T(), 1, called)
+
+	address := s.addressChain.EnsureAddresses()[0]
+	// 200 downloads in progress and 1100 queued.
+	const numTxs = 1300
+	history := []*blockchain.TxInfo{}
+	for i := 0; i < numTxs; i++ {
+		tx := newTx(chainhash.HashH(nil), uint32(i), address, 1)
+		s.blockchainMock.RegisterTxs(tx)
+		history = append(history, &blockchain.TxInfo{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0})
+	}
+	s.transactions.UpdateAddressHistory(address.PubkeyScriptHashHex(), history)
+	s.transactions.WhenTxDownloadQueueAvailable(onAvailable)
+	s.transactions.WhenTxDownloadQueueAvailable(onAvailable)
+	require.Equal(s.T(), 1, called)
+
+	// Finishing the 200 downloads in progress brings the queue below its capacity, which wakes up
+	// one waiter per finished download.
+	s.blockchainMock.CallAllTransactionGetCallbacks()
+	s.transactions.TstWaitTxDownloadDispatches()
+	require.Equal(s.T(), 3, called)
+	for s.blockchainMock.numTransactionGetCallbacks() != 0 {
+		s.blockchainMock.CallAllTransactionGetCallbacks()
+		s.transactions.TstWaitTxDownloadDispatches()
+	}
+	require.Equal(s.T(), btcutil.Amount(numTxs), s.transactions.Balance().Incoming)
+}
+
+// txServer is an Electrum server which serves the raw txs of blockchain.transaction.get, also in
+// batch requests.
+type txServer struct {
+	txs map[string]*wire.MsgTx
+}
+
+func (server *txServer) ServerInfo() *rpc.ServerInfo {
+	return &rpc.ServerInfo{Server: "txserver"}
+}
+
+func (server *txServer) reply(request *jsonRequest) map[string]interface{} {
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	switch request.Method {
+	case "server.version":
+		reply["result"] = []string{"ElectrumX 1.8.7", "1.4"}
+	case "blockchain.transaction.get":
+		rawTx := &bytes.Buffer{}
+		if err := server.txs[request.Params[0].(string)].Serialize(rawTx); err != nil {
+			panic(err)
+		}
+		reply["result"] = hex.EncodeToString(rawTx.Bytes())
+	default:
+		reply["result"] = nil
+	}
+	return reply
+}
+
+type jsonRequest struct {
+	ID     int           `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+func (server *txServer) EstablishConnection() (io.ReadWriteCloser, error) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var reply interface{}
+			if line[0] == '[' {
+				requests := []*jsonRequest{}
+				if err := json.Unmarshal(line, &requests); err != nil {
+					panic(err)
+				}
+				replies := []interface{}{}
+				for _, request := range requests {
+					replies = append(replies, server.reply(request))
+				}
+				reply = replies
+			} else {
+				request := &jsonRequest{}
+				if err := json.Unmarshal(line, request); err != nil {
+					panic(err)
+				}
+				reply = server.reply(request)
+			}
+			replyBytes, err := json.Marshal(reply)
+			if err != nil {
+				panic(err)
+			}
+			if _, err := serverConn.Write(append(replyBytes, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+	return clientConn, nil
+}
+
+// TestTxDownloadsThroughRPCClient downloads more txs than can be downloaded at the same time through
+// the JSON-RPC client. The next downloads are started when earlier ones finish, while the client
+// holds its pending requests lock, which must not deadlock.
+func TestTxDownloadsThroughRPCClient(t *testing.T) {
+	log := logging.Get().WithGroup("transactions_test")
+	_, addressChain := addressesTest.NewAddressChain()
+	address := addressChain.EnsureAddresses()[0]
+	server := &txServer{txs: map[string]*wire.MsgTx{}}
+	const numTxs = 500
+	history := []*blockchain.TxInfo{}
+	for i := 0; i < numTxs; i++ {
+		tx := newTx(chainhash.HashH(nil), uint32(i), address, 1)
+		server.txs[tx.TxHash().String()] = tx
+		history = append(history, &blockchain.TxInfo{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0})
+	}
+	rpcClient := jsonrpc.NewRPCClient([]rpc.Backend{server}, log)
+	defer rpcClient.Close()
+	electrumClient := client.NewElectrumClient(rpcClient, nil, log)
+
+	syncFinished := make(chan struct{}, 1)
+	db, err := transactionsdb.NewDB(test.TstTempFile("godbb-db-"))
+	require.NoError(t, err)
+	headers := &headersMock.Interface{}
+	headers.On("SubscribeEvent", mock.AnythingOfType("func(headers.Event)")).Return(func() {})
+	headers.On("TipHeight").Return(15)
+	txs := transactions.NewTransactions(
+		&chaincfg.TestNet3Params,
+		db,
+		headers,
+		synchronizer.NewSynchronizer(func() {}, func() {
+			select {
+			case syncFinished <- struct{}{}:
+			default:
+			}
+		}, log),
+		electrumClient,
+		log,
+	)
+	defer txs.Close()
+	txs.UpdateAddressHistory(address.PubkeyScriptHashHex(), history)
+	select {
+	case <-syncFinished:
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "the txs were not downloaded")
+	}
+	require.Equal(t, btcutil.Amount(numTxs), txs.Balance().Incoming)
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// OutputKind tells who an output of a tx belongs to. See the OutputKind* constants.
+type OutputKind string
+
+const (
+	// OutputKindOurs is an output paid to one of our receive addresses.
+	OutputKindOurs OutputKind = "ours"
+	// OutputKindChange is an output paid to one of our change addresses.
+	OutputKindChange OutputKind = "change"
+	// OutputKindExternal is an output paid to someone else.
+	OutputKindExternal OutputKind = "external"
+)
+
+// maxRBFSequence is the highest input sequence number signaling replaceability, see BIP125.
+const maxRBFSequence = wire.MaxTxInSequenceNum - 2
+
+// TxInputDetail describes an input of a tx.
+type TxInputDetail struct {
+	PreviousOutPoint wire.OutPoint
+	// Value and Address are only known if the spent output is ours, or the tx creating it is
+	// stored. Value is nil and Address empty otherwise, e.g. for coinbase inputs.
+	Value   *btcutil.Amount
+	Address string
+	Ours    bool
+}
+
+// TxOutputDetail describes an output of a tx.
+type TxOutputDetail struct {
+	Index   uint32
+	Value   btcutil.Amount
+	Address string
+	Kind    OutputKind
+}
+
+// TxDetail is the full information about a tx, in addition to the summary in TxInfo.
+type TxDetail struct {
+	*TxInfo
+	Inputs  []*TxInputDetail
+	Outputs []*TxOutputDetail
+	// RBF is true if the tx signals replaceability, see BIP125.
+	RBF bool
+	// BlockHash is the hash of the block the tx was confirmed in. Nil for unconfirmed txs or if
+	// the header is not synced yet.
+	BlockHash *chainhash.Hash
+	// Verified is true if the tx was verified to be in the block with a merkle proof.
+	Verified bool
+}
+
+// inputDetail returns the details of the input.
+func (transactions *Transactions) inputDetail(dbTx DBTxInterface, txIn *wire.TxIn) *TxInputDetail {
+	result := &TxInputDetail{PreviousOutPoint: txIn.PreviousOutPoint}
+	spentOut, err := dbTx.Output(txIn.PreviousOutPoint)
+	if err != nil {
+		transactions.log.WithError(err).Panic("Failed to retrieve output")
+	}
+	if spentOut == nil {
+		previousTx, _, _, _, err := dbTx.TxInfo(txIn.PreviousOutPoint.Hash)
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+		}
+		if previousTx == nil || int(txIn.PreviousOutPoint.Index) >= len(previousTx.TxOut) {
+			return result
+		}
+		spentOut = previousTx.TxOut[txIn.PreviousOutPoint.Index]
+	} else {
+		result.Ours = true
+	}
+	value := btcutil.Amount(spentOut.Value)
+	result.Value = &value
+	result.Address = transactions.outputToAddress(spentOut.PkScript)
+	return result
+}
+
+// TxDetail returns the full information about one of our txs, including local txs which are not
+// indexed yet. isChange tells whether an output script belongs to a change address.
+func (transactions *Transactions) TxDetail(
+	txHash chainhash.Hash,
+	isChange func(blockchain.ScriptHashHex) bool,
+) (*TxDetail, error) {
+	transactions.synchronizer.WaitSynchronized()
+	result, height, err := transactions.txDetail(txHash, isChange)
+	if err != nil {
+		return nil, err
+	}
+	// The header is looked up without holding the lock and the db tx, as the headers can block
+	// while they are synced.
+	if height > 0 {
+		header, err := transactions.headers.HeaderByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			blockHash := header.BlockHash()
+			result.BlockHash = &blockHash
+		}
+	}
+	return result, nil
+}
+
+// txDetail reads the details of the tx from the db, except for the block hash. It also returns the
+// height of the tx.
+func (transactions *Transactions) txDetail(
+	txHash chainhash.Hash,
+	isChange func(blockchain.ScriptHashHex) bool,
+) (*TxDetail, int, error) {
+	defer transactions.RLock()()
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dbTx.Rollback()
+
+	tx, _, height, timestamp, err := dbTx.TxInfo(txHash)
+	if err != nil {
+		return nil, 0, err
+	}
+	var status TxStatus
+	if tx != nil {
+		status = transactions.txStatus(dbTx, txHash, tx, height)
+	} else {
+		localTx, err := dbTx.LocalTx(txHash)
+		if err != nil {
+			return nil, 0, err
+		}
+		if localTx == nil {
+			return nil, 0, errp.Newf("tx %s not found", txHash)
+		}
+		tx = localTx.Tx
+		status = transactions.localTxStatus(dbTx, txHash, localTx)
+	}
+
+	result := &TxDetail{
+		TxInfo:  transactions.txInfo(dbTx, tx, height, timestamp, status, isChange),
+		Inputs:  []*TxInputDetail{},
+		Outputs: []*TxOutputDetail{},
+	}
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence <= maxRBFSequence {
+			result.RBF = true
+		}
+		result.Inputs = append(result.Inputs, transactions.inputDetail(dbTx, txIn))
+	}
+	for index, txOut := range tx.TxOut {
+		output, err := dbTx.Output(wire.OutPoint{Hash: txHash, Index: uint32(index)})
+		if err != nil {
+			return nil, 0, err
+		}
+		kind := OutputKindExternal
+		switch {
+		case isChange(getScriptHashHex(txOut)):
+			kind = OutputKindChange
+		case output != nil:
+			kind = OutputKindOurs
+		}
+		result.Outputs = append(result.Outputs, &TxOutputDetail{
+			Index:   uint32(index),
+			Value:   btcutil.Amount(txOut.Value),
+			Address: transactions.outputToAddress(txOut.PkScript),
+			Kind:    kind,
+		})
+	}
+	// The header timestamp is only stored once the tx is verified.
+	result.Verified = height > 0 && timestamp != nil
+	return result, height, nil
+}
@@ -85,8 +85,9 @@ func (transactions *Transactions) verifyTransaction(txHash chainhash.Hash, heigh
 	}
 	header, err := transactions.headers.HeaderByHeight(height)
 	if err != nil {
-		// TODO
-		panic(err)
+		// Will be retried the next time the headers are synced.
+		transactions.log.WithError(err).Warningf("Could not get header at %d, couldn't verify tx", height)
+		return
 	}
 	if header == nil {
 		transactions.log.Warningf("Header not yet synced to %d, couldn't verify tx", height)
@@ -114,7 +115,59 @@ func (transactions *Transactions) verifyTransaction(txHash chainhash.Hash, heigh
 			if err := dbTx.MarkTxVerified(txHash, header.Timestamp); err != nil {
 				return err
 			}
-			return dbTx.Commit()
+			if err := dbTx.Commit(); err != nil {
+				return err
+			}
+			transactions.invalidateBalanceHistory()
+			return nil
+		},
+		func(err error) {
+			// The tx stays unverified. If it was moved to a different block, it is verified again
+			// when the address history with the new height arrives.
+			transactions.log.WithError(err).Warningf("Could not get the merkle proof of %s", txHash)
 		},
 		func() { done() })
 }
+
+// Reorg must be called when the blocks from fromHeight to toHeight were orphaned. The transactions
+// confirmed in these blocks are marked as unverified and verified again against the new headers.
+// Returns the number of affected transactions.
+func (transactions *Transactions) Reorg(fromHeight, toHeight int) int {
+	affected := func() int {
+		defer transactions.Lock()()
+		dbTx, err := transactions.db.Begin()
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to begin transaction")
+		}
+		defer dbTx.Rollback()
+		txHashes, err := dbTx.Transactions()
+		if err != nil {
+			transactions.log.WithError(err).Panic("Failed to retrieve transactions")
+		}
+		affected := 0
+		for _, txHash := range txHashes {
+			_, _, height, _, err := dbTx.TxInfo(txHash)
+			if err != nil {
+				transactions.log.WithError(err).Panic("Failed to retrieve tx info")
+			}
+			if height <= 0 || height < fromHeight || height > toHeight {
+				continue
+			}
+			if err := dbTx.UnmarkTxVerified(txHash); err != nil {
+				transactions.log.WithError(err).Panic("Failed to unmark tx as verified")
+			}
+			affected++
+		}
+		if err := dbTx.Commit(); err != nil {
+			transactions.log.WithError(err).Panic("Failed to commit")
+		}
+		transactions.invalidateBalanceHistory()
+		return affected
+	}()
+	if affected > 0 {
+		transactions.log.Infof("%d transactions were in orphaned blocks %d to %d",
+			affected, fromHeight, toHeight)
+		transactions.verifyTransactions()
+	}
+	return affected
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coin
+
+import "time"
+
+// TransferType is the direction of a transfer. See the TransferType* constants.
+type TransferType string
+
+const (
+	// TransferTypeReceive is a transfer of funds into the account.
+	TransferTypeReceive TransferType = "receive"
+	// TransferTypeSend is a transfer of funds out of the account.
+	TransferTypeSend TransferType = "send"
+	// TransferTypeSendSelf is a transfer from the account to itself.
+	TransferTypeSendSelf TransferType = "send_to_self"
+)
+
+// Transfer is an entry of the history of an account, independent of how the coin models
+// transactions.
+type Transfer struct {
+	// TxID is the identifier of the transaction, as shown in block explorers.
+	TxID string
+	Type TransferType
+	// Amount is the amount received or sent, not including the fee.
+	Amount Amount
+	// Fee is nil if the fee was not paid by the account.
+	Fee *Amount
+	// Timestamp is the time of confirmation. Nil for unconfirmed transactions or if unknown.
+	Timestamp *time.Time
+	// NumConfirmations is the number of confirmations. 0 for unconfirmed.
+	NumConfirmations int
+	// Addresses are the counterparties of the transfer, or the own addresses receiving the funds.
+	Addresses []string
+}
+
+// Account models an account of a coin, through which funds are received and sent. Coin-specific
+// features are exposed by the concrete account types.
+type Account interface {
+	// Code returns the unique identifier of the account, e.g. "btc-p2wpkh".
+	Code() string
+
+	// Name returns the name of the account shown to the user.
+	Name() string
+
+	// Coin returns the coin of the account.
+	Coin() Coin
+
+	// Init initializes the account and starts synchronizing it.
+	Init() error
+
+	// InitialSyncDone returns whether the account was synchronized at least once.
+	InitialSyncDone() bool
+
+	// Offline returns whether the blockchain backend of the account can't be reached.
+	Offline() bool
+
+	// Close stops the account.
+	Close()
+
+	// TotalBalance returns the balance of the account, including unconfirmed funds.
+	TotalBalance() Amount
+
+	// ReceiveAddress returns an address to show to the user for receiving funds.
+	ReceiveAddress() string
+
+	// History returns the transfers of the account, newest first.
+	History() []*Transfer
+
+	// Send sends the amount to the recipient address, paying the default fee.
+	Send(recipientAddress string, amount Amount) error
+}
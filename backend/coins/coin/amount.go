@@ -0,0 +1,63 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coin
+
+import (
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Amount is an amount in the smallest unit of a coin, e.g. satoshi or wei. It is backed by a
+// big.Int, as amounts of some coins do not fit into an int64.
+type Amount struct {
+	n *big.Int
+}
+
+// NewAmount creates a new amount. The value is copied.
+func NewAmount(amount *big.Int) Amount {
+	return Amount{n: new(big.Int).Set(amount)}
+}
+
+// NewAmountFromInt64 creates a new amount.
+func NewAmountFromInt64(amount int64) Amount {
+	return Amount{n: big.NewInt(amount)}
+}
+
+// BigInt returns a copy of the amount as a big.Int.
+func (amount Amount) BigInt() *big.Int {
+	if amount.n == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(amount.n)
+}
+
+// Int64 returns the amount as an int64, or an error if it does not fit.
+func (amount Amount) Int64() (int64, error) {
+	bigInt := amount.BigInt()
+	if !bigInt.IsInt64() {
+		return 0, errp.Newf("amount %s does not fit into an int64", bigInt)
+	}
+	return bigInt.Int64(), nil
+}
+
+// Add returns the sum of both amounts.
+func (amount Amount) Add(other Amount) Amount {
+	return Amount{n: new(big.Int).Add(amount.BigInt(), other.BigInt())}
+}
+
+func (amount Amount) String() string {
+	return amount.BigInt().String()
+}
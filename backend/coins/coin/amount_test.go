@@ -0,0 +1,47 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coin_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmount(t *testing.T) {
+	var zero coin.Amount
+	require.Equal(t, "0", zero.String())
+
+	amount := coin.NewAmountFromInt64(1000)
+	value, err := amount.Int64()
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), value)
+	require.Equal(t, "1500", amount.Add(coin.NewAmountFromInt64(500)).String())
+	require.Equal(t, "1000", amount.String())
+
+	// Ten ether in wei do not fit into an int64.
+	wei, ok := new(big.Int).SetString("10000000000000000000", 10)
+	require.True(t, ok)
+	bigAmount := coin.NewAmount(wei)
+	_, err = bigAmount.Int64()
+	require.Error(t, err)
+	require.Equal(t, wei, bigAmount.BigInt())
+
+	// The amount is not affected by changes to the big.Int.
+	wei.SetInt64(1)
+	require.Equal(t, "10000000000000000000", bigAmount.String())
+}
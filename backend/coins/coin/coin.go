@@ -14,6 +14,8 @@
 
 package coin
 
+import "github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+
 // FormattedAmount with unit and conversions.
 type FormattedAmount struct {
 	Amount      string            `json:"amount"`
@@ -23,34 +25,47 @@ type FormattedAmount struct {
 
 // Coin models the currency of a blockchain.
 type Coin interface {
+	observable.Interface
+
+	// Init initializes the coin, e.g. the connection to the blockchain backend. Must be called
+	// before the coin is used by accounts.
+	Init()
+
 	// Code returns the acronym of the currency in lowercase.
-	// Code() string
+	Code() string
 
 	// Name returns the written-out name of the coin.
 	Name() string
 
-	// // Type returns the coin type according to BIP44:
-	// // https://github.com/satoshilabs/slips/blob/master/slip-0044.md
-	// Type() uint32
+	// Type returns the coin type according to BIP44:
+	// https://github.com/satoshilabs/slips/blob/master/slip-0044.md
+	Type() uint32
 
 	// Unit is the unit code of the string for formatting amounts.
 	Unit() string
 
 	// FormatAmount formats the given amount as a number followed by the currency code in a suitable
 	// denomination.
-	FormatAmount(int64) string
+	FormatAmount(Amount) string
 
 	// FormatAmountAsJSON formats the given amount as a JSON object with the number as a string and
 	// the currency code in a suitable denomination.
-	FormatAmountAsJSON(int64) FormattedAmount
+	FormatAmountAsJSON(Amount) FormattedAmount
+
+	// ToUnit converts the given amount to the denomination of Unit().
+	ToUnit(Amount) float64
+
+	// ValidateAddress returns an error if the address is not a valid address of the coin's network.
+	ValidateAddress(address string) error
 
-	// // Server returns the host and port of the full node used for blockchain synchronization.
-	// Server() string
+	// ExchangeRate returns the current exchange rate of one coin in the given fiat currency. The
+	// second return value is false if the rate is not available.
+	ExchangeRate(fiat string) (float64, bool)
 
-	// // Returns whether the coin is account-based (instead of UTXO).
-	// // Account-based transactions can have only one output and need no change address.
-	// AccountBased() bool
+	// AccountBased returns whether the coin is account-based (instead of UTXO).
+	// Account-based transactions can have only one output and need no change address.
+	AccountBased() bool
 
-	// // BlockExplorerTransactionURLPrefix returns the URL prefix of the block explorer.
-	// BlockExplorerTransactionURLPrefix() string
+	// BlockExplorerTransactionURLPrefix returns the URL prefix of the block explorer.
+	BlockExplorerTransactionURLPrefix() string
 }
@@ -15,6 +15,9 @@
 package coin
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
 )
 
@@ -23,3 +26,15 @@ type RatesUpdater interface {
 	observable.Interface
 	Last() map[string]map[string]float64
 }
+
+// FormatAsCurrency formats a fiat amount with two decimals and apostrophes as thousands
+// separators, e.g. "1'234.56".
+func FormatAsCurrency(amount float64) string {
+	formatted := strconv.FormatFloat(amount, 'f', 2, 64)
+	position := strings.Index(formatted, ".") - 3
+	for position > 0 {
+		formatted = formatted[:position] + "'" + formatted[position:]
+		position = position - 3
+	}
+	return formatted
+}
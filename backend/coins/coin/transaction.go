@@ -14,10 +14,30 @@
 
 package coin
 
-import "time"
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+)
+
+// SignatureHash is a hash to be signed with the key at the keypath.
+type SignatureHash struct {
+	Hash    []byte
+	Keypath signing.AbsoluteKeypath
+}
 
 // ProposedTransaction models a proposed but not yet fully signed transaction of the given coin.
+// Keystores sign it through this interface without knowing the coin.
 type ProposedTransaction interface {
+	// SignatureHashes returns the hashes to be signed by each cosigner.
+	SignatureHashes() ([]*SignatureHash, error)
+
+	// SetSignatures sets the signatures of the cosigner with the given index, one for each hash
+	// returned by SignatureHashes(), in the same order.
+	SetSignatures(cosignerIndex int, signatures []*btcec.Signature) error
+
 	// Coin() Coin
 	// Fee() uint64
 	// Inputs() []Input // Needed or rather make "private" (within implementation)?
@@ -0,0 +1,42 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doge
+
+import "github.com/btcsuite/btcd/wire"
+
+const (
+	// auxPowVersionBit is set in the version of merge mined block headers.
+	auxPowVersionBit = 1 << 8
+
+	// AuxPowChainID is the chain id which merge mined Dogecoin block headers encode in the upper
+	// half of their version.
+	AuxPowChainID = 0x62
+
+	// MainNetAuxPowHeight is the height of the first merge mined block of the main network.
+	MainNetAuxPowHeight = 371337
+)
+
+// IsAuxPow returns true if the header belongs to a merge mined block. The proof of work of such a
+// block is done on the header of a parent block of another chain, which commits to the hash of
+// this header. Electrum servers only serve the 80 byte header without the parent block, so the
+// proof of work of merge mined headers can't be verified.
+func IsAuxPow(header *wire.BlockHeader) bool {
+	return header.Version&auxPowVersionBit != 0
+}
+
+// ChainID returns the chain id encoded in the version of the header.
+func ChainID(header *wire.BlockHeader) int32 {
+	return header.Version >> 16
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package doge
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// These variables are the chain proof-of-work limit parameters for each default
+// network.
+var (
+	// mainPowLimit is the highest proof of work value a Dogecoin block can
+	// have for the main network.
+	mainPowLimit, _ = new(big.Int).SetString("0x0fffff000000000000000000000000000000000000000000000000000000", 0)
+
+	// testNet3PowLimit is the highest proof of work value a Dogecoin block
+	// can have for the test network.
+	testNet3PowLimit, _ = new(big.Int).SetString("0x0fffff000000000000000000000000000000000000000000000000000000", 0)
+)
+
+// MainNetDigishieldHeight is the height from which the difficulty of the main network is
+// retargeted with every block, using the DigiShield algorithm.
+const MainNetDigishieldHeight = 145000
+
+// MainNetParams defines the network parameters for the main Dogecoin network.
+var MainNetParams = chaincfg.Params{
+	Name:        "mainnet",
+	Net:         MainNet,
+	DefaultPort: "22556",
+	DNSSeeds: []chaincfg.DNSSeed{
+		{Host: "seed.multidoge.org", HasFiltering: true},
+		{Host: "seed2.multidoge.org", HasFiltering: false},
+	},
+
+	// Chain parameters
+	GenesisBlock:             &genesisBlock,
+	GenesisHash:              &genesisHash,
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             0x1e0fffff,
+	BIP0034Height:            1034383,
+	BIP0065Height:            3464751,
+	BIP0066Height:            1034383,
+	CoinbaseMaturity:         240,
+	SubsidyReductionInterval: 100000,
+	// The checkpoints are past MainNetDigishieldHeight, so the difficulty is retargeted with every
+	// block.
+	TargetTimespan:           time.Minute, // 1 minute
+	TargetTimePerBlock:       time.Minute, // 1 minute
+	RetargetAdjustmentFactor: 4,           // unused, DigiShield limits the adjustment itself
+	ReduceMinDifficulty:      false,
+	MinDiffReductionTime:     0,
+	GenerateSupported:        false,
+
+	// Checkpoints ordered from oldest to newest.
+	Checkpoints: []chaincfg.Checkpoint{
+		{Height: 104679, Hash: newHashFromStr("35eb87ae90d44b98898fec8c39577b76cb1eb08e1261cfc10706c8ce9a1d01cf")},
+		{Height: 145000, Hash: newHashFromStr("cc47cae70d7c5c92828d3214a266331dde59087d4a39071fa76ddfff9b7bde72")},
+		// First merge mined block.
+		{Height: 371337, Hash: newHashFromStr("60323982f9c5ff1b5a954eac9dc1269352835f47c2c5222691d80f0d50dcf053")},
+	},
+
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   target proof of work timespan / target proof of work spacing
+	RuleChangeActivationThreshold: 9576, // 95% of MinerConfirmationWindow
+	MinerConfirmationWindow:       10080,
+	Deployments: [chaincfg.DefinedDeployments]chaincfg.ConsensusDeployment{
+		chaincfg.DeploymentTestDummy: {
+			BitNumber:  28,
+			StartTime:  1199145601, // January 1, 2008 UTC
+			ExpireTime: 1230767999, // December 31, 2008 UTC
+		},
+	},
+
+	// Mempool parameters
+	RelayNonStdTxs: false,
+
+	// Address encoding magics
+	PubKeyHashAddrID: 0x1e, // starts with D
+	ScriptHashAddrID: 0x16, // starts with 9 or A
+	PrivateKeyID:     0x9e, // starts with 6 (uncompressed) or Q (compressed)
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x02, 0xfa, 0xc3, 0x98}, // starts with dgpv
+	HDPublicKeyID:  [4]byte{0x02, 0xfa, 0xca, 0xfd}, // starts with dgub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	HDCoinType: 3,
+}
+
+// TestNet3Params defines the network parameters for the Dogecoin test network.
+var TestNet3Params = chaincfg.Params{
+	Name:        "testnet3",
+	Net:         TestNet3,
+	DefaultPort: "44556",
+	DNSSeeds: []chaincfg.DNSSeed{
+		{Host: "testseed.jrn.me.uk", HasFiltering: false},
+	},
+
+	// Chain parameters
+	GenesisBlock:             &testNet3GenesisBlock,
+	GenesisHash:              &testNet3GenesisHash,
+	PowLimit:                 testNet3PowLimit,
+	PowLimitBits:             0x1e0fffff,
+	BIP0034Height:            708658,
+	BIP0065Height:            1854705,
+	BIP0066Height:            708658,
+	CoinbaseMaturity:         240,
+	SubsidyReductionInterval: 100000,
+	TargetTimespan:           time.Minute, // 1 minute
+	TargetTimePerBlock:       time.Minute, // 1 minute
+	RetargetAdjustmentFactor: 4,           // unused, DigiShield limits the adjustment itself
+	ReduceMinDifficulty:      true,
+	MinDiffReductionTime:     time.Minute * 2, // TargetTimePerBlock * 2
+	GenerateSupported:        false,
+
+	// No checkpoints, the headers are synced from the genesis block.
+	Checkpoints: nil,
+
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   target proof of work timespan / target proof of work spacing
+	RuleChangeActivationThreshold: 2160, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2880,
+	Deployments: [chaincfg.DefinedDeployments]chaincfg.ConsensusDeployment{
+		chaincfg.DeploymentTestDummy: {
+			BitNumber:  28,
+			StartTime:  1199145601, // January 1, 2008 UTC
+			ExpireTime: 1230767999, // December 31, 2008 UTC
+		},
+	},
+
+	// Mempool parameters
+	RelayNonStdTxs: true,
+
+	// Address encoding magics
+	PubKeyHashAddrID: 0x71, // starts with n
+	ScriptHashAddrID: 0xc4, // starts with 2
+	PrivateKeyID:     0xf1,
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // starts with tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // starts with tpub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	HDCoinType: 1,
+}
+
+// IsNet returns true if the network parameters are the ones of a Dogecoin network.
+func IsNet(net *chaincfg.Params) bool {
+	return net.Net == MainNet || net.Net == TestNet3
+}
+
+// newHashFromStr converts the passed big-endian hex string into a
+// chainhash.Hash.  It only differs from the one available in chainhash in that
+// it panics on an error since it will only (and must only) be called with
+// hard-coded, and therefore known good, hashes.
+func newHashFromStr(hexStr string) *chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(hexStr)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// mustRegister performs the same function as Register except it panics if there
+// is an error.  This should only be called from package init functions.
+func mustRegister(params *chaincfg.Params) {
+	if err := chaincfg.Register(params); err != nil {
+		panic("failed to register network: " + err.Error())
+	}
+}
+
+func init() {
+	// Register all default networks when the package is initialized.
+	mustRegister(&MainNetParams)
+	mustRegister(&TestNet3Params)
+}
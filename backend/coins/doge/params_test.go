@@ -0,0 +1,66 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doge_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/doge"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestGenesisBlocks(t *testing.T) {
+	for _, net := range []*chaincfg.Params{&doge.MainNetParams, &doge.TestNet3Params} {
+		block := net.GenesisBlock
+		require.Equal(t, *net.GenesisHash, block.BlockHash(), net.Name)
+		require.Equal(t, block.Header.MerkleRoot, block.Transactions[0].TxHash(), net.Name)
+
+		// The genesis blocks are mined with scrypt.
+		header := &bytes.Buffer{}
+		require.NoError(t, block.Header.Serialize(header))
+		powHash, err := scrypt.Key(header.Bytes(), header.Bytes(), 1024, 1, 1, 32)
+		require.NoError(t, err)
+		hash, err := chainhash.NewHash(powHash)
+		require.NoError(t, err)
+		target := blockchain.CompactToBig(block.Header.Bits)
+		require.True(t, blockchain.HashToBig(hash).Cmp(target) <= 0, net.Name)
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	address, err := btcutil.DecodeAddress(
+		"DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L", &doge.MainNetParams)
+	require.NoError(t, err)
+	require.IsType(t, &btcutil.AddressPubKeyHash{}, address)
+	require.True(t, address.IsForNet(&doge.MainNetParams))
+	require.False(t, address.IsForNet(&doge.TestNet3Params))
+}
+
+func TestAuxPow(t *testing.T) {
+	header := wire.NewBlockHeader(0x00620104, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0)
+	require.True(t, doge.IsAuxPow(header))
+	require.Equal(t, int32(doge.AuxPowChainID), doge.ChainID(header))
+
+	header.Version = 2
+	require.False(t, doge.IsAuxPow(header))
+	require.Equal(t, int32(0), doge.ChainID(header))
+}
@@ -0,0 +1,545 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+)
+
+const (
+	// pollInterval is the time between two updates of the account. Blocks are mined about every
+	// 12 seconds.
+	pollInterval = 15 * time.Second
+
+	// initialScanBlocks is the number of recent blocks scanned for txs when a used account is
+	// synced for the first time. Older txs are not found, as nodes do not index txs by address, and
+	// the history is marked as incomplete.
+	initialScanBlocks = 1000
+
+	// maxBlocksPerUpdate limits the number of blocks scanned in one update. The remaining blocks
+	// are scanned in the following updates.
+	maxBlocksPerUpdate = 100
+)
+
+// Account is an Ethereum account. Like most Ethereum wallets, it uses the single address at index
+// 0 of the keypath of the account, e.g. m/44'/60'/0'/0/0.
+type Account struct {
+	locker.Locker
+
+	coin                    *Coin
+	dbFolder                string
+	code                    string
+	name                    string
+	getSigningConfiguration func() (*signing.Configuration, error)
+	signingConfiguration    *signing.Configuration
+	keystores               keystore.Keystores
+
+	address         Address
+	historyFilename string
+	history         *history
+
+	// blockNumber is the latest block number, 0 until synced.
+	blockNumber uint64
+	// balance is nil until synced.
+	balance       *big.Int
+	nonce         uint64
+	tokenBalances []*TokenBalance
+	feeTargets    []*FeeTarget
+
+	// updateLock serializes the updates of the account.
+	updateLock locker.Locker
+	// updateNow triggers an update before the poll interval elapsed.
+	updateNow chan struct{}
+	quit      chan struct{}
+
+	initialSyncDone bool
+	offline         bool
+	onEvent         func(Event)
+	log             *logrus.Entry
+}
+
+// NewAccount creates a new account. getSigningConfiguration returns the configuration of the
+// account keypath, e.g. m/44'/60'/0'/0. Only singlesig configurations are supported.
+func NewAccount(
+	coin *Coin,
+	dbFolder string,
+	code string,
+	name string,
+	getSigningConfiguration func() (*signing.Configuration, error),
+	keystores keystore.Keystores,
+	onEvent func(Event),
+	log *logrus.Entry,
+) *Account {
+	log = log.WithField("group", "eth").
+		WithFields(logrus.Fields{"coin": coin.String(), "code": code, "name": name})
+	log.Debug("Creating new account")
+	return &Account{
+		coin:                    coin,
+		dbFolder:                dbFolder,
+		code:                    code,
+		name:                    name,
+		getSigningConfiguration: getSigningConfiguration,
+		keystores:               keystores,
+		updateNow:               make(chan struct{}, 1),
+		onEvent:                 onEvent,
+		log:                     log,
+	}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (account *Account) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		CoinCode              string `json:"coinCode"`
+		Code                  string `json:"code"`
+		Name                  string `json:"name"`
+		BlockExplorerTxPrefix string `json:"blockExplorerTxPrefix"`
+	}{
+		CoinCode:              account.coin.Code(),
+		Code:                  account.code,
+		Name:                  account.name,
+		BlockExplorerTxPrefix: account.coin.blockExplorerTxPrefix,
+	})
+}
+
+// String returns a representation of the account for logging.
+func (account *Account) String() string {
+	return fmt.Sprintf("%s-%s", account.coin.String(), account.code)
+}
+
+// Code implements coin.Account.
+func (account *Account) Code() string {
+	return account.code
+}
+
+// Name implements coin.Account.
+func (account *Account) Name() string {
+	return account.name
+}
+
+// Coin implements coin.Account.
+func (account *Account) Coin() coin.Coin {
+	return account.coin
+}
+
+// Keystores returns the keystores of the account.
+func (account *Account) Keystores() keystore.Keystores {
+	return account.keystores
+}
+
+// Init implements coin.Account. It derives the address and starts polling the node.
+func (account *Account) Init() error {
+	defer account.Lock()()
+	if account.signingConfiguration != nil {
+		account.log.Debug("Account has already been initialized")
+		return nil
+	}
+	signingConfiguration, err := account.getSigningConfiguration()
+	if err != nil {
+		return err
+	}
+	if !signingConfiguration.Singlesig() {
+		return errp.New("Ethereum accounts do not support multisig")
+	}
+	relativeKeypath, err := signing.NewRelativeKeypath("0")
+	if err != nil {
+		return err
+	}
+	addressConfiguration, err := signingConfiguration.Derive(relativeKeypath)
+	if err != nil {
+		return err
+	}
+	account.address = PubkeyToAddress(addressConfiguration.PublicKeys()[0])
+	account.historyFilename = path.Join(account.dbFolder,
+		fmt.Sprintf("account-%s-%s.json", signingConfiguration.Hash(), account.code))
+	account.history, err = loadHistory(account.historyFilename)
+	if err != nil {
+		return err
+	}
+	account.signingConfiguration = signingConfiguration
+	account.quit = make(chan struct{})
+	go account.poll(account.quit)
+	return nil
+}
+
+func (account *Account) poll(quit <-chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		account.update()
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		case <-account.updateNow:
+		}
+	}
+}
+
+// triggerUpdate makes the account update without waiting for the poll interval.
+func (account *Account) triggerUpdate() {
+	select {
+	case account.updateNow <- struct{}{}:
+	default:
+	}
+}
+
+// update fetches the state of the account from the node. The account is offline if the node can't
+// be reached.
+func (account *Account) update() {
+	defer account.updateLock.Lock()()
+	err := account.sync()
+	if err != nil {
+		account.log.WithError(err).Error("Could not update the account")
+	}
+	statusChanged := func() bool {
+		defer account.Lock()()
+		offline := err != nil
+		changed := offline != account.offline
+		account.offline = offline
+		if !offline && !account.initialSyncDone {
+			account.initialSyncDone = true
+			changed = true
+		}
+		return changed
+	}()
+	if statusChanged {
+		account.onEvent(EventStatusChanged)
+	}
+	if err == nil {
+		account.onEvent(EventFeeTargetsChanged)
+		account.onEvent(EventSyncDone)
+	}
+}
+
+// sync fetches the balances, the nonce and the fee targets and updates the history. Requires the
+// update lock.
+func (account *Account) sync() error {
+	client := account.coin.Client()
+	address := account.address.Hex()
+	blockNumber, err := client.BlockNumber()
+	if err != nil {
+		return err
+	}
+	balance, err := client.Balance(address)
+	if err != nil {
+		return err
+	}
+	nonce, err := client.PendingNonce(address)
+	if err != nil {
+		return err
+	}
+	feeTargets, err := estimateFeeTargets(client)
+	if err != nil {
+		return err
+	}
+	tokenBalances := []*TokenBalance{}
+	for _, token := range account.coin.Tokens() {
+		balance, err := tokenBalance(client, token, account.address)
+		if err != nil {
+			account.log.WithError(err).WithField("token", token.Code).
+				Warning("Could not fetch the token balance")
+			continue
+		}
+		tokenBalances = append(tokenBalances, &TokenBalance{Token: token, Balance: balance})
+	}
+	// An account without balance and nonce has no txs, so its history is complete without
+	// scanning past blocks.
+	used := balance.Sign() > 0 || nonce > 0
+	if err := account.updateHistory(client, blockNumber, used); err != nil {
+		return err
+	}
+
+	defer account.Lock()()
+	account.blockNumber = blockNumber
+	account.balance = balance
+	account.nonce = nonce
+	account.feeTargets = feeTargets
+	account.tokenBalances = tokenBalances
+	return nil
+}
+
+// updateHistory scans the new blocks for txs of the account and checks whether pending txs were
+// mined. used is whether the account has ever sent or received ether, as of the latest block.
+// Requires the update lock.
+func (account *Account) updateHistory(
+	client rpcclient.Interface, blockNumber uint64, used bool) error {
+	history := account.history
+	from := history.LastScannedBlock + 1
+	if history.LastScannedBlock == 0 {
+		switch {
+		case !used:
+			from = blockNumber
+		case blockNumber > initialScanBlocks:
+			from = blockNumber - initialScanBlocks
+			func() {
+				defer account.Lock()()
+				history.Incomplete = true
+			}()
+		}
+	}
+	to := blockNumber
+	if to >= from+maxBlocksPerUpdate {
+		to = from + maxBlocksPerUpdate - 1
+	}
+	for number := from; number <= to; number++ {
+		block, err := client.BlockByNumber(number)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			// The node is not synced up to the block yet.
+			break
+		}
+		for _, blockTx := range block.Transactions {
+			tx, err := account.txFromBlock(client, block, blockTx)
+			if err != nil {
+				return err
+			}
+			if tx != nil {
+				account.log.WithField("hash", tx.Hash).Debug("Found transaction")
+				account.addTx(tx)
+			}
+		}
+		history.LastScannedBlock = number
+	}
+	for _, tx := range account.pendingTxs() {
+		receipt, err := client.TransactionReceipt(tx.Hash)
+		if err != nil {
+			return err
+		}
+		if receipt == nil {
+			continue
+		}
+		block, err := client.BlockByNumber(receipt.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			continue
+		}
+		mined := *tx
+		mined.BlockNumber = receipt.BlockNumber
+		mined.Timestamp = &block.Timestamp
+		mined.Failed = !receipt.Success
+		if receipt.EffectiveGasPrice != nil {
+			mined.Fee = new(big.Int).Mul(
+				receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+		}
+		account.addTx(&mined)
+	}
+	return account.saveHistory()
+}
+
+func (account *Account) saveHistory() error {
+	defer account.RLock()()
+	return account.history.save(account.historyFilename)
+}
+
+// txFromBlock returns the tx if it is sent from or to the account, and nil otherwise.
+func (account *Account) txFromBlock(
+	client rpcclient.Interface,
+	block *rpcclient.Block,
+	blockTx *rpcclient.Transaction,
+) (*Tx, error) {
+	own := strings.ToLower(account.address.Hex())
+	if strings.ToLower(blockTx.From) != own && strings.ToLower(blockTx.To) != own {
+		return nil, nil
+	}
+	if blockTx.To == "" {
+		// Contract creations are not shown.
+		return nil, nil
+	}
+	from, err := ParseAddress(strings.ToLower(blockTx.From))
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseAddress(strings.ToLower(blockTx.To))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := block.Timestamp
+	tx := &Tx{
+		Hash:        blockTx.Hash,
+		From:        from,
+		To:          to,
+		Value:       blockTx.Value,
+		BlockNumber: block.Number,
+		Timestamp:   &timestamp,
+	}
+	if from == account.address {
+		receipt, err := client.TransactionReceipt(blockTx.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if receipt != nil {
+			tx.Failed = !receipt.Success
+			if receipt.EffectiveGasPrice != nil {
+				tx.Fee = new(big.Int).Mul(
+					receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+			}
+		}
+	}
+	return tx, nil
+}
+
+func (account *Account) pendingTxs() []*Tx {
+	defer account.RLock()()
+	return account.history.pending()
+}
+
+func (account *Account) addTx(tx *Tx) {
+	defer account.Lock()()
+	account.history.add(tx)
+}
+
+// Offline implements coin.Account.
+func (account *Account) Offline() bool {
+	defer account.RLock()()
+	return account.offline
+}
+
+// InitialSyncDone implements coin.Account.
+func (account *Account) InitialSyncDone() bool {
+	defer account.RLock()()
+	return account.initialSyncDone
+}
+
+// Close implements coin.Account.
+func (account *Account) Close() {
+	func() {
+		defer account.Lock()()
+		if account.quit != nil {
+			close(account.quit)
+			account.quit = nil
+		}
+		account.initialSyncDone = false
+	}()
+	account.log.Info("Closed account")
+	account.onEvent(EventStatusChanged)
+}
+
+// Address returns the address of the account.
+func (account *Account) Address() Address {
+	return account.address
+}
+
+// ReceiveAddress implements coin.Account.
+func (account *Account) ReceiveAddress() string {
+	return account.address.Hex()
+}
+
+// TotalBalance implements coin.Account. The balance includes pending outgoing txs.
+func (account *Account) TotalBalance() coin.Amount {
+	defer account.RLock()()
+	if account.balance == nil {
+		return coin.NewAmountFromInt64(0)
+	}
+	return coin.NewAmount(account.balance)
+}
+
+// TokenBalances returns the balances of the ERC-20 tokens of the coin.
+func (account *Account) TokenBalances() []*TokenBalance {
+	defer account.RLock()()
+	return account.tokenBalances
+}
+
+// FeeTargets returns the fee targets, sorted by ascending priority. Empty until synced.
+func (account *Account) FeeTargets() []*FeeTarget {
+	defer account.RLock()()
+	return account.feeTargets
+}
+
+// HistoryIncomplete returns whether txs older than the first scanned block may be missing from
+// the history.
+func (account *Account) HistoryIncomplete() bool {
+	defer account.RLock()()
+	return account.history != nil && account.history.Incomplete
+}
+
+// Transactions returns the txs of the account, newest first.
+func (account *Account) Transactions() []*Tx {
+	defer account.RLock()()
+	if account.history == nil {
+		return []*Tx{}
+	}
+	return account.history.sorted()
+}
+
+// NumConfirmations returns the number of confirmations of the tx, 0 if it is pending.
+func (account *Account) NumConfirmations(tx *Tx) int {
+	defer account.RLock()()
+	if tx.BlockNumber == 0 || tx.BlockNumber > account.blockNumber {
+		return 0
+	}
+	return int(account.blockNumber-tx.BlockNumber) + 1
+}
+
+// Transfer converts the tx to a transfer as seen from the account.
+func (account *Account) Transfer(tx *Tx) *coin.Transfer {
+	transfer := &coin.Transfer{
+		TxID:             tx.Hash,
+		Amount:           coin.NewAmount(tx.Value),
+		Timestamp:        tx.Timestamp,
+		NumConfirmations: account.NumConfirmations(tx),
+	}
+	switch {
+	case tx.From == account.address && tx.To == account.address:
+		transfer.Type = coin.TransferTypeSendSelf
+		transfer.Addresses = []string{tx.To.Hex()}
+	case tx.From == account.address:
+		transfer.Type = coin.TransferTypeSend
+		transfer.Addresses = []string{tx.To.Hex()}
+	default:
+		transfer.Type = coin.TransferTypeReceive
+		transfer.Addresses = []string{account.address.Hex()}
+	}
+	if tx.Fee != nil && transfer.Type != coin.TransferTypeReceive {
+		fee := coin.NewAmount(tx.Fee)
+		transfer.Fee = &fee
+	}
+	return transfer
+}
+
+// History implements coin.Account.
+func (account *Account) History() []*coin.Transfer {
+	transfers := []*coin.Transfer{}
+	for _, tx := range account.Transactions() {
+		transfers = append(transfers, account.Transfer(tx))
+	}
+	return transfers
+}
+
+// Send implements coin.Account.
+func (account *Account) Send(recipientAddress string, amount coin.Amount) error {
+	sendAmount, err := NewSendAmount(amount)
+	if err != nil {
+		return err
+	}
+	return account.SendTx(recipientAddress, sendAmount, defaultFeeTarget)
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/devnode"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+)
+
+const gwei = 1000000000
+
+var ether = big.NewInt(1000000000000000000)
+
+func newAccount(t *testing.T, theCoin *eth.Coin, pin string) *eth.Account {
+	keystores := keystore.NewKeystores(software.NewKeystoreFromPIN(0, pin))
+	keypath, err := signing.NewAbsoluteKeypath("m/44'/1'/0'/0")
+	require.NoError(t, err)
+	account := eth.NewAccount(
+		theCoin,
+		test.TstTempDir("eth-account"),
+		"reth",
+		"Ethereum Dev",
+		func() (*signing.Configuration, error) {
+			return keystores.Configuration(signing.ScriptTypeP2PKH, keypath, 1)
+		},
+		keystores,
+		func(eth.Event) {},
+		logging.Get().WithGroup("eth_test"),
+	)
+	require.NoError(t, account.Init())
+	return account
+}
+
+func TestAccount(t *testing.T) {
+	node := devnode.NewNode(eth.ChainIDDev, big.NewInt(10*gwei))
+	contract, err := eth.ParseAddress("0x3535353535353535353535353535353535353535")
+	require.NoError(t, err)
+	token := &eth.Token{
+		Code:     "reth-erc20-test",
+		Name:     "Test Token",
+		Unit:     "TEST",
+		Contract: contract,
+		Decimals: 6,
+	}
+	theCoin := eth.NewCoin("reth", "Ethereum Dev", "RETH", eth.ChainIDDev, node, "",
+		[]*eth.Token{token}, nil)
+	sender := newAccount(t, theCoin, "1234")
+	recipient := newAccount(t, theCoin, "5678")
+	defer sender.Close()
+	defer recipient.Close()
+	require.NotEqual(t, sender.Address(), recipient.Address())
+	require.Equal(t, sender.Address().Hex(), sender.ReceiveAddress())
+
+	node.Fund(sender.Address(), ether)
+	node.SetTokenBalance(token.Contract, sender.Address(), big.NewInt(1500000))
+	sender.Update()
+	require.True(t, sender.InitialSyncDone())
+	require.False(t, sender.Offline())
+	require.Equal(t, coin.NewAmount(ether), sender.TotalBalance())
+	require.Len(t, sender.TokenBalances(), 1)
+	require.Equal(t, "1.5", sender.TokenBalances()[0].Format())
+
+	// The priority fees of the stand-in node are 1, 2 and 3 gwei.
+	feeTargets := sender.FeeTargets()
+	require.Len(t, feeTargets, 3)
+	require.Equal(t, eth.FeeTargetCodeNormal, feeTargets[1].Code)
+	require.Equal(t, big.NewInt(2*gwei), feeTargets[1].GasTipCap)
+	require.Equal(t, big.NewInt(22*gwei), feeTargets[1].GasFeeCap)
+
+	_, err = sender.TxProposal("0x1234", eth.NewSendAmountAll(), eth.FeeTargetCodeNormal)
+	require.Equal(t, eth.TxValidationError("invalid address"), errp.Cause(err))
+	tooMuch, err := eth.NewSendAmount(coin.NewAmount(ether))
+	require.NoError(t, err)
+	_, err = sender.TxProposal(
+		recipient.ReceiveAddress(), tooMuch, eth.FeeTargetCodeNormal)
+	require.Equal(t, eth.ErrInsufficientFunds, errp.Cause(err))
+
+	value := new(big.Int).Div(ether, big.NewInt(10))
+	amount, err := eth.NewSendAmount(coin.NewAmount(value))
+	require.NoError(t, err)
+	txProposal, err := sender.TxProposal(
+		recipient.ReceiveAddress(), amount, eth.FeeTargetCodeNormal)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(21000*22*gwei), txProposal.Fee)
+
+	// Contracts need more gas than a transfer.
+	contractRecipient, err := eth.ParseAddress("0x4242424242424242424242424242424242424242")
+	require.NoError(t, err)
+	node.SetContractGas(contractRecipient, 50000)
+	contractTxProposal, err := sender.TxProposal(
+		contractRecipient.Hex(), amount, eth.FeeTargetCodeNormal)
+	require.NoError(t, err)
+	require.Equal(t, uint64(50000), contractTxProposal.Tx.Gas)
+	require.Equal(t, big.NewInt(50000*22*gwei), contractTxProposal.Fee)
+
+	require.NoError(t, sender.SendTx(recipient.ReceiveAddress(), amount, eth.FeeTargetCodeNormal))
+	require.Len(t, node.Pending(), 1)
+	require.True(t, node.Pending()[0].Dynamic())
+
+	history := sender.History()
+	require.Len(t, history, 1)
+	require.Equal(t, coin.TransferTypeSend, history[0].Type)
+	require.Equal(t, 0, history[0].NumConfirmations)
+	require.Nil(t, history[0].Timestamp)
+
+	node.Mine()
+	sender.Update()
+	recipient.Update()
+
+	// The effective gas price is the base fee plus the priority fee.
+	fee := big.NewInt(21000 * 12 * gwei)
+	history = sender.History()
+	require.Len(t, history, 1)
+	require.Equal(t, 1, history[0].NumConfirmations)
+	require.NotNil(t, history[0].Timestamp)
+	require.Equal(t, coin.NewAmount(fee), *history[0].Fee)
+	require.Equal(t, coin.NewAmount(value), history[0].Amount)
+	require.Equal(t,
+		coin.NewAmount(new(big.Int).Sub(new(big.Int).Sub(ether, value), fee)),
+		sender.TotalBalance())
+
+	received := recipient.History()
+	require.Len(t, received, 1)
+	require.Equal(t, coin.TransferTypeReceive, received[0].Type)
+	require.Equal(t, history[0].TxID, received[0].TxID)
+	require.Nil(t, received[0].Fee)
+	require.Equal(t, coin.NewAmount(value), recipient.TotalBalance())
+
+	// All funds can be sent back, leaving nothing but the unspent part of the max fee.
+	require.NoError(t, recipient.SendTx(
+		sender.ReceiveAddress(), eth.NewSendAmountAll(), eth.FeeTargetCodeLow))
+	node.Mine()
+	recipient.Update()
+	require.Len(t, recipient.History(), 2)
+	require.Equal(t, coin.TransferTypeSend, recipient.History()[0].Type)
+	require.Equal(t,
+		coin.NewAmount(big.NewInt(21000*(21-11)*gwei)), recipient.TotalBalance())
+}
+
+func TestAccountHistoryIncomplete(t *testing.T) {
+	newCoin := func(node *devnode.Node) *eth.Coin {
+		return eth.NewCoin("reth", "Ethereum Dev", "RETH", eth.ChainIDDev, node, "", nil, nil)
+	}
+	// The address is derived without syncing, so that the account is funded before its first sync.
+	other := newAccount(t, newCoin(devnode.NewNode(eth.ChainIDDev, big.NewInt(gwei))), "1234")
+	other.Close()
+
+	node := devnode.NewNode(eth.ChainIDDev, big.NewInt(gwei))
+	for i := 0; i < 1500; i++ {
+		node.Mine()
+	}
+	node.Fund(other.Address(), ether)
+	theCoin := newCoin(node)
+	used := newAccount(t, theCoin, "1234")
+	unused := newAccount(t, theCoin, "5678")
+	defer used.Close()
+	defer unused.Close()
+	used.Update()
+	unused.Update()
+	require.True(t, used.HistoryIncomplete())
+	require.False(t, unused.HistoryIncomplete())
+}
+
+func TestCoinFormatting(t *testing.T) {
+	theCoin := eth.NewCoin("eth", "Ethereum", "ETH", eth.ChainIDMainnet,
+		devnode.NewNode(eth.ChainIDMainnet, big.NewInt(gwei)), "", eth.MainnetTokens, nil)
+	require.Equal(t, uint32(60), theCoin.Type())
+	require.True(t, theCoin.AccountBased())
+	amount, err := theCoin.ParseAmount("1.25")
+	require.NoError(t, err)
+	require.Equal(t, "1.25 ETH", theCoin.FormatAmount(amount))
+	require.Equal(t, 1.25, theCoin.ToUnit(amount))
+	require.Equal(t, "0.000000000000000001", theCoin.FormatAmountAsJSON(
+		coin.NewAmountFromInt64(1)).Amount)
+	require.Equal(t, "0", theCoin.FormatAmountAsJSON(coin.NewAmountFromInt64(0)).Amount)
+	_, err = theCoin.ParseAmount("0.0000000000000000001")
+	require.Error(t, err)
+	_, err = theCoin.ParseAmount("-1")
+	require.Error(t, err)
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// keccak256 returns the Keccak-256 hash (not SHA3-256) of the concatenated data.
+func keccak256(data ...[]byte) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	for _, chunk := range data {
+		_, _ = hasher.Write(chunk)
+	}
+	return hasher.Sum(nil)
+}
+
+// Address is an Ethereum account address.
+type Address [20]byte
+
+// PubkeyToAddress returns the address controlled by the public key.
+func PubkeyToAddress(publicKey *btcec.PublicKey) Address {
+	var address Address
+	// The uncompressed encoding without the 0x04 prefix is hashed.
+	copy(address[:], keccak256(publicKey.SerializeUncompressed()[1:])[12:])
+	return address
+}
+
+// ParseAddress parses a hex encoded address, with or without 0x prefix. If the address contains
+// upper case letters, the EIP-55 checksum is verified.
+func ParseAddress(encoded string) (Address, error) {
+	var address Address
+	stripped := strings.TrimPrefix(strings.TrimPrefix(encoded, "0x"), "0X")
+	if len(stripped) != 2*len(address) {
+		return address, errp.Newf("invalid address length: %s", encoded)
+	}
+	decoded, err := hex.DecodeString(stripped)
+	if err != nil {
+		return address, errp.Newf("invalid address: %s", encoded)
+	}
+	copy(address[:], decoded)
+	if stripped != strings.ToLower(stripped) && address.Hex() != "0x"+stripped {
+		return address, errp.Newf("invalid address checksum: %s", encoded)
+	}
+	return address, nil
+}
+
+// Hex returns the address with 0x prefix and EIP-55 checksum:
+// https://github.com/ethereum/EIPs/blob/master/EIPS/eip-55.md
+func (address Address) Hex() string {
+	lower := hex.EncodeToString(address[:])
+	hash := keccak256([]byte(lower))
+	result := []byte(lower)
+	for i, char := range result {
+		nibble := hash[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if char >= 'a' && nibble&0xf >= 8 {
+			result[i] = char - 'a' + 'A'
+		}
+	}
+	return "0x" + string(result)
+}
+
+func (address Address) String() string {
+	return address.Hex()
+}
+
+// SignHash signs the hash with the private key, returning the signature as R || S || V with the
+// recovery id V in {0, 1}, as expected by Transaction.SetSignature().
+func SignHash(privateKey *btcec.PrivateKey, hash []byte) ([]byte, error) {
+	compact, err := btcec.SignCompact(btcec.S256(), privateKey, hash, false)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	// The compact signature is V || R || S with V = 27 + recovery id.
+	return append(compact[1:], compact[0]-27), nil
+}
+
+// MarshalJSON implements json.Marshaler. The address is encoded as a hex string.
+func (address Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(address.Hex())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (address *Address) UnmarshalJSON(jsonBytes []byte) error {
+	var encoded string
+	if err := json.Unmarshal(jsonBytes, &encoded); err != nil {
+		return errp.WithStack(err)
+	}
+	parsed, err := ParseAddress(encoded)
+	if err != nil {
+		return err
+	}
+	*address = parsed
+	return nil
+}
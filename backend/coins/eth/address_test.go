@@ -0,0 +1,61 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stretchr/testify/require"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+)
+
+func TestPubkeyToAddress(t *testing.T) {
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), mustDecodeHex(
+		"0000000000000000000000000000000000000000000000000000000000000001"))
+	require.Equal(t,
+		"0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf",
+		eth.PubkeyToAddress(privateKey.PubKey()).Hex())
+}
+
+func TestParseAddress(t *testing.T) {
+	// Examples of https://github.com/ethereum/EIPs/blob/master/EIPS/eip-55.md.
+	for _, encoded := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		address, err := eth.ParseAddress(encoded)
+		require.NoError(t, err)
+		require.Equal(t, encoded, address.Hex())
+
+		// All lower case addresses have no checksum.
+		address, err = eth.ParseAddress(strings.ToLower(encoded))
+		require.NoError(t, err)
+		require.Equal(t, encoded, address.Hex())
+	}
+
+	for _, invalid := range []string{
+		"0x5aaeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA",
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeg",
+	} {
+		_, err := eth.ParseAddress(invalid)
+		require.Error(t, err)
+	}
+}
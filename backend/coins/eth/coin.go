@@ -0,0 +1,232 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+)
+
+// decimals is the number of decimals of ether: 1 ETH = 10^18 wei.
+const decimals = 18
+
+// Chain IDs of the supported networks according to EIP-155.
+const (
+	// ChainIDMainnet is the chain ID of the Ethereum mainnet.
+	ChainIDMainnet = 1
+	// ChainIDSepolia is the chain ID of the Sepolia testnet.
+	ChainIDSepolia = 11155111
+	// ChainIDDev is the chain ID of local development nodes, e.g. `geth --dev`.
+	ChainIDDev = 1337
+)
+
+// Coin models Ether on an Ethereum network.
+type Coin struct {
+	observable.Implementation
+
+	code                  string
+	name                  string
+	unit                  string
+	chainID               int64
+	blockExplorerTxPrefix string
+	tokens                []*Token
+
+	client       rpcclient.Interface
+	ratesUpdater coinpkg.RatesUpdater
+
+	log *logrus.Entry
+}
+
+// NewCoin creates a new coin on the network with the given chain ID, connected to a node through
+// the given client. The tokens are the ERC-20 tokens whose balances are shown in the accounts.
+func NewCoin(
+	code string,
+	name string,
+	unit string,
+	chainID int64,
+	client rpcclient.Interface,
+	blockExplorerTxPrefix string,
+	tokens []*Token,
+	ratesUpdater coinpkg.RatesUpdater,
+) *Coin {
+	return &Coin{
+		code:                  code,
+		name:                  name,
+		unit:                  unit,
+		chainID:               chainID,
+		blockExplorerTxPrefix: blockExplorerTxPrefix,
+		tokens:                tokens,
+		client:                client,
+		ratesUpdater:          ratesUpdater,
+
+		log: logging.Get().WithGroup("coin").WithField("code", code),
+	}
+}
+
+// Init implements coin.Coin.
+func (coin *Coin) Init() {
+	if coin.ratesUpdater != nil {
+		coin.ratesUpdater.Observe(coin.Notify)
+	}
+}
+
+// Code implements coin.Coin.
+func (coin *Coin) Code() string {
+	return coin.code
+}
+
+// Name implements coin.Coin.
+func (coin *Coin) Name() string {
+	return coin.name
+}
+
+// Type implements coin.Coin. All testnets share the coin type 1.
+func (coin *Coin) Type() uint32 {
+	if coin.chainID == ChainIDMainnet {
+		return 60
+	}
+	return 1
+}
+
+// Unit implements coin.Coin.
+func (coin *Coin) Unit() string {
+	return coin.unit
+}
+
+// ChainID returns the EIP-155 chain ID of the network.
+func (coin *Coin) ChainID() int64 {
+	return coin.chainID
+}
+
+// Client returns the client of the node through which the coin connects to the network.
+func (coin *Coin) Client() rpcclient.Interface {
+	return coin.client
+}
+
+// Tokens returns the ERC-20 tokens whose balances are shown in the accounts.
+func (coin *Coin) Tokens() []*Token {
+	return coin.tokens
+}
+
+// AccountBased implements coin.Coin.
+func (coin *Coin) AccountBased() bool {
+	return true
+}
+
+// BlockExplorerTransactionURLPrefix implements coin.Coin.
+func (coin *Coin) BlockExplorerTransactionURLPrefix() string {
+	return coin.blockExplorerTxPrefix
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+// formatUnits formats the amount in the smallest unit with the given number of decimals, without
+// trailing zeros.
+func formatUnits(amount *big.Int, decimals int) string {
+	formatted := new(big.Rat).SetFrac(amount, pow10(decimals)).FloatString(decimals)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// parseUnits parses a decimal amount with at most the given number of decimals into the smallest
+// unit.
+func parseUnits(amount string, decimals int) (*big.Int, error) {
+	parsed, ok := new(big.Rat).SetString(amount)
+	if !ok || parsed.Sign() < 0 {
+		return nil, errp.Newf("invalid amount %s", amount)
+	}
+	parsed.Mul(parsed, new(big.Rat).SetInt(pow10(decimals)))
+	if !parsed.IsInt() {
+		return nil, errp.Newf("amount %s has more than %d decimals", amount, decimals)
+	}
+	return parsed.Num(), nil
+}
+
+// ParseAmount parses an amount of ether, e.g. "0.1", into wei.
+func (coin *Coin) ParseAmount(amount string) (coinpkg.Amount, error) {
+	wei, err := parseUnits(amount, decimals)
+	if err != nil {
+		return coinpkg.Amount{}, err
+	}
+	return coinpkg.NewAmount(wei), nil
+}
+
+// ToUnit implements coin.Coin.
+func (coin *Coin) ToUnit(amount coinpkg.Amount) float64 {
+	result, _ := strconv.ParseFloat(formatUnits(amount.BigInt(), decimals), 64)
+	return result
+}
+
+// ValidateAddress implements coin.Coin.
+func (coin *Coin) ValidateAddress(address string) error {
+	_, err := ParseAddress(address)
+	return err
+}
+
+// FormatAmount implements coin.Coin.
+func (coin *Coin) FormatAmount(amount coinpkg.Amount) string {
+	return formatUnits(amount.BigInt(), decimals) + " " + coin.Unit()
+}
+
+// FormatAmountAsJSON implements coin.Coin.
+func (coin *Coin) FormatAmountAsJSON(amount coinpkg.Amount) coinpkg.FormattedAmount {
+	var conversions map[string]string
+	if coin.ratesUpdater != nil {
+		if rates := coin.ratesUpdater.Last(); rates != nil {
+			float := coin.ToUnit(amount)
+			conversions = map[string]string{}
+			for key, value := range rates[coin.ratesUnit()] {
+				conversions[key] = coinpkg.FormatAsCurrency(float * value)
+			}
+		}
+	}
+	return coinpkg.FormattedAmount{
+		Amount:      formatUnits(amount.BigInt(), decimals),
+		Unit:        coin.Unit(),
+		Conversions: conversions,
+	}
+}
+
+// ratesUnit returns the unit under which the exchange rates of the coin are listed. Testnet coins
+// are valued like their mainnet counterparts.
+func (coin *Coin) ratesUnit() string {
+	return strings.TrimPrefix(coin.unit, "T")
+}
+
+// ExchangeRate implements coin.Coin.
+func (coin *Coin) ExchangeRate(fiat string) (float64, bool) {
+	if coin.ratesUpdater == nil {
+		return 0, false
+	}
+	rate, ok := coin.ratesUpdater.Last()[coin.ratesUnit()][fiat]
+	return rate, ok
+}
+
+func (coin *Coin) String() string {
+	return coin.code
+}
@@ -0,0 +1,297 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package devnode implements an in-memory stand-in for an Ethereum node, to be used in tests and
+// for development without access to a blockchain.
+package devnode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+)
+
+// balanceOfSelector is the ERC-20 function selector of balanceOf(address).
+var balanceOfSelector = []byte{0x70, 0xa0, 0x82, 0x31}
+
+// transferGas is the gas used by a transfer of ether to an address without code.
+const transferGas = 21000
+
+// Node is an in-memory node implementing rpcclient.Interface. Txs are validated against the
+// balances and nonces of the accounts and added to a block when Mine() is called. Every tx burns
+// the base fee and pays the priority fee to nobody. Every tx uses all of its gas.
+type Node struct {
+	chainID *big.Int
+	baseFee *big.Int
+
+	balances      map[eth.Address]*big.Int
+	nonces        map[eth.Address]uint64
+	tokenBalances map[eth.Address]map[eth.Address]*big.Int
+	contractGas   map[eth.Address]uint64
+	blocks        []*rpcclient.Block
+	receipts      map[string]*rpcclient.Receipt
+	pending       []*eth.Transaction
+
+	lock locker.Locker
+}
+
+var _ rpcclient.Interface = &Node{}
+
+// NewNode creates a node with a genesis block. The base fee is constant.
+func NewNode(chainID int64, baseFee *big.Int) *Node {
+	return &Node{
+		chainID:       big.NewInt(chainID),
+		baseFee:       baseFee,
+		balances:      map[eth.Address]*big.Int{},
+		nonces:        map[eth.Address]uint64{},
+		tokenBalances: map[eth.Address]map[eth.Address]*big.Int{},
+		contractGas:   map[eth.Address]uint64{},
+		blocks: []*rpcclient.Block{
+			{Number: 0, Timestamp: time.Now(), Transactions: []*rpcclient.Transaction{}},
+		},
+		receipts: map[string]*rpcclient.Receipt{},
+	}
+}
+
+// Fund credits the address with the amount, outside of any tx.
+func (node *Node) Fund(address eth.Address, amount *big.Int) {
+	defer node.lock.Lock()()
+	node.balances[address] = new(big.Int).Add(node.balance(address), amount)
+}
+
+// SetTokenBalance sets the balance of the holder in the ERC-20 contract.
+func (node *Node) SetTokenBalance(contract eth.Address, holder eth.Address, amount *big.Int) {
+	defer node.lock.Lock()()
+	if _, ok := node.tokenBalances[contract]; !ok {
+		node.tokenBalances[contract] = map[eth.Address]*big.Int{}
+	}
+	node.tokenBalances[contract][holder] = amount
+}
+
+// SetContractGas makes the address a contract whose execution uses the given gas when receiving
+// ether.
+func (node *Node) SetContractGas(contract eth.Address, gas uint64) {
+	defer node.lock.Lock()()
+	node.contractGas[contract] = gas
+}
+
+// Pending returns the txs sent but not mined yet.
+func (node *Node) Pending() []*eth.Transaction {
+	defer node.lock.RLock()()
+	return append([]*eth.Transaction{}, node.pending...)
+}
+
+// Mine adds the pending txs to a new block.
+func (node *Node) Mine() {
+	defer node.lock.Lock()()
+	block := &rpcclient.Block{
+		Number:       uint64(len(node.blocks)),
+		Timestamp:    time.Now(),
+		Transactions: []*rpcclient.Transaction{},
+	}
+	for _, tx := range node.pending {
+		sender, _ := tx.Sender()
+		hash, _ := tx.Hash()
+		block.Transactions = append(block.Transactions, &rpcclient.Transaction{
+			Hash:  hash,
+			From:  strings.ToLower(sender.Hex()),
+			To:    strings.ToLower(tx.To.Hex()),
+			Value: tx.Value,
+		})
+		node.receipts[hash] = &rpcclient.Receipt{
+			BlockNumber:       block.Number,
+			Success:           true,
+			GasUsed:           tx.Gas,
+			EffectiveGasPrice: node.effectiveGasPrice(tx),
+		}
+	}
+	node.pending = nil
+	node.blocks = append(node.blocks, block)
+}
+
+func (node *Node) balance(address eth.Address) *big.Int {
+	balance, ok := node.balances[address]
+	if !ok {
+		return big.NewInt(0)
+	}
+	return balance
+}
+
+func (node *Node) gas(to eth.Address) uint64 {
+	if gas, ok := node.contractGas[to]; ok {
+		return gas
+	}
+	return transferGas
+}
+
+func (node *Node) effectiveGasPrice(tx *eth.Transaction) *big.Int {
+	if !tx.Dynamic() {
+		return tx.GasPrice
+	}
+	gasPrice := new(big.Int).Add(node.baseFee, tx.GasTipCap)
+	if gasPrice.Cmp(tx.GasFeeCap) > 0 {
+		return tx.GasFeeCap
+	}
+	return gasPrice
+}
+
+func parseAddress(address string) (eth.Address, error) {
+	// Addresses returned by nodes are lowercase, so the checksum is not verified.
+	return eth.ParseAddress(strings.ToLower(address))
+}
+
+// ChainID implements rpcclient.Interface.
+func (node *Node) ChainID() (*big.Int, error) {
+	return node.chainID, nil
+}
+
+// BlockNumber implements rpcclient.Interface.
+func (node *Node) BlockNumber() (uint64, error) {
+	defer node.lock.RLock()()
+	return uint64(len(node.blocks) - 1), nil
+}
+
+// Balance implements rpcclient.Interface.
+func (node *Node) Balance(address string) (*big.Int, error) {
+	parsed, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	defer node.lock.RLock()()
+	return new(big.Int).Set(node.balance(parsed)), nil
+}
+
+// PendingNonce implements rpcclient.Interface.
+func (node *Node) PendingNonce(address string) (uint64, error) {
+	parsed, err := parseAddress(address)
+	if err != nil {
+		return 0, err
+	}
+	defer node.lock.RLock()()
+	return node.nonces[parsed], nil
+}
+
+// GasPrice implements rpcclient.Interface.
+func (node *Node) GasPrice() (*big.Int, error) {
+	return new(big.Int).Mul(node.baseFee, big.NewInt(2)), nil
+}
+
+// FeeHistory implements rpcclient.Interface. The priority fees at the percentiles are 1, 2, 3, ...
+// gwei.
+func (node *Node) FeeHistory(blockCount int, percentiles []float64) (*rpcclient.FeeHistory, error) {
+	feeHistory := &rpcclient.FeeHistory{}
+	for i := 0; i <= blockCount; i++ {
+		feeHistory.BaseFees = append(feeHistory.BaseFees, node.baseFee)
+	}
+	for i := 0; i < blockCount; i++ {
+		rewards := []*big.Int{}
+		for index := range percentiles {
+			rewards = append(rewards, new(big.Int).Mul(big.NewInt(int64(index+1)), big.NewInt(1e9)))
+		}
+		feeHistory.Rewards = append(feeHistory.Rewards, rewards)
+	}
+	return feeHistory, nil
+}
+
+// BlockByNumber implements rpcclient.Interface.
+func (node *Node) BlockByNumber(number uint64) (*rpcclient.Block, error) {
+	defer node.lock.RLock()()
+	if number >= uint64(len(node.blocks)) {
+		return nil, nil
+	}
+	return node.blocks[number], nil
+}
+
+// TransactionReceipt implements rpcclient.Interface.
+func (node *Node) TransactionReceipt(txHash string) (*rpcclient.Receipt, error) {
+	defer node.lock.RLock()()
+	return node.receipts[txHash], nil
+}
+
+// EstimateGas implements rpcclient.Interface.
+func (node *Node) EstimateGas(from string, to string, value *big.Int) (uint64, error) {
+	parsed, err := parseAddress(to)
+	if err != nil {
+		return 0, err
+	}
+	defer node.lock.RLock()()
+	return node.gas(parsed), nil
+}
+
+// Call implements rpcclient.Interface. Only balanceOf() of ERC-20 contracts is supported.
+func (node *Node) Call(to string, data []byte) ([]byte, error) {
+	contract, err := parseAddress(to)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 36 || !bytes.Equal(data[:4], balanceOfSelector) {
+		return nil, errp.Newf("unsupported call data %s", hex.EncodeToString(data))
+	}
+	var holder eth.Address
+	copy(holder[:], data[16:])
+	defer node.lock.RLock()()
+	balance := big.NewInt(0)
+	if tokenBalance, ok := node.tokenBalances[contract][holder]; ok {
+		balance = tokenBalance
+	}
+	result := make([]byte, 32)
+	balanceBytes := balance.Bytes()
+	copy(result[32-len(balanceBytes):], balanceBytes)
+	return result, nil
+}
+
+// SendRawTransaction implements rpcclient.Interface.
+func (node *Node) SendRawTransaction(rawTx []byte) (string, error) {
+	tx, err := eth.DecodeTransaction(rawTx)
+	if err != nil {
+		return "", err
+	}
+	if tx.ChainID.Cmp(node.chainID) != 0 {
+		return "", errp.New("invalid chain id")
+	}
+	if tx.Dynamic() && tx.GasFeeCap.Cmp(node.baseFee) < 0 {
+		return "", errp.New("max fee per gas less than block base fee")
+	}
+	if tx.Gas < transferGas {
+		return "", errp.New("intrinsic gas too low")
+	}
+	sender, err := tx.Sender()
+	if err != nil {
+		return "", err
+	}
+	defer node.lock.Lock()()
+	if tx.Gas < node.gas(tx.To) {
+		return "", errp.New("out of gas")
+	}
+	if tx.Nonce != node.nonces[sender] {
+		return "", errp.Newf("invalid nonce %d", tx.Nonce)
+	}
+	fee := new(big.Int).Mul(node.effectiveGasPrice(tx), new(big.Int).SetUint64(tx.Gas))
+	cost := new(big.Int).Add(tx.Value, fee)
+	if node.balance(sender).Cmp(cost) < 0 {
+		return "", errp.New("insufficient funds for gas * price + value")
+	}
+	node.balances[sender] = new(big.Int).Sub(node.balance(sender), cost)
+	node.balances[tx.To] = new(big.Int).Add(node.balance(tx.To), tx.Value)
+	node.nonces[sender]++
+	node.pending = append(node.pending, tx)
+	return tx.Hash()
+}
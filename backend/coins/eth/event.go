@@ -0,0 +1,30 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+// Event instances are sent to the onEvent callback of the account.
+type Event string
+
+const (
+	// EventStatusChanged is fired when the status changes. Check the status using
+	// InitialSyncDone() and Offline().
+	EventStatusChanged Event = "statusChanged"
+
+	// EventSyncDone is fired after each update of the balance and the transactions.
+	EventSyncDone Event = "syncdone"
+
+	// EventFeeTargetsChanged is fired when the fee targets change.
+	EventFeeTargetsChanged Event = "feeTargetsChanged"
+)
@@ -0,0 +1,118 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// FeeTargetCode models the code of a fee target. See the constants below.
+type FeeTargetCode string
+
+const (
+	// FeeTargetCodeLow is the low priority fee target.
+	FeeTargetCodeLow FeeTargetCode = "low"
+
+	// FeeTargetCodeNormal is the normal priority fee target.
+	FeeTargetCodeNormal FeeTargetCode = "normal"
+
+	// FeeTargetCodeHigh is the high priority fee target.
+	FeeTargetCodeHigh FeeTargetCode = "high"
+
+	defaultFeeTarget = FeeTargetCodeNormal
+)
+
+// NewFeeTargetCode checks if the code is valid and returns a FeeTargetCode in that case.
+func NewFeeTargetCode(code string) (FeeTargetCode, error) {
+	switch FeeTargetCode(code) {
+	case FeeTargetCodeLow, FeeTargetCodeNormal, FeeTargetCodeHigh:
+		return FeeTargetCode(code), nil
+	default:
+		return "", errp.Newf("Unrecognized fee target code %s", code)
+	}
+}
+
+// feeHistoryBlocks is the number of recent blocks whose priority fees are averaged.
+const feeHistoryBlocks = 10
+
+// feeTargetPercentiles are the percentiles of the priority fees paid in recent blocks which are
+// offered as low, normal and high fee targets.
+var feeTargetPercentiles = []float64{25, 50, 75}
+
+// FeeTarget contains the fees per gas for a specific fee target.
+type FeeTarget struct {
+	Code FeeTargetCode
+
+	// GasTipCap is the max priority fee per gas of EIP-1559 txs. Nil for legacy txs.
+	GasTipCap *big.Int
+	// GasFeeCap is the max fee per gas of EIP-1559 txs, or the gas price of legacy txs.
+	GasFeeCap *big.Int
+}
+
+// Dynamic returns whether the fee target is for EIP-1559 txs.
+func (feeTarget *FeeTarget) Dynamic() bool {
+	return feeTarget.GasTipCap != nil
+}
+
+// TransferFee returns the maximum fee of a transfer of ether at this fee target.
+func (feeTarget *FeeTarget) TransferFee() *big.Int {
+	return new(big.Int).Mul(feeTarget.GasFeeCap, big.NewInt(transferGas))
+}
+
+// estimateFeeTargets estimates the fee targets from the priority fees paid in recent blocks
+// (EIP-1559). The max fee per gas is twice the base fee of the next block plus the priority fee,
+// which keeps the tx valid even if the base fee rises for several blocks in a row. If the node
+// does not support EIP-1559, the suggested gas price of legacy txs is used for all targets.
+func estimateFeeTargets(client rpcclient.Interface) ([]*FeeTarget, error) {
+	codes := []FeeTargetCode{FeeTargetCodeLow, FeeTargetCodeNormal, FeeTargetCodeHigh}
+	feeHistory, err := client.FeeHistory(feeHistoryBlocks, feeTargetPercentiles)
+	if err != nil || len(feeHistory.Rewards) == 0 {
+		gasPrice, err := client.GasPrice()
+		if err != nil {
+			return nil, err
+		}
+		feeTargets := []*FeeTarget{}
+		for _, code := range codes {
+			feeTargets = append(feeTargets, &FeeTarget{Code: code, GasFeeCap: gasPrice})
+		}
+		return feeTargets, nil
+	}
+	if len(feeHistory.BaseFees) == 0 {
+		return nil, errp.New("the fee history contains no base fees")
+	}
+	nextBaseFee := feeHistory.BaseFees[len(feeHistory.BaseFees)-1]
+	feeTargets := []*FeeTarget{}
+	for index, code := range codes {
+		sum := big.NewInt(0)
+		for _, rewards := range feeHistory.Rewards {
+			if len(rewards) != len(codes) {
+				return nil, errp.New("unexpected number of priority fees")
+			}
+			sum.Add(sum, rewards[index])
+		}
+		gasTipCap := sum.Div(sum, big.NewInt(int64(len(feeHistory.Rewards))))
+		gasFeeCap := new(big.Int).Mul(nextBaseFee, big.NewInt(2))
+		gasFeeCap.Add(gasFeeCap, gasTipCap)
+		feeTargets = append(feeTargets, &FeeTarget{
+			Code:      code,
+			GasTipCap: gasTipCap,
+			GasFeeCap: gasFeeCap,
+		})
+	}
+	return feeTargets, nil
+}
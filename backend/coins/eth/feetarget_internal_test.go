@@ -0,0 +1,69 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+)
+
+// feeClient is a node returning a fixed fee history. The other methods are not implemented.
+type feeClient struct {
+	rpcclient.Interface
+	feeHistory *rpcclient.FeeHistory
+}
+
+func (client *feeClient) FeeHistory(int, []float64) (*rpcclient.FeeHistory, error) {
+	if client.feeHistory == nil {
+		return nil, errors.New("the node does not support EIP-1559")
+	}
+	return client.feeHistory, nil
+}
+
+func (client *feeClient) GasPrice() (*big.Int, error) {
+	return big.NewInt(7), nil
+}
+
+func TestEstimateFeeTargets(t *testing.T) {
+	feeTargets, err := estimateFeeTargets(&feeClient{feeHistory: &rpcclient.FeeHistory{
+		BaseFees: []*big.Int{big.NewInt(10), big.NewInt(20)},
+		Rewards: [][]*big.Int{
+			{big.NewInt(1), big.NewInt(2), big.NewInt(3)},
+			{big.NewInt(3), big.NewInt(4), big.NewInt(5)},
+		},
+	}})
+	require.NoError(t, err)
+	require.Len(t, feeTargets, 3)
+	require.Equal(t, FeeTargetCodeNormal, feeTargets[1].Code)
+	require.Equal(t, big.NewInt(3), feeTargets[1].GasTipCap)
+	require.Equal(t, big.NewInt(43), feeTargets[1].GasFeeCap)
+
+	// Nodes not supporting EIP-1559 fall back to the gas price.
+	feeTargets, err = estimateFeeTargets(&feeClient{})
+	require.NoError(t, err)
+	require.Len(t, feeTargets, 3)
+	require.False(t, feeTargets[0].Dynamic())
+	require.Equal(t, big.NewInt(7), feeTargets[0].GasFeeCap)
+
+	_, err = estimateFeeTargets(&feeClient{feeHistory: &rpcclient.FeeHistory{
+		Rewards: [][]*big.Int{{big.NewInt(1), big.NewInt(2), big.NewInt(3)}},
+	}})
+	require.Error(t, err)
+}
@@ -0,0 +1,320 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressaudit"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Handlers provides a web api to the account. The endpoints mirror the ones of Bitcoin accounts,
+// so that the frontend can treat both alike.
+type Handlers struct {
+	account      *eth.Account
+	addressAudit *addressaudit.Log
+	log          *logrus.Entry
+}
+
+// NewHandlers creates a new Handlers instance.
+func NewHandlers(
+	handleFunc func(string, func(*http.Request) (interface{}, error)) *mux.Route,
+	addressAudit *addressaudit.Log,
+	log *logrus.Entry,
+) *Handlers {
+	handlers := &Handlers{addressAudit: addressAudit, log: log}
+
+	handleFunc("/init", handlers.postInit).Methods("POST")
+	handleFunc("/status", handlers.getAccountStatus).Methods("GET")
+	handleFunc("/transactions", handlers.ensureAccountInitialized(handlers.getAccountTransactions)).Methods("GET")
+	handleFunc("/balance", handlers.ensureAccountInitialized(handlers.getAccountBalance)).Methods("GET")
+	handleFunc("/tokens", handlers.ensureAccountInitialized(handlers.getTokenBalances)).Methods("GET")
+	handleFunc("/sendtx", handlers.ensureAccountInitialized(handlers.postAccountSendTx)).Methods("POST")
+	handleFunc("/fee-targets", handlers.ensureAccountInitialized(handlers.getAccountFeeTargets)).Methods("GET")
+	handleFunc("/tx-proposal", handlers.ensureAccountInitialized(handlers.getAccountTxProposal)).Methods("POST")
+	handleFunc("/receive-addresses", handlers.ensureAccountInitialized(handlers.getReceiveAddresses)).Methods("GET")
+	handleFunc("/address-shown", handlers.ensureAccountInitialized(handlers.postAddressShown)).Methods("POST")
+	return handlers
+}
+
+// Init installs a account as a base for the web api. This needs to be called before any requests are
+// made.
+func (handlers *Handlers) Init(account *eth.Account) {
+	handlers.account = account
+}
+
+// Uninit removes the account. After this, no requests should be made.
+func (handlers *Handlers) Uninit() {
+	handlers.account = nil
+}
+
+func (handlers *Handlers) ensureAccountInitialized(h func(*http.Request) (interface{}, error)) func(*http.Request) (interface{}, error) {
+	return func(request *http.Request) (interface{}, error) {
+		if handlers.account == nil {
+			return nil, errp.New("Account was uninitialized. Cannot handle request.")
+		}
+		return h(request)
+	}
+}
+
+func (handlers *Handlers) postInit(_ *http.Request) (interface{}, error) {
+	if handlers.account == nil {
+		return nil, errp.New("/init called even though account was not added yet")
+	}
+	return nil, handlers.account.Init()
+}
+
+// historyIncomplete is reported in addition to the statuses of Bitcoin accounts if older txs may
+// be missing from the history.
+const historyIncomplete btc.Status = "historyIncomplete"
+
+func (handlers *Handlers) getAccountStatus(_ *http.Request) (interface{}, error) {
+	status := []btc.Status{}
+	if handlers.account == nil {
+		status = append(status, btc.AccountDisabled)
+	} else {
+		if handlers.account.InitialSyncDone() {
+			status = append(status, btc.AccountSynced)
+		}
+		if handlers.account.Offline() {
+			status = append(status, btc.OfflineMode)
+		}
+		if handlers.account.HistoryIncomplete() {
+			status = append(status, historyIncomplete)
+		}
+	}
+	return status, nil
+}
+
+// Transaction is the info returned per transaction by the /transactions endpoint.
+type Transaction struct {
+	ID               string               `json:"id"`
+	NumConfirmations int                  `json:"numConfirmations"`
+	Height           uint64               `json:"height"`
+	Type             coin.TransferType    `json:"type"`
+	Amount           coin.FormattedAmount `json:"amount"`
+	Fee              coin.FormattedAmount `json:"fee"`
+	Time             *string              `json:"time"`
+	Addresses        []string             `json:"addresses"`
+	// Status is "broadcast" for pending txs, "confirmed" or "failed" if the execution of the tx
+	// failed.
+	Status string `json:"status"`
+}
+
+func (handlers *Handlers) getAccountTransactions(_ *http.Request) (interface{}, error) {
+	theCoin := handlers.account.Coin()
+	result := []Transaction{}
+	for _, tx := range handlers.account.Transactions() {
+		transfer := handlers.account.Transfer(tx)
+		var fee coin.FormattedAmount
+		if transfer.Fee != nil {
+			fee = theCoin.FormatAmountAsJSON(*transfer.Fee)
+		}
+		var formattedTime *string
+		if transfer.Timestamp != nil {
+			t := transfer.Timestamp.Format(time.RFC3339)
+			formattedTime = &t
+		}
+		status := "confirmed"
+		switch {
+		case tx.BlockNumber == 0:
+			status = "broadcast"
+		case tx.Failed:
+			status = "failed"
+		}
+		result = append(result, Transaction{
+			ID:               transfer.TxID,
+			NumConfirmations: transfer.NumConfirmations,
+			Height:           tx.BlockNumber,
+			Type:             transfer.Type,
+			Amount:           theCoin.FormatAmountAsJSON(transfer.Amount),
+			Fee:              fee,
+			Time:             formattedTime,
+			Addresses:        transfer.Addresses,
+			Status:           status,
+		})
+	}
+	return result, nil
+}
+
+func (handlers *Handlers) getAccountBalance(_ *http.Request) (interface{}, error) {
+	balance := handlers.account.Coin().FormatAmountAsJSON(handlers.account.TotalBalance())
+	// Ethereum has no unconfirmed incoming funds, pending txs are only included once mined.
+	return map[string]interface{}{
+		"available":   balance,
+		"incoming":    handlers.account.Coin().FormatAmountAsJSON(coin.NewAmountFromInt64(0)),
+		"hasIncoming": false,
+	}, nil
+}
+
+func (handlers *Handlers) getTokenBalances(_ *http.Request) (interface{}, error) {
+	result := []map[string]interface{}{}
+	for _, tokenBalance := range handlers.account.TokenBalances() {
+		result = append(result, map[string]interface{}{
+			"code":     tokenBalance.Token.Code,
+			"name":     tokenBalance.Token.Name,
+			"contract": tokenBalance.Token.Contract.Hex(),
+			"balance": coin.FormattedAmount{
+				Amount: tokenBalance.Format(),
+				Unit:   tokenBalance.Token.Unit,
+			},
+		})
+	}
+	return result, nil
+}
+
+type sendTxInput struct {
+	address       string
+	sendAll       bool
+	amount        string
+	feeTargetCode eth.FeeTargetCode
+}
+
+func (input *sendTxInput) UnmarshalJSON(jsonBytes []byte) error {
+	jsonBody := struct {
+		Address   string `json:"address"`
+		SendAll   string `json:"sendAll"`
+		FeeTarget string `json:"feeTarget"`
+		Amount    string `json:"amount"`
+	}{}
+	if err := json.Unmarshal(jsonBytes, &jsonBody); err != nil {
+		return errp.WithStack(err)
+	}
+	input.address = jsonBody.Address
+	var err error
+	input.feeTargetCode, err = eth.NewFeeTargetCode(jsonBody.FeeTarget)
+	if err != nil {
+		return errp.WithMessage(err, "Failed to retrieve fee target code")
+	}
+	input.sendAll = jsonBody.SendAll == "yes"
+	input.amount = jsonBody.Amount
+	return nil
+}
+
+// sendAmount parses the amount of the input. The amount is parsed exactly instead of as a float,
+// as ether has more decimals than a float64 can represent.
+func (handlers *Handlers) sendAmount(input *sendTxInput) (eth.SendAmount, error) {
+	if input.sendAll {
+		return eth.NewSendAmountAll(), nil
+	}
+	amount, err := handlers.account.Coin().(*eth.Coin).ParseAmount(input.amount)
+	if err != nil {
+		return eth.SendAmount{}, errp.WithStack(eth.TxValidationError("invalid amount"))
+	}
+	sendAmount, err := eth.NewSendAmount(amount)
+	if err != nil {
+		return eth.SendAmount{}, errp.WithStack(eth.TxValidationError("invalid amount"))
+	}
+	return sendAmount, nil
+}
+
+func (handlers *Handlers) postAccountSendTx(r *http.Request) (interface{}, error) {
+	input := &sendTxInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	sendAmount, err := handlers.sendAmount(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := handlers.account.SendTx(input.address, sendAmount, input.feeTargetCode); err != nil {
+		return nil, errp.WithMessage(err, "Failed to send transaction")
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+func txProposalError(err error) (interface{}, error) {
+	if errp.Cause(err) == eth.ErrInsufficientFunds {
+		return map[string]interface{}{
+			"success": false,
+			"errMsg":  "insufficient funds",
+		}, nil
+	}
+	if validationErr, ok := errp.Cause(err).(eth.TxValidationError); ok {
+		return map[string]interface{}{
+			"success": false,
+			"errMsg":  validationErr.Error(),
+		}, nil
+	}
+	return nil, errp.WithMessage(err, "Failed to create transaction proposal")
+}
+
+func (handlers *Handlers) getAccountTxProposal(r *http.Request) (interface{}, error) {
+	input := &sendTxInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return txProposalError(errp.WithStack(err))
+	}
+	sendAmount, err := handlers.sendAmount(input)
+	if err != nil {
+		return txProposalError(err)
+	}
+	txProposal, err := handlers.account.TxProposal(input.address, sendAmount, input.feeTargetCode)
+	if err != nil {
+		return txProposalError(err)
+	}
+	theCoin := handlers.account.Coin()
+	return map[string]interface{}{
+		"success": true,
+		"amount":  theCoin.FormatAmountAsJSON(coin.NewAmount(txProposal.Value)),
+		"fee":     theCoin.FormatAmountAsJSON(coin.NewAmount(txProposal.Fee)),
+		"total":   theCoin.FormatAmountAsJSON(coin.NewAmount(txProposal.Total())),
+		"address": input.address,
+	}, nil
+}
+
+func (handlers *Handlers) getAccountFeeTargets(_ *http.Request) (interface{}, error) {
+	theCoin := handlers.account.Coin()
+	result := []map[string]interface{}{}
+	for _, feeTarget := range handlers.account.FeeTargets() {
+		result = append(result, map[string]interface{}{
+			"code":    feeTarget.Code,
+			"maxFee":  theCoin.FormatAmountAsJSON(coin.NewAmount(feeTarget.TransferFee())),
+			"dynamic": feeTarget.Dynamic(),
+		})
+	}
+	return map[string]interface{}{
+		"feeTargets":       result,
+		"defaultFeeTarget": eth.FeeTargetCodeNormal,
+	}, nil
+}
+
+func (handlers *Handlers) getReceiveAddresses(_ *http.Request) (interface{}, error) {
+	address := handlers.account.ReceiveAddress()
+	// Ethereum accounts have a single address, which is reused.
+	return []interface{}{
+		struct {
+			Address string `json:"address"`
+		}{Address: address},
+	}, nil
+}
+
+// postAddressShown records that the receive address was shown to the user in the address audit log.
+// Unlike Bitcoin accounts, there are no addresses to rotate.
+func (handlers *Handlers) postAddressShown(_ *http.Request) (interface{}, error) {
+	return true, handlers.addressAudit.Record(addressaudit.Entry{
+		AccountCode: handlers.account.Code(),
+		Address:     handlers.account.ReceiveAddress(),
+		Action:      addressaudit.ActionDisplayed,
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Tx is a transaction sending ether from or to an account.
+type Tx struct {
+	Hash  string   `json:"hash"`
+	From  Address  `json:"from"`
+	To    Address  `json:"to"`
+	Value *big.Int `json:"value"`
+	// Fee is the fee paid by the sender. For pending txs sent by the account, it is the maximum
+	// fee. Nil for incoming txs.
+	Fee *big.Int `json:"fee"`
+	// BlockNumber is the block in which the tx was mined. 0 if the tx is pending.
+	BlockNumber uint64 `json:"blockNumber"`
+	// Timestamp is the time of the block in which the tx was mined. Nil if the tx is pending.
+	Timestamp *time.Time `json:"timestamp"`
+	// Failed is true if the tx was mined, but its execution failed.
+	Failed bool `json:"failed"`
+}
+
+// history is the persisted history of an account. As Ethereum nodes do not index txs by address,
+// the history is collected by scanning the blocks for txs of the account.
+type history struct {
+	// LastScannedBlock is the latest block scanned for txs. 0 if no block was scanned yet.
+	LastScannedBlock uint64 `json:"lastScannedBlock"`
+	// Incomplete is true if the account was used before the first scanned block, so that older
+	// txs may be missing.
+	Incomplete   bool  `json:"incomplete"`
+	Transactions []*Tx `json:"transactions"`
+}
+
+func loadHistory(filename string) (*history, error) {
+	loaded := &history{Transactions: []*Tx{}}
+	jsonBytes, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return loaded, nil
+	}
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := json.Unmarshal(jsonBytes, loaded); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return loaded, nil
+}
+
+func (history *history) save(filename string) error {
+	jsonBytes, err := json.Marshal(history)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(ioutil.WriteFile(filename, jsonBytes, 0600))
+}
+
+// add adds the tx, replacing a tx with the same hash, e.g. a pending tx which was mined since.
+func (history *history) add(tx *Tx) {
+	for index, existing := range history.Transactions {
+		if existing.Hash == tx.Hash {
+			history.Transactions[index] = tx
+			return
+		}
+	}
+	history.Transactions = append(history.Transactions, tx)
+}
+
+// pending returns the txs which are not mined yet.
+func (history *history) pending() []*Tx {
+	pending := []*Tx{}
+	for _, tx := range history.Transactions {
+		if tx.BlockNumber == 0 {
+			pending = append(pending, tx)
+		}
+	}
+	return pending
+}
+
+// sorted returns the txs, newest first. Pending txs come first.
+func (history *history) sorted() []*Tx {
+	sorted := append([]*Tx{}, history.Transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].BlockNumber == 0 || sorted[j].BlockNumber == 0 {
+			return sorted[i].BlockNumber == 0 && sorted[j].BlockNumber != 0
+		}
+		return sorted[i].BlockNumber > sorted[j].BlockNumber
+	})
+	return sorted
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// rlpEncode encodes the item with the recursive length prefix encoding:
+// https://github.com/ethereum/wiki/wiki/RLP
+//
+// Supported items are byte strings ([]byte), unsigned integers (uint64, *big.Int), which are
+// encoded as big endian byte strings without leading zeros, and lists ([]interface{}) thereof.
+func rlpEncode(item interface{}) []byte {
+	switch item := item.(type) {
+	case []byte:
+		if len(item) == 1 && item[0] < 0x80 {
+			return item
+		}
+		return append(rlpLengthPrefix(len(item), 0x80), item...)
+	case uint64:
+		return rlpEncode(new(big.Int).SetUint64(item))
+	case *big.Int:
+		if item.Sign() < 0 {
+			panic("negative integers can't be encoded")
+		}
+		return rlpEncode(item.Bytes())
+	case []interface{}:
+		payload := []byte{}
+		for _, element := range item {
+			payload = append(payload, rlpEncode(element)...)
+		}
+		return append(rlpLengthPrefix(len(payload), 0xc0), payload...)
+	default:
+		panic(fmt.Sprintf("type %T can't be encoded", item))
+	}
+}
+
+// rlpLengthPrefix returns the prefix of a string (offset 0x80) or a list (offset 0xc0) of the
+// given length.
+func rlpLengthPrefix(length int, offset byte) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+	lengthBytes := big.NewInt(int64(length)).Bytes()
+	return append([]byte{offset + 55 + byte(len(lengthBytes))}, lengthBytes...)
+}
+
+// rlpDecode decodes an RLP encoded item. Byte strings are returned as []byte and lists as
+// []interface{}.
+func rlpDecode(encoded []byte) (interface{}, error) {
+	item, rest, err := rlpDecodeItem(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errp.New("trailing bytes after RLP item")
+	}
+	return item, nil
+}
+
+// rlpDecodeItem decodes the first item and returns the remaining bytes.
+func rlpDecodeItem(encoded []byte) (interface{}, []byte, error) {
+	if len(encoded) == 0 {
+		return nil, nil, errp.New("unexpected end of RLP data")
+	}
+	prefix := encoded[0]
+	if prefix < 0x80 {
+		return encoded[:1], encoded[1:], nil
+	}
+	isList := prefix >= 0xc0
+	offset := byte(0x80)
+	if isList {
+		offset = 0xc0
+	}
+	headerLength, length := 1, int(prefix-offset)
+	if length > 55 {
+		lengthOfLength := length - 55
+		if len(encoded) < 1+lengthOfLength || lengthOfLength > 4 {
+			return nil, nil, errp.New("invalid RLP length")
+		}
+		headerLength += lengthOfLength
+		length = int(new(big.Int).SetBytes(encoded[1:headerLength]).Int64())
+	}
+	if len(encoded) < headerLength+length {
+		return nil, nil, errp.New("unexpected end of RLP data")
+	}
+	payload, rest := encoded[headerLength:headerLength+length], encoded[headerLength+length:]
+	if !isList {
+		return payload, rest, nil
+	}
+	items := []interface{}{}
+	for len(payload) > 0 {
+		item, remaining, err := rlpDecodeItem(payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+		payload = remaining
+	}
+	return items, rest, nil
+}
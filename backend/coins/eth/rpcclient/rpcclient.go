@@ -0,0 +1,371 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpcclient implements a client of the JSON-RPC API of Ethereum nodes.
+// See https://github.com/ethereum/wiki/wiki/JSON-RPC.
+package rpcclient
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// Interface is the part of the node API used by the wallet. Addresses and hashes are hex encoded
+// with 0x prefix.
+type Interface interface {
+	// ChainID returns the EIP-155 chain ID of the network.
+	ChainID() (*big.Int, error)
+	// BlockNumber returns the number of the latest block.
+	BlockNumber() (uint64, error)
+	// Balance returns the balance of the address in wei, as of the latest block.
+	Balance(address string) (*big.Int, error)
+	// PendingNonce returns the nonce to use for the next tx of the address, including pending txs.
+	PendingNonce(address string) (uint64, error)
+	// GasPrice returns the suggested gas price of legacy txs in wei.
+	GasPrice() (*big.Int, error)
+	// FeeHistory returns the base fees and the priority fees at the given percentiles of the
+	// latest blocks. It fails on nodes not supporting EIP-1559.
+	FeeHistory(blockCount int, percentiles []float64) (*FeeHistory, error)
+	// BlockByNumber returns the block with its txs. Nil if the block does not exist yet.
+	BlockByNumber(number uint64) (*Block, error)
+	// TransactionReceipt returns the receipt of the tx. Nil if the tx is not mined yet.
+	TransactionReceipt(txHash string) (*Receipt, error)
+	// EstimateGas returns the gas needed by a tx sending value wei from one address to another.
+	// It is more than 21000 if the recipient is a contract. It fails if the execution would fail.
+	EstimateGas(from string, to string, value *big.Int) (uint64, error)
+	// Call executes a message call without creating a tx, e.g. to query a contract.
+	Call(to string, data []byte) ([]byte, error)
+	// SendRawTransaction broadcasts the signed tx and returns its hash.
+	SendRawTransaction(rawTx []byte) (string, error)
+}
+
+// FeeHistory is returned by Interface.FeeHistory().
+type FeeHistory struct {
+	// BaseFees are the base fees per gas of the requested blocks, followed by the one of the next
+	// block.
+	BaseFees []*big.Int
+	// Rewards are the priority fees per gas paid at the requested percentiles, one list per block.
+	Rewards [][]*big.Int
+}
+
+// Transaction is a tx in a block.
+type Transaction struct {
+	Hash string
+	From string
+	// To is empty for contract creations.
+	To    string
+	Value *big.Int
+}
+
+// Block is returned by Interface.BlockByNumber().
+type Block struct {
+	Number       uint64
+	Timestamp    time.Time
+	Transactions []*Transaction
+}
+
+// Receipt is returned by Interface.TransactionReceipt().
+type Receipt struct {
+	BlockNumber uint64
+	// Success is false if the execution of the tx failed. The fee is paid nevertheless.
+	Success           bool
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+}
+
+// RPCClient implements Interface over HTTP.
+type RPCClient struct {
+	url        string
+	httpClient *http.Client
+	requestID  uint64
+}
+
+// NewRPCClient creates a client of the node at the given URL, e.g. "http://127.0.0.1:8545".
+func NewRPCClient(url string) *RPCClient {
+	return &RPCClient{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *rpcError) Error() string {
+	return err.Message
+}
+
+// call calls the JSON-RPC method and unmarshals the result into the result argument. If the result
+// is null, the result argument is not modified.
+func (client *RPCClient) call(result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      atomic.AddUint64(&client.requestID, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	response, err := client.httpClient.Post(client.url, "application/json", bytes.NewReader(requestBody))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return errp.Newf("%s failed with status %s", method, response.Status)
+	}
+	var responseBody struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&responseBody); err != nil {
+		return errp.WithStack(err)
+	}
+	if responseBody.Error != nil {
+		return errp.WithMessage(responseBody.Error, method)
+	}
+	if len(responseBody.Result) == 0 || string(responseBody.Result) == "null" {
+		return nil
+	}
+	return errp.WithStack(json.Unmarshal(responseBody.Result, result))
+}
+
+// parseQuantity parses a hex encoded quantity, e.g. "0x1a".
+func parseQuantity(quantity string) (*big.Int, error) {
+	if !strings.HasPrefix(quantity, "0x") {
+		return nil, errp.Newf("invalid quantity %s", quantity)
+	}
+	result, ok := new(big.Int).SetString(quantity[2:], 16)
+	if !ok {
+		return nil, errp.Newf("invalid quantity %s", quantity)
+	}
+	return result, nil
+}
+
+func parseUint64(quantity string) (uint64, error) {
+	result, err := parseQuantity(quantity)
+	if err != nil {
+		return 0, err
+	}
+	if !result.IsUint64() {
+		return 0, errp.Newf("quantity %s out of range", quantity)
+	}
+	return result.Uint64(), nil
+}
+
+func encodeQuantity(quantity uint64) string {
+	return "0x" + new(big.Int).SetUint64(quantity).Text(16)
+}
+
+func (client *RPCClient) callQuantity(method string, params ...interface{}) (*big.Int, error) {
+	var result string
+	if err := client.call(&result, method, params...); err != nil {
+		return nil, err
+	}
+	return parseQuantity(result)
+}
+
+// ChainID implements Interface.
+func (client *RPCClient) ChainID() (*big.Int, error) {
+	return client.callQuantity("eth_chainId")
+}
+
+// BlockNumber implements Interface.
+func (client *RPCClient) BlockNumber() (uint64, error) {
+	number, err := client.callQuantity("eth_blockNumber")
+	if err != nil {
+		return 0, err
+	}
+	return number.Uint64(), nil
+}
+
+// Balance implements Interface.
+func (client *RPCClient) Balance(address string) (*big.Int, error) {
+	return client.callQuantity("eth_getBalance", address, "latest")
+}
+
+// PendingNonce implements Interface.
+func (client *RPCClient) PendingNonce(address string) (uint64, error) {
+	nonce, err := client.callQuantity("eth_getTransactionCount", address, "pending")
+	if err != nil {
+		return 0, err
+	}
+	return nonce.Uint64(), nil
+}
+
+// GasPrice implements Interface.
+func (client *RPCClient) GasPrice() (*big.Int, error) {
+	return client.callQuantity("eth_gasPrice")
+}
+
+// FeeHistory implements Interface.
+func (client *RPCClient) FeeHistory(blockCount int, percentiles []float64) (*FeeHistory, error) {
+	var result struct {
+		BaseFeePerGas []string   `json:"baseFeePerGas"`
+		Reward        [][]string `json:"reward"`
+	}
+	if err := client.call(&result, "eth_feeHistory",
+		encodeQuantity(uint64(blockCount)), "latest", percentiles); err != nil {
+		return nil, err
+	}
+	if len(result.BaseFeePerGas) == 0 {
+		return nil, errp.New("the node does not support EIP-1559")
+	}
+	feeHistory := &FeeHistory{}
+	for _, baseFee := range result.BaseFeePerGas {
+		parsed, err := parseQuantity(baseFee)
+		if err != nil {
+			return nil, err
+		}
+		feeHistory.BaseFees = append(feeHistory.BaseFees, parsed)
+	}
+	for _, blockRewards := range result.Reward {
+		rewards := []*big.Int{}
+		for _, reward := range blockRewards {
+			parsed, err := parseQuantity(reward)
+			if err != nil {
+				return nil, err
+			}
+			rewards = append(rewards, parsed)
+		}
+		feeHistory.Rewards = append(feeHistory.Rewards, rewards)
+	}
+	return feeHistory, nil
+}
+
+// BlockByNumber implements Interface.
+func (client *RPCClient) BlockByNumber(number uint64) (*Block, error) {
+	var result *struct {
+		Number       string `json:"number"`
+		Timestamp    string `json:"timestamp"`
+		Transactions []struct {
+			Hash  string `json:"hash"`
+			From  string `json:"from"`
+			To    string `json:"to"`
+			Value string `json:"value"`
+		} `json:"transactions"`
+	}
+	if err := client.call(&result, "eth_getBlockByNumber", encodeQuantity(number), true); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	timestamp, err := parseUint64(result.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	block := &Block{
+		Number:       number,
+		Timestamp:    time.Unix(int64(timestamp), 0),
+		Transactions: []*Transaction{},
+	}
+	for _, tx := range result.Transactions {
+		value, err := parseQuantity(tx.Value)
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, &Transaction{
+			Hash:  tx.Hash,
+			From:  tx.From,
+			To:    tx.To,
+			Value: value,
+		})
+	}
+	return block, nil
+}
+
+// TransactionReceipt implements Interface.
+func (client *RPCClient) TransactionReceipt(txHash string) (*Receipt, error) {
+	var result *struct {
+		BlockNumber       string `json:"blockNumber"`
+		Status            string `json:"status"`
+		GasUsed           string `json:"gasUsed"`
+		EffectiveGasPrice string `json:"effectiveGasPrice"`
+	}
+	if err := client.call(&result, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	blockNumber, err := parseUint64(result.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	gasUsed, err := parseUint64(result.GasUsed)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{
+		BlockNumber: blockNumber,
+		Success:     result.Status == "0x1",
+		GasUsed:     gasUsed,
+	}
+	// Not returned by nodes predating EIP-1559.
+	if result.EffectiveGasPrice != "" {
+		receipt.EffectiveGasPrice, err = parseQuantity(result.EffectiveGasPrice)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return receipt, nil
+}
+
+// EstimateGas implements Interface.
+func (client *RPCClient) EstimateGas(from string, to string, value *big.Int) (uint64, error) {
+	gas, err := client.callQuantity("eth_estimateGas", map[string]string{
+		"from":  from,
+		"to":    to,
+		"value": "0x" + value.Text(16),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return gas.Uint64(), nil
+}
+
+// Call implements Interface.
+func (client *RPCClient) Call(to string, data []byte) ([]byte, error) {
+	var result string
+	if err := client.call(&result, "eth_call", map[string]string{
+		"to":   to,
+		"data": "0x" + hex.EncodeToString(data),
+	}, "latest"); err != nil {
+		return nil, err
+	}
+	decoded, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	return decoded, errp.WithStack(err)
+}
+
+// SendRawTransaction implements Interface.
+func (client *RPCClient) SendRawTransaction(rawTx []byte) (string, error) {
+	var txHash string
+	err := client.call(&txHash, "eth_sendRawTransaction", "0x"+hex.EncodeToString(rawTx))
+	return txHash, err
+}
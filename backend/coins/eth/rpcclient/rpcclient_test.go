@@ -0,0 +1,130 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcclient_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+)
+
+// newNode starts a node answering each method with the given result.
+func newNode(t *testing.T, results map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int           `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		result, ok := results[request.Method]
+		if ok {
+			response["result"] = result
+		} else {
+			response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+}
+
+func TestRPCClient(t *testing.T) {
+	node := newNode(t, map[string]interface{}{
+		"eth_chainId":             "0xaa36a7",
+		"eth_blockNumber":         "0x10",
+		"eth_getBalance":          "0xde0b6b3a7640000",
+		"eth_getTransactionCount": "0x2",
+		"eth_gasPrice":            "0x3b9aca00",
+		"eth_feeHistory": map[string]interface{}{
+			"baseFeePerGas": []string{"0x1", "0x2"},
+			"reward":        [][]string{{"0x3", "0x4"}},
+		},
+		"eth_getBlockByNumber": map[string]interface{}{
+			"number":    "0x10",
+			"timestamp": "0x5b7d2d4a",
+			"transactions": []map[string]string{
+				{"hash": "0xab", "from": "0x01", "to": "0x02", "value": "0x5"},
+			},
+		},
+		"eth_getTransactionReceipt": nil,
+		"eth_estimateGas":           "0x5208",
+		"eth_call":                  "0x0102",
+		"eth_sendRawTransaction":    "0xcd",
+	})
+	defer node.Close()
+	client := rpcclient.NewRPCClient(node.URL)
+
+	chainID, err := client.ChainID()
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(11155111), chainID)
+
+	blockNumber, err := client.BlockNumber()
+	require.NoError(t, err)
+	require.Equal(t, uint64(16), blockNumber)
+
+	balance, err := client.Balance("0x01")
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(1000000000000000000), balance)
+
+	nonce, err := client.PendingNonce("0x01")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), nonce)
+
+	gasPrice, err := client.GasPrice()
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(1000000000), gasPrice)
+
+	feeHistory, err := client.FeeHistory(1, []float64{25, 75})
+	require.NoError(t, err)
+	require.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(2)}, feeHistory.BaseFees)
+	require.Equal(t, [][]*big.Int{{big.NewInt(3), big.NewInt(4)}}, feeHistory.Rewards)
+
+	block, err := client.BlockByNumber(16)
+	require.NoError(t, err)
+	require.Equal(t, int64(1534930250), block.Timestamp.Unix())
+	require.Len(t, block.Transactions, 1)
+	require.Equal(t, "0xab", block.Transactions[0].Hash)
+	require.Equal(t, big.NewInt(5), block.Transactions[0].Value)
+
+	receipt, err := client.TransactionReceipt("0xab")
+	require.NoError(t, err)
+	require.Nil(t, receipt)
+
+	gas, err := client.EstimateGas("0x01", "0x02", big.NewInt(5))
+	require.NoError(t, err)
+	require.Equal(t, uint64(21000), gas)
+
+	result, err := client.Call("0x02", []byte{1})
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, result)
+
+	txHash, err := client.SendRawTransaction([]byte{1})
+	require.NoError(t, err)
+	require.Equal(t, "0xcd", txHash)
+}
+
+func TestRPCClientError(t *testing.T) {
+	node := newNode(t, map[string]interface{}{})
+	defer node.Close()
+	_, err := rpcclient.NewRPCClient(node.URL).FeeHistory(1, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "method not found")
+}
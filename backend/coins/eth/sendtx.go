@@ -0,0 +1,236 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// transferGas is the gas used by a transfer of ether to an address without code.
+const transferGas = 21000
+
+// ErrInsufficientFunds is returned when the balance does not cover the amount and the fee.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// TxValidationError represents errors in the tx proposal input data.
+type TxValidationError string
+
+func (err TxValidationError) Error() string {
+	return string(err)
+}
+
+// SendAmount is either a concrete amount or "all"/"max".
+type SendAmount struct {
+	amount  *big.Int
+	sendAll bool
+}
+
+// NewSendAmount creates a new SendAmount based on a concrete amount.
+func NewSendAmount(amount coin.Amount) (SendAmount, error) {
+	if amount.BigInt().Sign() <= 0 {
+		return SendAmount{}, errp.New("invalid amount")
+	}
+	return SendAmount{amount: amount.BigInt()}, nil
+}
+
+// NewSendAmountAll creates a new Sendall-amount.
+func NewSendAmountAll() SendAmount {
+	return SendAmount{sendAll: true}
+}
+
+// TxProposal is a proposed tx, to be signed by the keystores. It implements
+// coin.ProposedTransaction.
+type TxProposal struct {
+	// Keypath is the keypath of the key which signs the tx.
+	Keypath signing.AbsoluteKeypath
+	// From is the address of the key at Keypath.
+	From Address
+	Tx   *Transaction
+	// Value is the amount sent to the recipient.
+	Value *big.Int
+	// Fee is the maximum fee paid. The actual fee is lower if the base fee is lower than expected.
+	Fee *big.Int
+}
+
+// Total returns the amount sent plus the maximum fee.
+func (txProposal *TxProposal) Total() *big.Int {
+	return new(big.Int).Add(txProposal.Value, txProposal.Fee)
+}
+
+// SignatureHashes implements coin.ProposedTransaction.
+func (txProposal *TxProposal) SignatureHashes() ([]*coin.SignatureHash, error) {
+	return []*coin.SignatureHash{
+		{Hash: txProposal.Tx.SigningHash(), Keypath: txProposal.Keypath},
+	}, nil
+}
+
+// SetSignatures implements coin.ProposedTransaction. The signature carries no recovery id, so
+// the one recovering the sender is picked.
+func (txProposal *TxProposal) SetSignatures(_ int, signatures []*btcec.Signature) error {
+	if len(signatures) != 1 {
+		return errp.New("expected exactly one signature")
+	}
+	r, s := signatures[0].R.Bytes(), signatures[0].S.Bytes()
+	signature := make([]byte, 65)
+	copy(signature[32-len(r):32], r)
+	copy(signature[64-len(s):64], s)
+	for recoveryID := byte(0); recoveryID <= 1; recoveryID++ {
+		signature[64] = recoveryID
+		if err := txProposal.Tx.SetSignature(signature); err != nil {
+			return err
+		}
+		sender, err := txProposal.Tx.Sender()
+		if err == nil && sender == txProposal.From {
+			return nil
+		}
+	}
+	return errp.New("The signature does not match the sender")
+}
+
+// newTx creates a new tx to the given recipient address, paying the fees of the fee target.
+func (account *Account) newTx(
+	recipientAddress string,
+	amount SendAmount,
+	feeTargetCode FeeTargetCode,
+) (*TxProposal, error) {
+	recipient, err := ParseAddress(recipientAddress)
+	if err != nil {
+		return nil, errp.WithStack(TxValidationError("invalid address"))
+	}
+	balance, err := func() (*big.Int, error) {
+		defer account.RLock()()
+		if account.signingConfiguration == nil || account.balance == nil {
+			return nil, errp.New("The account is not synced yet")
+		}
+		return account.balance, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+	value := amount.amount
+	if amount.sendAll {
+		value = balance
+	}
+	if value.Cmp(balance) > 0 {
+		return nil, errp.WithStack(ErrInsufficientFunds)
+	}
+	// The recipient can be a contract, which needs more gas than a transfer to execute. The gas
+	// is estimated outside of the lock, as the node is queried.
+	gas, err := account.coin.Client().EstimateGas(account.address.Hex(), recipient.Hex(), value)
+	if err != nil {
+		return nil, errp.WithMessage(err, "Could not estimate the gas")
+	}
+	defer account.RLock()()
+	var feeTarget *FeeTarget
+	for _, target := range account.feeTargets {
+		if target.Code == feeTargetCode {
+			feeTarget = target
+		}
+	}
+	if feeTarget == nil {
+		return nil, errp.New("Fee could not be estimated")
+	}
+	tx := &Transaction{
+		ChainID: big.NewInt(account.coin.ChainID()),
+		Nonce:   account.nonce,
+		Gas:     gas,
+		To:      recipient,
+	}
+	if feeTarget.Dynamic() {
+		tx.GasTipCap = feeTarget.GasTipCap
+		tx.GasFeeCap = feeTarget.GasFeeCap
+	} else {
+		tx.GasPrice = feeTarget.GasFeeCap
+	}
+	fee := tx.MaxFee()
+	if amount.sendAll {
+		tx.Value = new(big.Int).Sub(account.balance, fee)
+		if tx.Value.Sign() <= 0 {
+			return nil, errp.WithStack(ErrInsufficientFunds)
+		}
+	} else {
+		tx.Value = amount.amount
+		if new(big.Int).Add(tx.Value, fee).Cmp(account.balance) > 0 {
+			return nil, errp.WithStack(ErrInsufficientFunds)
+		}
+	}
+	return &TxProposal{
+		Keypath: account.signingConfiguration.AbsoluteKeypath().Child(0, false),
+		From:    account.address,
+		Tx:      tx,
+		Value:   tx.Value,
+		Fee:     fee,
+	}, nil
+}
+
+// TxProposal creates a tx from the relevant input and returns it for display in the UI (the
+// amount and the fee). At the same time, it validates the input.
+func (account *Account) TxProposal(
+	recipientAddress string,
+	amount SendAmount,
+	feeTargetCode FeeTargetCode,
+) (*TxProposal, error) {
+	account.log.Debug("Proposing transaction")
+	return account.newTx(recipientAddress, amount, feeTargetCode)
+}
+
+// SendTx creates, signs and broadcasts a tx which sends `amount` to the recipient.
+func (account *Account) SendTx(
+	recipientAddress string,
+	amount SendAmount,
+	feeTargetCode FeeTargetCode,
+) error {
+	account.log.Info("Sending transaction")
+	txProposal, err := account.newTx(recipientAddress, amount, feeTargetCode)
+	if err != nil {
+		return errp.WithMessage(err, "Failed to create transaction")
+	}
+	if err := account.keystores.SignTransaction(txProposal); err != nil {
+		return errp.WithMessage(err, "Failed to sign transaction")
+	}
+	rawTx, err := txProposal.Tx.RawBytes()
+	if err != nil {
+		return err
+	}
+	account.log.Info("Signed transaction is broadcasted")
+	txHash, err := account.coin.Client().SendRawTransaction(rawTx)
+	if err != nil {
+		return err
+	}
+	func() {
+		defer account.Lock()()
+		// The next tx must use the next nonce, even if the account is not updated in between.
+		account.nonce = txProposal.Tx.Nonce + 1
+		account.history.add(&Tx{
+			Hash:  txHash,
+			From:  account.address,
+			To:    txProposal.Tx.To,
+			Value: txProposal.Value,
+			Fee:   txProposal.Fee,
+		})
+	}()
+	if err := account.saveHistory(); err != nil {
+		account.log.WithError(err).Error("Could not save the history")
+	}
+	account.triggerUpdate()
+	return nil
+}
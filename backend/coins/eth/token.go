@@ -0,0 +1,87 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// balanceOfSelector is the function selector of the ERC-20 function balanceOf(address), i.e. the
+// first four bytes of keccak256("balanceOf(address)").
+var balanceOfSelector = keccak256([]byte("balanceOf(address)"))[:4]
+
+// Token is an ERC-20 token contract.
+type Token struct {
+	Code     string
+	Name     string
+	Unit     string
+	Contract Address
+	Decimals int
+}
+
+func mustParseAddress(address string) Address {
+	parsed, err := ParseAddress(address)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// MainnetTokens are the ERC-20 tokens shown in mainnet accounts.
+var MainnetTokens = []*Token{
+	{
+		Code:     "eth-erc20-usdt",
+		Name:     "Tether USD",
+		Unit:     "USDT",
+		Contract: mustParseAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"),
+		Decimals: 6,
+	},
+	{
+		Code:     "eth-erc20-dai",
+		Name:     "Dai Stablecoin",
+		Unit:     "DAI",
+		Contract: mustParseAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"),
+		Decimals: 18,
+	},
+}
+
+// TokenBalance is the balance of an account in an ERC-20 token.
+type TokenBalance struct {
+	Token   *Token
+	Balance *big.Int
+}
+
+// Format formats the balance in the unit of the token, e.g. "1.5".
+func (balance *TokenBalance) Format() string {
+	return formatUnits(balance.Balance, balance.Token.Decimals)
+}
+
+// tokenBalance queries the balance of the holder by calling balanceOf() of the token contract.
+func tokenBalance(client rpcclient.Interface, token *Token, holder Address) (*big.Int, error) {
+	// The address argument is left-padded to 32 bytes.
+	data := append(append([]byte{}, balanceOfSelector...), make([]byte, 12)...)
+	data = append(data, holder[:]...)
+	result, err := client.Call(token.Contract.Hex(), data)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 32 {
+		return nil, errp.Newf("unexpected result of balanceOf() of %s", token.Unit)
+	}
+	return new(big.Int).SetBytes(result), nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// dynamicFeeTxType is the EIP-2718 type of EIP-1559 transactions.
+const dynamicFeeTxType = 0x02
+
+// Transaction is an Ethereum transaction. If GasTipCap is set, it is an EIP-1559 transaction with
+// GasTipCap as max priority fee and GasFeeCap as max fee per gas. Otherwise, it is a legacy
+// transaction paying GasPrice, with EIP-155 replay protection.
+type Transaction struct {
+	ChainID   *big.Int
+	Nonce     uint64
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+	Gas       uint64
+	To        Address
+	Value     *big.Int
+	Data      []byte
+
+	// signature is R || S || V with the recovery id V in {0, 1}. Nil if not signed yet.
+	signature []byte
+}
+
+// Dynamic returns whether the tx is an EIP-1559 transaction.
+func (tx *Transaction) Dynamic() bool {
+	return tx.GasTipCap != nil
+}
+
+// MaxFee returns the maximum fee paid by the tx.
+func (tx *Transaction) MaxFee() *big.Int {
+	gasPrice := tx.GasPrice
+	if tx.Dynamic() {
+		gasPrice = tx.GasFeeCap
+	}
+	return new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(tx.Gas))
+}
+
+func (tx *Transaction) fields() []interface{} {
+	if tx.Dynamic() {
+		return []interface{}{
+			tx.ChainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.Gas, tx.To[:], tx.Value, tx.Data,
+			[]interface{}{}, // access list
+		}
+	}
+	return []interface{}{tx.Nonce, tx.GasPrice, tx.Gas, tx.To[:], tx.Value, tx.Data}
+}
+
+// SigningHash returns the hash to be signed by the sender.
+func (tx *Transaction) SigningHash() []byte {
+	if tx.Dynamic() {
+		return keccak256([]byte{dynamicFeeTxType}, rlpEncode(tx.fields()))
+	}
+	return keccak256(rlpEncode(append(tx.fields(), tx.ChainID, uint64(0), uint64(0))))
+}
+
+// SetSignature sets the signature of the SigningHash(), encoded as R || S || V with the
+// recovery id V in {0, 1}.
+func (tx *Transaction) SetSignature(signature []byte) error {
+	if len(signature) != 65 || signature[64] > 1 {
+		return errp.New("invalid signature")
+	}
+	tx.signature = append([]byte{}, signature...)
+	return nil
+}
+
+// RawBytes returns the serialized signed tx, as broadcast to the network.
+func (tx *Transaction) RawBytes() ([]byte, error) {
+	if tx.signature == nil {
+		return nil, errp.New("the transaction is not signed")
+	}
+	r := new(big.Int).SetBytes(tx.signature[:32])
+	s := new(big.Int).SetBytes(tx.signature[32:64])
+	recoveryID := uint64(tx.signature[64])
+	if tx.Dynamic() {
+		return append(
+			[]byte{dynamicFeeTxType},
+			rlpEncode(append(tx.fields(), recoveryID, r, s))...), nil
+	}
+	// EIP-155: v = recoveryID + chainID * 2 + 35.
+	v := new(big.Int).Mul(tx.ChainID, big.NewInt(2))
+	v.Add(v, new(big.Int).SetUint64(recoveryID+35))
+	return rlpEncode(append(tx.fields(), v, r, s)), nil
+}
+
+// Hash returns the tx hash of the signed tx, with 0x prefix.
+func (tx *Transaction) Hash() (string, error) {
+	rawBytes, err := tx.RawBytes()
+	if err != nil {
+		return "", err
+	}
+	return "0x" + hex.EncodeToString(keccak256(rawBytes)), nil
+}
+
+// Sender recovers the address of the signer of the tx.
+func (tx *Transaction) Sender() (Address, error) {
+	if tx.signature == nil {
+		return Address{}, errp.New("the transaction is not signed")
+	}
+	compact := append([]byte{27 + tx.signature[64]}, tx.signature[:64]...)
+	publicKey, _, err := btcec.RecoverCompact(btcec.S256(), compact, tx.SigningHash())
+	if err != nil {
+		return Address{}, errp.WithStack(err)
+	}
+	return PubkeyToAddress(publicKey), nil
+}
+
+// DecodeTransaction decodes a signed tx serialized by RawBytes().
+func DecodeTransaction(rawTx []byte) (*Transaction, error) {
+	dynamic := len(rawTx) > 0 && rawTx[0] == dynamicFeeTxType
+	if dynamic {
+		rawTx = rawTx[1:]
+	}
+	decoded, err := rlpDecode(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := decoded.([]interface{})
+	numFields := 9
+	if dynamic {
+		numFields = 12
+	}
+	if !ok || len(fields) != numFields {
+		return nil, errp.New("invalid transaction")
+	}
+	strings := make([][]byte, len(fields))
+	for index, field := range fields {
+		// Only the access list of dynamic fee txs is a list, which must be empty.
+		if list, isList := field.([]interface{}); isList {
+			if !dynamic || index != 8 || len(list) != 0 {
+				return nil, errp.New("invalid transaction")
+			}
+			continue
+		}
+		strings[index] = field.([]byte)
+	}
+	integer := func(index int) *big.Int { return new(big.Int).SetBytes(strings[index]) }
+	tx := &Transaction{}
+	var to []byte
+	var v *big.Int
+	if dynamic {
+		tx.ChainID = integer(0)
+		tx.Nonce = integer(1).Uint64()
+		tx.GasTipCap, tx.GasFeeCap = integer(2), integer(3)
+		tx.Gas = integer(4).Uint64()
+		to, tx.Value, tx.Data = strings[5], integer(6), strings[7]
+		v = integer(9)
+	} else {
+		tx.Nonce = integer(0).Uint64()
+		tx.GasPrice = integer(1)
+		tx.Gas = integer(2).Uint64()
+		to, tx.Value, tx.Data = strings[3], integer(4), strings[5]
+		// EIP-155: v = recoveryID + chainID * 2 + 35.
+		v = integer(6)
+		if v.Cmp(big.NewInt(35)) < 0 {
+			return nil, errp.New("transaction without replay protection")
+		}
+		v.Sub(v, big.NewInt(35))
+		tx.ChainID = new(big.Int).Rsh(v, 1)
+		v = big.NewInt(int64(v.Bit(0)))
+	}
+	if len(to) != len(tx.To) {
+		return nil, errp.New("contract creations are not supported")
+	}
+	copy(tx.To[:], to)
+	if v.Cmp(big.NewInt(1)) > 0 {
+		return nil, errp.New("invalid recovery id")
+	}
+	r, s := strings[numFields-2], strings[numFields-1]
+	if len(r) > 32 || len(s) > 32 {
+		return nil, errp.New("invalid signature")
+	}
+	signature := make([]byte, 65)
+	copy(signature[32-len(r):32], r)
+	copy(signature[64-len(s):64], s)
+	signature[64] = byte(v.Uint64())
+	tx.signature = signature
+	return tx, nil
+}
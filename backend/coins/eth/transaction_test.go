@@ -0,0 +1,156 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth_test
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stretchr/testify/require"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+)
+
+func mustDecodeHex(hexString string) []byte {
+	decoded, err := hex.DecodeString(hexString)
+	if err != nil {
+		panic(err)
+	}
+	return decoded
+}
+
+// TestEIP155 uses the example of https://github.com/ethereum/EIPs/blob/master/EIPS/eip-155.md.
+func TestEIP155(t *testing.T) {
+	to, err := eth.ParseAddress("0x3535353535353535353535353535353535353535")
+	require.NoError(t, err)
+	tx := &eth.Transaction{
+		ChainID:  big.NewInt(1),
+		Nonce:    9,
+		GasPrice: big.NewInt(20000000000),
+		Gas:      21000,
+		To:       to,
+		Value:    big.NewInt(1000000000000000000),
+	}
+	require.Equal(t,
+		"daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53",
+		hex.EncodeToString(tx.SigningHash()))
+
+	_, err = tx.RawBytes()
+	require.Error(t, err)
+
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), mustDecodeHex(
+		"4646464646464646464646464646464646464646464646464646464646464646"))
+	signature, err := eth.SignHash(privateKey, tx.SigningHash())
+	require.NoError(t, err)
+	require.NoError(t, tx.SetSignature(signature))
+	rawBytes, err := tx.RawBytes()
+	require.NoError(t, err)
+	require.Equal(t,
+		"f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a7640000"+
+			"8025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f"+
+			"761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+		hex.EncodeToString(rawBytes))
+
+	decoded, err := eth.DecodeTransaction(rawBytes)
+	require.NoError(t, err)
+	require.Equal(t, tx.ChainID, decoded.ChainID)
+	require.Equal(t, tx.Value, decoded.Value)
+	decodedRawBytes, err := decoded.RawBytes()
+	require.NoError(t, err)
+	require.Equal(t, rawBytes, decodedRawBytes)
+	sender, err := decoded.Sender()
+	require.NoError(t, err)
+	require.Equal(t, "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F", sender.Hex())
+}
+
+func TestDynamicFeeTransaction(t *testing.T) {
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), mustDecodeHex(
+		"4646464646464646464646464646464646464646464646464646464646464646"))
+	tx := &eth.Transaction{
+		ChainID:   big.NewInt(11155111),
+		Nonce:     1,
+		GasTipCap: big.NewInt(2000000000),
+		GasFeeCap: big.NewInt(30000000000),
+		Gas:       21000,
+		To:        eth.PubkeyToAddress(privateKey.PubKey()),
+		Value:     big.NewInt(1),
+	}
+	require.True(t, tx.Dynamic())
+	require.Equal(t, big.NewInt(630000000000000), tx.MaxFee())
+	signature, err := eth.SignHash(privateKey, tx.SigningHash())
+	require.NoError(t, err)
+	require.NoError(t, tx.SetSignature(signature))
+	rawBytes, err := tx.RawBytes()
+	require.NoError(t, err)
+	// EIP-2718 typed transaction envelope.
+	require.Equal(t, byte(0x02), rawBytes[0])
+	// The sender can be recovered from the signature.
+	sender, err := tx.Sender()
+	require.NoError(t, err)
+	require.Equal(t, tx.To, sender)
+
+	decoded, err := eth.DecodeTransaction(rawBytes)
+	require.NoError(t, err)
+	require.Equal(t, tx.ChainID, decoded.ChainID)
+	require.Equal(t, tx.Value, decoded.Value)
+	decodedRawBytes, err := decoded.RawBytes()
+	require.NoError(t, err)
+	require.Equal(t, rawBytes, decodedRawBytes)
+	hash, err := tx.Hash()
+	require.NoError(t, err)
+	require.Len(t, hash, 66)
+}
+
+// TestTxProposalSetSignatures checks that the recovery id, which a keystore signature does not
+// carry, is recovered from the sender.
+func TestTxProposalSetSignatures(t *testing.T) {
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), mustDecodeHex(
+		"4646464646464646464646464646464646464646464646464646464646464646"))
+	to, err := eth.ParseAddress("0x3535353535353535353535353535353535353535")
+	require.NoError(t, err)
+	txProposal := &eth.TxProposal{
+		From: eth.PubkeyToAddress(privateKey.PubKey()),
+		Tx: &eth.Transaction{
+			ChainID:  big.NewInt(1),
+			Nonce:    9,
+			GasPrice: big.NewInt(20000000000),
+			Gas:      21000,
+			To:       to,
+			Value:    big.NewInt(1000000000000000000),
+		},
+	}
+	signatureHashes, err := txProposal.SignatureHashes()
+	require.NoError(t, err)
+	require.Len(t, signatureHashes, 1)
+	require.Equal(t, txProposal.Tx.SigningHash(), signatureHashes[0].Hash)
+	signature, err := privateKey.Sign(signatureHashes[0].Hash)
+	require.NoError(t, err)
+
+	require.Error(t, txProposal.SetSignatures(0, nil))
+	require.NoError(t, txProposal.SetSignatures(0, []*btcec.Signature{signature}))
+	rawBytes, err := txProposal.Tx.RawBytes()
+	require.NoError(t, err)
+	// Same as in TestEIP155, as both signatures are deterministic (RFC6979).
+	require.Equal(t,
+		"f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a7640000"+
+			"8025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f"+
+			"761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+		hex.EncodeToString(rawBytes))
+
+	txProposal.From = to
+	require.Error(t, txProposal.SetSignatures(0, []*btcec.Signature{signature}))
+}
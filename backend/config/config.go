@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
@@ -27,6 +28,37 @@ import (
 // CoinConfig holds configurations specific to a coin.
 type CoinConfig struct {
 	ElectrumServers []*rpc.ServerInfo `json:"electrumServers"`
+	// ConsistencyCheck enables cross-checking address histories and fee estimates against a
+	// second server. Requires at least two ElectrumServers.
+	ConsistencyCheck bool `json:"consistencyCheck"`
+	// DustThreshold is the value in the smallest unit of the coin, e.g. satoshi, below which
+	// incoming outputs are quarantined and not spent automatically. The value depends on the coin
+	// and its fee level, which is why the quarantine is disabled (0) by default.
+	DustThreshold int64 `json:"dustThreshold"`
+}
+
+// RPCBatchingConfig configures how the requests to the Electrum servers are combined into batch
+// requests. See rpc.BatchConfig.
+type RPCBatchingConfig struct {
+	// WindowMillis is how long a request is held back to be combined with following requests.
+	WindowMillis int `json:"windowMillis"`
+	MaxBatchSize int `json:"maxBatchSize"`
+	MaxInFlight  int `json:"maxInFlight"`
+}
+
+// BatchConfig converts the config to the configuration of the RPC client.
+func (config RPCBatchingConfig) BatchConfig() rpc.BatchConfig {
+	return rpc.BatchConfig{
+		Window:       time.Duration(config.WindowMillis) * time.Millisecond,
+		MaxBatchSize: config.MaxBatchSize,
+		MaxInFlight:  config.MaxInFlight,
+	}
+}
+
+// ETHConfig holds configurations specific to Ethereum.
+type ETHConfig struct {
+	// NodeURL is the URL of the JSON-RPC API of the Ethereum node.
+	NodeURL string `json:"nodeURL"`
 }
 
 // Backend holds the backend specific configuration.
@@ -36,11 +68,30 @@ type Backend struct {
 	BitcoinP2WPKHActive      bool `json:"bitcoinP2WPKHActive"`
 	LitecoinP2WPKHP2SHActive bool `json:"litecoinP2WPKHP2SHActive"`
 	LitecoinP2WPKHActive     bool `json:"litecoinP2WPKHActive"`
+	EthereumActive           bool `json:"ethereumActive"`
+	BitcoinCashActive        bool `json:"bitcoinCashActive"`
+	DogecoinActive           bool `json:"dogecoinActive"`
 
 	BTC  CoinConfig `json:"btc"`
 	TBTC CoinConfig `json:"tbtc"`
 	LTC  CoinConfig `json:"ltc"`
 	TLTC CoinConfig `json:"tltc"`
+	ETH  ETHConfig  `json:"eth"`
+	TETH ETHConfig  `json:"teth"`
+	// There are no default Electrum servers for Bitcoin Cash and Dogecoin. They have to be
+	// configured before activating the accounts.
+	BCH   CoinConfig `json:"bch"`
+	TBCH  CoinConfig `json:"tbch"`
+	DOGE  CoinConfig `json:"doge"`
+	TDOGE CoinConfig `json:"tdoge"`
+
+	// FiatRateTolerance is the relative change of the exchange rate, e.g. 0.02 for 2%, up to which
+	// a fiat amount is still sent at the rate shown in the proposal.
+	FiatRateTolerance float64 `json:"fiatRateTolerance"`
+
+	// RPCBatching configures the request batching of all Electrum connections. If nil, the
+	// defaults of the JSON-RPC client are used.
+	RPCBatching *RPCBatchingConfig `json:"rpcBatching"`
 }
 
 // AccountActive returns the Active setting for a coin by code.
@@ -56,6 +107,12 @@ func (backend Backend) AccountActive(code string) bool {
 		return backend.LitecoinP2WPKHP2SHActive
 	case "tltc-p2wpkh", "ltc-p2wpkh":
 		return backend.LitecoinP2WPKHActive
+	case "teth", "eth", "reth":
+		return backend.EthereumActive
+	case "tbch-p2pkh", "bch-p2pkh":
+		return backend.BitcoinCashActive
+	case "tdoge-p2pkh", "doge-p2pkh":
+		return backend.DogecoinActive
 	default:
 		panic(fmt.Sprintf("unknown code %s", code))
 	}
@@ -114,6 +171,10 @@ func NewDefaultConfig() AppConfig {
 			BitcoinP2WPKHActive:      false,
 			LitecoinP2WPKHP2SHActive: true,
 			LitecoinP2WPKHActive:     false,
+			EthereumActive:           false,
+			BitcoinCashActive:        false,
+			DogecoinActive:           false,
+			FiatRateTolerance:        0.02,
 			BTC: CoinConfig{
 				ElectrumServers: []*rpc.ServerInfo{
 					{
@@ -170,6 +231,12 @@ func NewDefaultConfig() AppConfig {
 					},
 				},
 			},
+			ETH: ETHConfig{
+				NodeURL: "https://cloudflare-eth.com",
+			},
+			TETH: ETHConfig{
+				NodeURL: "https://rpc.sepolia.org",
+			},
 		},
 	}
 }
@@ -125,6 +125,22 @@ func (tx *Tx) PutHeader(tip int, header *wire.BlockHeader) error {
 	return tx.PutTip(tip)
 }
 
+// PutHeaderBelowTip implements headers.DBTxInterface.
+func (tx *Tx) PutHeaderBelowTip(height int, header *wire.BlockHeader) error {
+	tip, err := tx.Tip()
+	if err != nil {
+		return err
+	}
+	if height > tip {
+		return errp.Newf("height %d is above the tip %d", height, tip)
+	}
+	var headerSer bytes.Buffer
+	if err := header.Serialize(&headerSer); err != nil {
+		return errp.WithStack(err)
+	}
+	return tx.bucketHeaders.Put(serInt(height), headerSer.Bytes())
+}
+
 // HeaderByHeight implements headers.DBTxInterface.
 func (tx *Tx) HeaderByHeight(height int) (*wire.BlockHeader, error) {
 	tip, err := tx.Tip()
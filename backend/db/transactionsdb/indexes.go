@@ -0,0 +1,136 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactionsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	bbolt "github.com/coreos/bbolt"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// The secondary indexes map the header timestamp and the tx ID (hex) to the txs, so that txs can be
+// searched without loading all of them:
+//
+// - bucketTxsByTime: <8 bytes big endian unix timestamp><tx hash> => nil, for verified txs.
+// - bucketTxIDs: <tx ID in hex> => nil, for all txs.
+
+// timeIndexKey returns the key of the tx in the time index. Timestamps before 1970 are clamped to
+// the unix epoch, which no block header precedes, so that they do not wrap around.
+func timeIndexKey(timestamp time.Time, txHash chainhash.Hash) []byte {
+	unix := timestamp.Unix()
+	if unix < 0 {
+		unix = 0
+	}
+	key := make([]byte, 8+chainhash.HashSize)
+	binary.BigEndian.PutUint64(key, uint64(unix))
+	copy(key[8:], txHash[:])
+	return key
+}
+
+// indexTx adds the tx to the secondary indexes.
+func (tx *Tx) indexTx(txHash chainhash.Hash, walletTx *walletTransaction) error {
+	if err := tx.bucketTxIDs.Put([]byte(txHash.String()), nil); err != nil {
+		return errp.WithStack(err)
+	}
+	if walletTx.HeaderTimestamp != nil {
+		key := timeIndexKey(*walletTx.HeaderTimestamp, txHash)
+		if err := tx.bucketTxsByTime.Put(key, nil); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// unindexTx removes the tx from the secondary indexes.
+func (tx *Tx) unindexTx(txHash chainhash.Hash, walletTx *walletTransaction) error {
+	if err := tx.bucketTxIDs.Delete([]byte(txHash.String())); err != nil {
+		return errp.WithStack(err)
+	}
+	if walletTx.HeaderTimestamp != nil {
+		key := timeIndexKey(*walletTx.HeaderTimestamp, txHash)
+		if err := tx.bucketTxsByTime.Delete(key); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// buildIndexes creates the secondary indexes of databases created before they existed.
+func buildIndexes(boltTx *bbolt.Tx) error {
+	if boltTx.Bucket([]byte(bucketTxIDs)) != nil {
+		return nil
+	}
+	bucketTxIDs, err := boltTx.CreateBucket([]byte(bucketTxIDs))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	bucketTxsByTime, err := boltTx.CreateBucketIfNotExists([]byte(bucketTxsByTime))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	bucketTransactions := boltTx.Bucket([]byte(bucketTransactions))
+	if bucketTransactions == nil {
+		return nil
+	}
+	tx := &Tx{tx: boltTx, bucketTxIDs: bucketTxIDs, bucketTxsByTime: bucketTxsByTime}
+	return bucketTransactions.ForEach(func(key []byte, _ []byte) error {
+		var txHash chainhash.Hash
+		if err := txHash.SetBytes(key); err != nil {
+			return errp.WithStack(err)
+		}
+		walletTx := newWalletTransaction()
+		if _, err := readJSON(bucketTransactions, key, walletTx); err != nil {
+			return err
+		}
+		return tx.indexTx(txHash, walletTx)
+	})
+}
+
+// TxsByTime implements transactions.DBTxInterface.
+func (tx *Tx) TxsByTime(from, to time.Time) ([]chainhash.Hash, error) {
+	result := []chainhash.Hash{}
+	end := timeIndexKey(to, chainhash.Hash{})[:8]
+	cursor := tx.bucketTxsByTime.Cursor()
+	for key, _ := cursor.Seek(timeIndexKey(from, chainhash.Hash{})); key != nil &&
+		bytes.Compare(key[:8], end) < 0; key, _ = cursor.Next() {
+		var txHash chainhash.Hash
+		if err := txHash.SetBytes(key[8:]); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		result = append(result, txHash)
+	}
+	return result, nil
+}
+
+// TxsByIDPrefix implements transactions.DBTxInterface.
+func (tx *Tx) TxsByIDPrefix(prefix string) ([]chainhash.Hash, error) {
+	prefixBytes := []byte(strings.ToLower(prefix))
+	result := []chainhash.Hash{}
+	cursor := tx.bucketTxIDs.Cursor()
+	for key, _ := cursor.Seek(prefixBytes); key != nil &&
+		bytes.HasPrefix(key, prefixBytes); key, _ = cursor.Next() {
+		txHash, err := chainhash.NewHashFromStr(string(key))
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		result = append(result, *txHash)
+	}
+	return result, nil
+}
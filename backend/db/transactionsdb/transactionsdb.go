@@ -33,6 +33,12 @@ const (
 	bucketInputs                 = "inputs"
 	bucketOutputs                = "outputs"
 	bucketAddressHistories       = "addressHistories"
+	bucketLocalTransactions      = "localTransactions"
+	bucketFrozenOutputs          = "frozenOutputs"
+	bucketReleasedOutputs        = "releasedOutputs"
+	bucketDisplayedAddresses     = "displayedAddresses"
+	bucketTxsByTime              = "txsByTime"
+	bucketTxIDs                  = "txIDs"
 )
 
 // DB is a bbolt key/value database.
@@ -46,6 +52,9 @@ func NewDB(filename string) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := db.Update(buildIndexes); err != nil {
+		return nil, err
+	}
 	return &DB{db: db}, nil
 }
 
@@ -75,6 +84,30 @@ func (db *DB) Begin() (transactions.DBTxInterface, error) {
 	if err != nil {
 		return nil, err
 	}
+	bucketLocalTransactions, err := tx.CreateBucketIfNotExists([]byte(bucketLocalTransactions))
+	if err != nil {
+		return nil, err
+	}
+	bucketFrozenOutputs, err := tx.CreateBucketIfNotExists([]byte(bucketFrozenOutputs))
+	if err != nil {
+		return nil, err
+	}
+	bucketReleasedOutputs, err := tx.CreateBucketIfNotExists([]byte(bucketReleasedOutputs))
+	if err != nil {
+		return nil, err
+	}
+	bucketDisplayedAddresses, err := tx.CreateBucketIfNotExists([]byte(bucketDisplayedAddresses))
+	if err != nil {
+		return nil, err
+	}
+	bucketTxsByTime, err := tx.CreateBucketIfNotExists([]byte(bucketTxsByTime))
+	if err != nil {
+		return nil, err
+	}
+	bucketTxIDs, err := tx.CreateBucketIfNotExists([]byte(bucketTxIDs))
+	if err != nil {
+		return nil, err
+	}
 	return &Tx{
 		tx:                           tx,
 		bucketTransactions:           bucketTransactions,
@@ -82,6 +115,12 @@ func (db *DB) Begin() (transactions.DBTxInterface, error) {
 		bucketInputs:                 bucketInputs,
 		bucketOutputs:                bucketOutputs,
 		bucketAddressHistories:       bucketAddressHistories,
+		bucketLocalTransactions:      bucketLocalTransactions,
+		bucketFrozenOutputs:          bucketFrozenOutputs,
+		bucketReleasedOutputs:        bucketReleasedOutputs,
+		bucketDisplayedAddresses:     bucketDisplayedAddresses,
+		bucketTxsByTime:              bucketTxsByTime,
+		bucketTxIDs:                  bucketTxIDs,
 	}, nil
 }
 
@@ -99,6 +138,12 @@ type Tx struct {
 	bucketInputs                 *bbolt.Bucket
 	bucketOutputs                *bbolt.Bucket
 	bucketAddressHistories       *bbolt.Bucket
+	bucketLocalTransactions      *bbolt.Bucket
+	bucketFrozenOutputs          *bbolt.Bucket
+	bucketReleasedOutputs        *bbolt.Bucket
+	bucketDisplayedAddresses     *bbolt.Bucket
+	bucketTxsByTime              *bbolt.Bucket
+	bucketTxIDs                  *bbolt.Bucket
 }
 
 // Rollback implements transactions.DBTxInterface.
@@ -143,12 +188,23 @@ func writeJSON(bucket *bbolt.Bucket, key []byte, value interface{}) error {
 	return bucket.Put(key, jsonBytes)
 }
 
+// modifyTx modifies the stored tx, keeping the secondary indexes up to date.
 func (tx *Tx) modifyTx(key []byte, f func(value *walletTransaction)) error {
+	var txHash chainhash.Hash
+	if err := txHash.SetBytes(key); err != nil {
+		return errp.WithStack(err)
+	}
 	walletTx := newWalletTransaction()
 	if _, err := readJSON(tx.bucketTransactions, key, walletTx); err != nil {
 		return err
 	}
+	if err := tx.unindexTx(txHash, walletTx); err != nil {
+		return err
+	}
 	f(walletTx)
+	if err := tx.indexTx(txHash, walletTx); err != nil {
+		return err
+	}
 	return writeJSON(tx.bucketTransactions, key, walletTx)
 }
 
@@ -185,6 +241,13 @@ func (tx *Tx) PutTx(txHash chainhash.Hash, msgTx *wire.MsgTx, height int) error
 // DeleteTx implements transactions.DBTxInterface. It panics if called from a read-only db
 // transaction.
 func (tx *Tx) DeleteTx(txHash chainhash.Hash) {
+	walletTx := newWalletTransaction()
+	if _, err := readJSON(tx.bucketTransactions, txHash[:], walletTx); err != nil {
+		panic(err)
+	}
+	if err := tx.unindexTx(txHash, walletTx); err != nil {
+		panic(errp.WithStack(err))
+	}
 	if err := tx.bucketTransactions.Delete(txHash[:]); err != nil {
 		panic(errp.WithStack(err))
 	}
@@ -242,23 +305,72 @@ func (tx *Tx) MarkTxVerified(txHash chainhash.Hash, headerTimestamp time.Time) e
 	})
 }
 
+// UnmarkTxVerified implements transactions.DBTxInterface.
+func (tx *Tx) UnmarkTxVerified(txHash chainhash.Hash) error {
+	if err := tx.bucketUnverifiedTransactions.Put(txHash[:], nil); err != nil {
+		return errp.WithStack(err)
+	}
+	return tx.modifyTx(txHash[:], func(walletTx *walletTransaction) {
+		walletTx.Verified = nil
+		walletTx.HeaderTimestamp = nil
+	})
+}
+
 // PutInput implements transactions.DBTxInterface.
 func (tx *Tx) PutInput(outPoint wire.OutPoint, txHash chainhash.Hash) error {
-	return tx.bucketInputs.Put([]byte(outPoint.String()), txHash[:])
+	spenders, err := tx.Inputs(outPoint)
+	if err != nil {
+		return err
+	}
+	for _, spender := range spenders {
+		if spender == txHash {
+			return nil
+		}
+	}
+	return tx.putInputs(outPoint, append(spenders, txHash))
 }
 
-// Input implements transactions.DBTxInterface.
-func (tx *Tx) Input(outPoint wire.OutPoint) (*chainhash.Hash, error) {
-	if value := tx.bucketInputs.Get([]byte(outPoint.String())); value != nil {
-		return chainhash.NewHash(value)
+// putInputs stores the spenders of an output as concatenated hashes. A single spender is stored
+// the same way as before multiple spenders were recorded.
+func (tx *Tx) putInputs(outPoint wire.OutPoint, spenders []chainhash.Hash) error {
+	key := []byte(outPoint.String())
+	if len(spenders) == 0 {
+		return tx.bucketInputs.Delete(key)
+	}
+	value := make([]byte, 0, len(spenders)*chainhash.HashSize)
+	for _, spender := range spenders {
+		value = append(value, spender[:]...)
 	}
-	return nil, nil
+	return tx.bucketInputs.Put(key, value)
+}
+
+// Inputs implements transactions.DBTxInterface.
+func (tx *Tx) Inputs(outPoint wire.OutPoint) ([]chainhash.Hash, error) {
+	value := tx.bucketInputs.Get([]byte(outPoint.String()))
+	if len(value)%chainhash.HashSize != 0 {
+		return nil, errp.Newf("invalid input entry for %s", outPoint)
+	}
+	spenders := make([]chainhash.Hash, len(value)/chainhash.HashSize)
+	for i := range spenders {
+		copy(spenders[i][:], value[i*chainhash.HashSize:])
+	}
+	return spenders, nil
 }
 
 // DeleteInput implements transactions.DBTxInterface. It panics if called from a read-only db
 // transaction.
-func (tx *Tx) DeleteInput(outPoint wire.OutPoint) {
-	if err := tx.bucketInputs.Delete([]byte(outPoint.String())); err != nil {
+func (tx *Tx) DeleteInput(outPoint wire.OutPoint, txHash chainhash.Hash) {
+	spenders, err := tx.Inputs(outPoint)
+	if err != nil {
+		panic(err)
+	}
+	remaining := []chainhash.Hash{}
+	for _, spender := range spenders {
+		if spender != txHash {
+			remaining = append(remaining, spender)
+		}
+	}
+	if err := tx.putInputs(outPoint, remaining); err != nil {
 		panic(errp.WithStack(err))
 	}
 }
@@ -318,3 +430,111 @@ func (tx *Tx) AddressHistory(scriptHashHex blockchain.ScriptHashHex) (blockchain
 	_, err := readJSON(tx.bucketAddressHistories, []byte(string(scriptHashHex)), &history)
 	return history, err
 }
+
+// PutLocalTx implements transactions.DBTxInterface.
+func (tx *Tx) PutLocalTx(txHash chainhash.Hash, localTx *transactions.LocalTx) error {
+	return writeJSON(tx.bucketLocalTransactions, txHash[:], localTx)
+}
+
+// LocalTx implements transactions.DBTxInterface.
+func (tx *Tx) LocalTx(txHash chainhash.Hash) (*transactions.LocalTx, error) {
+	localTx := &transactions.LocalTx{}
+	found, err := readJSON(tx.bucketLocalTransactions, txHash[:], localTx)
+	if err != nil || !found {
+		return nil, err
+	}
+	return localTx, nil
+}
+
+// LocalTxs implements transactions.DBTxInterface.
+func (tx *Tx) LocalTxs() (map[chainhash.Hash]*transactions.LocalTx, error) {
+	txHashes, err := getTransactions(tx.bucketLocalTransactions)
+	if err != nil {
+		return nil, err
+	}
+	result := map[chainhash.Hash]*transactions.LocalTx{}
+	for _, txHash := range txHashes {
+		localTx, err := tx.LocalTx(txHash)
+		if err != nil {
+			return nil, err
+		}
+		result[txHash] = localTx
+	}
+	return result, nil
+}
+
+// DeleteLocalTx implements transactions.DBTxInterface. It panics if called from a read-only db
+// transaction.
+func (tx *Tx) DeleteLocalTx(txHash chainhash.Hash) {
+	if err := tx.bucketLocalTransactions.Delete(txHash[:]); err != nil {
+		panic(errp.WithStack(err))
+	}
+}
+
+// PutFrozenOutput implements transactions.DBTxInterface.
+func (tx *Tx) PutFrozenOutput(outPoint wire.OutPoint) error {
+	return tx.bucketFrozenOutputs.Put([]byte(outPoint.String()), nil)
+}
+
+func getOutPoints(bucket *bbolt.Bucket) (map[wire.OutPoint]struct{}, error) {
+	result := map[wire.OutPoint]struct{}{}
+	cursor := bucket.Cursor()
+	for outPointBytes, _ := cursor.First(); outPointBytes != nil; outPointBytes, _ = cursor.Next() {
+		outPoint, err := util.ParseOutPoint(outPointBytes)
+		if err != nil {
+			return nil, err
+		}
+		result[*outPoint] = struct{}{}
+	}
+	return result, nil
+}
+
+// FrozenOutputs implements transactions.DBTxInterface.
+func (tx *Tx) FrozenOutputs() (map[wire.OutPoint]struct{}, error) {
+	return getOutPoints(tx.bucketFrozenOutputs)
+}
+
+// DeleteFrozenOutput implements transactions.DBTxInterface. It panics if called from a read-only
+// db transaction.
+func (tx *Tx) DeleteFrozenOutput(outPoint wire.OutPoint) {
+	if err := tx.bucketFrozenOutputs.Delete([]byte(outPoint.String())); err != nil {
+		panic(errp.WithStack(err))
+	}
+}
+
+// PutReleasedOutput implements transactions.DBTxInterface.
+func (tx *Tx) PutReleasedOutput(outPoint wire.OutPoint) error {
+	return tx.bucketReleasedOutputs.Put([]byte(outPoint.String()), nil)
+}
+
+// ReleasedOutputs implements transactions.DBTxInterface.
+func (tx *Tx) ReleasedOutputs() (map[wire.OutPoint]struct{}, error) {
+	return getOutPoints(tx.bucketReleasedOutputs)
+}
+
+// DeleteReleasedOutput implements transactions.DBTxInterface. It panics if called from a read-only
+// db transaction.
+func (tx *Tx) DeleteReleasedOutput(outPoint wire.OutPoint) {
+	if err := tx.bucketReleasedOutputs.Delete([]byte(outPoint.String())); err != nil {
+		panic(errp.WithStack(err))
+	}
+}
+
+// PutAddressDisplayed implements transactions.DBTxInterface.
+func (tx *Tx) PutAddressDisplayed(scriptHashHex blockchain.ScriptHashHex, displayed time.Time) error {
+	return writeJSON(tx.bucketDisplayedAddresses, []byte(string(scriptHashHex)), displayed)
+}
+
+// DisplayedAddresses implements transactions.DBTxInterface.
+func (tx *Tx) DisplayedAddresses() (map[blockchain.ScriptHashHex]time.Time, error) {
+	result := map[blockchain.ScriptHashHex]time.Time{}
+	cursor := tx.bucketDisplayedAddresses.Cursor()
+	for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+		var displayed time.Time
+		if err := json.Unmarshal(value, &displayed); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		result[blockchain.ScriptHashHex(key)] = displayed
+	}
+	return result, nil
+}
@@ -997,7 +997,7 @@ func (dbb *Device) signBatch(
 			return nil, errp.WithMessage(err, "The signing echo from the BitBox was not a string.")
 		}
 		if txProposal.AccountConfiguration.Singlesig() {
-			if err = dbb.channel.SendSigningEcho(signingEcho, txProposal.Coin.Name(), string(txProposal.AccountConfiguration.ScriptType()), transaction); err != nil {
+			if err = dbb.channel.SendSigningEcho(signingEcho, txProposal.Coin.Code(), string(txProposal.AccountConfiguration.ScriptType()), transaction); err != nil {
 				return nil, errp.WithMessage(err, "Could not send the signing echo to the mobile.")
 			}
 		}
@@ -1040,6 +1040,12 @@ func (dbb *Device) signBatch(
 	return reply, nil
 }
 
+// verifiableTransaction is a proposed transaction which the paired mobile app can verify before
+// the BitBox signs it.
+type verifiableTransaction interface {
+	VerificationTxProposal() *maketx.TxProposal
+}
+
 // Sign returns signatures for the provided hashes. The private keys used to sign them are derived
 // using the provided keyPaths.
 func (dbb *Device) Sign(
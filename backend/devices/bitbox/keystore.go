@@ -17,10 +17,10 @@ package bitbox
 import (
 	"fmt"
 
-	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil/hdkeychain"
-	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystoreInterface "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/sirupsen/logrus"
@@ -57,13 +57,19 @@ func (keystore *keystore) HasSecureOutput() bool {
 	return keystore.dbb.channel != nil
 }
 
+// SecureOutputType implements keystore.Keystore. The BitBox has no screen, addresses are shown on
+// the paired mobile app.
+func (keystore *keystore) SecureOutputType() keystoreInterface.SecureOutputType {
+	return keystoreInterface.SecureOutputTypeMobile
+}
+
 // OutputAddress implements keystore.Keystore.
 func (keystore *keystore) OutputAddress(
 	keyPath signing.AbsoluteKeypath, scriptType signing.ScriptType, coin coin.Coin) error {
 	if !keystore.HasSecureOutput() {
 		panic("HasSecureOutput must be true")
 	}
-	return keystore.dbb.DisplayAddress(keyPath.Encode(), fmt.Sprintf("%s-%s", coin.Name(), string(scriptType)))
+	return keystore.dbb.DisplayAddress(keyPath.Encode(), fmt.Sprintf("%s-%s", coin.Code(), string(scriptType)))
 }
 
 // ExtendedPublicKey implements keystore.Keystore.
@@ -74,57 +80,28 @@ func (keystore *keystore) ExtendedPublicKey(
 
 // SignTransaction implements keystore.Keystore.
 func (keystore *keystore) SignTransaction(proposedTx coin.ProposedTransaction) error {
-	btcProposedTx, ok := proposedTx.(*btc.ProposedTransaction)
+	verifiableTx, ok := proposedTx.(verifiableTransaction)
 	if !ok {
-		panic("only btc")
+		return errp.New("The BitBox can only sign Bitcoin-based transactions.")
 	}
 	keystore.log.Info("Sign transaction")
-	signatureHashes := [][]byte{}
-	keyPaths := []string{}
-	transaction := btcProposedTx.TXProposal.Transaction
-	for index, txIn := range transaction.TxIn {
-		spentOutput, ok := btcProposedTx.PreviousOutputs[txIn.PreviousOutPoint]
-		if !ok {
-			keystore.log.Panic("There needs to be exactly one output being spent per input!")
-		}
-		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
-		isSegwit, subScript := address.ScriptForHashToSign()
-		var signatureHash []byte
-		if isSegwit {
-			var err error
-			signatureHash, err = txscript.CalcWitnessSigHash(subScript, btcProposedTx.SigHashes,
-				txscript.SigHashAll, transaction, index, spentOutput.Value)
-			if err != nil {
-				return errp.Wrap(err, "Failed to calculate SegWit signature hash")
-			}
-			keystore.log.Debug("Calculated segwit signature hash")
-		} else {
-			var err error
-			signatureHash, err = txscript.CalcSignatureHash(
-				subScript, txscript.SigHashAll, transaction, index)
-			if err != nil {
-				return errp.Wrap(err, "Failed to calculate legacy signature hash")
-			}
-			keystore.log.Debug("Calculated legacy signature hash")
-		}
-
-		signatureHashes = append(signatureHashes, signatureHash)
-		keyPaths = append(keyPaths, address.Configuration.AbsoluteKeypath().Encode())
-
-		// Special serialization of the unsigned transaction for the mobile verification app.
-		txIn.SignatureScript = subScript
+	signatureHashes, err := proposedTx.SignatureHashes()
+	if err != nil {
+		return err
 	}
-
-	signatures, err := keystore.dbb.Sign(btcProposedTx.TXProposal, signatureHashes, keyPaths)
+	hashes := make([][]byte, len(signatureHashes))
+	keyPaths := make([]string, len(signatureHashes))
+	for i, signatureHash := range signatureHashes {
+		hashes[i] = signatureHash.Hash
+		keyPaths[i] = signatureHash.Keypath.Encode()
+	}
+	signatures, err := keystore.dbb.Sign(verifiableTx.VerificationTxProposal(), hashes, keyPaths)
 	if err != nil {
 		return errp.WithMessage(err, "Failed to sign signature hash")
 	}
-	if len(signatures) != len(transaction.TxIn) {
-		panic("number of signatures doesn't match number of inputs")
-	}
-	for i, signature := range signatures {
-		signature := signature
-		btcProposedTx.Signatures[i][keystore.CosignerIndex()] = &signature
+	signaturePointers := make([]*btcec.Signature, len(signatures))
+	for i := range signatures {
+		signaturePointers[i] = &signatures[i]
 	}
-	return nil
+	return proposedTx.SetSignatures(keystore.CosignerIndex(), signaturePointers)
 }
@@ -22,6 +22,7 @@ import (
 	"runtime/debug"
 	"strconv"
 
+	"github.com/btcsuite/btcutil"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
@@ -29,14 +30,20 @@ import (
 	"golang.org/x/text/language"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressaudit"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/addressbook"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	accountHandlers "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/handlers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	ethHandlers "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/handlers"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox"
 	bitboxHandlers "github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox/handlers"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/device"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/scheduler"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
@@ -48,13 +55,13 @@ import (
 type Backend interface {
 	Config() *config.Config
 	DefaultConfig() config.AppConfig
-	Coin(string) *btc.Coin
+	Coin(string) coin.Coin
 	WalletStatus() string
 	Testing() bool
-	Accounts() []*btc.Account
+	Accounts() []coin.Account
 	UserLanguage() language.Tag
-	OnWalletInit(f func(*btc.Account))
-	OnWalletUninit(f func(*btc.Account))
+	OnWalletInit(f func(coin.Account))
+	OnWalletUninit(f func(coin.Account))
 	OnDeviceInit(f func(device.Interface))
 	OnDeviceUninit(f func(deviceID string))
 	DevicesRegistered() []string
@@ -65,6 +72,10 @@ type Backend interface {
 	Register(device device.Interface) error
 	Deregister(deviceID string)
 	Rates() map[string]map[string]float64
+	Portfolio(string) *backend.Portfolio
+	AddressBook() *addressbook.AddressBook
+	AddressAudit() *addressaudit.Log
+	Scheduler() *scheduler.Scheduler
 	DownloadCert(string) (string, error)
 	CheckElectrumServer(string, string) error
 }
@@ -142,6 +153,20 @@ func NewHandlers(
 	getAPIRouter(apiRouter)("/wallet-status", handlers.getWalletStatusHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/test/register", handlers.registerTestKeyStoreHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/test/deregister", handlers.deregisterTestKeyStoreHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/portfolio", handlers.getPortfolioHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/address-book", handlers.getAddressBookHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/address-book/add", handlers.postAddressBookAddHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/address-book/update", handlers.postAddressBookUpdateHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/address-book/delete", handlers.postAddressBookDeleteHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/address-audit-log", handlers.getAddressAuditLogHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/address-audit-log/export", handlers.getAddressAuditLogExportHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/scheduled-payments", handlers.getScheduledPaymentsHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/scheduled-payments/add", handlers.postScheduledPaymentAddHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/scheduled-payments/update", handlers.postScheduledPaymentUpdateHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/scheduled-payments/delete", handlers.postScheduledPaymentDeleteHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/scheduled-payments/proposals", handlers.getScheduledPaymentProposalsHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/scheduled-payments/send", handlers.postScheduledPaymentSendHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/scheduled-payments/skip", handlers.postScheduledPaymentSkipHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/coins/rates", handlers.getRatesHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/convertToFiat", handlers.getConvertToFiatHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/convertFromFiat", handlers.getConvertFromFiatHandler).Methods("GET")
@@ -163,19 +188,42 @@ func NewHandlers(
 		if _, ok := accountHandlersMap[accountCode]; !ok {
 			accountHandlersMap[accountCode] = accountHandlers.NewHandlers(getAPIRouter(
 				apiRouter.PathPrefix(fmt.Sprintf("/wallet/%s", accountCode)).Subrouter(),
-			), log)
+			), backend.AddressBook(), backend.AddressAudit(), log)
 		}
 		accHandlers := accountHandlersMap[accountCode]
 		log.WithField("account-handlers", accHandlers).Debug("Account handlers")
 		return accHandlers
 	}
 
-	backend.OnWalletInit(func(account *btc.Account) {
+	ethHandlersMap := map[string]*ethHandlers.Handlers{}
+	getETHHandlers := func(accountCode string) *ethHandlers.Handlers {
+		defer handlersMapLock.Lock()()
+		if _, ok := ethHandlersMap[accountCode]; !ok {
+			ethHandlersMap[accountCode] = ethHandlers.NewHandlers(getAPIRouter(
+				apiRouter.PathPrefix(fmt.Sprintf("/wallet/%s", accountCode)).Subrouter(),
+			), backend.AddressAudit(), log)
+		}
+		return ethHandlersMap[accountCode]
+	}
+
+	backend.OnWalletInit(func(account coin.Account) {
 		log.WithField("code", account.Code()).Debug("Initializing account")
-		getAccountHandlers(account.Code()).Init(account)
+		switch specificAccount := account.(type) {
+		case btc.Interface:
+			getAccountHandlers(account.Code()).Init(specificAccount)
+		case *eth.Account:
+			getETHHandlers(account.Code()).Init(specificAccount)
+		default:
+			log.WithField("code", account.Code()).Error("No handlers for the account type")
+		}
 	})
-	backend.OnWalletUninit(func(account *btc.Account) {
-		getAccountHandlers(account.Code()).Uninit()
+	backend.OnWalletUninit(func(account coin.Account) {
+		switch account.(type) {
+		case btc.Interface:
+			getAccountHandlers(account.Code()).Uninit()
+		case *eth.Account:
+			getETHHandlers(account.Code()).Uninit()
+		}
 	})
 
 	deviceHandlersMap := map[string]*bitboxHandlers.Handlers{}
@@ -286,6 +334,207 @@ func (handlers *Handlers) getRatesHandler(_ *http.Request) (interface{}, error)
 	return handlers.backend.Rates(), nil
 }
 
+func (handlers *Handlers) getPortfolioHandler(r *http.Request) (interface{}, error) {
+	fiat := r.URL.Query().Get("fiat")
+	if fiat == "" {
+		fiat = "USD"
+	}
+	portfolio := handlers.backend.Portfolio(fiat)
+	coins := []map[string]interface{}{}
+	for _, portfolioCoin := range portfolio.Coins {
+		coins = append(coins, map[string]interface{}{
+			"coinCode":   portfolioCoin.Coin.Code(),
+			"balance":    portfolioCoin.Coin.FormatAmountAsJSON(portfolioCoin.Balance),
+			"fiatValue":  strconv.FormatFloat(portfolioCoin.FiatValue, 'f', 2, 64),
+			"allocation": strconv.FormatFloat(portfolioCoin.Allocation, 'f', 2, 64),
+		})
+	}
+	return map[string]interface{}{
+		"fiat":      portfolio.Fiat,
+		"fiatTotal": strconv.FormatFloat(portfolio.FiatTotal, 'f', 2, 64),
+		"coins":     coins,
+		"complete":  portfolio.Complete,
+	}, nil
+}
+
+// getAddressBookHandler returns the saved recipients matching the optional `query` and `coin`
+// query parameters.
+func (handlers *Handlers) getAddressBookHandler(r *http.Request) (interface{}, error) {
+	return handlers.backend.AddressBook().Search(
+		r.URL.Query().Get("query"), r.URL.Query().Get("coin")), nil
+}
+
+func addressBookError(err error) (interface{}, error) {
+	if validationErr, ok := errp.Cause(err).(addressbook.ValidationError); ok {
+		return map[string]interface{}{
+			"success": false,
+			"errMsg":  validationErr.Error(),
+		}, nil
+	}
+	return nil, err
+}
+
+func (handlers *Handlers) postAddressBookAddHandler(r *http.Request) (interface{}, error) {
+	entry := addressbook.Entry{}
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	id, err := handlers.backend.AddressBook().Add(entry)
+	if err != nil {
+		return addressBookError(err)
+	}
+	return map[string]interface{}{"success": true, "id": id}, nil
+}
+
+func (handlers *Handlers) postAddressBookUpdateHandler(r *http.Request) (interface{}, error) {
+	entry := addressbook.Entry{}
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := handlers.backend.AddressBook().Update(entry); err != nil {
+		return addressBookError(err)
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+func (handlers *Handlers) postAddressBookDeleteHandler(r *http.Request) (interface{}, error) {
+	var id string
+	if err := json.NewDecoder(r.Body).Decode(&id); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return nil, handlers.backend.AddressBook().Delete(id)
+}
+
+// getAddressAuditLogHandler returns the log of displayed and verified receive addresses. If the
+// `account` query parameter is set, only the entries of that account are returned. corruptLines
+// are the numbers of the lines of the log which could not be read.
+func (handlers *Handlers) getAddressAuditLogHandler(r *http.Request) (interface{}, error) {
+	entries, corruptLines, err := handlers.backend.AddressAudit().Entries(
+		r.URL.Query().Get("account"))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"entries": entries, "corruptLines": corruptLines}, nil
+}
+
+// getAddressAuditLogExportHandler returns the log as CSV, filtered like
+// getAddressAuditLogHandler.
+func (handlers *Handlers) getAddressAuditLogExportHandler(r *http.Request) (interface{}, error) {
+	csv, corruptLines, err := handlers.backend.AddressAudit().ExportCSV(
+		r.URL.Query().Get("account"))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"csv": csv, "corruptLines": corruptLines}, nil
+}
+
+func (handlers *Handlers) getScheduledPaymentsHandler(_ *http.Request) (interface{}, error) {
+	return handlers.backend.Scheduler().Payments(), nil
+}
+
+func scheduledPaymentError(err error) (interface{}, error) {
+	if validationErr, ok := errp.Cause(err).(scheduler.ValidationError); ok {
+		return map[string]interface{}{
+			"success": false,
+			"errMsg":  validationErr.Error(),
+		}, nil
+	}
+	return nil, err
+}
+
+func (handlers *Handlers) postScheduledPaymentAddHandler(r *http.Request) (interface{}, error) {
+	payment := scheduler.Payment{}
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	id, err := handlers.backend.Scheduler().Add(payment)
+	if err != nil {
+		return scheduledPaymentError(err)
+	}
+	return map[string]interface{}{"success": true, "id": id}, nil
+}
+
+func (handlers *Handlers) postScheduledPaymentUpdateHandler(r *http.Request) (interface{}, error) {
+	payment := scheduler.Payment{}
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := handlers.backend.Scheduler().Update(payment); err != nil {
+		return scheduledPaymentError(err)
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+func (handlers *Handlers) postScheduledPaymentDeleteHandler(r *http.Request) (interface{}, error) {
+	var id string
+	if err := json.NewDecoder(r.Body).Decode(&id); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return nil, handlers.backend.Scheduler().Delete(id)
+}
+
+// getScheduledPaymentProposalsHandler returns the txs proposed for the due payments, with the
+// amounts formatted in the unit of the account.
+func (handlers *Handlers) getScheduledPaymentProposalsHandler(_ *http.Request) (interface{}, error) {
+	coins := map[string]coin.Coin{}
+	for _, account := range handlers.backend.Accounts() {
+		coins[account.Code()] = account.Coin()
+	}
+	result := []map[string]interface{}{}
+	for _, proposal := range handlers.backend.Scheduler().Proposals() {
+		payment, err := handlers.backend.Scheduler().Payment(proposal.PaymentID)
+		if err != nil {
+			// Deleted in the meantime.
+			continue
+		}
+		accountCoin, ok := coins[payment.AccountCode]
+		if !ok {
+			continue
+		}
+		jsonProposal := map[string]interface{}{
+			"payment": payment,
+			"created": proposal.Created,
+			"success": proposal.Error == "",
+			"errMsg":  proposal.Error,
+			"rate":    proposal.Rate,
+		}
+		if proposal.Error == "" {
+			for key, amount := range map[string]btcutil.Amount{
+				"amount": proposal.Amount,
+				"fee":    proposal.Fee,
+				"total":  proposal.Total,
+			} {
+				jsonProposal[key] = accountCoin.FormatAmountAsJSON(coin.NewAmountFromInt64(int64(amount)))
+			}
+		}
+		result = append(result, jsonProposal)
+	}
+	return result, nil
+}
+
+func (handlers *Handlers) postScheduledPaymentSendHandler(r *http.Request) (interface{}, error) {
+	var id string
+	if err := json.NewDecoder(r.Body).Decode(&id); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	err := handlers.backend.Scheduler().Send(id)
+	if bitbox.IsErrorAbort(err) {
+		return map[string]interface{}{"success": false}, nil
+	}
+	if err != nil {
+		return scheduledPaymentError(err)
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+func (handlers *Handlers) postScheduledPaymentSkipHandler(r *http.Request) (interface{}, error) {
+	var id string
+	if err := json.NewDecoder(r.Body).Decode(&id); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return nil, handlers.backend.Scheduler().Skip(id)
+}
+
 func (handlers *Handlers) getConvertToFiatHandler(r *http.Request) (interface{}, error) {
 	from := r.URL.Query().Get("from")
 	to := r.URL.Query().Get("to")
@@ -328,7 +577,11 @@ func (handlers *Handlers) getConvertFromFiatHandler(r *http.Request) (interface{
 
 func (handlers *Handlers) getHeadersStatus(coinCode string) func(*http.Request) (interface{}, error) {
 	return func(_ *http.Request) (interface{}, error) {
-		return handlers.backend.Coin(coinCode).Headers().Status()
+		btcCoin, ok := handlers.backend.Coin(coinCode).(*btc.Coin)
+		if !ok {
+			return nil, errp.Newf("coin %s has no headers", coinCode)
+		}
+		return btcCoin.Headers().Status()
 	}
 }
 
@@ -0,0 +1,96 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/arguments"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/handlers"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+type portfolioCoin struct {
+	coin.Coin
+}
+
+func (portfolioCoin) Code() string { return "tbtc" }
+
+func (portfolioCoin) FormatAmountAsJSON(amount coin.Amount) coin.FormattedAmount {
+	return coin.FormattedAmount{Amount: amount.String(), Unit: "TBTC"}
+}
+
+// portfolioBackend serves a fixed portfolio.
+type portfolioBackend struct {
+	*backend.Backend
+	fiat string
+}
+
+func (b *portfolioBackend) Portfolio(fiat string) *backend.Portfolio {
+	b.fiat = fiat
+	return &backend.Portfolio{
+		Fiat:      fiat,
+		FiatTotal: 1234.5,
+		Coins: []*backend.PortfolioCoin{{
+			Coin:       portfolioCoin{},
+			Balance:    coin.NewAmountFromInt64(100),
+			FiatValue:  1234.5,
+			Allocation: 100,
+		}},
+		Complete: false,
+	}
+}
+
+func TestGetPortfolio(t *testing.T) {
+	portfolioBackend := &portfolioBackend{Backend: backend.NewBackend(arguments.NewArguments(
+		test.TstTempDir("godbb-portfolio-"), false, false, false, false))}
+	router := handlers.NewHandlers(portfolioBackend, handlers.NewConnectionData(8082, "")).Router
+
+	get := func(url string) map[string]interface{} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		result := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		return result
+	}
+
+	require.Equal(t,
+		map[string]interface{}{
+			"fiat":      "EUR",
+			"fiatTotal": "1234.50",
+			"complete":  false,
+			"coins": []interface{}{
+				map[string]interface{}{
+					"coinCode": "tbtc",
+					"balance": map[string]interface{}{
+						"amount": "100", "unit": "TBTC", "conversions": nil,
+					},
+					"fiatValue":  "1234.50",
+					"allocation": "100.00",
+				},
+			},
+		},
+		get("/api/portfolio?fiat=EUR"))
+	require.Equal(t, "EUR", portfolioBackend.fiat)
+
+	// USD is the default.
+	require.Equal(t, "USD", get("/api/portfolio")["fiat"])
+	require.Equal(t, "USD", portfolioBackend.fiat)
+}
@@ -20,6 +20,17 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 )
 
+// SecureOutputType is how a keystore outputs addresses securely. See the SecureOutputType*
+// constants.
+type SecureOutputType string
+
+const (
+	// SecureOutputTypeDevice is the screen of the device.
+	SecureOutputTypeDevice SecureOutputType = "device"
+	// SecureOutputTypeMobile is the mobile app paired with the device.
+	SecureOutputTypeMobile SecureOutputType = "mobile"
+)
+
 // Keystore supports hardened key derivation according to BIP32 and signing of transactions.
 //go:generate mockery -name Keystore
 type Keystore interface {
@@ -38,6 +49,10 @@ type Keystore interface {
 	// This is typically done through a screen on the device or through a paired mobile phone.
 	HasSecureOutput() bool
 
+	// SecureOutputType returns how the keystore outputs addresses securely. Only meaningful if
+	// HasSecureOutput() returns true.
+	SecureOutputType() SecureOutputType
+
 	// OutputAddress outputs the public key at the given absolute keypath for the given coin.
 	// Please note that this is only supported if the keystore has a secure output channel.
 	OutputAddress(signing.AbsoluteKeypath, signing.ScriptType, coin.Coin) error
@@ -39,6 +39,9 @@ type Keystores interface {
 	// keystores that have a secure output.
 	OutputAddress(*signing.Configuration, coin.Coin) error
 
+	// SecureOutputs returns the keystores that have a secure output.
+	SecureOutputs() ([]*SecureOutput, error)
+
 	// SignTransaction signs the given proposed transaction on all keystores.
 	SignTransaction(coin.ProposedTransaction) error
 
@@ -46,6 +49,13 @@ type Keystores interface {
 	Configuration(signing.ScriptType, signing.AbsoluteKeypath, int) (*signing.Configuration, error)
 }
 
+// SecureOutput describes a keystore which has a secure output.
+type SecureOutput struct {
+	// Identifier is the identifier of the keystore, see Keystore.Identifier().
+	Identifier string
+	Type       SecureOutputType
+}
+
 type implementation struct {
 	keystores []Keystore
 }
@@ -118,6 +128,24 @@ func (keystores *implementation) OutputAddress(
 	return nil
 }
 
+// SecureOutputs implements the above interface.
+func (keystores *implementation) SecureOutputs() ([]*SecureOutput, error) {
+	secureOutputs := []*SecureOutput{}
+	for _, keystore := range keystores.keystores {
+		if keystore.HasSecureOutput() {
+			identifier, err := keystore.Identifier()
+			if err != nil {
+				return nil, err
+			}
+			secureOutputs = append(secureOutputs, &SecureOutput{
+				Identifier: identifier,
+				Type:       keystore.SecureOutputType(),
+			})
+		}
+	}
+	return secureOutputs, nil
+}
+
 // SignTransaction implements the above interface.
 func (keystores *implementation) SignTransaction(proposedTransaction coin.ProposedTransaction) error {
 	for _, keystore := range keystores.keystores {
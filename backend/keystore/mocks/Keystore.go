@@ -3,6 +3,7 @@ package mocks
 
 import coin "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 import hdkeychain "github.com/btcsuite/btcutil/hdkeychain"
+import keystore "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 
 import mock "github.com/stretchr/testify/mock"
 import signing "github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
@@ -98,6 +99,20 @@ func (_m *Keystore) OutputAddress(_a0 signing.AbsoluteKeypath, _a1 signing.Scrip
 	return r0
 }
 
+// SecureOutputType provides a mock function with given fields:
+func (_m *Keystore) SecureOutputType() keystore.SecureOutputType {
+	ret := _m.Called()
+
+	var r0 keystore.SecureOutputType
+	if rf, ok := ret.Get(0).(func() keystore.SecureOutputType); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(keystore.SecureOutputType)
+	}
+
+	return r0
+}
+
 // SignTransaction provides a mock function with given fields: _a0
 func (_m *Keystore) SignTransaction(_a0 coin.ProposedTransaction) error {
 	ret := _m.Called(_a0)
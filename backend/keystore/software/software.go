@@ -22,12 +22,11 @@ import (
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/sirupsen/logrus"
 
-	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystoreInterface "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
@@ -87,6 +86,11 @@ func (keystore *Keystore) HasSecureOutput() bool {
 	return false
 }
 
+// SecureOutputType implements keystore.Keystore.
+func (keystore *Keystore) SecureOutputType() keystoreInterface.SecureOutputType {
+	return ""
+}
+
 // OutputAddress implements keystore.Keystore.
 func (keystore *Keystore) OutputAddress(signing.AbsoluteKeypath, signing.ScriptType, coin.Coin) error {
 	return errp.New("The software-based keystore has no secure output to display the address.")
@@ -103,17 +107,10 @@ func (keystore *Keystore) ExtendedPublicKey(
 	return extendedPrivateKey.Neuter()
 }
 
-func (keystore *Keystore) sign(
-	signatureHashes [][]byte,
-	keyPaths []signing.AbsoluteKeypath,
-) ([]btcec.Signature, error) {
-	if len(signatureHashes) != len(keyPaths) {
-		return nil, errp.New("The number of hashes to sign has to be equal to the number of paths.")
-	}
-	len := len(keyPaths)
-	signatures := make([]btcec.Signature, len)
-	for i := 0; i < len; i++ {
-		xprv, err := keyPaths[i].Derive(keystore.master)
+func (keystore *Keystore) sign(signatureHashes []*coin.SignatureHash) ([]*btcec.Signature, error) {
+	signatures := make([]*btcec.Signature, len(signatureHashes))
+	for i, signatureHash := range signatureHashes {
+		xprv, err := signatureHash.Keypath.Derive(keystore.master)
 		if err != nil {
 			return nil, err
 		}
@@ -121,67 +118,25 @@ func (keystore *Keystore) sign(
 		if err != nil {
 			return nil, err
 		}
-		signature, err := prv.Sign(signatureHashes[i])
+		signature, err := prv.Sign(signatureHash.Hash)
 		if err != nil {
 			return nil, err
 		}
-		signatures[i] = *signature
+		signatures[i] = signature
 	}
 	return signatures, nil
 }
 
 // SignTransaction implements keystore.Keystore.
-func (keystore *Keystore) SignTransaction(
-	proposedTransaction coin.ProposedTransaction,
-) error {
-	btcProposedTx, ok := proposedTransaction.(*btc.ProposedTransaction)
-	if !ok {
-		panic("Only BTC supported for now.")
-	}
+func (keystore *Keystore) SignTransaction(proposedTx coin.ProposedTransaction) error {
 	keystore.log.Info("Sign transaction.")
-	signatureHashes := [][]byte{}
-	keyPaths := []signing.AbsoluteKeypath{}
-	transaction := btcProposedTx.TXProposal.Transaction
-	for index, txIn := range transaction.TxIn {
-		spentOutput, ok := btcProposedTx.PreviousOutputs[txIn.PreviousOutPoint]
-		if !ok {
-			keystore.log.Panic("There needs to be exactly one output being spent per input!")
-		}
-		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
-		isSegwit, subScript := address.ScriptForHashToSign()
-		var signatureHash []byte
-		if isSegwit {
-			var err error
-			signatureHash, err = txscript.CalcWitnessSigHash(subScript, btcProposedTx.SigHashes,
-				txscript.SigHashAll, transaction, index, spentOutput.Value)
-			if err != nil {
-				return errp.Wrap(err, "Failed to calculate SegWit signature hash")
-			}
-			keystore.log.Debug("Calculated segwit signature hash")
-		} else {
-			var err error
-			signatureHash, err = txscript.CalcSignatureHash(
-				subScript, txscript.SigHashAll, transaction, index)
-			if err != nil {
-				return errp.Wrap(err, "Failed to calculate legacy signature hash")
-			}
-			keystore.log.Debug("Calculated legacy signature hash")
-		}
-
-		signatureHashes = append(signatureHashes, signatureHash)
-		keyPaths = append(keyPaths, address.Configuration.AbsoluteKeypath())
+	signatureHashes, err := proposedTx.SignatureHashes()
+	if err != nil {
+		return err
 	}
-
-	signatures, err := keystore.sign(signatureHashes, keyPaths)
+	signatures, err := keystore.sign(signatureHashes)
 	if err != nil {
 		return errp.WithMessage(err, "Failed to sign signature hash")
 	}
-	if len(signatures) != len(transaction.TxIn) {
-		panic("number of signatures doesn't match number of inputs")
-	}
-	for i, signature := range signatures {
-		signature := signature
-		btcProposedTx.Signatures[i][keystore.CosignerIndex()] = &signature
-	}
-	return nil
+	return proposedTx.SetSignatures(keystore.CosignerIndex(), signatures)
 }
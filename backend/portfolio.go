@@ -0,0 +1,93 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"sort"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+)
+
+// PortfolioCoin is the part of the portfolio held in one coin, summed over all accounts of the
+// coin.
+type PortfolioCoin struct {
+	Coin    coin.Coin
+	Balance coin.Amount
+	// FiatValue is the value of the balance at the current exchange rate.
+	FiatValue float64
+	// Allocation is the share of the coin in the total fiat value, in percent.
+	Allocation float64
+}
+
+// Portfolio is the total of all active accounts.
+type Portfolio struct {
+	Fiat      string
+	FiatTotal float64
+	// Coins are sorted by fiat value descending.
+	Coins []*PortfolioCoin
+	// Complete is false if accounts are still syncing or if an exchange rate is missing, in which
+	// case the total is too low.
+	Complete bool
+}
+
+// Portfolio aggregates the balances of all synced accounts and values them in the given fiat
+// currency. The balance of an account includes unconfirmed incoming funds.
+func (backend *Backend) Portfolio(fiat string) *Portfolio {
+	accounts := func() []coin.Account {
+		defer backend.accountsLock.RLock()()
+		return append([]coin.Account{}, backend.accounts...)
+	}()
+	result := &Portfolio{
+		Fiat:     fiat,
+		Coins:    []*PortfolioCoin{},
+		Complete: true,
+	}
+	coins := map[coin.Coin]*PortfolioCoin{}
+	for _, account := range accounts {
+		if !account.InitialSyncDone() || account.Offline() {
+			result.Complete = false
+			continue
+		}
+		portfolioCoin, ok := coins[account.Coin()]
+		if !ok {
+			portfolioCoin = &PortfolioCoin{Coin: account.Coin()}
+			coins[account.Coin()] = portfolioCoin
+			result.Coins = append(result.Coins, portfolioCoin)
+		}
+		portfolioCoin.Balance = portfolioCoin.Balance.Add(account.TotalBalance())
+	}
+	for _, portfolioCoin := range result.Coins {
+		rate, ok := portfolioCoin.Coin.ExchangeRate(fiat)
+		if !ok {
+			result.Complete = false
+		}
+		portfolioCoin.FiatValue = portfolioCoin.Coin.ToUnit(portfolioCoin.Balance) * rate
+		result.FiatTotal += portfolioCoin.FiatValue
+	}
+	for _, portfolioCoin := range result.Coins {
+		if result.FiatTotal > 0 {
+			portfolioCoin.Allocation = portfolioCoin.FiatValue / result.FiatTotal * 100
+		}
+	}
+	sort.SliceStable(result.Coins, func(i, j int) bool {
+		return result.Coins[i].FiatValue > result.Coins[j].FiatValue
+	})
+	return result
+}
+
+// notifyPortfolioChanged is called when balances or exchange rates change.
+func (backend *Backend) notifyPortfolioChanged() {
+	backend.events <- backendEvent{Type: "backend", Data: "portfolioChanged"}
+}
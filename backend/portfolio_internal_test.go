@@ -0,0 +1,110 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/stretchr/testify/require"
+)
+
+// portfolioCoin is a coin with 100 base units per unit and fixed exchange rates.
+type portfolioCoin struct {
+	coin.Coin
+	code  string
+	rates map[string]float64
+}
+
+func (c *portfolioCoin) Code() string { return c.code }
+
+func (c *portfolioCoin) ToUnit(amount coin.Amount) float64 {
+	value, err := amount.Int64()
+	if err != nil {
+		panic(err)
+	}
+	return float64(value) / 100
+}
+
+func (c *portfolioCoin) ExchangeRate(fiat string) (float64, bool) {
+	rate, ok := c.rates[fiat]
+	return rate, ok
+}
+
+type portfolioAccount struct {
+	coin.Account
+	coin    coin.Coin
+	balance int64
+	synced  bool
+	offline bool
+}
+
+func (a *portfolioAccount) Coin() coin.Coin { return a.coin }
+
+func (a *portfolioAccount) InitialSyncDone() bool { return a.synced }
+
+func (a *portfolioAccount) Offline() bool { return a.offline }
+
+func (a *portfolioAccount) TotalBalance() coin.Amount { return coin.NewAmountFromInt64(a.balance) }
+
+func TestPortfolio(t *testing.T) {
+	btc := &portfolioCoin{code: "btc", rates: map[string]float64{"USD": 10, "EUR": 8}}
+	ltc := &portfolioCoin{code: "ltc", rates: map[string]float64{"USD": 5}}
+	backend := &Backend{}
+	require.Equal(t,
+		&Portfolio{Fiat: "USD", Coins: []*PortfolioCoin{}, Complete: true},
+		backend.Portfolio("USD"))
+
+	backend.accounts = []coin.Account{
+		&portfolioAccount{coin: ltc, balance: 1000, synced: true},
+		&portfolioAccount{coin: btc, balance: 100, synced: true},
+		&portfolioAccount{coin: btc, balance: 200, synced: true},
+	}
+	portfolio := backend.Portfolio("USD")
+	require.True(t, portfolio.Complete)
+	require.Equal(t, 80.0, portfolio.FiatTotal)
+	require.Len(t, portfolio.Coins, 2)
+	// The accounts of a coin are summed up, and the coins are sorted by value.
+	require.Equal(t,
+		&PortfolioCoin{
+			Coin: btc, Balance: coin.NewAmountFromInt64(300), FiatValue: 30, Allocation: 37.5,
+		},
+		portfolio.Coins[1])
+	require.Equal(t,
+		&PortfolioCoin{
+			Coin: ltc, Balance: coin.NewAmountFromInt64(1000), FiatValue: 50, Allocation: 62.5,
+		},
+		portfolio.Coins[0])
+
+	// A missing exchange rate makes the portfolio incomplete.
+	portfolio = backend.Portfolio("EUR")
+	require.False(t, portfolio.Complete)
+	require.Equal(t, 24.0, portfolio.FiatTotal)
+	require.Equal(t, btc, portfolio.Coins[0].Coin)
+	require.Equal(t, 100.0, portfolio.Coins[0].Allocation)
+	require.Equal(t, 0.0, portfolio.Coins[1].Allocation)
+
+	// Accounts which are syncing or offline are left out.
+	backend.accounts = []coin.Account{
+		&portfolioAccount{coin: btc, balance: 100, synced: true},
+		&portfolioAccount{coin: btc, balance: 200},
+		&portfolioAccount{coin: ltc, balance: 1000, synced: true, offline: true},
+	}
+	portfolio = backend.Portfolio("USD")
+	require.False(t, portfolio.Complete)
+	require.Equal(t, 10.0, portfolio.FiatTotal)
+	require.Len(t, portfolio.Coins, 1)
+	require.Equal(t, coin.NewAmountFromInt64(100), portfolio.Coins[0].Balance)
+}
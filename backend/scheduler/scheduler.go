@@ -0,0 +1,674 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/random"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// checkInterval is the interval at which due payments are looked for.
+	checkInterval = time.Minute
+	// maxRetryDelay is the longest time waited before a failed proposal is retried, see
+	// retryDelay().
+	maxRetryDelay = time.Hour
+)
+
+// errBusy is returned if the payment is being proposed or sent at the same time.
+var errBusy = ValidationError("the payment is being processed")
+
+// ValidationError is returned when a payment can not be saved because of invalid input.
+type ValidationError string
+
+func (err ValidationError) Error() string {
+	return string(err)
+}
+
+// Recurrence is the interval at which a payment is repeated. See the Recurrence* constants.
+type Recurrence string
+
+const (
+	// RecurrenceOnce means that the payment is removed after it has been made.
+	RecurrenceOnce Recurrence = "once"
+	// RecurrenceWeekly repeats the payment every seven days.
+	RecurrenceWeekly Recurrence = "weekly"
+	// RecurrenceMonthly repeats the payment on the same day of every month.
+	RecurrenceMonthly Recurrence = "monthly"
+)
+
+// next returns the due time following the given one, or nil if the payment is not repeated. Monthly
+// payments are due on the day of the month of the first payment, or on the last day of the month
+// if it is shorter.
+func (recurrence Recurrence) next(start time.Time, due time.Time) *time.Time {
+	var next time.Time
+	switch recurrence {
+	case RecurrenceWeekly:
+		next = due.AddDate(0, 0, 7)
+	case RecurrenceMonthly:
+		year, month, _ := due.Date()
+		firstOfMonth := time.Date(year, month+1, 1, 0, 0, 0, 0, start.Location())
+		day := start.Day()
+		if lastDay := firstOfMonth.AddDate(0, 1, -1).Day(); day > lastDay {
+			day = lastDay
+		}
+		hour, min, sec := start.Clock()
+		next = time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day,
+			hour, min, sec, start.Nanosecond(), start.Location())
+	default:
+		return nil
+	}
+	return &next
+}
+
+// Event instances are sent to the onEvent callback of the scheduler.
+type Event string
+
+const (
+	// EventProposalsChanged is fired when a payment became due and a proposal for it was created,
+	// or when a proposal was removed.
+	EventProposalsChanged Event = "proposalsChanged"
+)
+
+// Account is the part of an account needed to prepare and make scheduled payments.
+type Account interface {
+	Coin() coin.Coin
+	InitialSyncDone() bool
+	TxProposal(string, btc.SendAmount, btc.FeeTargetCode, btcutil.Amount, map[wire.OutPoint]struct{}) (
+		btcutil.Amount, btcutil.Amount, btcutil.Amount, error)
+	SignTx(string, btc.SendAmount, btc.FeeTargetCode, btcutil.Amount, map[wire.OutPoint]struct{}) (
+		*wire.MsgTx, error)
+	BroadcastTx(*wire.MsgTx) error
+}
+
+// Payment is a payment template which is due at a given time, and possibly repeated.
+type Payment struct {
+	// ID is assigned when the payment is added.
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	AccountCode string `json:"accountCode"`
+	Address     string `json:"address"`
+	// Amount is the amount in the unit of the coin. If empty, FiatAmount is converted at the time
+	// the payment becomes due.
+	Amount     string            `json:"amount"`
+	FiatAmount string            `json:"fiatAmount"`
+	Fiat       string            `json:"fiat"`
+	FeeTarget  btc.FeeTargetCode `json:"feeTarget"`
+	Recurrence Recurrence        `json:"recurrence"`
+	// Due is the time at which the next payment is proposed.
+	Due time.Time `json:"due"`
+	// Start is the due time of the first payment, set when the payment is added or its due time
+	// is changed.
+	Start time.Time `json:"start"`
+	// InFlightTxID is the ID of the tx broadcast for the due payment. It is stored before the
+	// broadcast and cleared when the payment is advanced, so that a payment is not made twice if
+	// the app stops in between. A payment in flight is not proposed or sent again until it is
+	// skipped.
+	InFlightTxID string `json:"inFlightTxID"`
+}
+
+// Proposal is a tx ready to be signed for a due payment.
+type Proposal struct {
+	PaymentID string
+	Created   time.Time
+	Amount    btcutil.Amount
+	Fee       btcutil.Amount
+	Total     btcutil.Amount
+	// Rate is the exchange rate used to convert the fiat amount, or 0 if the amount is given in
+	// the unit of the coin.
+	Rate float64
+	// Error is set if no tx could be proposed, e.g. because the funds are insufficient. The
+	// proposal is retried later, see retryDelay().
+	Error string
+
+	// failures is the number of failed proposals in a row.
+	failures int
+	// retry is the time after which a failed proposal is retried.
+	retry time.Time
+}
+
+// retryDelay returns how long to wait before retrying a proposal which failed the given number of
+// times in a row. The delay doubles with every failure, up to maxRetryDelay.
+func retryDelay(failures int) time.Duration {
+	delay := checkInterval
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// Scheduler stores payment templates and proposes txs for them when they become due.
+type Scheduler struct {
+	lock      locker.Locker
+	filename  string
+	payments  map[string]*Payment
+	proposals map[string]*Proposal
+	// busy contains the IDs of the payments being proposed or sent, see lockPayment().
+	busy map[string]struct{}
+
+	// account returns the loaded account with the given code, or nil if there is none.
+	account func(code string) Account
+	onEvent func(Event)
+	quit    chan struct{}
+	closed  bool
+	log     *logrus.Entry
+}
+
+// NewScheduler creates a new Scheduler, whose payments are stored in the given location. The
+// filename must be writable, but does not have to exist. Start() needs to be called to start
+// looking for due payments.
+func NewScheduler(
+	filename string,
+	account func(code string) Account,
+	onEvent func(Event),
+	log *logrus.Entry,
+) *Scheduler {
+	scheduler := &Scheduler{
+		filename:  filename,
+		payments:  map[string]*Payment{},
+		proposals: map[string]*Proposal{},
+		busy:      map[string]struct{}{},
+		account:   account,
+		onEvent:   onEvent,
+		quit:      make(chan struct{}),
+		log:       log.WithField("group", "scheduler"),
+	}
+	scheduler.load()
+	return scheduler
+}
+
+func (scheduler *Scheduler) load() {
+	jsonBytes, err := ioutil.ReadFile(scheduler.filename)
+	if err != nil {
+		return
+	}
+	payments := []*Payment{}
+	if err := json.Unmarshal(jsonBytes, &payments); err != nil {
+		scheduler.log.WithError(err).Error("Could not load the scheduled payments")
+		return
+	}
+	for _, payment := range payments {
+		scheduler.payments[payment.ID] = payment
+	}
+}
+
+func (scheduler *Scheduler) save() error {
+	payments := []*Payment{}
+	for _, payment := range scheduler.payments {
+		payments = append(payments, payment)
+	}
+	jsonBytes, err := json.Marshal(payments)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(ioutil.WriteFile(scheduler.filename, jsonBytes, 0600))
+}
+
+// Start checks for due payments now and periodically until Close() is called.
+func (scheduler *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		scheduler.checkDue(time.Now())
+		for {
+			select {
+			case <-scheduler.quit:
+				return
+			case <-ticker.C:
+				scheduler.checkDue(time.Now())
+			}
+		}
+	}()
+}
+
+// Close stops looking for due payments.
+func (scheduler *Scheduler) Close() {
+	defer scheduler.lock.Lock()()
+	if !scheduler.closed {
+		scheduler.closed = true
+		close(scheduler.quit)
+	}
+}
+
+// lockPayment marks the payment as busy while it is proposed or sent, so that the periodic check
+// and the user can not act on it at the same time. It returns false if the payment is busy already,
+// and otherwise a function to release the payment.
+func (scheduler *Scheduler) lockPayment(id string) (func(), bool) {
+	defer scheduler.lock.Lock()()
+	if _, ok := scheduler.busy[id]; ok {
+		return nil, false
+	}
+	scheduler.busy[id] = struct{}{}
+	return func() {
+		defer scheduler.lock.Lock()()
+		delete(scheduler.busy, id)
+	}, true
+}
+
+func parseAmount(amountString string) (float64, error) {
+	amount, err := strconv.ParseFloat(amountString, 64)
+	if err != nil || amount <= 0 {
+		return 0, errp.WithStack(ValidationError("invalid amount"))
+	}
+	return amount, nil
+}
+
+func (scheduler *Scheduler) validate(payment *Payment) error {
+	account := scheduler.account(payment.AccountCode)
+	if account == nil {
+		return errp.WithStack(ValidationError("unknown account"))
+	}
+	if payment.Address == "" {
+		return errp.WithStack(ValidationError("address missing"))
+	}
+	if err := account.Coin().ValidateAddress(payment.Address); err != nil {
+		return errp.WithStack(ValidationError("invalid address"))
+	}
+	if (payment.Amount == "") == (payment.FiatAmount == "") {
+		return errp.WithStack(ValidationError("either an amount or a fiat amount is required"))
+	}
+	if payment.Amount != "" {
+		amount, err := parseAmount(payment.Amount)
+		if err != nil {
+			return err
+		}
+		if _, err := btcutil.NewAmount(amount); err != nil {
+			return errp.WithStack(ValidationError("invalid amount"))
+		}
+	} else {
+		if _, err := parseAmount(payment.FiatAmount); err != nil {
+			return err
+		}
+		if payment.Fiat == "" {
+			return errp.WithStack(ValidationError("fiat currency missing"))
+		}
+	}
+	feeTarget, err := btc.NewFeeTargetCode(string(payment.FeeTarget), scheduler.log)
+	if err != nil || feeTarget == btc.FeeTargetCodeCustom {
+		return errp.WithStack(ValidationError("invalid fee target"))
+	}
+	switch payment.Recurrence {
+	case RecurrenceOnce, RecurrenceWeekly, RecurrenceMonthly:
+	default:
+		return errp.WithStack(ValidationError("invalid recurrence"))
+	}
+	if payment.Due.IsZero() {
+		return errp.WithStack(ValidationError("due date missing"))
+	}
+	return nil
+}
+
+// Payments returns all payments, sorted by due time.
+func (scheduler *Scheduler) Payments() []*Payment {
+	defer scheduler.lock.RLock()()
+	result := []*Payment{}
+	for _, payment := range scheduler.payments {
+		paymentCopy := *payment
+		result = append(result, &paymentCopy)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Due.Equal(result[j].Due) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Due.Before(result[j].Due)
+	})
+	return result
+}
+
+// Add validates and stores a new payment. The ID of the given payment is ignored and the ID of the
+// new payment is returned.
+func (scheduler *Scheduler) Add(payment Payment) (string, error) {
+	if err := scheduler.validate(&payment); err != nil {
+		return "", err
+	}
+	id, err := random.HexString(16)
+	if err != nil {
+		return "", err
+	}
+	payment.ID = id
+	payment.Start = payment.Due
+	payment.InFlightTxID = ""
+	defer scheduler.lock.Lock()()
+	scheduler.payments[id] = &payment
+	if err := scheduler.save(); err != nil {
+		delete(scheduler.payments, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Update validates and replaces the payment with the same ID. A pending proposal for the payment
+// is discarded.
+func (scheduler *Scheduler) Update(payment Payment) error {
+	if err := scheduler.validate(&payment); err != nil {
+		return err
+	}
+	release, ok := scheduler.lockPayment(payment.ID)
+	if !ok {
+		return errp.WithStack(errBusy)
+	}
+	defer release()
+	unlock := scheduler.lock.Lock()
+	previous, ok := scheduler.payments[payment.ID]
+	if !ok {
+		unlock()
+		return errp.Newf("scheduled payment %s not found", payment.ID)
+	}
+	payment.Start = payment.Due
+	if payment.Due.Equal(previous.Due) {
+		payment.Start = previous.Start
+	}
+	payment.InFlightTxID = previous.InFlightTxID
+	scheduler.payments[payment.ID] = &payment
+	if err := scheduler.save(); err != nil {
+		scheduler.payments[payment.ID] = previous
+		unlock()
+		return err
+	}
+	_, hadProposal := scheduler.proposals[payment.ID]
+	delete(scheduler.proposals, payment.ID)
+	unlock()
+	if hadProposal {
+		scheduler.onEvent(EventProposalsChanged)
+	}
+	return nil
+}
+
+// Delete removes the payment with the given ID, and its pending proposal.
+func (scheduler *Scheduler) Delete(id string) error {
+	release, ok := scheduler.lockPayment(id)
+	if !ok {
+		return errp.WithStack(errBusy)
+	}
+	defer release()
+	unlock := scheduler.lock.Lock()
+	previous, ok := scheduler.payments[id]
+	if !ok {
+		unlock()
+		return errp.Newf("scheduled payment %s not found", id)
+	}
+	delete(scheduler.payments, id)
+	if err := scheduler.save(); err != nil {
+		scheduler.payments[id] = previous
+		unlock()
+		return err
+	}
+	_, hadProposal := scheduler.proposals[id]
+	delete(scheduler.proposals, id)
+	unlock()
+	if hadProposal {
+		scheduler.onEvent(EventProposalsChanged)
+	}
+	return nil
+}
+
+// Proposals returns the proposals of all due payments, sorted by creation time.
+func (scheduler *Scheduler) Proposals() []*Proposal {
+	defer scheduler.lock.RLock()()
+	result := []*Proposal{}
+	for _, proposal := range scheduler.proposals {
+		proposalCopy := *proposal
+		result = append(result, &proposalCopy)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Created.Equal(result[j].Created) {
+			return result[i].PaymentID < result[j].PaymentID
+		}
+		return result[i].Created.Before(result[j].Created)
+	})
+	return result
+}
+
+// Payment returns the payment with the given ID.
+func (scheduler *Scheduler) Payment(id string) (*Payment, error) {
+	defer scheduler.lock.RLock()()
+	payment, ok := scheduler.payments[id]
+	if !ok {
+		return nil, errp.Newf("scheduled payment %s not found", id)
+	}
+	paymentCopy := *payment
+	return &paymentCopy, nil
+}
+
+// sendAmount returns the amount to pay, converting the fiat amount at the current exchange rate if
+// needed. The rate used is returned as well, or 0 if no conversion was needed.
+func sendAmount(account Account, payment *Payment) (btc.SendAmount, float64, error) {
+	if payment.Amount != "" {
+		amount, err := parseAmount(payment.Amount)
+		if err != nil {
+			return btc.SendAmount{}, 0, err
+		}
+		btcAmount, err := btcutil.NewAmount(amount)
+		if err != nil {
+			return btc.SendAmount{}, 0, errp.WithStack(err)
+		}
+		sendAmount, err := btc.NewSendAmount(btcAmount)
+		return sendAmount, 0, err
+	}
+	fiatAmount, err := parseAmount(payment.FiatAmount)
+	if err != nil {
+		return btc.SendAmount{}, 0, err
+	}
+	sendAmount, err := btc.NewSendAmountFiat(fiatAmount, payment.Fiat)
+	if err != nil {
+		return btc.SendAmount{}, 0, err
+	}
+	return account.Coin().(*btc.Coin).ResolveSendAmount(sendAmount)
+}
+
+// propose creates a proposal for the payment. It returns nil if the account is not ready yet.
+func (scheduler *Scheduler) propose(payment *Payment, now time.Time) *Proposal {
+	account := scheduler.account(payment.AccountCode)
+	if account == nil || !account.InitialSyncDone() {
+		return nil
+	}
+	proposal := &Proposal{PaymentID: payment.ID, Created: now}
+	amount, rate, err := sendAmount(account, payment)
+	if err == nil {
+		proposal.Amount, proposal.Fee, proposal.Total, err = account.TxProposal(
+			payment.Address, amount, payment.FeeTarget, 0, nil)
+	}
+	proposal.Rate = rate
+	if err != nil {
+		scheduler.log.WithField("payment", payment.ID).WithError(err).Warning(
+			"Could not propose a tx for a scheduled payment")
+		proposal.Error = errp.Cause(err).Error()
+	}
+	return proposal
+}
+
+// checkDue creates proposals for the payments which are due at the given time. Failed proposals are
+// retried after a delay, see retryDelay().
+func (scheduler *Scheduler) checkDue(now time.Time) {
+	due := func() []*Payment {
+		defer scheduler.lock.RLock()()
+		result := []*Payment{}
+		for _, payment := range scheduler.payments {
+			if payment.Due.After(now) || payment.InFlightTxID != "" {
+				continue
+			}
+			if proposal, ok := scheduler.proposals[payment.ID]; ok &&
+				(proposal.Error == "" || now.Before(proposal.retry)) {
+				continue
+			}
+			paymentCopy := *payment
+			result = append(result, &paymentCopy)
+		}
+		return result
+	}()
+	changed := false
+	for _, payment := range due {
+		release, ok := scheduler.lockPayment(payment.ID)
+		if !ok {
+			// Being sent, or modified by the user.
+			continue
+		}
+		func() {
+			defer release()
+			proposal := scheduler.propose(payment, now)
+			if proposal == nil {
+				return
+			}
+			defer scheduler.lock.Lock()()
+			current, ok := scheduler.payments[payment.ID]
+			if !ok || *current != *payment {
+				// Modified in the meantime.
+				return
+			}
+			previous, ok := scheduler.proposals[payment.ID]
+			if !ok || previous.Error != proposal.Error {
+				changed = true
+			}
+			if proposal.Error != "" {
+				proposal.failures = 1
+				if ok && previous.Error != "" {
+					proposal.failures = previous.failures + 1
+				}
+				proposal.retry = now.Add(retryDelay(proposal.failures))
+			}
+			scheduler.proposals[payment.ID] = proposal
+		}()
+	}
+	if changed {
+		scheduler.onEvent(EventProposalsChanged)
+	}
+}
+
+// advance removes the proposal of the payment and schedules the next payment, or removes the
+// payment if it is not repeated. Due times missed in the meantime are skipped.
+func (scheduler *Scheduler) advance(paymentID string, now time.Time) error {
+	defer scheduler.lock.Lock()()
+	payment, ok := scheduler.payments[paymentID]
+	if !ok {
+		return errp.Newf("scheduled payment %s not found", paymentID)
+	}
+	delete(scheduler.proposals, paymentID)
+	payment.InFlightTxID = ""
+	next := payment.Recurrence.next(payment.Start, payment.Due)
+	for next != nil && !next.After(now) {
+		next = payment.Recurrence.next(payment.Start, *next)
+	}
+	if next == nil {
+		delete(scheduler.payments, paymentID)
+	} else {
+		payment.Due = *next
+	}
+	return scheduler.save()
+}
+
+// setInFlight stores the ID of the tx broadcast for the payment, or clears it if txID is empty.
+func (scheduler *Scheduler) setInFlight(paymentID string, txID string) error {
+	defer scheduler.lock.Lock()()
+	payment, ok := scheduler.payments[paymentID]
+	if !ok {
+		return errp.Newf("scheduled payment %s not found", paymentID)
+	}
+	previous := payment.InFlightTxID
+	payment.InFlightTxID = txID
+	if err := scheduler.save(); err != nil {
+		payment.InFlightTxID = previous
+		return err
+	}
+	return nil
+}
+
+// Send makes the proposed payment, which needs to be confirmed on the device, and schedules the
+// next one. The payment is marked as in flight before the tx is broadcast, and the tx is not
+// broadcast if that fails.
+func (scheduler *Scheduler) Send(paymentID string) error {
+	release, ok := scheduler.lockPayment(paymentID)
+	if !ok {
+		return errp.WithStack(errBusy)
+	}
+	defer release()
+	payment, err := scheduler.Payment(paymentID)
+	if err != nil {
+		return err
+	}
+	if payment.InFlightTxID != "" {
+		return errp.WithStack(ValidationError("the payment was sent already"))
+	}
+	proposal, err := func() (*Proposal, error) {
+		defer scheduler.lock.RLock()()
+		proposal, ok := scheduler.proposals[paymentID]
+		if !ok || proposal.Error != "" {
+			return nil, errp.WithStack(ValidationError("no proposal for this payment"))
+		}
+		return proposal, nil
+	}()
+	if err != nil {
+		return err
+	}
+	account := scheduler.account(payment.AccountCode)
+	if account == nil {
+		return errp.WithStack(ValidationError("unknown account"))
+	}
+	sendAmount, err := btc.NewSendAmount(proposal.Amount)
+	if err != nil {
+		return err
+	}
+	tx, err := account.SignTx(payment.Address, sendAmount, payment.FeeTarget, 0, nil)
+	if err != nil {
+		return err
+	}
+	txID := tx.TxHash().String()
+	if err := scheduler.setInFlight(paymentID, txID); err != nil {
+		return errp.WithMessage(err, "Could not store the payment before broadcasting it")
+	}
+	if err := account.BroadcastTx(tx); err != nil {
+		if clearErr := scheduler.setInFlight(paymentID, ""); clearErr != nil {
+			scheduler.log.WithField("payment", paymentID).WithError(clearErr).Error(
+				"Could not clear the tx of a failed payment")
+		}
+		return err
+	}
+	if err := scheduler.advance(paymentID, time.Now()); err != nil {
+		scheduler.log.WithField("payment", paymentID).WithField("txID", txID).WithError(err).Error(
+			"Could not advance a sent payment")
+		return err
+	}
+	scheduler.onEvent(EventProposalsChanged)
+	return nil
+}
+
+// Skip discards the due payment without making it, and schedules the next one. A payment in
+// flight is skipped to mark it as done.
+func (scheduler *Scheduler) Skip(paymentID string) error {
+	release, ok := scheduler.lockPayment(paymentID)
+	if !ok {
+		return errp.WithStack(errBusy)
+	}
+	defer release()
+	if err := scheduler.advance(paymentID, time.Now()); err != nil {
+		return err
+	}
+	scheduler.onEvent(EventProposalsChanged)
+	return nil
+}
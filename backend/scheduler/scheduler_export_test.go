@@ -0,0 +1,29 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import "time"
+
+// TstCheckDue creates the proposals for the payments due at the given time.
+func (scheduler *Scheduler) TstCheckDue(now time.Time) {
+	scheduler.checkDue(now)
+}
+
+// TstSetInFlight stores the payment as in flight, as if the app stopped during the broadcast.
+func (scheduler *Scheduler) TstSetInFlight(paymentID string, txID string) {
+	if err := scheduler.setInFlight(paymentID, txID); err != nil {
+		panic(err)
+	}
+}
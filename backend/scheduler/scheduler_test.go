@@ -0,0 +1,407 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/scheduler"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+const fee = btcutil.Amount(1000)
+
+// recipient is a testnet address.
+var recipient = func() string {
+	address, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &chaincfg.TestNet3Params)
+	if err != nil {
+		panic(err)
+	}
+	return address.EncodeAddress()
+}()
+
+type testRatesUpdater struct {
+	observable.Implementation
+	rates map[string]map[string]float64
+}
+
+func (updater *testRatesUpdater) Last() map[string]map[string]float64 {
+	return updater.rates
+}
+
+// testAccount proposes txs with a fixed fee and records the sent amounts.
+type testAccount struct {
+	synced  bool
+	balance btcutil.Amount
+	// rate is the BTC/CHF exchange rate, or 0 if there is none.
+	rate float64
+	sent []btcutil.Amount
+	// broadcastErr is returned by BroadcastTx() if not nil.
+	broadcastErr error
+}
+
+func (account *testAccount) Coin() coin.Coin {
+	rates := map[string]map[string]float64{"BTC": {}}
+	if account.rate != 0 {
+		rates["BTC"]["CHF"] = account.rate
+	}
+	return btc.NewCoin("tbtc", "Bitcoin Testnet", "TBTC", &chaincfg.TestNet3Params, "", nil, "",
+		&testRatesUpdater{rates: rates})
+}
+
+func (account *testAccount) InitialSyncDone() bool {
+	return account.synced
+}
+
+func (account *testAccount) TxProposal(
+	address string,
+	amount btc.SendAmount,
+	feeTarget btc.FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
+	selectedUTXOs map[wire.OutPoint]struct{},
+) (btcutil.Amount, btcutil.Amount, btcutil.Amount, error) {
+	value := amount.Amount()
+	if amount.SendAll() {
+		value = account.balance - fee
+	}
+	if value+fee > account.balance {
+		return 0, 0, 0, errp.WithStack(maketx.ErrInsufficientFunds)
+	}
+	return value, fee, value + fee, nil
+}
+
+func (account *testAccount) SignTx(
+	address string,
+	amount btc.SendAmount,
+	feeTarget btc.FeeTargetCode,
+	customFeeRatePerKb btcutil.Amount,
+	selectedUTXOs map[wire.OutPoint]struct{},
+) (*wire.MsgTx, error) {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxOut(wire.NewTxOut(int64(amount.Amount()), nil))
+	return tx, nil
+}
+
+func (account *testAccount) BroadcastTx(tx *wire.MsgTx) error {
+	if account.broadcastErr != nil {
+		return account.broadcastErr
+	}
+	account.sent = append(account.sent, btcutil.Amount(tx.TxOut[0].Value))
+	return nil
+}
+
+type testEnv struct {
+	account *testAccount
+
+	eventsLock sync.Mutex
+	events     int
+}
+
+func (env *testEnv) newScheduler(filename string) *scheduler.Scheduler {
+	return scheduler.NewScheduler(
+		filename,
+		func(code string) scheduler.Account {
+			if code != "tbtc-p2wpkh" {
+				return nil
+			}
+			return env.account
+		},
+		func(scheduler.Event) {
+			env.eventsLock.Lock()
+			defer env.eventsLock.Unlock()
+			env.events++
+		},
+		logging.Get().WithGroup("scheduler_test"),
+	)
+}
+
+func (env *testEnv) takeEvents() int {
+	env.eventsLock.Lock()
+	defer env.eventsLock.Unlock()
+	events := env.events
+	env.events = 0
+	return events
+}
+
+func TestScheduledPayments(t *testing.T) {
+	env := &testEnv{
+		account: &testAccount{synced: true, balance: btcutil.SatoshiPerBitcoin, rate: 5000},
+	}
+	filename := test.TstTempFile("scheduledpayments-")
+	paymentScheduler := env.newScheduler(filename)
+	due := time.Date(2018, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	rentID, err := paymentScheduler.Add(scheduler.Payment{
+		Name:        "Rent",
+		AccountCode: "tbtc-p2wpkh",
+		Address:     recipient,
+		Amount:      "0.1",
+		FeeTarget:   btc.FeeTargetCodeNormal,
+		Recurrence:  scheduler.RecurrenceMonthly,
+		Due:         due,
+	})
+	require.NoError(t, err)
+	invoiceID, err := paymentScheduler.Add(scheduler.Payment{
+		Name:        "Invoice",
+		AccountCode: "tbtc-p2wpkh",
+		Address:     recipient,
+		FiatAmount:  "100",
+		Fiat:        "CHF",
+		FeeTarget:   btc.FeeTargetCodeEconomy,
+		Recurrence:  scheduler.RecurrenceOnce,
+		Due:         due.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.Len(t, paymentScheduler.Payments(), 2)
+
+	// Nothing due yet.
+	paymentScheduler.TstCheckDue(due.Add(-time.Second))
+	require.Empty(t, paymentScheduler.Proposals())
+	require.Equal(t, 0, env.takeEvents())
+
+	// The account is not synced yet.
+	env.account.synced = false
+	paymentScheduler.TstCheckDue(due)
+	require.Empty(t, paymentScheduler.Proposals())
+	env.account.synced = true
+
+	paymentScheduler.TstCheckDue(due)
+	require.Equal(t, 1, env.takeEvents())
+	proposals := paymentScheduler.Proposals()
+	require.Len(t, proposals, 1)
+	require.Equal(t, &scheduler.Proposal{
+		PaymentID: rentID,
+		Created:   due,
+		Amount:    btcutil.SatoshiPerBitcoin / 10,
+		Fee:       fee,
+		Total:     btcutil.SatoshiPerBitcoin/10 + fee,
+	}, proposals[0])
+
+	// Already proposed.
+	paymentScheduler.TstCheckDue(due.Add(time.Minute))
+	require.Equal(t, 0, env.takeEvents())
+	require.Len(t, paymentScheduler.Proposals(), 1)
+
+	// The fiat amount is converted at the time the payment becomes due.
+	paymentScheduler.TstCheckDue(due.Add(time.Hour))
+	require.Equal(t, 1, env.takeEvents())
+	proposals = paymentScheduler.Proposals()
+	require.Len(t, proposals, 2)
+	require.Equal(t, invoiceID, proposals[1].PaymentID)
+	require.Equal(t, btcutil.Amount(2000000), proposals[1].Amount)
+	require.Equal(t, float64(5000), proposals[1].Rate)
+
+	// Sending advances a monthly payment by one month.
+	require.NoError(t, paymentScheduler.Send(rentID))
+	require.Equal(t, []btcutil.Amount{btcutil.SatoshiPerBitcoin / 10}, env.account.sent)
+	rent, err := paymentScheduler.Payment(rentID)
+	require.NoError(t, err)
+	require.True(t, rent.Due.After(time.Now()))
+	require.Equal(t, 31, rent.Due.Day())
+
+	// One-off payments are removed after they are made.
+	require.NoError(t, paymentScheduler.Send(invoiceID))
+	require.Equal(t, btcutil.Amount(2000000), env.account.sent[1])
+	_, err = paymentScheduler.Payment(invoiceID)
+	require.Error(t, err)
+	require.Empty(t, paymentScheduler.Proposals())
+
+	// Without a proposal, there is nothing to send.
+	require.Error(t, paymentScheduler.Send(rentID))
+
+	// Payments are persisted.
+	payments := env.newScheduler(filename).Payments()
+	require.Len(t, payments, 1)
+	require.Equal(t, rentID, payments[0].ID)
+	require.True(t, rent.Due.Equal(payments[0].Due))
+}
+
+func TestScheduledPaymentRetry(t *testing.T) {
+	env := &testEnv{account: &testAccount{synced: true, balance: 1000}}
+	paymentScheduler := env.newScheduler(test.TstTempFile("scheduledpayments-"))
+	due := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	id, err := paymentScheduler.Add(scheduler.Payment{
+		Name:        "Vendor",
+		AccountCode: "tbtc-p2wpkh",
+		Address:     recipient,
+		Amount:      "0.1",
+		FeeTarget:   btc.FeeTargetCodeNormal,
+		Recurrence:  scheduler.RecurrenceWeekly,
+		Due:         due,
+	})
+	require.NoError(t, err)
+
+	paymentScheduler.TstCheckDue(due)
+	require.Equal(t, 1, env.takeEvents())
+	proposals := paymentScheduler.Proposals()
+	require.Len(t, proposals, 1)
+	require.Equal(t, "insufficient funds", proposals[0].Error)
+	require.Error(t, paymentScheduler.Send(id))
+
+	// Retried at the next check.
+	env.account.balance = btcutil.SatoshiPerBitcoin
+	paymentScheduler.TstCheckDue(due.Add(time.Minute))
+	require.Equal(t, 1, env.takeEvents())
+	proposals = paymentScheduler.Proposals()
+	require.Len(t, proposals, 1)
+	require.Empty(t, proposals[0].Error)
+
+	// Skipping advances the payment without sending.
+	require.NoError(t, paymentScheduler.Skip(id))
+	require.Empty(t, env.account.sent)
+	require.Empty(t, paymentScheduler.Proposals())
+	payment, err := paymentScheduler.Payment(id)
+	require.NoError(t, err)
+	require.Equal(t, time.Monday, payment.Due.Weekday())
+	require.True(t, payment.Due.After(time.Now()))
+}
+
+func TestScheduledPaymentValidation(t *testing.T) {
+	env := &testEnv{account: &testAccount{}}
+	paymentScheduler := env.newScheduler(test.TstTempFile("scheduledpayments-"))
+	valid := scheduler.Payment{
+		Name:        "Vendor",
+		AccountCode: "tbtc-p2wpkh",
+		Address:     recipient,
+		Amount:      "0.1",
+		FeeTarget:   btc.FeeTargetCodeNormal,
+		Recurrence:  scheduler.RecurrenceOnce,
+		Due:         time.Now(),
+	}
+	for _, modify := range []func(*scheduler.Payment){
+		func(payment *scheduler.Payment) { payment.AccountCode = "btc-p2wpkh" },
+		func(payment *scheduler.Payment) { payment.Address = "" },
+		// Mainnet address for a testnet account.
+		func(payment *scheduler.Payment) { payment.Address = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2" },
+		func(payment *scheduler.Payment) { payment.Amount = "-1" },
+		func(payment *scheduler.Payment) { payment.FiatAmount = "100" },
+		func(payment *scheduler.Payment) { payment.Amount, payment.FiatAmount = "", "100" },
+		func(payment *scheduler.Payment) { payment.FeeTarget = btc.FeeTargetCodeCustom },
+		func(payment *scheduler.Payment) { payment.Recurrence = "daily" },
+		func(payment *scheduler.Payment) { payment.Due = time.Time{} },
+	} {
+		payment := valid
+		modify(&payment)
+		_, err := paymentScheduler.Add(payment)
+		_, ok := errp.Cause(err).(scheduler.ValidationError)
+		require.True(t, ok, err)
+	}
+	_, err := paymentScheduler.Add(valid)
+	require.NoError(t, err)
+}
+
+func TestScheduledPaymentRetryBackoff(t *testing.T) {
+	env := &testEnv{account: &testAccount{synced: true, balance: 1000}}
+	paymentScheduler := env.newScheduler(test.TstTempFile("scheduledpayments-"))
+	due := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := paymentScheduler.Add(scheduler.Payment{
+		Name:        "Vendor",
+		AccountCode: "tbtc-p2wpkh",
+		Address:     recipient,
+		Amount:      "0.1",
+		FeeTarget:   btc.FeeTargetCodeNormal,
+		Recurrence:  scheduler.RecurrenceWeekly,
+		Due:         due,
+	})
+	require.NoError(t, err)
+
+	// The delay doubles with every failure: the proposals are retried after 1, 2 and 4 minutes.
+	now := due
+	for _, delay := range []time.Duration{0, time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		paymentScheduler.TstCheckDue(now.Add(delay - time.Second))
+		if delay != 0 {
+			require.True(t, paymentScheduler.Proposals()[0].Created.Equal(now))
+		}
+		now = now.Add(delay)
+		paymentScheduler.TstCheckDue(now)
+		require.True(t, paymentScheduler.Proposals()[0].Created.Equal(now))
+	}
+	require.Equal(t, "insufficient funds", paymentScheduler.Proposals()[0].Error)
+}
+
+func TestScheduledPaymentInFlight(t *testing.T) {
+	env := &testEnv{account: &testAccount{synced: true, balance: btcutil.SatoshiPerBitcoin}}
+	dir := test.TstTempDir("scheduledpayments-")
+	filename := path.Join(dir, "scheduledpayments.json")
+	paymentScheduler := env.newScheduler(filename)
+	due := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	id, err := paymentScheduler.Add(scheduler.Payment{
+		Name:        "Vendor",
+		AccountCode: "tbtc-p2wpkh",
+		Address:     recipient,
+		Amount:      "0.1",
+		FeeTarget:   btc.FeeTargetCodeNormal,
+		Recurrence:  scheduler.RecurrenceWeekly,
+		Due:         due,
+	})
+	require.NoError(t, err)
+	paymentScheduler.TstCheckDue(due)
+
+	// A failed broadcast clears the tx, so that the payment can be sent again.
+	env.account.broadcastErr = errors.New("rejected")
+	require.Error(t, paymentScheduler.Send(id))
+	payment, err := paymentScheduler.Payment(id)
+	require.NoError(t, err)
+	require.Empty(t, payment.InFlightTxID)
+	require.Len(t, paymentScheduler.Proposals(), 1)
+	env.account.broadcastErr = nil
+
+	// If the payment can't be stored as in flight, the tx is not broadcast.
+	require.NoError(t, os.RemoveAll(dir))
+	require.Error(t, paymentScheduler.Send(id))
+	require.Empty(t, env.account.sent)
+	payment, err = paymentScheduler.Payment(id)
+	require.NoError(t, err)
+	require.Empty(t, payment.InFlightTxID)
+	require.True(t, payment.Due.Equal(due))
+	_, err = paymentScheduler.Add(*payment)
+	require.Error(t, err)
+	require.Len(t, paymentScheduler.Payments(), 1)
+
+	// The app stopped after the payment was stored as in flight. It is neither proposed nor sent
+	// again.
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	paymentScheduler.TstSetInFlight(id, "txid")
+	paymentScheduler = env.newScheduler(filename)
+	payment, err = paymentScheduler.Payment(id)
+	require.NoError(t, err)
+	require.Equal(t, "txid", payment.InFlightTxID)
+	paymentScheduler.TstCheckDue(due)
+	require.Empty(t, paymentScheduler.Proposals())
+	require.Error(t, paymentScheduler.Send(id))
+	require.Empty(t, env.account.sent)
+
+	// Skipping marks it as done.
+	require.NoError(t, paymentScheduler.Skip(id))
+	payment, err = paymentScheduler.Payment(id)
+	require.NoError(t, err)
+	require.Empty(t, payment.InFlightTxID)
+	require.True(t, payment.Due.After(due))
+}
@@ -54,6 +54,7 @@ func main() {
 	connectionData := backendHandlers.NewConnectionData(-1, "")
 	backend := backend.NewBackend(
 		arguments.NewArguments(".", !*mainnet, *regtest, *multisig, *devmode))
+	defer backend.Close()
 	handlers := backendHandlers.NewHandlers(backend, connectionData)
 	log.WithFields(logrus.Fields{"address": address, "port": port}).Info("Listening for HTTP")
 	fmt.Printf("Listening on: http://localhost:%d\n", port)
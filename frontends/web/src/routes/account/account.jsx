@@ -35,6 +35,7 @@ export default class Account extends Component {
         walletInitialized: false,
         transactions: [],
         walletConnected: false,
+        historyIncomplete: false,
         balance: null,
         hasCard: false,
     }
@@ -113,6 +114,7 @@ export default class Account extends Component {
             let state = {
                 walletInitialized: status.includes('accountSynced'),
                 walletConnected: !status.includes('offlineMode'),
+                historyIncomplete: status.includes('historyIncomplete'),
             };
             if (!status.walletInitialized && !status.includes('accountDisabled')) {
                 apiPost(`wallet/${code}/init`);
@@ -148,6 +150,7 @@ export default class Account extends Component {
         transactions,
         walletInitialized,
         walletConnected,
+        historyIncomplete,
         balance,
         hasCard,
     }) {
@@ -191,6 +194,9 @@ export default class Account extends Component {
                                     </Status>
                                 )
                             }
+                            <Status type="warning">
+                                {historyIncomplete && t('account.historyIncomplete')}
+                            </Status>
                         </div>
                     </div>
                     <div class={['innerContainer', ''].join(' ')}>
@@ -35,7 +35,7 @@ export default class Receive extends Component {
 
     componentDidMount() {
         apiGet('wallet/' + this.props.code + '/receive-addresses').then(receiveAddresses => {
-            this.setState({ receiveAddresses, activeIndex: 0 });
+            this.setState({ receiveAddresses, activeIndex: 0 }, this.addressShown);
         });
         if (this.props.deviceIDs.length > 0) {
             apiGet('devices/' + this.props.deviceIDs[0] + '/paired').then((paired) => {
@@ -69,16 +69,22 @@ export default class Receive extends Component {
         });
     }
 
+    // addressShown records that the active address was shown, so that the next visit starts with a
+    // fresh address.
+    addressShown = () => {
+        apiPost('wallet/' + this.props.code + '/address-shown', this.state.receiveAddresses[this.state.activeIndex].scriptHashHex);
+    }
+
     previous = () => {
         this.setState(({ activeIndex, receiveAddresses }) => ({
             activeIndex: (activeIndex + receiveAddresses.length - 1) % receiveAddresses.length
-        }));
+        }), this.addressShown);
     };
 
     next = () => {
         this.setState(({ activeIndex, receiveAddresses }) => ({
             activeIndex: (activeIndex + 1) % receiveAddresses.length
-        }));
+        }), this.addressShown);
     };
 
     ltcConvertToLegacy = () => {
@@ -121,6 +121,26 @@ export default class Settings extends Component {
                                                     label={t('settings.accounts.litecoinP2WPKH')}
                                                     className="text-medium" />
                                             </div>
+                                            <div class={style.column}>
+                                                <Checkbox
+                                                    checked={config.backend.ethereumActive}
+                                                    id="ethereumActive"
+                                                    onChange={this.handleToggleAccount}
+                                                    label={t('settings.accounts.ethereum')}
+                                                    className="text-medium" />
+                                                <Checkbox
+                                                    checked={config.backend.bitcoinCashActive}
+                                                    id="bitcoinCashActive"
+                                                    onChange={this.handleToggleAccount}
+                                                    label={t('settings.accounts.bitcoinCash')}
+                                                    className="text-medium" />
+                                                <Checkbox
+                                                    checked={config.backend.dogecoinActive}
+                                                    id="dogecoinActive"
+                                                    onChange={this.handleToggleAccount}
+                                                    label={t('settings.accounts.dogecoin')}
+                                                    className="text-medium" />
+                                            </div>
                                         </div>
                                         <hr />
                                         <div class="subHeaderContainer">
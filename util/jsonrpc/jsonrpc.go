@@ -16,10 +16,12 @@ package jsonrpc
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
+	"reflect"
 	"sync"
 	"time"
 
@@ -38,9 +40,20 @@ const (
 	responseTimeout = 30 * time.Second
 )
 
+// defaultBatchConfig is used unless ConfigureBatching() is called. The window is short enough not to
+// be noticeable for single requests, but long enough to combine the requests issued in a loop.
+var defaultBatchConfig = rpc.BatchConfig{
+	Window:       10 * time.Millisecond,
+	MaxBatchSize: 50,
+	MaxInFlight:  200,
+}
+
 type callbacks struct {
 	// success is called when a successful response has been received.
 	success func([]byte) error
+	// failure, if not nil, is called when the server responds with an error. If nil, an error
+	// response is treated like a broken connection.
+	failure func(error)
 	// setupAndTeardown will be called before the response has been received.
 	setupAndTeardown func() func()
 	// cleanup will be called after the response has been received.
@@ -76,6 +89,10 @@ type request struct {
 	method            string
 	params            []interface{}
 	jsonText          []byte
+	sentAt            time.Time
+	// inFlight is true if the request holds a slot limiting the number of batched requests in
+	// flight.
+	inFlight bool
 }
 
 type heartBeat struct {
@@ -113,10 +130,24 @@ type RPCClient struct {
 	msgID     int
 	msgIDLock sync.Mutex
 	close     bool
+	closeLock locker.Locker
 
 	notificationsCallbacks     map[string][]func([]byte)
 	notificationsCallbacksLock locker.Locker
 
+	batchConfig rpc.BatchConfig
+	// batch holds the IDs of the requests waiting to be sent in the next batch.
+	batch      []int
+	batchTimer *time.Timer
+	batchLock  locker.Locker
+	// sendBatchLock makes sure only one batch at a time waits for in-flight slots, so that
+	// concurrent batches can't deadlock each other by holding part of the slots.
+	sendBatchLock sync.Mutex
+	inFlightSlots chan struct{}
+
+	metrics     rpc.Metrics
+	metricsLock locker.Locker
+
 	log *logrus.Entry
 }
 
@@ -131,11 +162,30 @@ func NewRPCClient(backends []rpc.Backend, log *logrus.Entry) *RPCClient {
 		pingRequests:                    map[int]bool{},
 		subscriptionRequests:            []*request{},
 		notificationsCallbacks:          map[string][]func([]byte){},
+		batchConfig:                     defaultBatchConfig,
+		inFlightSlots:                   make(chan struct{}, defaultBatchConfig.MaxInFlight),
 		log: log,
 	}
 	return client
 }
 
+// ConfigureBatching changes how requests sent with MethodBatched() are batched. It must be called
+// before the first request is sent.
+func (client *RPCClient) ConfigureBatching(config rpc.BatchConfig) {
+	if !config.Valid() {
+		panic(errp.Newf("invalid batch config: %+v", config))
+	}
+	defer client.batchLock.Lock()()
+	client.batchConfig = config
+	client.inFlightSlots = make(chan struct{}, config.MaxInFlight)
+}
+
+// Metrics returns a snapshot of the request metrics.
+func (client *RPCClient) Metrics() rpc.Metrics {
+	defer client.metricsLock.RLock()()
+	return client.metrics
+}
+
 // ConnectionStatus returns the current connection status of this client to the backend(s).
 func (client *RPCClient) ConnectionStatus() rpc.Status {
 	if _, err := client.conn(); err != nil {
@@ -144,6 +194,16 @@ func (client *RPCClient) ConnectionStatus() rpc.Status {
 	return rpc.CONNECTED
 }
 
+// ServerInfo returns the info of the backend the client is currently connected to, or nil if there
+// is no active connection.
+func (client *RPCClient) ServerInfo() *rpc.ServerInfo {
+	connection := client.connection
+	if connection == nil {
+		return nil
+	}
+	return connection.backend.ServerInfo()
+}
+
 // RegisterOnConnectionStatusChangedEvent registers an event that is fired if the connection status changes.
 // After registration it fires the event to notify the holder of the callback about the current status.
 // TODO: eventually return a de-register method that deletes the callback. Will be required once we
@@ -157,7 +217,12 @@ func (client *RPCClient) requeueSubscriptions() {
 	defer client.subscriptionRequestsLock.Lock()()
 	client.log.Debugf("Got %v subscriptions that need to be resubscribed", len(client.subscriptionRequests))
 	for _, r := range client.subscriptionRequests {
-		client.prepare(r.responseCallbacks.success, r.responseCallbacks.setupAndTeardown, r.method, r.params...)
+		client.prepare(
+			r.responseCallbacks.success,
+			r.responseCallbacks.failure,
+			r.responseCallbacks.setupAndTeardown,
+			r.method,
+			r.params...)
 	}
 	client.subscriptionRequests = []*request{}
 }
@@ -228,7 +293,7 @@ func (client *RPCClient) read(connection *connection, success func(*connection,
 		}
 	}()
 	reader := bufio.NewReader(connection.conn)
-	for !client.close {
+	for !client.IsClosed() {
 		line, err := reader.ReadBytes(byte('\n'))
 		if err != nil {
 			panic(&SocketError{errp.Wrap(err, "Failed to read from socket"), connection})
@@ -251,6 +316,8 @@ func (client *RPCClient) establishConnection(backend rpc.Backend) error {
 	go client.read(client.connection, client.handleResponse)
 	if err := client.onConnectCallback(); err != nil {
 		client.log.WithError(err).Error("Error happened in connect callback")
+		client.connection = nil
+		_ = conn.Close()
 		return err
 	}
 	go client.ping()
@@ -318,6 +385,15 @@ func (client *RPCClient) cleanupFinishedRequest(conn *connection, responseID int
 	defer client.pendingRequestsLock.Lock()()
 	finishedRequest := client.pendingRequests[responseID]
 	finishedRequest.responseCallbacks.cleanup()
+	if finishedRequest.inFlight {
+		finishedRequest.inFlight = false
+		<-client.inFlightSlots
+	}
+	func() {
+		defer client.metricsLock.Lock()()
+		client.metrics.Responses++
+		client.metrics.TotalLatency += time.Since(finishedRequest.sentAt)
+	}()
 	if client.isSubscriptionRequest(finishedRequest.method) {
 		func() {
 			defer client.subscriptionRequestsLock.Lock()()
@@ -340,6 +416,19 @@ func (client *RPCClient) cleanupFinishedRequest(conn *connection, responseID int
 func (client *RPCClient) handleResponse(conn *connection, responseBytes []byte) {
 	// fmt.Println("got response ", string(responseBytes))
 
+	// The response to a batch request is an array of responses.
+	if trimmed := bytes.TrimSpace(responseBytes); len(trimmed) > 0 && trimmed[0] == '[' {
+		responses := []json.RawMessage{}
+		if err := json.Unmarshal(trimmed, &responses); err != nil {
+			// panic will be caught in read() and subscribed connections will be re-subscribed
+			panic(&ResponseError{errp.Wrap(err, "Failed to unmarshal batch response")})
+		}
+		for _, response := range responses {
+			client.handleResponse(conn, response)
+		}
+		return
+	}
+
 	// Catch all response.
 	// A notification contains:
 	// - jsonrpc
@@ -387,6 +476,11 @@ func (client *RPCClient) handleResponse(conn *connection, responseBytes []byte)
 			responseCallbacks := pendingRequest.responseCallbacks
 			if response.Error != nil {
 				responseError = &ResponseError{errp.New(parseError(*response.Error))}
+				if responseCallbacks.failure != nil {
+					responseCallbacks.failure(responseError)
+					client.cleanupFinishedRequest(conn, *response.ID)
+					return
+				}
 			} else if len(response.Result) == 0 {
 				responseError = &ResponseError{errp.New("unexpected reply")}
 			} else if err := responseCallbacks.success([]byte(response.Result)); err != nil {
@@ -445,7 +539,7 @@ func (client *RPCClient) RegisterHeartbeat(
 
 // ping periodically pings the server to keep the connection alive.
 func (client *RPCClient) ping() {
-	for !client.close {
+	for !client.IsClosed() {
 		time.Sleep(time.Minute)
 		if client.heartBeat == nil {
 			continue
@@ -490,13 +584,14 @@ func (client *RPCClient) transform(
 	}), byte('\n'))
 }
 
-// prepare ...
+// prepare adds the request to the pending requests and returns its ID and JSON encoding.
 func (client *RPCClient) prepare(
 	success func([]byte) error,
+	failure func(error),
 	setupAndTeardown func() func(),
 	method string,
 	params ...interface{},
-) []byte {
+) (int, []byte) {
 	// Ideally, we should have a worker thread that processes a "to be send" list.
 	cleanup := func() {}
 	if setupAndTeardown != nil {
@@ -512,14 +607,26 @@ func (client *RPCClient) prepare(
 	client.pendingRequests[msgID] = &request{
 		callbacks{
 			success:          success,
+			failure:          failure,
 			setupAndTeardown: setupAndTeardown,
 			cleanup:          cleanup,
 		},
 		method,
 		params,
 		jsonText,
+		time.Now(),
+		false,
+	}
+	return msgID, jsonText
+}
+
+func (client *RPCClient) countRequests(requests int, batched bool) {
+	defer client.metricsLock.Lock()()
+	client.metrics.Requests += int64(requests)
+	if batched {
+		client.metrics.BatchedRequests += int64(requests)
+		client.metrics.Batches++
 	}
-	return jsonText
 }
 
 // Method sends invokes the remote method with the provided parameters. Before the request is send,
@@ -531,7 +638,20 @@ func (client *RPCClient) Method(
 	method string,
 	params ...interface{},
 ) {
-	jsonText := client.prepare(success, setupAndTeardown, method, params...)
+	client.method(success, nil, setupAndTeardown, method, params...)
+}
+
+// method is the same as Method, but failure, if not nil, is called with the error if the server
+// responds with one.
+func (client *RPCClient) method(
+	success func([]byte) error,
+	failure func(error),
+	setupAndTeardown func() func(),
+	method string,
+	params ...interface{},
+) {
+	_, jsonText := client.prepare(success, failure, setupAndTeardown, method, params...)
+	client.countRequests(1, false)
 	err := client.send(jsonText)
 	if err != nil {
 		client.log.Debugf("Resend triggered in Method (%v)", method)
@@ -539,17 +659,97 @@ func (client *RPCClient) Method(
 	}
 }
 
+// MethodBatched is the same as Method, but the request is held back for a short time to be sent
+// together with other requests in one batch request. This reduces the number of round trips when
+// many requests are issued at once, e.g. when syncing a wallet. The number of batched requests
+// waiting for a response is limited, see rpc.BatchConfig. If failure is not nil, it is called with
+// the error if the server responds with one.
+func (client *RPCClient) MethodBatched(
+	success func([]byte) error,
+	failure func(error),
+	setupAndTeardown func() func(),
+	method string,
+	params ...interface{},
+) {
+	msgID, _ := client.prepare(success, failure, setupAndTeardown, method, params...)
+	unlock := client.batchLock.Lock()
+	client.batch = append(client.batch, msgID)
+	if len(client.batch) >= client.batchConfig.MaxBatchSize {
+		batch := client.takeBatch()
+		unlock()
+		go client.sendBatch(batch)
+		return
+	}
+	if client.batchTimer == nil {
+		client.batchTimer = time.AfterFunc(client.batchConfig.Window, func() {
+			unlock := client.batchLock.Lock()
+			batch := client.takeBatch()
+			unlock()
+			client.sendBatch(batch)
+		})
+	}
+	unlock()
+}
+
+// takeBatch returns the queued requests and starts a new batch. batchLock must be held.
+func (client *RPCClient) takeBatch() []int {
+	batch := client.batch
+	client.batch = nil
+	if client.batchTimer != nil {
+		client.batchTimer.Stop()
+		client.batchTimer = nil
+	}
+	return batch
+}
+
+// sendBatch sends the given requests as one batch request, after waiting for enough in-flight
+// slots. Requests which were already answered in the meantime (e.g. because they were resent after
+// a failover) are skipped.
+func (client *RPCClient) sendBatch(batch []int) {
+	if len(batch) == 0 {
+		return
+	}
+	client.sendBatchLock.Lock()
+	jsonTexts := [][]byte{}
+	for _, msgID := range batch {
+		client.inFlightSlots <- struct{}{}
+		func() {
+			defer client.pendingRequestsLock.Lock()()
+			request, ok := client.pendingRequests[msgID]
+			if !ok {
+				<-client.inFlightSlots
+				return
+			}
+			request.inFlight = true
+			request.sentAt = time.Now()
+			jsonTexts = append(jsonTexts, bytes.TrimSuffix(request.jsonText, []byte{'\n'}))
+		}()
+	}
+	client.sendBatchLock.Unlock()
+	if len(jsonTexts) == 0 {
+		return
+	}
+	client.countRequests(len(jsonTexts), true)
+	jsonText := append(append([]byte{'['}, bytes.Join(jsonTexts, []byte{','})...), ']', '\n')
+	if err := client.send(jsonText); err != nil {
+		client.log.Debug("Resend triggered in sendBatch")
+		client.resendPendingRequestsAndSubscriptions(err.connection)
+	}
+}
+
 // MethodSync is the same as method, but blocks until the response is available. The result is
-// json-deserialized into response.
+// json-deserialized into response. If the server responds with an error, it is returned.
 func (client *RPCClient) MethodSync(response interface{}, method string, params ...interface{}) error {
-	responseChan := make(chan []byte)
-	errChan := make(chan error)
+	// Buffered so that a late response does not block the read loop after a timeout.
+	responseChan := make(chan []byte, 1)
+	errChan := make(chan error, 1)
 
-	client.Method(
+	client.method(
 		func(responseBytes []byte) error {
 			responseChan <- responseBytes
 			return nil
 		},
+		func(err error) { errChan <- err },
 		func() func() { return func() {} },
 		method, params...)
 	select {
@@ -577,6 +777,19 @@ func (client *RPCClient) SubscribeNotifications(method string, callback func([]b
 	client.notificationsCallbacks[method] = append(client.notificationsCallbacks[method], callback)
 }
 
+// RemoveSubscription forgets the subscription request with the given method and parameters, so it
+// is not re-sent when failing over to another backend.
+func (client *RPCClient) RemoveSubscription(method string, params ...interface{}) {
+	defer client.subscriptionRequestsLock.Lock()()
+	subscriptionRequests := []*request{}
+	for _, r := range client.subscriptionRequests {
+		if r.method != method || !reflect.DeepEqual(r.params, params) {
+			subscriptionRequests = append(subscriptionRequests, r)
+		}
+	}
+	client.subscriptionRequests = subscriptionRequests
+}
+
 func (client *RPCClient) send(msg []byte) *SocketError {
 	conn, err := client.conn()
 	if err != nil {
@@ -591,10 +804,12 @@ func (client *RPCClient) send(msg []byte) *SocketError {
 
 // Close shuts down the connection.
 func (client *RPCClient) Close() {
+	defer client.closeLock.Lock()()
 	client.close = true
 }
 
 // IsClosed returns true if the client is closed and false otherwise.
 func (client *RPCClient) IsClosed() bool {
+	defer client.closeLock.RLock()()
 	return client.close
 }
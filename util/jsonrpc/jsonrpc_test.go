@@ -0,0 +1,131 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonrpc_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+type jsonRequest struct {
+	ID     int           `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type jsonResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Result  interface{} `json:"result"`
+}
+
+// echoBackend is a server which replies to every request with its first parameter, and answers
+// batch requests with a batch response.
+type echoBackend struct{}
+
+func (backend *echoBackend) ServerInfo() *rpc.ServerInfo {
+	return &rpc.ServerInfo{Server: "echo"}
+}
+
+func (backend *echoBackend) EstablishConnection() (io.ReadWriteCloser, error) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var reply interface{}
+			if line[0] == '[' {
+				requests := []*jsonRequest{}
+				if err := json.Unmarshal(line, &requests); err != nil {
+					panic(err)
+				}
+				responses := []*jsonResponse{}
+				for _, request := range requests {
+					responses = append(responses,
+						&jsonResponse{JSONRPC: "2.0", ID: request.ID, Result: request.Params[0]})
+				}
+				reply = responses
+			} else {
+				request := &jsonRequest{}
+				if err := json.Unmarshal(line, request); err != nil {
+					panic(err)
+				}
+				reply = &jsonResponse{JSONRPC: "2.0", ID: request.ID, Result: request.Params[0]}
+			}
+			replyBytes, err := json.Marshal(reply)
+			if err != nil {
+				panic(err)
+			}
+			if _, err := serverConn.Write(append(replyBytes, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+	return clientConn, nil
+}
+
+func TestMethodBatched(t *testing.T) {
+	client := jsonrpc.NewRPCClient([]rpc.Backend{&echoBackend{}}, logging.Get().WithGroup("jsonrpc"))
+	defer client.Close()
+	client.OnConnect(func() error { return nil })
+	client.ConfigureBatching(rpc.BatchConfig{
+		Window:       time.Hour,
+		MaxBatchSize: 10,
+		MaxInFlight:  10,
+	})
+
+	const numRequests = 30
+	var wg sync.WaitGroup
+	wg.Add(numRequests)
+	var resultsLock sync.Mutex
+	results := map[int]bool{}
+	for i := 0; i < numRequests; i++ {
+		client.MethodBatched(
+			func(responseBytes []byte) error {
+				var result int
+				if err := json.Unmarshal(responseBytes, &result); err != nil {
+					return err
+				}
+				resultsLock.Lock()
+				results[result] = true
+				resultsLock.Unlock()
+				return nil
+			},
+			nil,
+			func() func() { return wg.Done },
+			"echo", i)
+	}
+	wg.Wait()
+	require.Len(t, results, numRequests)
+
+	metrics := client.Metrics()
+	require.Equal(t, int64(numRequests), metrics.Requests)
+	require.Equal(t, int64(numRequests), metrics.BatchedRequests)
+	require.Equal(t, int64(numRequests/10), metrics.Batches)
+	require.Equal(t, int64(numRequests), metrics.Responses)
+}
@@ -16,6 +16,7 @@ package rpc
 
 import (
 	"io"
+	"time"
 )
 
 // Status is the connection status to the blockchain node
@@ -31,14 +32,57 @@ const (
 // Client describes the methods needed to communicate with an RPC server.
 type Client interface {
 	Method(func([]byte) error, func() func(), string, ...interface{})
+	MethodBatched(func([]byte) error, func(error), func() func(), string, ...interface{})
 	MethodSync(interface{}, string, ...interface{}) error
 	SubscribeNotifications(string, func([]byte))
+	RemoveSubscription(string, ...interface{})
 	Close()
 	IsClosed() bool
 	RegisterHeartbeat(string, ...interface{})
 	OnConnect(func() error)
 	ConnectionStatus() Status
 	RegisterOnConnectionStatusChangedEvent(func(Status))
+	ServerInfo() *ServerInfo
+	Metrics() Metrics
+}
+
+// BatchConfig configures how requests sent with MethodBatched are combined into batch requests.
+type BatchConfig struct {
+	// Window is how long a request is held back to be combined with following requests.
+	Window time.Duration
+	// MaxBatchSize is the maximum number of requests in one batch. A batch is sent immediately
+	// when it is full.
+	MaxBatchSize int
+	// MaxInFlight is the maximum number of batched requests sent but not yet answered. Must be at
+	// least MaxBatchSize.
+	MaxInFlight int
+}
+
+// Valid returns true if the batch size is positive and at most MaxInFlight.
+func (config BatchConfig) Valid() bool {
+	return config.MaxBatchSize >= 1 && config.MaxInFlight >= config.MaxBatchSize
+}
+
+// Metrics are counters about the requests handled by a client.
+type Metrics struct {
+	// Requests is the number of requests sent, including the batched ones.
+	Requests int64 `json:"requests"`
+	// BatchedRequests is the number of requests sent as part of a batch.
+	BatchedRequests int64 `json:"batchedRequests"`
+	// Batches is the number of batches sent.
+	Batches int64 `json:"batches"`
+	// Responses is the number of responses received.
+	Responses int64 `json:"responses"`
+	// TotalLatency is the sum of the times between sending requests and receiving their response.
+	TotalLatency time.Duration `json:"totalLatency"`
+}
+
+// AverageLatency returns the average time it took to get a response to a request.
+func (metrics Metrics) AverageLatency() time.Duration {
+	if metrics.Responses == 0 {
+		return 0
+	}
+	return metrics.TotalLatency / time.Duration(metrics.Responses)
 }
 
 // ServerInfo holds information about the backend server(s).